@@ -0,0 +1,134 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/nikhilkarle/social/internal/store"
+)
+
+var errOwnAccountStatus = errors.New("you can't change your own account status")
+
+type SetAccountStatusPayload struct{
+	Status string `json:"status" validate:"required,oneof=active suspended banned shadow_banned"`
+	// SuspendHours is how long to suspend the user for, up to a year
+	SuspendHours int `json:"suspend_hours" validate:"required_if=Status suspended,gte=0,lte=8760"`
+	Reason string `json:"reason" validate:"required,max=500"`
+}
+
+// getAccountStatusHandler godoc
+//
+//	@Summary		Fetches a user's account status
+//	@Description	Shows whether the account is active, suspended, banned or shadow banned, and why. Only admins can see it.
+//	@Tags			admin
+//	@Accept			json
+//	@Produce		json
+//	@Param			userID	path		int	true	"User ID"
+//	@Success		200		{object}	store.AccountStatus
+//	@Failure		403		{object}	error	"Not an admin"
+//	@Failure		404		{object}	error	"User not found"
+//	@Failure		500		{object}	error	"Internal server error"
+//	@Security		ApiKeyAuth
+//	@Router			/admin/users/{userID}/status [get]
+func (app *application) getAccountStatusHandler(w http.ResponseWriter, r *http.Request){
+	user := getUserFromCtx(r)
+
+	status, err := app.store.Users.GetStatus(r.Context(), user.ID)
+	if err != nil{
+		switch{
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundError(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, status); err != nil{
+		app.internalServerError(w, r, err)
+	}
+}
+
+// setAccountStatusHandler godoc
+//
+//	@Summary		Changes a user's account status
+//	@Description	Suspends, bans, shadow bans or reinstates a user with a reason. Suspended and banned users are turned away from the API; shadow banned users' posts and comments are only shown to themselves.
+//	@Tags			admin
+//	@Accept			json
+//	@Produce		json
+//	@Param			userID	path		int						true	"User ID"
+//	@Param			payload	body		SetAccountStatusPayload	true	"Status payload"
+//	@Success		200		{object}	store.AccountStatus
+//	@Failure		400		{object}	error	"Bad request"
+//	@Failure		403		{object}	error	"Not an admin"
+//	@Failure		404		{object}	error	"User not found"
+//	@Failure		500		{object}	error	"Internal server error"
+//	@Security		ApiKeyAuth
+//	@Router			/admin/users/{userID}/status [put]
+func (app *application) setAccountStatusHandler(w http.ResponseWriter, r *http.Request){
+	user := getUserFromCtx(r)
+
+	var payload SetAccountStatusPayload
+	if err := readJSON(w, r, &payload); err != nil{
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	payload.Reason = strings.TrimSpace(payload.Reason)
+
+	if err := Validate.Struct(payload); err != nil{
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	adminID := getAuthUserID(r)
+	if user.ID == adminID{
+		app.badRequestError(w, r, errOwnAccountStatus)
+		return
+	}
+
+	change := store.StatusChange{
+		Status: payload.Status,
+		SuspendFor: time.Duration(payload.SuspendHours) * time.Hour,
+		Reason: payload.Reason,
+	}
+
+	ctx := r.Context()
+
+	before, err := app.store.Users.GetStatus(ctx, user.ID)
+	if err != nil{
+		switch{
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundError(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	status, err := app.store.Users.SetStatus(ctx, user.ID, adminID, change)
+	if err != nil{
+		switch{
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundError(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	app.invalidateUser(ctx, user.ID)
+
+	app.audit(r, &store.AuditEvent{
+		Action: store.AuditAccountStatusChange,
+		TargetType: store.AuditTargetUser,
+		TargetID: user.ID,
+		Changes: store.Diff(before, status),
+	})
+
+	if err := app.jsonResponse(w, http.StatusOK, status); err != nil{
+		app.internalServerError(w, r, err)
+	}
+}
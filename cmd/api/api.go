@@ -1,8 +1,13 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"expvar"
 	"fmt"
 	"net/http"
+	"net/netip"
+	"sync/atomic"
 	"time"
 
 	"github.com/go-chi/chi/v5"
@@ -10,6 +15,12 @@ import (
 	"go.uber.org/zap"
 
 	"github.com/nikhilkarle/social/docs"
+	"github.com/nikhilkarle/social/internal/cache"
+	"github.com/nikhilkarle/social/internal/events"
+	"github.com/nikhilkarle/social/internal/filter"
+	"github.com/nikhilkarle/social/internal/media"
+	"github.com/nikhilkarle/social/internal/ranking"
+	"github.com/nikhilkarle/social/internal/ratelimit"
 	"github.com/nikhilkarle/social/internal/store"
 	httpSwagger "github.com/swaggo/http-swagger"
 )
@@ -18,6 +29,21 @@ type application struct{
 	config config
 	store  store.Storage
 	logger *zap.SugaredLogger
+	ranker ranking.Experiment
+	broker *events.Broker
+	blobs media.BlobStore
+	linkPreviews chan string
+	filter *filter.Filter
+	// limiter is nil when rate limiting is off
+	limiter ratelimit.Limiter
+	// cache is nil when caching is off
+	cache *cache.Storage
+	// draining is set once shutdown starts, failing health checks
+	draining atomic.Bool
+	// streams is cancelled when shutdown starts to end open event streams,
+	// which the server would otherwise wait on until the deadline
+	streams context.Context
+	closeStreams context.CancelFunc
 }
 
 type config struct{
@@ -25,6 +51,68 @@ type config struct{
 	db dbConfig
 	env string
 	apiURL string
+	cursorSecret string
+	trendingRefreshInterval time.Duration
+	media mediaConfig
+	linkPreviewWorkers int
+	// contentFilterConfig is the path of the content filter rules; empty
+	// disables filtering
+	contentFilterConfig string
+	// trustedProxies may set X-Forwarded-For and X-Real-IP; without any the
+	// headers are ignored and clients are known by their connection address
+	trustedProxies []netip.Prefix
+	// wsAllowedOrigins are the browser origins that may open WebSockets, as
+	// lowercase scheme://host[:port]
+	wsAllowedOrigins []string
+	rateLimit rateLimitConfig
+	cache cacheConfig
+	redis redisConfig
+	shutdown shutdownConfig
+}
+
+type shutdownConfig struct{
+	// timeout bounds how long in-flight requests get to finish
+	timeout time.Duration
+	// drainDelay is how long health checks report draining before the
+	// listener closes; it should cover the load balancer's check interval,
+	// and at 0 no load balancer sees the draining status
+	drainDelay time.Duration
+}
+
+type cacheConfig struct{
+	enabled bool
+	// store is "memory" or "redis"; the memory cache is per API instance
+	store string
+	// size is how many users and how many posts the memory cache holds
+	size int
+	ttl time.Duration
+}
+
+type rateLimitConfig struct{
+	enabled bool
+	// store is "memory" or "redis"
+	store string
+	// algorithm is ratelimit.FixedWindow or ratelimit.TokenBucket
+	algorithm string
+	// api applies to every authenticated route; the stricter limits below
+	// apply on top of it
+	api ratelimit.Limit
+	createPost ratelimit.Limit
+}
+
+type redisConfig struct{
+	addr string
+	password string
+	db int
+}
+
+type mediaConfig struct{
+	// store is "local" or "s3"
+	store string
+	maxBytes int64
+	dir string
+	baseURL string
+	s3 media.S3Config
 }
 
 type dbConfig struct{
@@ -38,42 +126,163 @@ func (app *application) mount() http.Handler{
 	r := chi.NewRouter()
 
 	r.Use(middleware.RequestID)
-	r.Use(middleware.RealIP)
+	r.Use(app.realIPMiddleware)
 	r.Use(middleware.Logger)
 	r.Use(middleware.Recoverer)
 
+	r.Route("/v1", func(r chi.Router){
+		// streams stay open for as long as the client is connected, so they
+		// can't sit behind the request timeout
+		r.With(app.activeAccountMiddleware, app.rateLimit("api", app.config.rateLimit.api)).Get("/stream", app.streamHandler)
+		r.With(app.activeAccountMiddleware, app.rateLimit("api", app.config.rateLimit.api)).Get("/ws", app.wsHandler)
 
-	r.Use(middleware.Timeout(60 * time.Second))
+		r.Group(func(r chi.Router){
+			r.Use(middleware.Timeout(60 * time.Second))
 
-	r.Route("/v1", func(r chi.Router){
-		r.Get("/health", app.healthCheckHandler)
+			r.Get("/health", app.healthCheckHandler)
 
-		docsURL := fmt.Sprintf("%s/swagger/doc.json", app.config.addr)
-		r.Get("/swagger/*", httpSwagger.Handler(httpSwagger.URL(docsURL)))
+			docsURL := fmt.Sprintf("%s/swagger/doc.json", app.config.addr)
+			r.Get("/swagger/*", httpSwagger.Handler(httpSwagger.URL(docsURL)))
 
-		r.Route("/posts", func(r chi.Router){
-			r.Post("/", app.createPostHandler)
+			// files in the local store are served by the API itself
+			if files, ok := app.blobs.(http.Handler); ok{
+				r.Handle("/media/files/*", http.StripPrefix("/v1/media/files", files))
+			}
 
-			r.Route("/{postID}",  func(r chi.Router){
-				r.Use(app.postContextMiddleware)
+			r.Group(func(r chi.Router){
+				r.Use(app.activeAccountMiddleware)
+				r.Use(app.rateLimit("api", app.config.rateLimit.api))
 
-				r.Get("/", app.getPostHandler)
-				r.Patch("/", app.updatePostHandler)
-				r.Delete("/", app.deletePostHandler)
-			})
-		})
+				r.Post("/media", app.uploadMediaHandler)
 
-		r.Route("/users", func(r chi.Router){
-			r.Route("/{userID}",  func(r chi.Router){
-				r.Use(app.userContextMiddleware)
+				r.Route("/posts", func(r chi.Router){
+					r.With(app.rateLimit("create_post", app.config.rateLimit.createPost)).Post("/", app.createPostHandler)
 
-				r.Get("/", app.getUserHandler)
-				r.Put("/follow", app.followUserHandler)
-				r.Put("/unfollow", app.unfollowUserHandler)
-			})
+					r.Route("/{postID}",  func(r chi.Router){
+						r.Use(app.postContextMiddleware)
 
-			r.Group(func(r chi.Router){
-				r.Get("/feed", app.getUserFeedHandler)
+						r.Get("/", app.getPostHandler)
+						r.Patch("/", app.updatePostHandler)
+						r.Delete("/", app.deletePostHandler)
+						r.Post("/comments", app.createCommentHandler)
+						r.Put("/reactions", app.reactToPostHandler)
+						r.Delete("/reactions", app.unreactToPostHandler)
+						r.Post("/poll/votes", app.votePollHandler)
+					})
+				})
+
+				r.Route("/users", func(r chi.Router){
+					r.Route("/{userID}",  func(r chi.Router){
+						r.Use(app.userContextMiddleware)
+
+						r.Get("/", app.getUserHandler)
+						r.Put("/follow", app.followUserHandler)
+						r.Put("/unfollow", app.unfollowUserHandler)
+						r.Put("/block", app.blockUserHandler)
+						r.Put("/unblock", app.unblockUserHandler)
+					})
+
+					r.Group(func(r chi.Router){
+						r.Get("/feed", app.getUserFeedHandler)
+						r.Put("/privacy", app.updatePrivacyHandler)
+					})
+				})
+
+				r.Route("/communities", func(r chi.Router){
+					r.Post("/", app.createCommunityHandler)
+
+					r.Route("/{communityID}", func(r chi.Router){
+						r.Use(app.communityContextMiddleware)
+
+						r.Get("/", app.getCommunityHandler)
+						r.Post("/join", app.joinCommunityHandler)
+						r.Post("/leave", app.leaveCommunityHandler)
+
+						r.Group(func(r chi.Router){
+							r.Use(app.requireCommunityAccess)
+
+							r.Get("/feed", app.getCommunityFeedHandler)
+							r.Get("/members", app.getCommunityMembersHandler)
+						})
+
+						r.Group(func(r chi.Router){
+							r.Use(app.requireCommunityRole(store.RoleModerator))
+
+							r.Get("/requests", app.getJoinRequestsHandler)
+							r.Post("/requests/{userID}/approve", app.approveJoinRequestHandler)
+							r.Post("/requests/{userID}/reject", app.rejectJoinRequestHandler)
+							r.Put("/bans/{userID}", app.banCommunityMemberHandler)
+							r.Delete("/bans/{userID}", app.unbanCommunityMemberHandler)
+							r.Delete("/posts/{postID}", app.removeCommunityPostHandler)
+						})
+
+						r.With(app.requireCommunityRole(store.RoleOwner)).Put("/members/{userID}/role", app.setCommunityRoleHandler)
+					})
+				})
+
+				r.Route("/conversations", func(r chi.Router){
+					r.Get("/", app.getConversationsHandler)
+					r.Post("/", app.createConversationHandler)
+
+					r.Route("/{conversationID}", func(r chi.Router){
+						r.Use(app.conversationContextMiddleware)
+
+						r.Get("/", app.getConversationHandler)
+						r.Get("/messages", app.getMessagesHandler)
+						r.Post("/messages", app.sendMessageHandler)
+						r.Post("/read", app.markConversationReadHandler)
+						r.Post("/leave", app.leaveConversationHandler)
+					})
+				})
+
+				r.Post("/reports", app.createReportHandler)
+
+				r.Route("/moderation", func(r chi.Router){
+					r.Use(app.requireUserRole(store.UserRoleModerator))
+
+					r.Get("/queue", app.getModerationQueueHandler)
+
+					r.Route("/reports/{reportID}", func(r chi.Router){
+						r.Get("/", app.getReportHandler)
+						r.Post("/claim", app.claimReportHandler)
+						r.Post("/resolve", app.resolveReportHandler)
+					})
+				})
+
+				r.Route("/admin", func(r chi.Router){
+					r.Use(app.requireUserRole(store.UserRoleAdmin))
+
+					r.Get("/audit", app.getAuditEventsHandler)
+					// counters such as cache hit ratios
+					r.Handle("/debug/vars", expvar.Handler())
+
+					r.Route("/users/{userID}", func(r chi.Router){
+						r.Use(app.userContextMiddleware)
+
+						r.Get("/status", app.getAccountStatusHandler)
+						r.Put("/status", app.setAccountStatusHandler)
+					})
+				})
+
+				r.Route("/notifications", func(r chi.Router){
+					r.Get("/", app.getNotificationsHandler)
+					r.Post("/read", app.markNotificationsReadHandler)
+					r.Get("/preferences", app.getNotificationPreferencesHandler)
+					r.Put("/preferences", app.updateNotificationPreferencesHandler)
+				})
+
+				r.Get("/explore", app.exploreHandler)
+				r.Get("/trending/tags", app.trendingTagsHandler)
+
+				r.Route("/search", func(r chi.Router){
+					r.Get("/posts", app.searchPostsHandler)
+					r.Get("/users", app.searchUsersHandler)
+				})
+
+				r.Route("/tags", func(r chi.Router){
+					r.Get("/", app.searchTagsHandler)
+					r.Get("/{tag}/posts", app.getTagPostsHandler)
+				})
 			})
 		})
 	})
@@ -81,7 +290,10 @@ func (app *application) mount() http.Handler{
 	return r
 }
 
-func (app *application) run(mux http.Handler) error{
+// run serves mux until ctx is done, then drains: health checks start failing,
+// the listener closes and in-flight requests get until the shutdown timeout
+// to finish.
+func (app *application) run(ctx context.Context, mux http.Handler) error{
 	//Docs
 	docs.SwaggerInfo.Version = version
 	docs.SwaggerInfo.Host = app.config.apiURL
@@ -96,8 +308,38 @@ func (app *application) run(mux http.Handler) error{
 		IdleTimeout: time.Minute,
 	}
 
-	app.logger.Infow("server has started at %s", app.config.addr)
+	srv.RegisterOnShutdown(app.closeStreams)
+
+	app.logger.Infow("server has started", "addr", app.config.addr)
+
+	serveErr := make(chan error, 1)
+	go func(){
+		serveErr <- srv.ListenAndServe()
+	}()
+
+	select{
+	case err := <-serveErr:
+		return err
+	case <-ctx.Done():
+	}
 
-	return srv.ListenAndServe()
+	app.logger.Infow("server is draining", "timeout", app.config.shutdown.timeout.String())
+	app.draining.Store(true)
+	time.Sleep(app.config.shutdown.drainDelay)
 
-}
\ No newline at end of file
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), app.config.shutdown.timeout)
+	defer cancel()
+
+	if err := srv.Shutdown(shutdownCtx); err != nil{
+		// drop whatever is still running
+		srv.Close()
+		return fmt.Errorf("shutdown: %w", err)
+	}
+
+	if err := <-serveErr; !errors.Is(err, http.ErrServerClosed){
+		return err
+	}
+
+	app.logger.Info("server has stopped")
+	return nil
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/nikhilkarle/social/internal/store"
+)
+
+// audit records a security or moderation relevant action by the user making
+// the request. The log is best effort: the action has already been committed
+// in its own transaction, so a failed write is logged rather than failing the
+// request, and the action stands without its audit record.
+func (app *application) audit(r *http.Request, event *store.AuditEvent){
+	actorID := getAuthUserID(r)
+	event.ActorID = &actorID
+	event.RequestID = middleware.GetReqID(r.Context())
+	event.IP = clientIP(r)
+
+	// a client hanging up mustn't cancel the write; the store still bounds it
+	// with QueryTimeoutDuration
+	ctx := context.WithoutCancel(r.Context())
+
+	if err := app.store.Audit.Create(ctx, event); err != nil{
+		app.logger.Errorw("audit event failed", "action", event.Action, "target_type", event.TargetType, "target_id", event.TargetID, "error", err.Error())
+	}
+}
+
+// postSnapshot is what the audit log keeps of a deleted post.
+func postSnapshot(post *store.Post) map[string]any{
+	return map[string]any{
+		"user_id": post.UserID,
+		"community_id": post.CommunityID,
+		"title": post.Title,
+		"content": post.Content,
+	}
+}
+
+// reportSnapshot is the part of a report moderators change.
+func reportSnapshot(report *store.Report) map[string]any{
+	return map[string]any{
+		"status": report.Status,
+		"claimed_by": report.ClaimedBy,
+		"resolution": report.Resolution,
+		"resolved_by": report.ResolvedBy,
+	}
+}
+
+// getAuditEventsHandler godoc
+//
+//	@Summary		Fetches the audit log
+//	@Description	Lists security and moderation relevant actions newest first. next_cursor pages to older events and prev_cursor to newer ones. Only admins can see the log.
+//	@Tags			admin
+//	@Accept			json
+//	@Produce		json
+//	@Param			actor_id		query		int		false	"User who acted"
+//	@Param			action			query		string	false	"Action, such as post.delete"
+//	@Param			target_type		query		string	false	"Target type"
+//	@Param			target_id		query		int		false	"Target ID"
+//	@Param			community_id	query		int		false	"Community ID"
+//	@Param			since			query		string	false	"Since (RFC 3339)"
+//	@Param			until			query		string	false	"Until (RFC 3339)"
+//	@Param			limit			query		int		false	"Limit"
+//	@Param			cursor			query		string	false	"Cursor from next_cursor or prev_cursor"
+//	@Success		200				{object}	[]store.AuditEvent
+//	@Failure		400				{object}	error	"Bad request"
+//	@Failure		403				{object}	error	"Not an admin"
+//	@Failure		500				{object}	error	"Internal server error"
+//	@Security		ApiKeyAuth
+//	@Router			/admin/audit [get]
+func (app *application) getAuditEventsHandler(w http.ResponseWriter, r *http.Request){
+	aq := store.AuditQuery{
+		Limit: 50,
+	}
+
+	aq, err := aq.Parse(r)
+	if err != nil{
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(aq); err != nil{
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	if token := r.URL.Query().Get("cursor"); token != ""{
+		cursor, err := store.DecodeCursor([]byte(app.config.cursorSecret), token)
+		if err != nil{
+			app.badRequestError(w, r, err)
+			return
+		}
+
+		aq.Cursor = &cursor
+	}
+
+	events, err := app.store.Audit.List(r.Context(), aq)
+	if err != nil{
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	nextCursor, prevCursor := app.auditCursors(aq, events)
+
+	if err := app.paginatedJSONResponse(w, http.StatusOK, events, nextCursor, prevCursor); err != nil{
+		app.internalServerError(w, r, err)
+	}
+}
+
+// auditCursors returns the cursors for the pages of older and newer events,
+// following the same rules as feedCursors.
+func (app *application) auditCursors(aq store.AuditQuery, events []store.AuditEvent) (string, string){
+	if len(events) == 0{
+		return "", ""
+	}
+
+	secret := []byte(app.config.cursorSecret)
+	first, last := events[0], events[len(events)-1]
+	full := len(events) == aq.Limit
+	backwards := aq.Cursor != nil && aq.Cursor.Prev
+
+	var nextCursor, prevCursor string
+
+	if full || backwards{
+		nextCursor = store.EncodeCursor(secret, store.FeedCursor{
+			CreatedAt: last.CreatedAt,
+			ID: last.ID,
+			Sort: "desc",
+		})
+	}
+
+	if aq.Cursor != nil && (!backwards || full){
+		prevCursor = store.EncodeCursor(secret, store.FeedCursor{
+			CreatedAt: first.CreatedAt,
+			ID: first.ID,
+			Sort: "desc",
+			Prev: true,
+		})
+	}
+
+	return nextCursor, prevCursor
+}
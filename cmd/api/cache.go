@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/nikhilkarle/social/internal/cache"
+	"github.com/nikhilkarle/social/internal/redis"
+	"github.com/nikhilkarle/social/internal/store"
+)
+
+// newCache builds the cache the config asks for, or nil when caching is off.
+func newCache(cfg cacheConfig, client *redis.Client) (*cache.Storage, error){
+	if !cfg.enabled{
+		return nil, nil
+	}
+
+	var storage cache.Storage
+	switch cfg.store{
+	case "memory":
+		storage = cache.NewLRUStorage(cfg.size, cfg.ttl)
+	case "redis":
+		storage = cache.NewRedisStorage(client, cfg.ttl)
+	default:
+		return nil, fmt.Errorf("unknown cache store %q", cfg.store)
+	}
+
+	return &storage, nil
+}
+
+// getUser reads a user through the cache. The cache is best effort: when it
+// fails the user is read from the store.
+func (app *application) getUser(ctx context.Context, userID int64) (*store.User, error){
+	if app.cache == nil{
+		return app.store.Users.GetByID(ctx, userID)
+	}
+
+	user, err := app.cache.Users.Get(ctx, userID)
+	if err != nil{
+		app.logger.Warnw("user cache read failed", "user_id", userID, "error", err.Error())
+	}
+	if user != nil{
+		return user, nil
+	}
+
+	user, err = app.store.Users.GetByID(ctx, userID)
+	if err != nil{
+		return nil, err
+	}
+
+	if err := app.cache.Users.Set(ctx, user); err != nil{
+		app.logger.Warnw("user cache write failed", "user_id", userID, "error", err.Error())
+	}
+
+	return user, nil
+}
+
+// getPost reads a post through the cache, like getUser.
+func (app *application) getPost(ctx context.Context, postID int64) (*store.Post, error){
+	if app.cache == nil{
+		return app.store.Posts.GetByID(ctx, postID)
+	}
+
+	post, err := app.cache.Posts.Get(ctx, postID)
+	if err != nil{
+		app.logger.Warnw("post cache read failed", "post_id", postID, "error", err.Error())
+	}
+	if post != nil{
+		return post, nil
+	}
+
+	post, err = app.store.Posts.GetByID(ctx, postID)
+	if err != nil{
+		return nil, err
+	}
+
+	if err := app.cache.Posts.Set(ctx, post); err != nil{
+		app.logger.Warnw("post cache write failed", "post_id", postID, "error", err.Error())
+	}
+
+	return post, nil
+}
+
+// invalidateUser drops a changed user from the cache.
+func (app *application) invalidateUser(ctx context.Context, userID int64){
+	if app.cache == nil{
+		return
+	}
+
+	if err := app.cache.Users.Delete(ctx, userID); err != nil{
+		app.logger.Errorw("user cache invalidation failed", "user_id", userID, "error", err.Error())
+	}
+}
+
+// invalidatePost drops a changed or deleted post from the cache.
+func (app *application) invalidatePost(ctx context.Context, postID int64){
+	if app.cache == nil{
+		return
+	}
+
+	if err := app.cache.Posts.Delete(ctx, postID); err != nil{
+		app.logger.Errorw("post cache invalidation failed", "post_id", postID, "error", err.Error())
+	}
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/nikhilkarle/social/internal/store"
+)
+
+type CreateCommentPayload struct{
+	Content string `json:"content" validate:"required,max=1000"`
+}
+
+// CreateComment godoc
+//
+//	@Summary		Comments on a post
+//	@Description	Adds a comment to a post and notifies its author. Comments the content filter holds for review are accepted hidden with a 202.
+//	@Tags			posts
+//	@Accept			json
+//	@Produce		json
+//	@Param			postID	path		int						true	"Post ID"
+//	@Param			payload	body		CreateCommentPayload	true	"Comment payload"
+//	@Success		201		{object}	store.Comment
+//	@Success		202		{object}	store.Comment	"Held for review"
+//	@Failure		400		{object}	error	"Bad request"
+//	@Failure		403		{object}	error	"Not a member of the post's community"
+//	@Failure		404		{object}	error	"Post not found"
+//	@Failure		422		{object}	error	"Rejected by the content filter"
+//	@Failure		500		{object}	error	"Internal server error"
+//	@Security		ApiKeyAuth
+//	@Router			/posts/{postID}/comments [post]
+func (app *application) createCommentHandler(w http.ResponseWriter, r *http.Request){
+	post := getPostFromCtx(r)
+
+	var payload CreateCommentPayload
+	if err := readJSON(w, r, &payload); err != nil{
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil{
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	comment := &store.Comment{
+		PostID: post.ID,
+		UserID: getAuthUserID(r),
+		Content: payload.Content,
+	}
+
+	ctx := r.Context()
+
+	// only members, which excludes banned users, comment on community posts
+	if post.CommunityID != nil{
+		member, err := app.isCommunityMember(ctx, *post.CommunityID, comment.UserID)
+		if err != nil{
+			app.internalServerError(w, r, err)
+			return
+		}
+
+		if !member{
+			app.forbiddenError(w, r, errNotCommunityMember)
+			return
+		}
+	}
+
+	screening, err := app.screenContent(ctx, comment.UserID, store.ReportTargetComment, comment.Content)
+	if err != nil{
+		app.screeningError(w, r, err)
+		return
+	}
+	comment.Screening = screening
+
+	if err := app.store.Comments.Create(ctx, comment); err != nil{
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	// held comments are only announced once approved
+	if comment.HiddenAt != nil{
+		if err := app.jsonResponse(w, http.StatusAccepted, comment); err != nil{
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	// shadow banned users' comments are never announced
+	if getAuthUser(r).Status != store.AccountShadowBanned{
+		commentID, _ := strconv.ParseInt(comment.ID, 10, 64)
+
+		app.notify(ctx, &store.Notification{
+			UserID: post.UserID,
+			ActorID: comment.UserID,
+			Type: store.NotificationComment,
+			PostID: &post.ID,
+			CommentID: &commentID,
+		})
+	}
+
+	if err := app.jsonResponse(w, http.StatusCreated, comment); err != nil{
+		app.internalServerError(w, r, err)
+	}
+}
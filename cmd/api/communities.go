@@ -0,0 +1,789 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/nikhilkarle/social/internal/store"
+)
+
+type communityKey string
+const (
+	communityCtx communityKey = "community"
+	communityMemberCtx communityKey = "communityMember"
+)
+
+var errNotCommunityMember = errors.New("you must be a member of the community")
+
+type CreateCommunityPayload struct{
+	Name string `json:"name" validate:"required,min=3,max=50"`
+	Description string `json:"description" validate:"max=500"`
+	Visibility string `json:"visibility" validate:"omitempty,oneof=public private"`
+}
+
+type SetCommunityRolePayload struct{
+	Role string `json:"role" validate:"required,oneof=moderator member"`
+}
+
+type BanCommunityMemberPayload struct{
+	Reason string `json:"reason" validate:"max=255"`
+}
+
+// createCommunityHandler godoc
+//
+//	@Summary		Creates a community
+//	@Description	Creates a community owned by the caller
+//	@Tags			communities
+//	@Accept			json
+//	@Produce		json
+//	@Param			payload	body		CreateCommunityPayload	true	"Community payload"
+//	@Success		201		{object}	store.Community
+//	@Failure		400		{object}	error	"Bad request"
+//	@Failure		409		{object}	error	"Name taken"
+//	@Failure		500		{object}	error	"Internal server error"
+//	@Security		ApiKeyAuth
+//	@Router			/communities [post]
+func (app *application) createCommunityHandler(w http.ResponseWriter, r *http.Request){
+	var payload CreateCommunityPayload
+	if err := readJSON(w, r, &payload); err != nil{
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil{
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	community := &store.Community{
+		Name: payload.Name,
+		Description: payload.Description,
+		Visibility: payload.Visibility,
+		CreatedBy: getAuthUserID(r),
+	}
+
+	if community.Visibility == ""{
+		community.Visibility = store.CommunityPublic
+	}
+
+	if err := app.store.Communities.Create(r.Context(), community); err != nil{
+		switch{
+		case errors.Is(err, store.ErrConflict):
+			app.conflictError(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusCreated, community); err != nil{
+		app.internalServerError(w, r, err)
+	}
+}
+
+// getCommunityHandler godoc
+//
+//	@Summary		Fetches a community
+//	@Description	Fetches a community by ID. Private communities are listed too, but only members see their posts and members.
+//	@Tags			communities
+//	@Accept			json
+//	@Produce		json
+//	@Param			communityID	path		int	true	"Community ID"
+//	@Success		200			{object}	store.Community
+//	@Failure		404			{object}	error	"Community not found"
+//	@Failure		500			{object}	error	"Internal server error"
+//	@Security		ApiKeyAuth
+//	@Router			/communities/{communityID} [get]
+func (app *application) getCommunityHandler(w http.ResponseWriter, r *http.Request){
+	community := getCommunityFromCtx(r)
+
+	if err := app.jsonResponse(w, http.StatusOK, community); err != nil{
+		app.internalServerError(w, r, err)
+	}
+}
+
+// getCommunityFeedHandler godoc
+//
+//	@Summary		Fetches a community feed
+//	@Description	Fetches the posts published to a community
+//	@Tags			communities
+//	@Accept			json
+//	@Produce		json
+//	@Param			communityID	path		int		true	"Community ID"
+//	@Param			since		query		string	false	"Since"
+//	@Param			until		query		string	false	"Until"
+//	@Param			limit		query		int		false	"Limit"
+//	@Param			cursor		query		string	false	"Cursor from next_cursor or prev_cursor"
+//	@Param			offset		query		int		false	"Offset (deprecated, use cursor)"
+//	@Param			sort		query		string	false	"Sort: asc or desc"
+//	@Param			tags		query		string	false	"Tags"
+//	@Param			search		query		string	false	"Search"
+//	@Success		200			{object}	[]store.PostWithMetadata
+//	@Failure		400			{object}	error	"Bad request"
+//	@Failure		403			{object}	error	"Private community"
+//	@Failure		404			{object}	error	"Community not found"
+//	@Failure		500			{object}	error	"Internal server error"
+//	@Security		ApiKeyAuth
+//	@Router			/communities/{communityID}/feed [get]
+func (app *application) getCommunityFeedHandler(w http.ResponseWriter, r *http.Request){
+	community := getCommunityFromCtx(r)
+
+	fq := store.PaginatedFeedQuery{
+		Limit: 20,
+		Offset: 0,
+		Sort: "desc",
+	}
+
+	fq, err := fq.Parse(r)
+	if err != nil{
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(fq); err != nil{
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	if fq.Sort == "ranked"{
+		app.badRequestError(w, r, errors.New("sort must be asc or desc"))
+		return
+	}
+
+	if err := app.parseFeedCursor(w, r, &fq); err != nil{
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	feed, err := app.store.Communities.GetFeed(r.Context(), community.ID, getAuthUserID(r), fq)
+	if err != nil{
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.attachPostDetails(r.Context(), getAuthUserID(r), feedPosts(feed)...); err != nil{
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	nextCursor, prevCursor := app.feedCursors(fq, feed)
+
+	if err := app.paginatedJSONResponse(w, http.StatusOK, feed, nextCursor, prevCursor); err != nil{
+		app.internalServerError(w, r, err)
+	}
+}
+
+// getCommunityMembersHandler godoc
+//
+//	@Summary		Fetches community members
+//	@Description	Lists a community's members, owner and moderators first
+//	@Tags			communities
+//	@Accept			json
+//	@Produce		json
+//	@Param			communityID	path		int	true	"Community ID"
+//	@Param			limit		query		int	false	"Limit"
+//	@Param			offset		query		int	false	"Offset"
+//	@Success		200			{object}	[]store.CommunityMember
+//	@Failure		400			{object}	error	"Bad request"
+//	@Failure		403			{object}	error	"Private community"
+//	@Failure		404			{object}	error	"Community not found"
+//	@Failure		500			{object}	error	"Internal server error"
+//	@Security		ApiKeyAuth
+//	@Router			/communities/{communityID}/members [get]
+func (app *application) getCommunityMembersHandler(w http.ResponseWriter, r *http.Request){
+	community := getCommunityFromCtx(r)
+
+	cq, ok := app.parseCommunityQuery(w, r)
+	if !ok{
+		return
+	}
+
+	members, err := app.store.Communities.GetMembers(r.Context(), community.ID, cq)
+	if err != nil{
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, members); err != nil{
+		app.internalServerError(w, r, err)
+	}
+}
+
+// joinCommunityHandler godoc
+//
+//	@Summary		Joins a community
+//	@Description	Joins a public community, or asks to join a private one
+//	@Tags			communities
+//	@Accept			json
+//	@Produce		json
+//	@Param			communityID	path		int		true	"Community ID"
+//	@Success		202			{string}	string	"Join request sent"
+//	@Success		204			{string}	string	"Joined"
+//	@Failure		403			{object}	error	"Banned"
+//	@Failure		404			{object}	error	"Community not found"
+//	@Failure		500			{object}	error	"Internal server error"
+//	@Security		ApiKeyAuth
+//	@Router			/communities/{communityID}/join [post]
+func (app *application) joinCommunityHandler(w http.ResponseWriter, r *http.Request){
+	community := getCommunityFromCtx(r)
+
+	if getCommunityMemberFromCtx(r) != nil{
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	if err := app.store.Communities.Join(r.Context(), community, getAuthUserID(r)); err != nil{
+		switch{
+		case errors.Is(err, store.ErrBanned):
+			app.forbiddenError(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if community.Visibility == store.CommunityPrivate{
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// leaveCommunityHandler godoc
+//
+//	@Summary		Leaves a community
+//	@Description	Leaves a community, or withdraws a pending join request. The owner can't leave.
+//	@Tags			communities
+//	@Accept			json
+//	@Produce		json
+//	@Param			communityID	path		int		true	"Community ID"
+//	@Success		204			{string}	string	"Left"
+//	@Failure		400			{object}	error	"Owner can't leave"
+//	@Failure		404			{object}	error	"Community not found"
+//	@Failure		500			{object}	error	"Internal server error"
+//	@Security		ApiKeyAuth
+//	@Router			/communities/{communityID}/leave [post]
+func (app *application) leaveCommunityHandler(w http.ResponseWriter, r *http.Request){
+	community := getCommunityFromCtx(r)
+
+	if err := app.store.Communities.Leave(r.Context(), community.ID, getAuthUserID(r)); err != nil{
+		switch{
+		case errors.Is(err, store.ErrOwnerCannotLeave):
+			app.badRequestError(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// getJoinRequestsHandler godoc
+//
+//	@Summary		Fetches join requests
+//	@Description	Lists pending requests to join a private community, oldest first. Moderators only.
+//	@Tags			communities
+//	@Accept			json
+//	@Produce		json
+//	@Param			communityID	path		int	true	"Community ID"
+//	@Param			limit		query		int	false	"Limit"
+//	@Param			offset		query		int	false	"Offset"
+//	@Success		200			{object}	[]store.CommunityJoinRequest
+//	@Failure		400			{object}	error	"Bad request"
+//	@Failure		403			{object}	error	"Not a moderator"
+//	@Failure		404			{object}	error	"Community not found"
+//	@Failure		500			{object}	error	"Internal server error"
+//	@Security		ApiKeyAuth
+//	@Router			/communities/{communityID}/requests [get]
+func (app *application) getJoinRequestsHandler(w http.ResponseWriter, r *http.Request){
+	community := getCommunityFromCtx(r)
+
+	cq, ok := app.parseCommunityQuery(w, r)
+	if !ok{
+		return
+	}
+
+	requests, err := app.store.Communities.GetJoinRequests(r.Context(), community.ID, cq)
+	if err != nil{
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, requests); err != nil{
+		app.internalServerError(w, r, err)
+	}
+}
+
+// approveJoinRequestHandler godoc
+//
+//	@Summary		Approves a join request
+//	@Description	Makes the requesting user a member. Moderators only.
+//	@Tags			communities
+//	@Accept			json
+//	@Produce		json
+//	@Param			communityID	path		int		true	"Community ID"
+//	@Param			userID		path		int		true	"User ID"
+//	@Success		204			{string}	string	"Request approved"
+//	@Failure		403			{object}	error	"Not a moderator"
+//	@Failure		404			{object}	error	"Request not found"
+//	@Failure		500			{object}	error	"Internal server error"
+//	@Security		ApiKeyAuth
+//	@Router			/communities/{communityID}/requests/{userID}/approve [post]
+func (app *application) approveJoinRequestHandler(w http.ResponseWriter, r *http.Request){
+	app.resolveJoinRequest(w, r, true)
+}
+
+// rejectJoinRequestHandler godoc
+//
+//	@Summary		Rejects a join request
+//	@Description	Drops a pending join request. Moderators only.
+//	@Tags			communities
+//	@Accept			json
+//	@Produce		json
+//	@Param			communityID	path		int		true	"Community ID"
+//	@Param			userID		path		int		true	"User ID"
+//	@Success		204			{string}	string	"Request rejected"
+//	@Failure		403			{object}	error	"Not a moderator"
+//	@Failure		404			{object}	error	"Request not found"
+//	@Failure		500			{object}	error	"Internal server error"
+//	@Security		ApiKeyAuth
+//	@Router			/communities/{communityID}/requests/{userID}/reject [post]
+func (app *application) rejectJoinRequestHandler(w http.ResponseWriter, r *http.Request){
+	app.resolveJoinRequest(w, r, false)
+}
+
+func (app *application) resolveJoinRequest(w http.ResponseWriter, r *http.Request, approve bool){
+	community := getCommunityFromCtx(r)
+
+	userID, err := strconv.ParseInt(chi.URLParam(r, "userID"), 10, 64)
+	if err != nil{
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	if err := app.store.Communities.ResolveJoinRequest(r.Context(), community.ID, userID, approve); err != nil{
+		switch{
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundError(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// setCommunityRoleHandler godoc
+//
+//	@Summary		Sets a member's role
+//	@Description	Promotes a member to moderator or demotes a moderator. Owner only.
+//	@Tags			communities
+//	@Accept			json
+//	@Produce		json
+//	@Param			communityID	path		int						true	"Community ID"
+//	@Param			userID		path		int						true	"User ID"
+//	@Param			payload		body		SetCommunityRolePayload	true	"Role"
+//	@Success		204			{string}	string	"Role updated"
+//	@Failure		400			{object}	error	"Bad request"
+//	@Failure		403			{object}	error	"Not the owner"
+//	@Failure		404			{object}	error	"Member not found"
+//	@Failure		500			{object}	error	"Internal server error"
+//	@Security		ApiKeyAuth
+//	@Router			/communities/{communityID}/members/{userID}/role [put]
+func (app *application) setCommunityRoleHandler(w http.ResponseWriter, r *http.Request){
+	community := getCommunityFromCtx(r)
+
+	userID, err := strconv.ParseInt(chi.URLParam(r, "userID"), 10, 64)
+	if err != nil{
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	var payload SetCommunityRolePayload
+	if err := readJSON(w, r, &payload); err != nil{
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil{
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	ctx := r.Context()
+
+	member, err := app.store.Communities.GetMember(ctx, community.ID, userID)
+	if err != nil{
+		switch{
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundError(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if err := app.store.Communities.SetRole(ctx, community.ID, userID, payload.Role); err != nil{
+		switch{
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundError(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	app.audit(r, &store.AuditEvent{
+		Action: store.AuditCommunityRoleChange,
+		TargetType: store.AuditTargetUser,
+		TargetID: userID,
+		CommunityID: &community.ID,
+		Changes: store.Diff(map[string]any{"role": member.Role}, map[string]any{"role": payload.Role}),
+	})
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// banCommunityMemberHandler godoc
+//
+//	@Summary		Bans a user from a community
+//	@Description	Removes the user from the community and stops them rejoining. Moderators only; moderators can only be banned by the owner.
+//	@Tags			communities
+//	@Accept			json
+//	@Produce		json
+//	@Param			communityID	path		int							true	"Community ID"
+//	@Param			userID		path		int							true	"User ID"
+//	@Param			payload		body		BanCommunityMemberPayload	false	"Ban reason"
+//	@Success		200			{object}	store.CommunityBan
+//	@Failure		400			{object}	error	"Bad request"
+//	@Failure		403			{object}	error	"Not allowed to ban this user"
+//	@Failure		404			{object}	error	"Community not found"
+//	@Failure		500			{object}	error	"Internal server error"
+//	@Security		ApiKeyAuth
+//	@Router			/communities/{communityID}/bans/{userID} [put]
+func (app *application) banCommunityMemberHandler(w http.ResponseWriter, r *http.Request){
+	community := getCommunityFromCtx(r)
+	moderator := getCommunityMemberFromCtx(r)
+
+	userID, err := strconv.ParseInt(chi.URLParam(r, "userID"), 10, 64)
+	if err != nil{
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	var payload BanCommunityMemberPayload
+	if r.ContentLength != 0{
+		if err := readJSON(w, r, &payload); err != nil{
+			app.badRequestError(w, r, err)
+			return
+		}
+	}
+
+	if err := Validate.Struct(payload); err != nil{
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	ctx := r.Context()
+
+	// only users below the moderator's own role can be banned
+	target, err := app.store.Communities.GetMember(ctx, community.ID, userID)
+	if err != nil && !errors.Is(err, store.ErrNotFound){
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if target.HasRole(moderator.Role){
+		app.forbiddenError(w, r, errors.New("you can't ban this user"))
+		return
+	}
+
+	ban := &store.CommunityBan{
+		CommunityID: community.ID,
+		UserID: userID,
+		BannedBy: moderator.UserID,
+		Reason: payload.Reason,
+	}
+
+	if err := app.store.Communities.Ban(ctx, ban); err != nil{
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	app.audit(r, &store.AuditEvent{
+		Action: store.AuditCommunityBan,
+		TargetType: store.AuditTargetUser,
+		TargetID: userID,
+		CommunityID: &community.ID,
+		Changes: store.Diff(nil, map[string]any{"banned": true, "reason": ban.Reason}),
+	})
+
+	if err := app.jsonResponse(w, http.StatusOK, ban); err != nil{
+		app.internalServerError(w, r, err)
+	}
+}
+
+// unbanCommunityMemberHandler godoc
+//
+//	@Summary		Lifts a community ban
+//	@Description	Lets a banned user join again. Moderators only.
+//	@Tags			communities
+//	@Accept			json
+//	@Produce		json
+//	@Param			communityID	path		int		true	"Community ID"
+//	@Param			userID		path		int		true	"User ID"
+//	@Success		204			{string}	string	"Ban lifted"
+//	@Failure		403			{object}	error	"Not a moderator"
+//	@Failure		404			{object}	error	"Ban not found"
+//	@Failure		500			{object}	error	"Internal server error"
+//	@Security		ApiKeyAuth
+//	@Router			/communities/{communityID}/bans/{userID} [delete]
+func (app *application) unbanCommunityMemberHandler(w http.ResponseWriter, r *http.Request){
+	community := getCommunityFromCtx(r)
+
+	userID, err := strconv.ParseInt(chi.URLParam(r, "userID"), 10, 64)
+	if err != nil{
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	if err := app.store.Communities.Unban(r.Context(), community.ID, userID); err != nil{
+		switch{
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundError(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	app.audit(r, &store.AuditEvent{
+		Action: store.AuditCommunityUnban,
+		TargetType: store.AuditTargetUser,
+		TargetID: userID,
+		CommunityID: &community.ID,
+		Changes: store.Diff(map[string]any{"banned": true}, nil),
+	})
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// removeCommunityPostHandler godoc
+//
+//	@Summary		Removes a community post
+//	@Description	Deletes a post published to the community. Moderators only.
+//	@Tags			communities
+//	@Accept			json
+//	@Produce		json
+//	@Param			communityID	path		int		true	"Community ID"
+//	@Param			postID		path		int		true	"Post ID"
+//	@Success		204			{string}	string	"Post removed"
+//	@Failure		403			{object}	error	"Not a moderator"
+//	@Failure		404			{object}	error	"Post not found"
+//	@Failure		500			{object}	error	"Internal server error"
+//	@Security		ApiKeyAuth
+//	@Router			/communities/{communityID}/posts/{postID} [delete]
+func (app *application) removeCommunityPostHandler(w http.ResponseWriter, r *http.Request){
+	community := getCommunityFromCtx(r)
+
+	postID, err := strconv.ParseInt(chi.URLParam(r, "postID"), 10, 64)
+	if err != nil{
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	ctx := r.Context()
+
+	// loaded first for the audit log
+	post, err := app.store.Posts.GetByID(ctx, postID)
+	if err != nil{
+		switch{
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundError(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if err := app.store.Communities.RemovePost(ctx, community.ID, postID); err != nil{
+		switch{
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundError(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	app.invalidatePost(ctx, postID)
+
+	app.audit(r, &store.AuditEvent{
+		Action: store.AuditPostDelete,
+		TargetType: store.AuditTargetPost,
+		TargetID: postID,
+		CommunityID: &community.ID,
+		Changes: store.Diff(postSnapshot(post), nil),
+	})
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (app *application) parseCommunityQuery(w http.ResponseWriter, r *http.Request) (store.CommunityQuery, bool){
+	cq := store.CommunityQuery{
+		Limit: 50,
+		Offset: 0,
+	}
+
+	cq, err := cq.Parse(r)
+	if err != nil{
+		app.badRequestError(w, r, err)
+		return cq, false
+	}
+
+	if err := Validate.Struct(cq); err != nil{
+		app.badRequestError(w, r, err)
+		return cq, false
+	}
+
+	return cq, true
+}
+
+// communityContextMiddleware loads the community from the URL along with the
+// caller's membership, which is nil for non-members.
+func (app *application) communityContextMiddleware(next http.Handler) http.Handler{
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request){
+		communityID, err := strconv.ParseInt(chi.URLParam(r, "communityID"), 10, 64)
+		if err != nil{
+			app.badRequestError(w, r, err)
+			return
+		}
+
+		ctx := r.Context()
+
+		community, err := app.store.Communities.GetByID(ctx, communityID)
+		if err != nil{
+			switch{
+			case errors.Is(err, store.ErrNotFound):
+				app.notFoundError(w, r, err)
+			default:
+				app.internalServerError(w, r, err)
+			}
+			return
+		}
+
+		member, err := app.store.Communities.GetMember(ctx, communityID, getAuthUserID(r))
+		if err != nil && !errors.Is(err, store.ErrNotFound){
+			app.internalServerError(w, r, err)
+			return
+		}
+
+		ctx = context.WithValue(ctx, communityCtx, community)
+		ctx = context.WithValue(ctx, communityMemberCtx, member)
+
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// requireCommunityRole only lets members with at least role through.
+func (app *application) requireCommunityRole(role string) func(http.Handler) http.Handler{
+	return func(next http.Handler) http.Handler{
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request){
+			if !getCommunityMemberFromCtx(r).HasRole(role){
+				app.forbiddenError(w, r, errors.New("you must be a community "+role))
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// requireCommunityAccess hides the content of private communities from
+// non-members.
+func (app *application) requireCommunityAccess(next http.Handler) http.Handler{
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request){
+		community := getCommunityFromCtx(r)
+
+		if community.Visibility == store.CommunityPrivate && getCommunityMemberFromCtx(r) == nil{
+			app.forbiddenError(w, r, errNotCommunityMember)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// canViewPost reports whether the user may see a post, which is always the
+// case unless it belongs to a private community they aren't a member of,
+// moderators hid it or its author is shadow banned. Hidden posts stay visible
+// to their author and moderators, and shadow banned authors still see theirs.
+func (app *application) canViewPost(ctx context.Context, userID int64, post *store.Post) (bool, error){
+	if post.UserID != userID{
+		author, err := app.getUser(ctx, post.UserID)
+		if err != nil{
+			return false, err
+		}
+
+		if author.Status == store.AccountShadowBanned{
+			return false, nil
+		}
+	}
+
+	if post.HiddenAt != nil && post.UserID != userID{
+		user, err := app.store.Users.GetByID(ctx, userID)
+		if err != nil{
+			if errors.Is(err, store.ErrNotFound){
+				return false, nil
+			}
+			return false, err
+		}
+
+		if !user.HasRole(store.UserRoleModerator){
+			return false, nil
+		}
+	}
+
+	if post.CommunityID == nil{
+		return true, nil
+	}
+
+	community, err := app.store.Communities.GetByID(ctx, *post.CommunityID)
+	if err != nil{
+		return false, err
+	}
+
+	if community.Visibility == store.CommunityPublic{
+		return true, nil
+	}
+
+	return app.isCommunityMember(ctx, community.ID, userID)
+}
+
+func (app *application) isCommunityMember(ctx context.Context, communityID int64, userID int64) (bool, error){
+	_, err := app.store.Communities.GetMember(ctx, communityID, userID)
+	if err != nil{
+		if errors.Is(err, store.ErrNotFound){
+			return false, nil
+		}
+		return false, err
+	}
+
+	return true, nil
+}
+
+func getCommunityFromCtx(r *http.Request) *store.Community{
+	community, _ := r.Context().Value(communityCtx).(*store.Community)
+	return community
+}
+
+func getCommunityMemberFromCtx(r *http.Request) *store.CommunityMember{
+	member, _ := r.Context().Value(communityMemberCtx).(*store.CommunityMember)
+	return member
+}
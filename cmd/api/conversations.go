@@ -0,0 +1,411 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/nikhilkarle/social/internal/store"
+)
+
+type conversationKey string
+const conversationCtx conversationKey = "conversation"
+
+type CreateConversationPayload struct{
+	UserIDs []int64 `json:"user_ids" validate:"required,min=1,max=9,dive,gt=0"`
+	Title string `json:"title" validate:"max=100"`
+}
+
+type SendMessagePayload struct{
+	Content string `json:"content" validate:"required,max=2000"`
+}
+
+type MarkConversationReadPayload struct{
+	// MessageID defaults to the latest message
+	MessageID int64 `json:"message_id" validate:"gte=0"`
+}
+
+// getConversationsHandler godoc
+//
+//	@Summary		Fetches conversations
+//	@Description	Fetches the caller's conversations with their latest message and unread count, most recently active first
+//	@Tags			conversations
+//	@Accept			json
+//	@Produce		json
+//	@Param			limit	query		int	false	"Limit"
+//	@Param			offset	query		int	false	"Offset"
+//	@Success		200		{object}	[]store.Conversation
+//	@Failure		400		{object}	error	"Bad request"
+//	@Failure		500		{object}	error	"Internal server error"
+//	@Security		ApiKeyAuth
+//	@Router			/conversations [get]
+func (app *application) getConversationsHandler(w http.ResponseWriter, r *http.Request){
+	cq := store.ConversationQuery{
+		Limit: 20,
+		Offset: 0,
+	}
+
+	cq, err := cq.Parse(r)
+	if err != nil{
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(cq); err != nil{
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	conversations, err := app.store.Conversations.List(r.Context(), getAuthUserID(r), cq)
+	if err != nil{
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, conversations); err != nil{
+		app.internalServerError(w, r, err)
+	}
+}
+
+// createConversationHandler godoc
+//
+//	@Summary		Starts a conversation
+//	@Description	Starts a one-to-one conversation, or a group when more than one user is given. Starting a one-to-one conversation that already exists returns it.
+//	@Tags			conversations
+//	@Accept			json
+//	@Produce		json
+//	@Param			payload	body		CreateConversationPayload	true	"Conversation payload"
+//	@Success		201		{object}	store.Conversation
+//	@Failure		400		{object}	error	"Bad request"
+//	@Failure		403		{object}	error	"A user can't be messaged"
+//	@Failure		500		{object}	error	"Internal server error"
+//	@Security		ApiKeyAuth
+//	@Router			/conversations [post]
+func (app *application) createConversationHandler(w http.ResponseWriter, r *http.Request){
+	var payload CreateConversationPayload
+	if err := readJSON(w, r, &payload); err != nil{
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil{
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	userID := getAuthUserID(r)
+
+	for _, id := range payload.UserIDs{
+		if id == userID{
+			app.badRequestError(w, r, errors.New("you can't start a conversation with yourself"))
+			return
+		}
+	}
+
+	conv := &store.Conversation{
+		IsGroup: len(payload.UserIDs) > 1,
+		Title: payload.Title,
+		CreatedBy: userID,
+	}
+
+	if !conv.IsGroup && conv.Title != ""{
+		app.badRequestError(w, r, errors.New("only group conversations have a title"))
+		return
+	}
+
+	if err := app.store.Conversations.Create(r.Context(), conv, payload.UserIDs); err != nil{
+		switch{
+		case errors.Is(err, store.ErrCannotMessage):
+			app.forbiddenError(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusCreated, conv); err != nil{
+		app.internalServerError(w, r, err)
+	}
+}
+
+// getConversationHandler godoc
+//
+//	@Summary		Fetches a conversation
+//	@Description	Fetches a conversation the caller is a member of
+//	@Tags			conversations
+//	@Accept			json
+//	@Produce		json
+//	@Param			conversationID	path		int	true	"Conversation ID"
+//	@Success		200				{object}	store.Conversation
+//	@Failure		404				{object}	error	"Conversation not found"
+//	@Failure		500				{object}	error	"Internal server error"
+//	@Security		ApiKeyAuth
+//	@Router			/conversations/{conversationID} [get]
+func (app *application) getConversationHandler(w http.ResponseWriter, r *http.Request){
+	conv := getConversationFromCtx(r)
+
+	if err := app.jsonResponse(w, http.StatusOK, conv); err != nil{
+		app.internalServerError(w, r, err)
+	}
+}
+
+// getMessagesHandler godoc
+//
+//	@Summary		Fetches messages
+//	@Description	Fetches a page of a conversation's messages, newest first. next_cursor pages to older messages and prev_cursor to newer ones.
+//	@Tags			conversations
+//	@Accept			json
+//	@Produce		json
+//	@Param			conversationID	path		int		true	"Conversation ID"
+//	@Param			limit			query		int		false	"Limit"
+//	@Param			cursor			query		string	false	"Cursor from next_cursor or prev_cursor"
+//	@Success		200				{object}	[]store.Message
+//	@Failure		400				{object}	error	"Bad request"
+//	@Failure		404				{object}	error	"Conversation not found"
+//	@Failure		500				{object}	error	"Internal server error"
+//	@Security		ApiKeyAuth
+//	@Router			/conversations/{conversationID}/messages [get]
+func (app *application) getMessagesHandler(w http.ResponseWriter, r *http.Request){
+	conv := getConversationFromCtx(r)
+
+	mq := store.MessageQuery{
+		Limit: 30,
+	}
+
+	mq, err := mq.Parse(r)
+	if err != nil{
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(mq); err != nil{
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	if token := r.URL.Query().Get("cursor"); token != ""{
+		cursor, err := store.DecodeCursor([]byte(app.config.cursorSecret), token)
+		if err != nil{
+			app.badRequestError(w, r, err)
+			return
+		}
+
+		mq.Cursor = &cursor
+	}
+
+	messages, err := app.store.Conversations.GetMessages(r.Context(), getAuthUserID(r), conv.ID, mq)
+	if err != nil{
+		switch{
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundError(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	nextCursor, prevCursor := app.messageCursors(mq, messages)
+
+	if err := app.paginatedJSONResponse(w, http.StatusOK, messages, nextCursor, prevCursor); err != nil{
+		app.internalServerError(w, r, err)
+	}
+}
+
+// messageCursors returns the cursors for the pages of older and newer
+// messages, following the same rules as feedCursors.
+func (app *application) messageCursors(mq store.MessageQuery, messages []store.Message) (string, string){
+	if len(messages) == 0{
+		return "", ""
+	}
+
+	secret := []byte(app.config.cursorSecret)
+	first, last := messages[0], messages[len(messages)-1]
+	full := len(messages) == mq.Limit
+	backwards := mq.Cursor != nil && mq.Cursor.Prev
+
+	var nextCursor, prevCursor string
+
+	if full || backwards{
+		nextCursor = store.EncodeCursor(secret, store.FeedCursor{
+			CreatedAt: last.CreatedAt,
+			ID: last.ID,
+			Sort: "desc",
+		})
+	}
+
+	if mq.Cursor != nil && (!backwards || full){
+		prevCursor = store.EncodeCursor(secret, store.FeedCursor{
+			CreatedAt: first.CreatedAt,
+			ID: first.ID,
+			Sort: "desc",
+			Prev: true,
+		})
+	}
+
+	return nextCursor, prevCursor
+}
+
+// sendMessageHandler godoc
+//
+//	@Summary		Sends a message
+//	@Description	Sends a message to a conversation the caller is a member of
+//	@Tags			conversations
+//	@Accept			json
+//	@Produce		json
+//	@Param			conversationID	path		int					true	"Conversation ID"
+//	@Param			payload			body		SendMessagePayload	true	"Message payload"
+//	@Success		201				{object}	store.Message
+//	@Failure		400				{object}	error	"Bad request"
+//	@Failure		403				{object}	error	"The other user can't be messaged"
+//	@Failure		404				{object}	error	"Conversation not found"
+//	@Failure		500				{object}	error	"Internal server error"
+//	@Security		ApiKeyAuth
+//	@Router			/conversations/{conversationID}/messages [post]
+func (app *application) sendMessageHandler(w http.ResponseWriter, r *http.Request){
+	conv := getConversationFromCtx(r)
+
+	var payload SendMessagePayload
+	if err := readJSON(w, r, &payload); err != nil{
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil{
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	msg := &store.Message{
+		ConversationID: conv.ID,
+		SenderID: getAuthUserID(r),
+		Content: payload.Content,
+	}
+
+	if err := app.store.Conversations.SendMessage(r.Context(), msg); err != nil{
+		switch{
+		case errors.Is(err, store.ErrCannotMessage):
+			app.forbiddenError(w, r, err)
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundError(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusCreated, msg); err != nil{
+		app.internalServerError(w, r, err)
+	}
+}
+
+// markConversationReadHandler godoc
+//
+//	@Summary		Marks a conversation as read
+//	@Description	Marks the conversation as read up to a message, or up to its latest message, and sends a read receipt to the other members
+//	@Tags			conversations
+//	@Accept			json
+//	@Produce		json
+//	@Param			conversationID	path		int							true	"Conversation ID"
+//	@Param			payload			body		MarkConversationReadPayload	false	"Message to read up to"
+//	@Success		204				{string}	string	"Conversation marked as read"
+//	@Failure		400				{object}	error	"Bad request"
+//	@Failure		404				{object}	error	"Conversation or message not found"
+//	@Failure		500				{object}	error	"Internal server error"
+//	@Security		ApiKeyAuth
+//	@Router			/conversations/{conversationID}/read [post]
+func (app *application) markConversationReadHandler(w http.ResponseWriter, r *http.Request){
+	conv := getConversationFromCtx(r)
+
+	var payload MarkConversationReadPayload
+	if r.ContentLength != 0{
+		if err := readJSON(w, r, &payload); err != nil{
+			app.badRequestError(w, r, err)
+			return
+		}
+	}
+
+	if err := Validate.Struct(payload); err != nil{
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	if err := app.store.Conversations.MarkRead(r.Context(), getAuthUserID(r), conv.ID, payload.MessageID); err != nil{
+		switch{
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundError(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// leaveConversationHandler godoc
+//
+//	@Summary		Leaves a group conversation
+//	@Description	Removes the caller from a group conversation. One-to-one conversations can't be left.
+//	@Tags			conversations
+//	@Accept			json
+//	@Produce		json
+//	@Param			conversationID	path		int		true	"Conversation ID"
+//	@Success		204				{string}	string	"Left the conversation"
+//	@Failure		400				{object}	error	"Not a group conversation"
+//	@Failure		404				{object}	error	"Conversation not found"
+//	@Failure		500				{object}	error	"Internal server error"
+//	@Security		ApiKeyAuth
+//	@Router			/conversations/{conversationID}/leave [post]
+func (app *application) leaveConversationHandler(w http.ResponseWriter, r *http.Request){
+	conv := getConversationFromCtx(r)
+
+	if err := app.store.Conversations.Leave(r.Context(), getAuthUserID(r), conv.ID); err != nil{
+		switch{
+		case errors.Is(err, store.ErrNotGroup):
+			app.badRequestError(w, r, err)
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundError(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// conversationContextMiddleware loads the conversation from the URL, answering
+// 404 unless the caller is one of its members.
+func (app *application) conversationContextMiddleware(next http.Handler) http.Handler{
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request){
+		conversationID, err := strconv.ParseInt(chi.URLParam(r, "conversationID"), 10, 64)
+		if err != nil{
+			app.badRequestError(w, r, err)
+			return
+		}
+
+		ctx := r.Context()
+
+		conv, err := app.store.Conversations.GetByID(ctx, getAuthUserID(r), conversationID)
+		if err != nil{
+			switch{
+			case errors.Is(err, store.ErrNotFound):
+				app.notFoundError(w, r, err)
+			default:
+				app.internalServerError(w, r, err)
+			}
+			return
+		}
+
+		ctx = context.WithValue(ctx, conversationCtx, conv)
+
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func getConversationFromCtx(r *http.Request) *store.Conversation{
+	conv, _ := r.Context().Value(conversationCtx).(*store.Conversation)
+	return conv
+}
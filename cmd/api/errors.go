@@ -2,6 +2,8 @@ package main
 
 import (
 	"net/http"
+	"strconv"
+	"time"
 )
 
 func (app *application) internalServerError(w http.ResponseWriter, r *http.Request, err error){
@@ -26,4 +28,41 @@ func (app *application) conflictError(w http.ResponseWriter, r *http.Request, er
 	app.logger.Errorf("conflict error", "method", r.Method, "path", r.URL.Path, "error", err.Error())
 
 	writeJSONError(w, http.StatusConflict, "already exists")
-}
\ No newline at end of file
+}
+func (app *application) unauthorizedError(w http.ResponseWriter, r *http.Request, err error){
+	app.logger.Warnw("unauthorized error", "method", r.Method, "path", r.URL.Path, "error", err.Error())
+
+	writeJSONError(w, http.StatusUnauthorized, "unauthorized")
+}
+
+func (app *application) forbiddenError(w http.ResponseWriter, r *http.Request, err error){
+	app.logger.Warnw("forbidden error", "method", r.Method, "path", r.URL.Path, "error", err.Error())
+
+	writeJSONError(w, http.StatusForbidden, err.Error())
+}
+
+func (app *application) payloadTooLargeError(w http.ResponseWriter, r *http.Request, err error){
+	app.logger.Warnw("payload too large error", "method", r.Method, "path", r.URL.Path, "error", err.Error())
+
+	writeJSONError(w, http.StatusRequestEntityTooLarge, err.Error())
+}
+
+func (app *application) unsupportedMediaTypeError(w http.ResponseWriter, r *http.Request, err error){
+	app.logger.Warnw("unsupported media type error", "method", r.Method, "path", r.URL.Path, "error", err.Error())
+
+	writeJSONError(w, http.StatusUnsupportedMediaType, err.Error())
+}
+
+func (app *application) unprocessableEntityError(w http.ResponseWriter, r *http.Request, err error){
+	app.logger.Warnw("unprocessable entity error", "method", r.Method, "path", r.URL.Path, "error", err.Error())
+
+	writeJSONError(w, http.StatusUnprocessableEntity, err.Error())
+}
+
+func (app *application) rateLimitExceededError(w http.ResponseWriter, r *http.Request, retryAfter time.Duration){
+	app.logger.Warnw("rate limit exceeded", "method", r.Method, "path", r.URL.Path)
+
+	w.Header().Set("Retry-After", strconv.Itoa(ceilSeconds(retryAfter)))
+
+	writeJSONError(w, http.StatusTooManyRequests, "rate limit exceeded, retry in "+retryAfter.Round(time.Second).String())
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/nikhilkarle/social/internal/store"
+)
+
+// exploreHandler godoc
+//
+//	@Summary		Fetches popular recent posts
+//	@Description	Fetches popular recent posts from across the site
+//	@Tags			explore
+//	@Accept			json
+//	@Produce		json
+//	@Param			limit	query		int		false	"Limit"
+//	@Param			offset	query		int		false	"Offset"
+//	@Success		200		{object}	[]store.PostWithMetadata
+//	@Failure		400		{object}	error	"Bad request"
+//	@Failure		500		{object}	error	"Internal server error"
+//	@Security		ApiKeyAuth
+//	@Router			/explore [get]
+func (app *application) exploreHandler(w http.ResponseWriter, r *http.Request){
+	fq := store.PaginatedFeedQuery{
+		Limit: 20,
+		Offset: 0,
+		Sort: "desc",
+	}
+
+	fq, err := fq.Parse(r)
+	if err != nil{
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(fq); err != nil{
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	posts, err := app.store.Trending.GetExplore(r.Context(), getAuthUserID(r), fq)
+	if err != nil{
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.attachPostDetails(r.Context(), getAuthUserID(r), feedPosts(posts)...); err != nil{
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, posts); err != nil{
+		app.internalServerError(w, r, err)
+	}
+}
+
+// trendingTagsHandler godoc
+//
+//	@Summary		Fetches trending tags
+//	@Description	Fetches the tags gaining the most use in the last hour compared to the last day
+//	@Tags			explore
+//	@Accept			json
+//	@Produce		json
+//	@Param			limit	query		int	false	"Limit"
+//	@Success		200		{object}	[]store.TrendingTag
+//	@Failure		400		{object}	error	"Bad request"
+//	@Failure		500		{object}	error	"Internal server error"
+//	@Security		ApiKeyAuth
+//	@Router			/trending/tags [get]
+func (app *application) trendingTagsHandler(w http.ResponseWriter, r *http.Request){
+	limit := 10
+	if l := r.URL.Query().Get("limit"); l != ""{
+		n, err := strconv.Atoi(l)
+		if err != nil || n < 1 || n > 50{
+			app.badRequestError(w, r, errors.New("limit must be between 1 and 50"))
+			return
+		}
+		limit = n
+	}
+
+	tags, err := app.store.Trending.GetTags(r.Context(), limit)
+	if err != nil{
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, tags); err != nil{
+		app.internalServerError(w, r, err)
+	}
+}
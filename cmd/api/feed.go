@@ -1,8 +1,11 @@
 package main
 
 import (
+	"errors"
 	"net/http"
+	"time"
 
+	"github.com/nikhilkarle/social/internal/ranking"
 	"github.com/nikhilkarle/social/internal/store"
 )
 
@@ -16,8 +19,9 @@ import (
 //	@Param			since	query		string	false	"Since"
 //	@Param			until	query		string	false	"Until"
 //	@Param			limit	query		int		false	"Limit"
-//	@Param			offset	query		int		false	"Offset"
-//	@Param			sort	query		string	false	"Sort"
+//	@Param			cursor	query		string	false	"Cursor from next_cursor or prev_cursor"
+//	@Param			offset	query		int		false	"Offset (deprecated, use cursor)"
+//	@Param			sort	query		string	false	"Sort: asc, desc or ranked"
 //	@Param			tags	query		string	false	"Tags"
 //	@Param			search	query		string	false	"Search"
 //	@Success		200		{object}	[]store.PostWithMetadata
@@ -44,15 +48,143 @@ func (app *application) getUserFeedHandler(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
-	feed, err := app.store.Posts.GetUserFeed(r.Context(), int64(50), fq)
+	if fq.Sort == "ranked"{
+		app.getRankedFeed(w, r, fq)
+		return
+	}
+
+	if err := app.parseFeedCursor(w, r, &fq); err != nil{
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	feed, err := app.store.Posts.GetUserFeed(r.Context(), getAuthUserID(r), fq)
 
 	if err != nil{
 		app.internalServerError(w, r, err)
 		return
 	}
 
-	if err := app.jsonResponse(w, http.StatusOK, feed); err != nil{
+	if err := app.attachPostDetails(r.Context(), getAuthUserID(r), feedPosts(feed)...); err != nil{
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	nextCursor, prevCursor := app.feedCursors(fq, feed)
+
+	if err := app.paginatedJSONResponse(w, http.StatusOK, feed, nextCursor, prevCursor); err != nil{
 		app.internalServerError(w,r,err)
 		return
 	}
+}
+
+// parseFeedCursor sets fq.Cursor from the "cursor" query parameter, taking
+// the sort order from it, and flags offset pagination as deprecated.
+func (app *application) parseFeedCursor(w http.ResponseWriter, r *http.Request, fq *store.PaginatedFeedQuery) error{
+	token := r.URL.Query().Get("cursor")
+	if token == ""{
+		if fq.Offset != 0{
+			w.Header().Set("Deprecation", "true")
+		}
+		return nil
+	}
+
+	if fq.Offset != 0{
+		return errors.New("cursor and offset can't be combined")
+	}
+
+	cursor, err := store.DecodeCursor([]byte(app.config.cursorSecret), token)
+	if err != nil{
+		return err
+	}
+
+	fq.Cursor = &cursor
+	fq.Sort = cursor.Sort
+	return nil
+}
+
+// feedCursors returns the cursors for the pages after and before feed. A full
+// page is assumed to have more posts behind it, and a page reached through a
+// cursor or an offset always has one in front of it.
+func (app *application) feedCursors(fq store.PaginatedFeedQuery, feed []store.PostWithMetadata) (string, string){
+	if len(feed) == 0{
+		return "", ""
+	}
+
+	secret := []byte(app.config.cursorSecret)
+	first, last := feed[0], feed[len(feed)-1]
+	full := len(feed) == fq.Limit
+	backwards := fq.Cursor != nil && fq.Cursor.Prev
+
+	var nextCursor, prevCursor string
+
+	if full || backwards{
+		nextCursor = store.EncodeCursor(secret, store.FeedCursor{
+			CreatedAt: last.CreatedAt,
+			ID: last.ID,
+			Sort: fq.Sort,
+		})
+	}
+
+	if (fq.Cursor != nil && (!backwards || full)) || fq.Offset > 0{
+		prevCursor = store.EncodeCursor(secret, store.FeedCursor{
+			CreatedAt: first.CreatedAt,
+			ID: first.ID,
+			Sort: fq.Sort,
+			Prev: true,
+		})
+	}
+
+	return nextCursor, prevCursor
+}
+
+// rankedCandidateLimit is how many of the newest feed posts are scored for sort=ranked.
+const rankedCandidateLimit = 300
+
+// getRankedFeed scores the newest feed posts with the user's ranker and pages
+// through them by offset; ranked pages have no cursors.
+func (app *application) getRankedFeed(w http.ResponseWriter, r *http.Request, fq store.PaginatedFeedQuery){
+	if r.URL.Query().Get("cursor") != ""{
+		app.badRequestError(w, r, errors.New("cursor can't be used with sort=ranked"))
+		return
+	}
+
+	userID := getAuthUserID(r)
+	ctx := r.Context()
+
+	candidates := fq
+	candidates.Sort = "desc"
+	candidates.Limit = rankedCandidateLimit
+	candidates.Offset = 0
+
+	feed, err := app.store.Posts.GetUserFeed(ctx, userID, candidates)
+	if err != nil{
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	affinity, err := app.store.Reactions.GetAffinity(ctx, userID)
+	if err != nil{
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	ranker := app.ranker.For(userID)
+	ranked := ranking.Rank(ranker, feed, ranking.Signals{Now: time.Now(), Affinity: *affinity})
+
+	start := min(fq.Offset, len(ranked))
+	end := min(start+fq.Limit, len(ranked))
+
+	page := ranked[start:end]
+
+	if err := app.attachPostDetails(ctx, userID, feedPosts(page)...); err != nil{
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	w.Header().Set("X-Ranker", ranker.Name())
+
+	if err := app.jsonResponse(w, http.StatusOK, page); err != nil{
+		app.internalServerError(w, r, err)
+	}
 }
\ No newline at end of file
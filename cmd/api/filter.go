@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/nikhilkarle/social/internal/filter"
+	"github.com/nikhilkarle/social/internal/store"
+)
+
+var errContentRejected = errors.New("content rejected")
+
+// screenContent runs new content through the content filter. Rejected content
+// returns errContentRejected with the reasons; flagged and held content gets a
+// screening for the store to queue it for review.
+func (app *application) screenContent(ctx context.Context, userID int64, kind string, text string) (*store.Screening, error){
+	verdict, err := app.filter.Check(ctx, filter.Content{UserID: userID, Kind: kind, Text: text})
+	if err != nil{
+		return nil, err
+	}
+
+	switch verdict.Mode{
+	case filter.ModeReject:
+		return nil, fmt.Errorf("%w: %s", errContentRejected, strings.Join(verdict.Reasons(), "; "))
+	case filter.ModeHold, filter.ModeFlag:
+		return &store.Screening{
+			Hold: verdict.Mode == filter.ModeHold,
+			Reasons: verdict.Reasons(),
+		}, nil
+	}
+
+	return nil, nil
+}
+
+// screeningError responds to a failed screenContent.
+func (app *application) screeningError(w http.ResponseWriter, r *http.Request, err error){
+	switch{
+	case errors.Is(err, errContentRejected):
+		app.unprocessableEntityError(w, r, err)
+	default:
+		app.internalServerError(w, r, err)
+	}
+}
+
+// announceReleased sends the notifications that held content skipped when it
+// was created, once a moderator approves it.
+func (app *application) announceReleased(ctx context.Context, report *store.Report){
+	author, err := app.getUser(ctx, report.TargetUserID)
+	if err != nil{
+		app.logger.Errorw("announcing released content", "report_id", report.ID, "error", err.Error())
+		return
+	}
+
+	// shadow banned users' content is never announced
+	if author.Status == store.AccountShadowBanned{
+		return
+	}
+
+	switch report.TargetType{
+	case store.ReportTargetPost:
+		post, err := app.store.Posts.GetByID(ctx, report.TargetID)
+		if err != nil{
+			app.logger.Errorw("announcing released post", "post_id", report.TargetID, "error", err.Error())
+			return
+		}
+
+		app.notifyMentions(ctx, post, nil)
+
+	case store.ReportTargetComment:
+		comment, err := app.store.Comments.GetByID(ctx, report.TargetID)
+		if err != nil{
+			app.logger.Errorw("announcing released comment", "comment_id", report.TargetID, "error", err.Error())
+			return
+		}
+
+		post, err := app.store.Posts.GetByID(ctx, comment.PostID)
+		if err != nil{
+			app.logger.Errorw("announcing released comment", "comment_id", report.TargetID, "error", err.Error())
+			return
+		}
+
+		commentID, _ := strconv.ParseInt(comment.ID, 10, 64)
+
+		app.notify(ctx, &store.Notification{
+			UserID: post.UserID,
+			ActorID: comment.UserID,
+			Type: store.NotificationComment,
+			PostID: &post.ID,
+			CommentID: &commentID,
+		})
+	}
+}
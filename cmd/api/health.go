@@ -5,13 +5,20 @@ import (
 )
 
 func (app *application) healthCheckHandler(w http.ResponseWriter, r *http.Request){
+	status, code := "ok", http.StatusOK
+	// a draining instance fails its health check so it's taken out of
+	// rotation before it stops accepting connections
+	if app.draining.Load(){
+		status, code = "draining", http.StatusServiceUnavailable
+	}
+
 	data := map[string]string{
-		"staus": "ok",
+		"staus": status,
 		"env": app.config.env, 
 		"version": version, 
 	}
 
-	if err := app.jsonResponse(w, http.StatusOK, data); err != nil{
+	if err := app.jsonResponse(w, code, data); err != nil{
 		app.internalServerError(w,r,err)
 	}
 }
\ No newline at end of file
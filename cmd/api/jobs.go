@@ -0,0 +1,25 @@
+package main
+
+import (
+	"context"
+	"time"
+)
+
+// refreshTrendingTags recomputes the trending tags table right away and then
+// every trendingRefreshInterval until ctx is done.
+func (app *application) refreshTrendingTags(ctx context.Context){
+	ticker := time.NewTicker(app.config.trendingRefreshInterval)
+	defer ticker.Stop()
+
+	for{
+		if err := app.store.Trending.Refresh(ctx); err != nil{
+			app.logger.Errorw("trending tags refresh failed", "error", err.Error())
+		}
+
+		select{
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -5,12 +5,20 @@ import (
 	"net/http"
 
 	"github.com/go-playground/validator/v10"
+	"github.com/nikhilkarle/social/internal/store"
 )
 
 var Validate *validator.Validate
 
 func init(){
 	Validate = validator.New(validator.WithRequiredStructEnabled())
+
+	err := Validate.RegisterValidation("tag", func(fl validator.FieldLevel) bool{
+		return store.TagPattern.MatchString(fl.Field().String())
+	})
+	if err != nil{
+		panic("registering the tag validator: " + err.Error())
+	}
 }
 
 func writeJSON(w http.ResponseWriter, status int, data any) error{
@@ -44,4 +52,16 @@ func (app *application) jsonResponse(w http.ResponseWriter, status int, data any
 	}
 
 	return writeJSON(w, status, &envelope{Data: data})
+}
+
+// paginatedJSONResponse wraps data in the same envelope as jsonResponse and
+// adds the cursors for the neighbouring pages, omitting those that don't exist.
+func (app *application) paginatedJSONResponse(w http.ResponseWriter, status int, data any, nextCursor, prevCursor string) error{
+	type envelope struct{
+		Data any `json:"data"`
+		NextCursor string `json:"next_cursor,omitempty"`
+		PrevCursor string `json:"prev_cursor,omitempty"`
+	}
+
+	return writeJSON(w, status, &envelope{Data: data, NextCursor: nextCursor, PrevCursor: prevCursor})
 }
\ No newline at end of file
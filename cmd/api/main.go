@@ -1,9 +1,24 @@
 package main
 
 import (
+	"context"
+	"expvar"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
 	"github.com/nikhilkarle/social/internal/db"
 	"github.com/nikhilkarle/social/internal/env"
+	"github.com/nikhilkarle/social/internal/events"
+	"github.com/nikhilkarle/social/internal/filter"
+	"github.com/nikhilkarle/social/internal/media"
+	"github.com/nikhilkarle/social/internal/ranking"
+	"github.com/nikhilkarle/social/internal/ratelimit"
+	"github.com/nikhilkarle/social/internal/redis"
 	"github.com/nikhilkarle/social/internal/store"
+	"github.com/nikhilkarle/social/internal/unfurl"
 	"go.uber.org/zap"
 )
 
@@ -38,11 +53,81 @@ func main() {
 			maxIdleTime: env.GetString("DB_MAX_IDLE_TIME", "15m"),
 		},
 		env: env.GetString("ENV", "development"),
+		cursorSecret: env.GetString("CURSOR_SECRET", ""),
+		trendingRefreshInterval: time.Duration(env.GetInt("TRENDING_REFRESH_SECONDS", 300)) * time.Second,
+		linkPreviewWorkers: env.GetInt("LINK_PREVIEW_WORKERS", 2),
+		contentFilterConfig: env.GetString("CONTENT_FILTER_CONFIG", ""),
+		media: mediaConfig{
+			store: env.GetString("MEDIA_STORE", "local"),
+			maxBytes: int64(env.GetInt("MEDIA_MAX_BYTES", 10 << 20)),
+			dir: env.GetString("MEDIA_DIR", "./uploads"),
+			baseURL: env.GetString("MEDIA_BASE_URL", "http://localhost:8080/v1/media/files"),
+			s3: media.S3Config{
+				Endpoint: env.GetString("S3_ENDPOINT", "http://localhost:9000"),
+				Region: env.GetString("S3_REGION", "us-east-1"),
+				Bucket: env.GetString("S3_BUCKET", "social-media"),
+				AccessKey: env.GetString("S3_ACCESS_KEY", ""),
+				SecretKey: env.GetString("S3_SECRET_KEY", ""),
+				PublicURL: env.GetString("S3_PUBLIC_URL", ""),
+			},
+		},
+		rateLimit: rateLimitConfig{
+			enabled: env.GetBool("RATE_LIMIT_ENABLED", true),
+			store: env.GetString("RATE_LIMIT_STORE", "memory"),
+			algorithm: env.GetString("RATE_LIMIT_ALGORITHM", ratelimit.TokenBucket),
+			api: ratelimit.Limit{
+				Requests: env.GetInt("RATE_LIMIT_REQUESTS", 120),
+				Window: time.Duration(env.GetInt("RATE_LIMIT_WINDOW_SECONDS", 60)) * time.Second,
+			},
+			createPost: ratelimit.Limit{
+				Requests: env.GetInt("RATE_LIMIT_POST_REQUESTS", 10),
+				Window: time.Duration(env.GetInt("RATE_LIMIT_POST_WINDOW_SECONDS", 300)) * time.Second,
+			},
+		},
+		cache: cacheConfig{
+			enabled: env.GetBool("CACHE_ENABLED", false),
+			store: env.GetString("CACHE_STORE", "memory"),
+			size: env.GetInt("CACHE_SIZE", 10000),
+			ttl: time.Duration(env.GetInt("CACHE_TTL_SECONDS", 60)) * time.Second,
+		},
+		redis: redisConfig{
+			addr: env.GetString("REDIS_ADDR", "localhost:6379"),
+			password: env.GetString("REDIS_PASSWORD", ""),
+			db: env.GetInt("REDIS_DB", 0),
+		},
+		shutdown: shutdownConfig{
+			timeout: time.Duration(env.GetInt("SHUTDOWN_TIMEOUT_SECONDS", 30)) * time.Second,
+			drainDelay: time.Duration(env.GetInt("SHUTDOWN_DRAIN_SECONDS", 5)) * time.Second,
+		},
 	}
 
 	//Logger
 	logger := zap.Must(zap.NewProduction()).Sugar()
-	defer logger.Sync()
+
+	wsAllowedOrigins, err := parseAllowedOrigins(env.GetString("WS_ALLOWED_ORIGINS", ""))
+	if err != nil{
+		logger.Fatal(err)
+	}
+	cfg.wsAllowedOrigins = wsAllowedOrigins
+
+	// a default secret would be public, letting anyone forge cursors
+	if cfg.cursorSecret == ""{
+		if cfg.env != "development"{
+			logger.Fatal("CURSOR_SECRET must be set outside development")
+		}
+		cfg.cursorSecret = "dev-cursor-secret"
+	}
+
+	// time.NewTicker panics on anything else
+	if cfg.trendingRefreshInterval <= 0{
+		logger.Fatal("TRENDING_REFRESH_SECONDS must be positive")
+	}
+
+	trustedProxies, err := parseTrustedProxies(env.GetString("TRUSTED_PROXIES", ""))
+	if err != nil{
+		logger.Fatal(err)
+	}
+	cfg.trustedProxies = trustedProxies
 
 	db, err := db.New(
 		cfg.db.addr,
@@ -55,17 +140,132 @@ func main() {
 		logger.Fatal(err)
 	}
 
-	defer db.Close()
 	logger.Info("Database conntection pool established")
 
-	store := store.NewStorage(db)
+	// background workers share one context, cancelled once requests have
+	// drained since those can still queue work
+	workers, stopWorkers := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	background := func(run func(ctx context.Context)){
+		wg.Add(1)
+		go func(){
+			defer wg.Done()
+			run(workers)
+		}()
+	}
+
+	broker := events.NewBroker()
+	transport := events.NewPostgresTransport(db, cfg.db.addr, broker, logger)
+	broker.SetTransport(transport)
+
+	background(func(ctx context.Context){
+		if err := transport.Run(ctx); err != nil{
+			logger.Errorw("events listener stopped", "error", err.Error())
+		}
+	})
+	background(broker.Run)
+
+	store := store.NewStorage(db, broker)
+
+	blobs, err := newBlobStore(cfg.media)
+	if err != nil{
+		logger.Fatal(err)
+	}
+
+	contentFilter, err := filter.Load(cfg.contentFilterConfig)
+	if err != nil{
+		logger.Fatal(err)
+	}
+
+	// connections are only opened once something uses Redis
+	redisClient := redis.NewClient(redis.Config{
+		Addr: cfg.redis.addr,
+		Password: cfg.redis.password,
+		DB: cfg.redis.db,
+	})
+
+	usesRedis := (cfg.rateLimit.enabled && cfg.rateLimit.store == "redis") ||
+		(cfg.cache.enabled && cfg.cache.store == "redis")
+
+	if usesRedis{
+		ctx, cancel := context.WithTimeout(context.Background(), 5 * time.Second)
+		err := redisClient.Ping(ctx)
+		cancel()
+		if err != nil{
+			logger.Fatal(err)
+		}
+		logger.Info("Redis connection established")
+	}
+
+	limiter, err := newLimiter(cfg.rateLimit, redisClient)
+	if err != nil{
+		logger.Fatal(err)
+	}
+
+	cache, err := newCache(cfg.cache, redisClient)
+	if err != nil{
+		logger.Fatal(err)
+	}
+
+	if cache != nil{
+		expvar.Publish("cache", expvar.Func(func() any{
+			return cache.Stats.Vars()
+		}))
+	}
+
+	background(store.Timelines.Run)
+
+	streams, closeStreams := context.WithCancel(context.Background())
 
 	app := &application{
 		config: cfg,
 		store: store,
 		logger: logger,
+		broker: broker,
+		blobs: blobs,
+		linkPreviews: make(chan string, linkPreviewQueueSize),
+		filter: contentFilter,
+		limiter: limiter,
+		cache: cache,
+		streams: streams,
+		closeStreams: closeStreams,
+		ranker: ranking.Experiment{
+			Control: ranking.NewWeighted(),
+			Treatment: ranking.Chronological{},
+			TreatmentPercent: env.GetInt("RANKER_TREATMENT_PERCENT", 0),
+		},
 	}
 
+	background(app.refreshTrendingTags)
+
+	fetcher := unfurl.NewFetcher()
+	for i := 0; i < cfg.linkPreviewWorkers; i++{
+		background(func(ctx context.Context){
+			app.fetchLinkPreviews(ctx, fetcher)
+		})
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	// a second signal kills the process without waiting for the drain
+	context.AfterFunc(ctx, stop)
+
 	mux := app.mount()
-	logger.Fatal(app.run(mux))
+	err = app.run(ctx, mux)
+	if err != nil{
+		logger.Errorw("server stopped", "error", err.Error())
+	}
+
+	stopWorkers()
+	wg.Wait()
+	logger.Info("background workers stopped")
+
+	redisClient.Close()
+	logger.Sync()
+	// last, as everything above may still be using it
+	db.Close()
+
+	if err != nil{
+		os.Exit(1)
+	}
 }
\ No newline at end of file
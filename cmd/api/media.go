@@ -0,0 +1,182 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/nikhilkarle/social/internal/media"
+	"github.com/nikhilkarle/social/internal/store"
+)
+
+// multipartOverhead allows for the form's boundaries and headers on top of
+// the file itself.
+const multipartOverhead = 64 << 10
+
+var (
+	errNoFile = errors.New(`missing "file" form field`)
+	errUploadTooLarge = errors.New("upload too large")
+)
+
+func newBlobStore(cfg mediaConfig) (media.BlobStore, error){
+	switch cfg.store{
+	case "local":
+		return media.NewLocalStore(cfg.dir, cfg.baseURL)
+	case "s3":
+		return media.NewS3Store(cfg.s3), nil
+	}
+	return nil, fmt.Errorf("unknown media store %q", cfg.store)
+}
+
+// uploadMediaHandler godoc
+//
+//	@Summary		Uploads an image
+//	@Description	Uploads a JPEG, PNG or GIF as the "file" field of a multipart form. Metadata is stripped and a thumbnail generated. Attach the returned ID to a post with media_ids.
+//	@Tags			media
+//	@Accept			mpfd
+//	@Produce		json
+//	@Param			file	formData	file	true	"Image"
+//	@Success		201		{object}	store.Media
+//	@Failure		400		{object}	error	"Bad request"
+//	@Failure		413		{object}	error	"File too large"
+//	@Failure		415		{object}	error	"Not a supported image"
+//	@Failure		500		{object}	error	"Internal server error"
+//	@Security		ApiKeyAuth
+//	@Router			/media [post]
+func (app *application) uploadMediaHandler(w http.ResponseWriter, r *http.Request){
+	maxBytes := app.config.media.maxBytes
+	r.Body = http.MaxBytesReader(w, r.Body, maxBytes+multipartOverhead)
+
+	data, err := readUpload(r, maxBytes)
+	if err != nil{
+		var maxErr *http.MaxBytesError
+		switch{
+		case errors.As(err, &maxErr), errors.Is(err, errUploadTooLarge):
+			app.payloadTooLargeError(w, r, fmt.Errorf("file must be at most %d bytes", maxBytes))
+		default:
+			app.badRequestError(w, r, err)
+		}
+		return
+	}
+
+	img, err := media.Process(data)
+	if err != nil{
+		switch{
+		case errors.Is(err, media.ErrUnsupportedType):
+			app.unsupportedMediaTypeError(w, r, err)
+		case errors.Is(err, media.ErrImageTooLarge):
+			app.payloadTooLargeError(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	ctx := r.Context()
+	userID := getAuthUserID(r)
+
+	name, err := randomName()
+	if err != nil{
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	m := &store.Media{
+		UserID: userID,
+		ContentType: img.ContentType,
+		Width: img.Width,
+		Height: img.Height,
+		Size: len(img.Data),
+		Key: fmt.Sprintf("%d/%s%s", userID, name, media.Extension(img.ContentType)),
+		ThumbnailKey: fmt.Sprintf("%d/%s_thumb%s", userID, name, media.Extension(img.ThumbnailType)),
+	}
+
+	if err := app.blobs.Put(ctx, m.Key, img.Data, img.ContentType); err != nil{
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.blobs.Put(ctx, m.ThumbnailKey, img.Thumbnail, img.ThumbnailType); err != nil{
+		app.deleteBlobs(ctx, m.Key)
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.store.Media.Create(ctx, m); err != nil{
+		app.deleteBlobs(ctx, m.Key, m.ThumbnailKey)
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	app.mediaURLs(m)
+
+	if err := app.jsonResponse(w, http.StatusCreated, m); err != nil{
+		app.internalServerError(w, r, err)
+	}
+}
+
+// readUpload reads the "file" part of a multipart request, up to maxBytes.
+// Parts are streamed rather than parsed into memory or temp files up front.
+func readUpload(r *http.Request, maxBytes int64) ([]byte, error){
+	mr, err := r.MultipartReader()
+	if err != nil{
+		return nil, err
+	}
+
+	for{
+		part, err := mr.NextPart()
+		if err == io.EOF{
+			return nil, errNoFile
+		}
+		if err != nil{
+			return nil, err
+		}
+
+		if part.FormName() != "file"{
+			part.Close()
+			continue
+		}
+
+		data, err := io.ReadAll(io.LimitReader(part, maxBytes+1))
+		part.Close()
+		if err != nil{
+			return nil, err
+		}
+
+		if int64(len(data)) > maxBytes{
+			return nil, errUploadTooLarge
+		}
+
+		return data, nil
+	}
+}
+
+func randomName() (string, error){
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil{
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// deleteBlobs cleans up after a failed upload. Failures only leave orphaned
+// files behind, so they are logged.
+func (app *application) deleteBlobs(ctx context.Context, keys ...string){
+	for _, key := range keys{
+		if err := app.blobs.Delete(ctx, key); err != nil{
+			app.logger.Errorw("delete blob", "key", key, "error", err.Error())
+		}
+	}
+}
+
+// mediaURLs fills in where clients download the files from.
+func (app *application) mediaURLs(media ...*store.Media){
+	for _, m := range media{
+		m.URL = app.blobs.URL(m.Key)
+		m.ThumbnailURL = app.blobs.URL(m.ThumbnailKey)
+	}
+}
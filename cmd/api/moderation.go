@@ -0,0 +1,351 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/nikhilkarle/social/internal/store"
+)
+
+type CreateReportPayload struct{
+	TargetType string `json:"target_type" validate:"required,oneof=post comment user"`
+	TargetID int64 `json:"target_id" validate:"required,gt=0"`
+	Reason string `json:"reason" validate:"required,oneof=spam harassment hate violence sexual self_harm misinformation other"`
+	// Details are required for the "other" reason
+	Details string `json:"details" validate:"required_if=Reason other,max=1000"`
+}
+
+type ResolveReportPayload struct{
+	Action string `json:"action" validate:"required,oneof=dismiss hide suspend"`
+	Note string `json:"note" validate:"max=500"`
+	// SuspendHours is how long to suspend the target user for, up to a year
+	SuspendHours int `json:"suspend_hours" validate:"required_if=Action suspend,gte=0,lte=8760"`
+}
+
+// createReportHandler godoc
+//
+//	@Summary		Reports content
+//	@Description	Reports a post, comment or user to the moderators with a reason code
+//	@Tags			moderation
+//	@Accept			json
+//	@Produce		json
+//	@Param			payload	body		CreateReportPayload	true	"Report payload"
+//	@Success		201		{object}	store.Report
+//	@Failure		400		{object}	error	"Bad request"
+//	@Failure		404		{object}	error	"Target not found"
+//	@Failure		409		{object}	error	"Already reported"
+//	@Failure		500		{object}	error	"Internal server error"
+//	@Security		ApiKeyAuth
+//	@Router			/reports [post]
+func (app *application) createReportHandler(w http.ResponseWriter, r *http.Request){
+	var payload CreateReportPayload
+	if err := readJSON(w, r, &payload); err != nil{
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	payload.Details = strings.TrimSpace(payload.Details)
+
+	if err := Validate.Struct(payload); err != nil{
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	ctx := r.Context()
+	userID := getAuthUserID(r)
+
+	// posts in private communities can't be reported by outsiders, who can't
+	// see them
+	if payload.TargetType == store.ReportTargetPost{
+		post, err := app.store.Posts.GetByID(ctx, payload.TargetID)
+		if err != nil{
+			switch{
+			case errors.Is(err, store.ErrNotFound):
+				app.notFoundError(w, r, err)
+			default:
+				app.internalServerError(w, r, err)
+			}
+			return
+		}
+
+		visible, err := app.canViewPost(ctx, userID, post)
+		if err != nil{
+			app.internalServerError(w, r, err)
+			return
+		}
+
+		if !visible{
+			app.notFoundError(w, r, store.ErrNotFound)
+			return
+		}
+	}
+
+	report := &store.Report{
+		ReporterID: &userID,
+		TargetType: payload.TargetType,
+		TargetID: payload.TargetID,
+		Reason: payload.Reason,
+		Details: payload.Details,
+	}
+
+	if err := app.store.Reports.Create(ctx, report); err != nil{
+		switch{
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundError(w, r, err)
+		case errors.Is(err, store.ErrConflict):
+			app.conflictError(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusCreated, report); err != nil{
+		app.internalServerError(w, r, err)
+	}
+}
+
+// getModerationQueueHandler godoc
+//
+//	@Summary		Fetches the moderation queue
+//	@Description	Lists reports oldest first. Only moderators can see the queue.
+//	@Tags			moderation
+//	@Accept			json
+//	@Produce		json
+//	@Param			status		query		string	false	"open (default), claimed or resolved"
+//	@Param			target_type	query		string	false	"post, comment or user"
+//	@Param			reason		query		string	false	"Reason code"
+//	@Param			claimed_by	query		int		false	"Moderator ID"
+//	@Param			limit		query		int		false	"Limit"
+//	@Param			offset		query		int		false	"Offset"
+//	@Success		200			{object}	[]store.Report
+//	@Failure		400			{object}	error	"Bad request"
+//	@Failure		403			{object}	error	"Not a moderator"
+//	@Failure		500			{object}	error	"Internal server error"
+//	@Security		ApiKeyAuth
+//	@Router			/moderation/queue [get]
+func (app *application) getModerationQueueHandler(w http.ResponseWriter, r *http.Request){
+	rq := store.ReportQuery{
+		Status: store.ReportOpen,
+		Limit: 20,
+		Offset: 0,
+	}
+
+	rq, err := rq.Parse(r)
+	if err != nil{
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(rq); err != nil{
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	reports, err := app.store.Reports.GetQueue(r.Context(), rq)
+	if err != nil{
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, reports); err != nil{
+		app.internalServerError(w, r, err)
+	}
+}
+
+// getReportHandler godoc
+//
+//	@Summary		Fetches a report
+//	@Description	Fetches a report with its moderation history
+//	@Tags			moderation
+//	@Accept			json
+//	@Produce		json
+//	@Param			reportID	path		int	true	"Report ID"
+//	@Success		200			{object}	store.Report
+//	@Failure		403			{object}	error	"Not a moderator"
+//	@Failure		404			{object}	error	"Report not found"
+//	@Failure		500			{object}	error	"Internal server error"
+//	@Security		ApiKeyAuth
+//	@Router			/moderation/reports/{reportID} [get]
+func (app *application) getReportHandler(w http.ResponseWriter, r *http.Request){
+	reportID, err := strconv.ParseInt(chi.URLParam(r, "reportID"), 10, 64)
+	if err != nil{
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	report, err := app.store.Reports.GetByID(r.Context(), reportID)
+	if err != nil{
+		switch{
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundError(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, report); err != nil{
+		app.internalServerError(w, r, err)
+	}
+}
+
+// claimReportHandler godoc
+//
+//	@Summary		Claims a report
+//	@Description	Assigns an open report to the caller so other moderators leave it alone
+//	@Tags			moderation
+//	@Accept			json
+//	@Produce		json
+//	@Param			reportID	path		int	true	"Report ID"
+//	@Success		200			{object}	store.Report
+//	@Failure		403			{object}	error	"Not a moderator"
+//	@Failure		404			{object}	error	"Report not found"
+//	@Failure		409			{object}	error	"Claimed by someone else or resolved"
+//	@Failure		500			{object}	error	"Internal server error"
+//	@Security		ApiKeyAuth
+//	@Router			/moderation/reports/{reportID}/claim [post]
+func (app *application) claimReportHandler(w http.ResponseWriter, r *http.Request){
+	reportID, err := strconv.ParseInt(chi.URLParam(r, "reportID"), 10, 64)
+	if err != nil{
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	ctx := r.Context()
+
+	before, err := app.store.Reports.GetByID(ctx, reportID)
+	if err != nil{
+		app.moderationError(w, r, err)
+		return
+	}
+
+	if err := app.store.Reports.Claim(ctx, reportID, getAuthUserID(r)); err != nil{
+		app.moderationError(w, r, err)
+		return
+	}
+
+	app.respondWithReport(w, r, store.AuditReportClaim, before)
+}
+
+// resolveReportHandler godoc
+//
+//	@Summary		Resolves a report
+//	@Description	Dismisses the report, hides the reported post or comment, or suspends the reported user. Every pending report against the same target is resolved with it, and the decision is recorded in the report's history.
+//	@Tags			moderation
+//	@Accept			json
+//	@Produce		json
+//	@Param			reportID	path		int						true	"Report ID"
+//	@Param			payload		body		ResolveReportPayload	true	"Decision"
+//	@Success		200			{object}	store.Report
+//	@Failure		400			{object}	error	"Bad request"
+//	@Failure		403			{object}	error	"Not a moderator"
+//	@Failure		404			{object}	error	"Report not found"
+//	@Failure		409			{object}	error	"Claimed by someone else or resolved"
+//	@Failure		500			{object}	error	"Internal server error"
+//	@Security		ApiKeyAuth
+//	@Router			/moderation/reports/{reportID}/resolve [post]
+func (app *application) resolveReportHandler(w http.ResponseWriter, r *http.Request){
+	reportID, err := strconv.ParseInt(chi.URLParam(r, "reportID"), 10, 64)
+	if err != nil{
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	var payload ResolveReportPayload
+	if err := readJSON(w, r, &payload); err != nil{
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil{
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	resolution := store.Resolution{
+		Action: payload.Action,
+		Note: strings.TrimSpace(payload.Note),
+		SuspendFor: time.Duration(payload.SuspendHours) * time.Hour,
+	}
+
+	ctx := r.Context()
+
+	before, err := app.store.Reports.GetByID(ctx, reportID)
+	if err != nil{
+		app.moderationError(w, r, err)
+		return
+	}
+
+	released, err := app.store.Reports.Resolve(ctx, reportID, getAuthUserID(r), resolution)
+	if err != nil{
+		app.moderationError(w, r, err)
+		return
+	}
+
+	// hiding, approving and suspending change the target's row
+	app.invalidateUser(ctx, before.TargetUserID)
+	if before.TargetType == store.ReportTargetPost{
+		app.invalidatePost(ctx, before.TargetID)
+	}
+
+	if released{
+		app.announceReleased(ctx, before)
+	}
+
+	app.respondWithReport(w, r, store.AuditReportResolve, before)
+}
+
+func (app *application) moderationError(w http.ResponseWriter, r *http.Request, err error){
+	switch{
+	case errors.Is(err, store.ErrNotFound):
+		app.notFoundError(w, r, err)
+	case errors.Is(err, store.ErrReportClaimed), errors.Is(err, store.ErrReportResolved):
+		app.logger.Warnw("moderation conflict", "method", r.Method, "path", r.URL.Path, "error", err.Error())
+		writeJSONError(w, http.StatusConflict, err.Error())
+	case errors.Is(err, store.ErrCannotHideUser):
+		app.badRequestError(w, r, err)
+	default:
+		app.internalServerError(w, r, err)
+	}
+}
+
+// respondWithReport reloads a report after a moderator's action, records the
+// action in the audit log and responds with the report.
+func (app *application) respondWithReport(w http.ResponseWriter, r *http.Request, action string, before *store.Report){
+	report, err := app.store.Reports.GetByID(r.Context(), before.ID)
+	if err != nil{
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	app.audit(r, &store.AuditEvent{
+		Action: action,
+		TargetType: store.AuditTargetReport,
+		TargetID: report.ID,
+		Changes: store.Diff(reportSnapshot(before), reportSnapshot(report)),
+	})
+
+	if err := app.jsonResponse(w, http.StatusOK, report); err != nil{
+		app.internalServerError(w, r, err)
+	}
+}
+
+// requireUserRole only lets users with at least the given site-wide role
+// through. It runs after activeAccountMiddleware.
+func (app *application) requireUserRole(role string) func(http.Handler) http.Handler{
+	return func(next http.Handler) http.Handler{
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request){
+			if !getAuthUser(r).HasRole(role){
+				app.forbiddenError(w, r, errors.New("you must be a "+role))
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"slices"
+
+	"github.com/nikhilkarle/social/internal/store"
+)
+
+// notify stores a notification. Failing to notify shouldn't fail the action
+// that caused it, so errors are only logged.
+func (app *application) notify(ctx context.Context, n *store.Notification){
+	if err := app.store.Notifications.Create(ctx, n); err != nil{
+		app.logger.Errorw("failed to create notification", "type", n.Type, "user_id", n.UserID, "error", err.Error())
+	}
+}
+
+// notifyMentions notifies users mentioned in post who weren't already
+// mentioned in previous, the entities before an edit.
+func (app *application) notifyMentions(ctx context.Context, post *store.Post, previous store.Entities){
+	notified := map[int64]bool{}
+	for _, e := range previous{
+		if e.Type == store.EntityMention{
+			notified[e.UserID] = true
+		}
+	}
+
+	for _, e := range post.Entities{
+		if e.Type != store.EntityMention || notified[e.UserID]{
+			continue
+		}
+		notified[e.UserID] = true
+
+		app.notify(ctx, &store.Notification{
+			UserID: e.UserID,
+			ActorID: post.UserID,
+			Type: store.NotificationMention,
+			PostID: &post.ID,
+		})
+	}
+}
+
+// getNotificationsHandler godoc
+//
+//	@Summary		Fetches notifications
+//	@Description	Fetches the caller's notifications, grouped, newest first
+//	@Tags			notifications
+//	@Accept			json
+//	@Produce		json
+//	@Param			unread	query		bool	false	"Only unread"
+//	@Param			limit	query		int		false	"Limit"
+//	@Param			offset	query		int		false	"Offset"
+//	@Success		200		{object}	[]store.NotificationGroup
+//	@Failure		400		{object}	error	"Bad request"
+//	@Failure		500		{object}	error	"Internal server error"
+//	@Security		ApiKeyAuth
+//	@Router			/notifications [get]
+func (app *application) getNotificationsHandler(w http.ResponseWriter, r *http.Request){
+	nq := store.NotificationQuery{
+		Limit: 20,
+		Offset: 0,
+	}
+
+	nq, err := nq.Parse(r)
+	if err != nil{
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(nq); err != nil{
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	groups, err := app.store.Notifications.List(r.Context(), getAuthUserID(r), nq)
+	if err != nil{
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, groups); err != nil{
+		app.internalServerError(w, r, err)
+	}
+}
+
+type MarkNotificationsReadPayload struct{
+	IDs []int64 `json:"ids" validate:"max=100"`
+	All bool `json:"all"`
+}
+
+// markNotificationsReadHandler godoc
+//
+//	@Summary		Marks notifications as read
+//	@Description	Marks the given notifications, or all of them, as read
+//	@Tags			notifications
+//	@Accept			json
+//	@Produce		json
+//	@Param			payload	body		MarkNotificationsReadPayload	true	"Notifications to mark"
+//	@Success		204		{string}	string	"Notifications marked as read"
+//	@Failure		400		{object}	error	"Bad request"
+//	@Failure		500		{object}	error	"Internal server error"
+//	@Security		ApiKeyAuth
+//	@Router			/notifications/read [post]
+func (app *application) markNotificationsReadHandler(w http.ResponseWriter, r *http.Request){
+	var payload MarkNotificationsReadPayload
+	if err := readJSON(w, r, &payload); err != nil{
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil{
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	if payload.All == (len(payload.IDs) > 0){
+		app.badRequestError(w, r, errors.New("set either ids or all"))
+		return
+	}
+
+	ctx := r.Context()
+	userID := getAuthUserID(r)
+
+	var err error
+	if payload.All{
+		err = app.store.Notifications.MarkAllRead(ctx, userID)
+	} else{
+		err = app.store.Notifications.MarkRead(ctx, userID, payload.IDs)
+	}
+
+	if err != nil{
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// getNotificationPreferencesHandler godoc
+//
+//	@Summary		Fetches notification preferences
+//	@Description	Fetches which notification types the caller receives
+//	@Tags			notifications
+//	@Accept			json
+//	@Produce		json
+//	@Success		200	{object}	map[string]bool
+//	@Failure		500	{object}	error	"Internal server error"
+//	@Security		ApiKeyAuth
+//	@Router			/notifications/preferences [get]
+func (app *application) getNotificationPreferencesHandler(w http.ResponseWriter, r *http.Request){
+	prefs, err := app.store.Notifications.GetPreferences(r.Context(), getAuthUserID(r))
+	if err != nil{
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, prefs); err != nil{
+		app.internalServerError(w, r, err)
+	}
+}
+
+// updateNotificationPreferencesHandler godoc
+//
+//	@Summary		Updates notification preferences
+//	@Description	Turns notification types on or off; types left out are unchanged
+//	@Tags			notifications
+//	@Accept			json
+//	@Produce		json
+//	@Param			payload	body		map[string]bool	true	"Enabled per type"
+//	@Success		200		{object}	map[string]bool
+//	@Failure		400		{object}	error	"Bad request"
+//	@Failure		500		{object}	error	"Internal server error"
+//	@Security		ApiKeyAuth
+//	@Router			/notifications/preferences [put]
+func (app *application) updateNotificationPreferencesHandler(w http.ResponseWriter, r *http.Request){
+	var payload map[string]bool
+	if err := readJSON(w, r, &payload); err != nil{
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	for t := range payload{
+		if !slices.Contains(store.NotificationTypes, t){
+			app.badRequestError(w, r, errors.New("unknown notification type "+t))
+			return
+		}
+	}
+
+	ctx := r.Context()
+	userID := getAuthUserID(r)
+
+	if err := app.store.Notifications.SetPreferences(ctx, userID, payload); err != nil{
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	prefs, err := app.store.Notifications.GetPreferences(ctx, userID)
+	if err != nil{
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, prefs); err != nil{
+		app.internalServerError(w, r, err)
+	}
+}
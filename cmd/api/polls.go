@@ -0,0 +1,113 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/nikhilkarle/social/internal/store"
+)
+
+type CreatePollPayload struct{
+	Options []string `json:"options" validate:"required,min=2,max=4,dive,required,max=80"`
+	// ExpiresInMinutes is how long the poll stays open, at most a week
+	ExpiresInMinutes int `json:"expires_in_minutes" validate:"required,gte=5,lte=10080"`
+	// HideResults keeps results from voters until they vote or the poll closes
+	HideResults bool `json:"hide_results"`
+}
+
+type VotePollPayload struct{
+	OptionID int64 `json:"option_id" validate:"required,gt=0"`
+}
+
+// newPoll validates the payload beyond what the tags cover and builds the poll
+// to store with the post.
+func newPoll(payload *CreatePollPayload) (*store.Poll, error){
+	poll := &store.Poll{
+		HideResults: payload.HideResults,
+		ExpiresAt: time.Now().Add(time.Duration(payload.ExpiresInMinutes) * time.Minute).UTC().Format(time.RFC3339),
+	}
+
+	seen := map[string]bool{}
+	for _, text := range payload.Options{
+		text = strings.TrimSpace(text)
+		key := strings.ToLower(text)
+
+		if text == ""{
+			return nil, errors.New("poll options can't be blank")
+		}
+
+		if seen[key]{
+			return nil, errors.New("poll options must be different")
+		}
+		seen[key] = true
+
+		poll.Options = append(poll.Options, store.PollOption{Text: text})
+	}
+
+	return poll, nil
+}
+
+// votePollHandler godoc
+//
+//	@Summary		Votes in a poll
+//	@Description	Votes for one of the options of the post's poll. Each user votes once.
+//	@Tags			posts
+//	@Accept			json
+//	@Produce		json
+//	@Param			postID	path		int				true	"Post ID"
+//	@Param			payload	body		VotePollPayload	true	"Option to vote for"
+//	@Success		201		{object}	store.Poll
+//	@Failure		400		{object}	error	"Bad request or poll closed"
+//	@Failure		404		{object}	error	"Post has no poll"
+//	@Failure		409		{object}	error	"Already voted"
+//	@Failure		500		{object}	error	"Internal server error"
+//	@Security		ApiKeyAuth
+//	@Router			/posts/{postID}/poll/votes [post]
+func (app *application) votePollHandler(w http.ResponseWriter, r *http.Request){
+	post := getPostFromCtx(r)
+
+	var payload VotePollPayload
+	if err := readJSON(w, r, &payload); err != nil{
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil{
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	ctx := r.Context()
+	userID := getAuthUserID(r)
+
+	vote := &store.PollVote{
+		PostID: post.ID,
+		OptionID: payload.OptionID,
+		UserID: userID,
+	}
+
+	if err := app.store.Polls.Vote(ctx, vote); err != nil{
+		switch{
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundError(w, r, err)
+		case errors.Is(err, store.ErrPollClosed), errors.Is(err, store.ErrInvalidPollOption):
+			app.badRequestError(w, r, err)
+		case errors.Is(err, store.ErrConflict):
+			app.conflictError(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if err := app.attachPostDetails(ctx, userID, post); err != nil{
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusCreated, post.Poll); err != nil{
+		app.internalServerError(w, r, err)
+	}
+}
@@ -4,9 +4,11 @@ import (
 	"context"
 	"errors"
 	"net/http"
+	"slices"
 	"strconv"
 
 	"github.com/go-chi/chi/v5"
+	"github.com/nikhilkarle/social/internal/markdown"
 	"github.com/nikhilkarle/social/internal/store"
 )
 
@@ -15,8 +17,15 @@ const postCtx postKey = "post"
 
 type CreatePostPayload struct{
 	Title string `json:"title" validate:"required,max=100"`
+	// Content is Markdown; see package markdown for the supported subset
 	Content string `json:"content" validate:"required,max=1000"`
-	Tags []string `json:"tags"`
+	Tags []string `json:"tags" validate:"max=5,dive,max=50,tag"`
+	// CommunityID publishes the post to a community the author is a member of
+	// instead of to their followers
+	CommunityID *int64 `json:"community_id" validate:"omitempty,gt=0"`
+	Poll *CreatePollPayload `json:"poll"`
+	// MediaIDs are uploads from POST /media to attach, in display order
+	MediaIDs []int64 `json:"media_ids" validate:"max=4,unique,dive,gt=0"`
 }
 
 func (app *application) createPostHandler(w http.ResponseWriter, r *http.Request){
@@ -26,6 +35,9 @@ func (app *application) createPostHandler(w http.ResponseWriter, r *http.Request
 		return
 	}
 
+	// hashtags in the content count towards the tag limit
+	payload.Tags = store.MergeHashtags(payload.Tags, payload.Content)
+
 	if err := Validate.Struct(payload); err != nil{
 		app.badRequestError(w,r,err)
 		return
@@ -34,19 +46,75 @@ func (app *application) createPostHandler(w http.ResponseWriter, r *http.Request
 	post := &store.Post{
 		Title: payload.Title,
 		Content: payload.Content,
+		ContentHTML: markdown.Render(payload.Content),
 		Tags: payload.Tags,
 		//TODO: change afer auth
 		UserID: 1,
+		CommunityID: payload.CommunityID,
+	}
+
+	if payload.Poll != nil{
+		poll, err := newPoll(payload.Poll)
+		if err != nil{
+			app.badRequestError(w, r, err)
+			return
+		}
+		post.Poll = poll
+	}
+
+	for _, id := range payload.MediaIDs{
+		post.Media = append(post.Media, store.Media{ID: id})
 	}
 
 	ctx := r.Context()
 
+	if post.CommunityID != nil{
+		member, err := app.isCommunityMember(ctx, *post.CommunityID, post.UserID)
+		if err != nil{
+			app.internalServerError(w, r, err)
+			return
+		}
+
+		if !member{
+			app.forbiddenError(w, r, errNotCommunityMember)
+			return
+		}
+	}
+
+	screening, err := app.screenContent(ctx, post.UserID, store.ReportTargetPost, post.Title+"\n"+post.Content)
+	if err != nil{
+		app.screeningError(w, r, err)
+		return
+	}
+	post.Screening = screening
+
 	if err := app.store.Posts.Create(ctx, post); err != nil{
-		app.internalServerError(w,r,err)
+		switch{
+		case errors.Is(err, store.ErrInvalidMedia):
+			app.badRequestError(w, r, err)
+		default:
+			app.internalServerError(w,r,err)
+		}
 		return
 	}
 
-	if err := app.jsonResponse(w, http.StatusCreated, post); err != nil{
+	for i := range post.Media{
+		app.mediaURLs(&post.Media[i])
+	}
+
+	app.queueLinkPreviews(ctx, post.Content)
+
+	// held posts are only announced once approved, and shadow banned users'
+	// posts never are
+	status := http.StatusAccepted
+	if post.HiddenAt == nil{
+		if getAuthUser(r).Status != store.AccountShadowBanned{
+			app.notifyMentions(ctx, post, nil)
+		}
+		status = http.StatusCreated
+	}
+
+	if err := app.jsonResponse(w, status, post); err != nil{
 		app.internalServerError(w,r,err)
 		return
 	}
@@ -55,7 +123,9 @@ func (app *application) createPostHandler(w http.ResponseWriter, r *http.Request
 func (app *application) getPostHandler(w http.ResponseWriter, r *http.Request){
 	post := getPostFromCtx(r)
 
-	comments, err := app.store.Comments.GetByPostID(r.Context(), post.ID)
+	moderator := getAuthUser(r).HasRole(store.UserRoleModerator)
+
+	comments, err := app.store.Comments.GetByPostID(r.Context(), post.ID, getAuthUserID(r), moderator)
 	if err != nil{
 		app.internalServerError(w,r,err)
 		return
@@ -63,6 +133,11 @@ func (app *application) getPostHandler(w http.ResponseWriter, r *http.Request){
 
 	post.Comments = comments
 
+	if err := app.attachPostDetails(r.Context(), getAuthUserID(r), post); err != nil{
+		app.internalServerError(w,r,err)
+		return
+	}
+
 	if err := app.jsonResponse(w, http.StatusOK, post); err != nil{
 		app.internalServerError(w,r,err)
 		return
@@ -83,6 +158,7 @@ func (app *application) deletePostHandler(w http.ResponseWriter, r *http.Request
 	ctx := r.Context()
 
 	err = app.store.Posts.Delete(ctx, postID)
+	app.invalidatePost(ctx, postID)
 	
 	if err != nil {
 		switch{
@@ -95,12 +171,22 @@ func (app *application) deletePostHandler(w http.ResponseWriter, r *http.Request
 		return
 	}
 
+	post := getPostFromCtx(r)
+	app.audit(r, &store.AuditEvent{
+		Action: store.AuditPostDelete,
+		TargetType: store.AuditTargetPost,
+		TargetID: post.ID,
+		CommunityID: post.CommunityID,
+		Changes: store.Diff(postSnapshot(post), nil),
+	})
+
 	w.WriteHeader(http.StatusNoContent)
 }
 
 type UpdatePostPayload struct{
 	Title *string `json:"title" validate:"omitempty,max=100"`
 	Content *string `json:"content" validate:"omitempty,max=1000"`
+	Tags *[]string `json:"tags" validate:"omitempty,max=5,dive,max=50,tag"`
 }
 
 // UpdatePost godoc
@@ -113,9 +199,11 @@ type UpdatePostPayload struct{
 //	@Param			id		path		int					true	"Post ID"
 //	@Param			payload	body		UpdatePostPayload	true	"Post payload"
 //	@Success		200		{object}	store.Post
+//	@Success		202		{object}	store.Post	"Held for review by the content filter"
 //	@Failure		400		{object}	error	"Bad request"
 //	@Failure		401		{object}	error	"Unauthorized"
 //	@Failure		404		{object}	error	"Post not found"
+//	@Failure		422		{object}	error	"Rejected by the content filter"
 //	@Failure		500		{object}	error	"Internal server error"
 //	@Security		ApiKeyAuth
 //	@Router			/posts/{id} [put]
@@ -128,6 +216,29 @@ func (app *application) updatePostHandler(w http.ResponseWriter, r *http.Request
 		return
 	}
 
+	// hashtags follow the content: ones removed from it are dropped from the
+	// tags unless the tags are being replaced outright, and new ones are added
+	if payload.Tags != nil || payload.Content != nil{
+		tags := post.Tags
+		content := post.Content
+
+		if payload.Content != nil{
+			content = *payload.Content
+		}
+
+		if payload.Tags != nil{
+			tags = *payload.Tags
+		} else{
+			old := store.Hashtags(post.Content)
+			tags = slices.DeleteFunc(slices.Clone(tags), func(tag string) bool{
+				return slices.Contains(old, tag)
+			})
+		}
+
+		tags = store.MergeHashtags(tags, content)
+		payload.Tags = &tags
+	}
+
 	if err := Validate.Struct(payload); err != nil{
 		app.badRequestError(w, r, err)
 		return
@@ -141,12 +252,54 @@ func (app *application) updatePostHandler(w http.ResponseWriter, r *http.Request
 		post.Title = *payload.Title
 	}
 
-	if err := app.store.Posts.Update(r.Context(), post); err != nil{
+	if payload.Tags != nil{
+		post.Tags = *payload.Tags
+	}
+
+	// re-rendered even when the content is unchanged so posts pick up
+	// renderer changes when edited
+	post.ContentHTML = markdown.Render(post.Content)
+
+	// edits are screened like new posts, so the filter can't be sidestepped
+	// by posting clean text first
+	if payload.Title != nil || payload.Content != nil{
+		screening, err := app.screenContent(r.Context(), post.UserID, store.ReportTargetPost, post.Title+"\n"+post.Content)
+		if err != nil{
+			app.screeningError(w, r, err)
+			return
+		}
+		post.Screening = screening
+	}
+
+	previous := post.Entities
+
+	err := app.store.Posts.Update(r.Context(), post)
+	// a failed update may mean the cached post was out of date
+	app.invalidatePost(r.Context(), post.ID)
+
+	if err != nil{
 		app.internalServerError(w,r,err)
 		return
 	}
 
-	if err := app.jsonResponse(w, http.StatusOK, post); err != nil{
+	app.queueLinkPreviews(r.Context(), post.Content)
+
+	// hidden posts are announced once approved, and shadow banned users'
+	// posts never are
+	status := http.StatusAccepted
+	if post.HiddenAt == nil{
+		if getAuthUser(r).Status != store.AccountShadowBanned{
+			app.notifyMentions(r.Context(), post, previous)
+		}
+		status = http.StatusOK
+	}
+
+	if err := app.attachPostDetails(r.Context(), getAuthUserID(r), post); err != nil{
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, status, post); err != nil{
 		app.internalServerError(w,r,err)
 	}
 }
@@ -163,7 +316,7 @@ func (app *application) postContextMiddleware(next http.Handler) http.Handler{
 		
 		ctx := r.Context()
 		
-		post, err := app.store.Posts.GetByID(ctx, postID)
+		post, err := app.getPost(ctx, postID)
 
 		if err != nil {
 			switch{
@@ -176,6 +329,18 @@ func (app *application) postContextMiddleware(next http.Handler) http.Handler{
 			return
 		}
 
+		// posts in private communities don't exist for non-members
+		visible, err := app.canViewPost(ctx, getAuthUserID(r), post)
+		if err != nil{
+			app.internalServerError(w, r, err)
+			return
+		}
+
+		if !visible{
+			app.notFoundError(w, r, store.ErrNotFound)
+			return
+		}
+
 		ctx = context.WithValue(ctx, postCtx, post)
 
 		next.ServeHTTP(w, r.WithContext(ctx))
@@ -187,3 +352,51 @@ func getPostFromCtx(r *http.Request) *store.Post{
 	return post
 }
 
+// attachPostDetails loads the polls, media and link previews of the given
+// posts, with poll results as userID may see them.
+func (app *application) attachPostDetails(ctx context.Context, userID int64, posts ...*store.Post) error{
+	if len(posts) == 0{
+		return nil
+	}
+
+	ids := make([]int64, len(posts))
+	for i, p := range posts{
+		ids[i] = p.ID
+	}
+
+	polls, err := app.store.Polls.GetByPostIDs(ctx, userID, ids)
+	if err != nil{
+		return err
+	}
+
+	media, err := app.store.Media.GetByPostIDs(ctx, ids)
+	if err != nil{
+		return err
+	}
+
+	previews, err := app.store.LinkPreviews.GetByPostIDs(ctx, ids)
+	if err != nil{
+		return err
+	}
+
+	for _, p := range posts{
+		p.Poll = polls[p.ID]
+		p.Media = media[p.ID]
+		p.LinkPreviews = previews[p.ID]
+
+		for i := range p.Media{
+			app.mediaURLs(&p.Media[i])
+		}
+	}
+
+	return nil
+}
+
+// feedPosts returns pointers to the posts of a feed page for attachPostDetails.
+func feedPosts(feed []store.PostWithMetadata) []*store.Post{
+	posts := make([]*store.Post, len(feed))
+	for i := range feed{
+		posts[i] = &feed[i].Post
+	}
+	return posts
+}
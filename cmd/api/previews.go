@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+
+	"github.com/nikhilkarle/social/internal/store"
+	"github.com/nikhilkarle/social/internal/unfurl"
+)
+
+// linkPreviewQueueSize bounds pending fetches; when it's full new URLs are
+// skipped and picked up the next time a post links them.
+const linkPreviewQueueSize = 1024
+
+// queueLinkPreviews schedules fetches for the links in content that have no
+// fresh preview. Previews show up on the post once fetched.
+func (app *application) queueLinkPreviews(ctx context.Context, content string){
+	urls := unfurl.ExtractURLs(content)
+	if len(urls) == 0{
+		return
+	}
+
+	stale, err := app.store.LinkPreviews.Stale(ctx, urls)
+	if err != nil{
+		app.logger.Errorw("link preview lookup failed", "error", err.Error())
+		return
+	}
+
+	for _, url := range stale{
+		select{
+		case app.linkPreviews <- url:
+		default:
+			app.logger.Warnw("link preview queue full", "url", url)
+		}
+	}
+}
+
+// fetchLinkPreviews fetches queued URLs until ctx is done.
+func (app *application) fetchLinkPreviews(ctx context.Context, fetcher *unfurl.Fetcher){
+	for{
+		select{
+		case <-ctx.Done():
+			return
+		case url := <-app.linkPreviews:
+			app.fetchLinkPreview(ctx, fetcher, url)
+		}
+	}
+}
+
+func (app *application) fetchLinkPreview(ctx context.Context, fetcher *unfurl.Fetcher, url string){
+	fetchCtx, cancel := context.WithTimeout(ctx, unfurl.DefaultTimeout)
+	defer cancel()
+
+	p, err := fetcher.Fetch(fetchCtx, url)
+	if err != nil{
+		app.logger.Infow("link preview fetch failed", "url", url, "error", err.Error())
+
+		if err := app.store.LinkPreviews.SaveFailure(ctx, url); err != nil{
+			app.logger.Errorw("saving link preview failure", "url", url, "error", err.Error())
+		}
+		return
+	}
+
+	preview := &store.LinkPreview{
+		URL: url,
+		Title: p.Title,
+		Description: p.Description,
+		ImageURL: p.ImageURL,
+		SiteName: p.SiteName,
+	}
+
+	if err := app.store.LinkPreviews.Save(ctx, preview); err != nil{
+		app.logger.Errorw("saving link preview", "url", url, "error", err.Error())
+	}
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/nikhilkarle/social/internal/ratelimit"
+	"github.com/nikhilkarle/social/internal/redis"
+)
+
+// newLimiter builds the limiter the config asks for, or nil when rate
+// limiting is off.
+func newLimiter(cfg rateLimitConfig, client *redis.Client) (ratelimit.Limiter, error){
+	if !cfg.enabled{
+		return nil, nil
+	}
+
+	if cfg.algorithm != ratelimit.FixedWindow && cfg.algorithm != ratelimit.TokenBucket{
+		return nil, fmt.Errorf("unknown rate limit algorithm %q", cfg.algorithm)
+	}
+
+	switch cfg.store{
+	case "memory":
+		return ratelimit.New(cfg.algorithm), nil
+	case "redis":
+		return ratelimit.NewRedis(client, cfg.algorithm, "ratelimit:"), nil
+	}
+
+	return nil, fmt.Errorf("unknown rate limit store %q", cfg.store)
+}
+
+// rateLimit limits each caller to limit on the routes it wraps, keyed by IP.
+// name keeps the quotas of different route groups apart. If the limiter
+// fails, requests are let through rather than taking the API down with it.
+func (app *application) rateLimit(name string, limit ratelimit.Limit) func(http.Handler) http.Handler{
+	return func(next http.Handler) http.Handler{
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request){
+			if app.limiter == nil{
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			//TODO: key on the user once requests carry real credentials; until
+			// then every request is the same user and would share one quota
+			key := name + ":ip:" + clientIP(r)
+
+			res, err := app.limiter.Allow(r.Context(), key, limit)
+			if err != nil{
+				app.logger.Errorw("rate limiter failed", "key", key, "error", err.Error())
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			// RateLimit-* headers as in the IETF httpapi-ratelimit-headers draft
+			w.Header().Set("RateLimit-Limit", strconv.Itoa(res.Limit))
+			w.Header().Set("RateLimit-Remaining", strconv.Itoa(res.Remaining))
+			w.Header().Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(res.Reset)))
+
+			if !res.Allowed{
+				app.rateLimitExceededError(w, r, res.RetryAfter)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// ceilSeconds rounds d up to whole seconds, and at least one.
+func ceilSeconds(d time.Duration) int{
+	return max(1, int(math.Ceil(d.Seconds())))
+}
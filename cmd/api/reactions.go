@@ -0,0 +1,95 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/nikhilkarle/social/internal/store"
+)
+
+type ReactPayload struct{
+	Kind string `json:"kind" validate:"required,oneof=like love laugh wow sad angry"`
+}
+
+// ReactToPost godoc
+//
+//	@Summary		Reacts to a post
+//	@Description	Sets the caller's reaction on a post, replacing any earlier one
+//	@Tags			posts
+//	@Accept			json
+//	@Produce		json
+//	@Param			postID	path		int				true	"Post ID"
+//	@Param			payload	body		ReactPayload	true	"Reaction"
+//	@Success		200		{object}	store.Reaction
+//	@Failure		400		{object}	error	"Bad request"
+//	@Failure		404		{object}	error	"Post not found"
+//	@Failure		500		{object}	error	"Internal server error"
+//	@Security		ApiKeyAuth
+//	@Router			/posts/{postID}/reactions [put]
+func (app *application) reactToPostHandler(w http.ResponseWriter, r *http.Request){
+	post := getPostFromCtx(r)
+
+	var payload ReactPayload
+	if err := readJSON(w, r, &payload); err != nil{
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil{
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	reaction := &store.Reaction{
+		PostID: post.ID,
+		UserID: getAuthUserID(r),
+		Kind: payload.Kind,
+	}
+
+	ctx := r.Context()
+
+	if err := app.store.Reactions.React(ctx, reaction); err != nil{
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	app.notify(ctx, &store.Notification{
+		UserID: post.UserID,
+		ActorID: reaction.UserID,
+		Type: store.NotificationReaction,
+		PostID: &post.ID,
+	})
+
+	if err := app.jsonResponse(w, http.StatusOK, reaction); err != nil{
+		app.internalServerError(w, r, err)
+	}
+}
+
+// UnreactToPost godoc
+//
+//	@Summary		Removes a reaction
+//	@Description	Removes the caller's reaction from a post
+//	@Tags			posts
+//	@Accept			json
+//	@Produce		json
+//	@Param			postID	path		int		true	"Post ID"
+//	@Success		204		{string}	string	"Reaction removed"
+//	@Failure		404		{object}	error	"Reaction not found"
+//	@Failure		500		{object}	error	"Internal server error"
+//	@Security		ApiKeyAuth
+//	@Router			/posts/{postID}/reactions [delete]
+func (app *application) unreactToPostHandler(w http.ResponseWriter, r *http.Request){
+	post := getPostFromCtx(r)
+
+	if err := app.store.Reactions.Unreact(r.Context(), post.ID, getAuthUserID(r)); err != nil{
+		switch{
+		case errors.Is(err, store.ErrNotFound):
+			app.notFoundError(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// parseTrustedProxies reads a comma-separated list of proxy addresses and
+// CIDR ranges.
+func parseTrustedProxies(s string) ([]netip.Prefix, error){
+	var proxies []netip.Prefix
+
+	for _, entry := range strings.Split(s, ","){
+		entry = strings.TrimSpace(entry)
+		if entry == ""{
+			continue
+		}
+
+		if strings.Contains(entry, "/"){
+			prefix, err := netip.ParsePrefix(entry)
+			if err != nil{
+				return nil, fmt.Errorf("trusted proxy %q: %w", entry, err)
+			}
+			proxies = append(proxies, prefix.Masked())
+			continue
+		}
+
+		addr, err := netip.ParseAddr(entry)
+		if err != nil{
+			return nil, fmt.Errorf("trusted proxy %q: %w", entry, err)
+		}
+		addr = addr.Unmap()
+		proxies = append(proxies, netip.PrefixFrom(addr, addr.BitLen()))
+	}
+
+	return proxies, nil
+}
+
+// realIPMiddleware replaces RemoteAddr with the client address forwarded by a
+// trusted proxy. Headers from anyone else are ignored, since they could pick
+// the address that rate limits and the audit log see.
+func (app *application) realIPMiddleware(next http.Handler) http.Handler{
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request){
+		if ip := app.forwardedIP(r); ip != ""{
+			r.RemoteAddr = ip
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// forwardedIP returns the client address the proxies in front of the API
+// report, or "" when the request didn't come through a trusted proxy.
+// X-Forwarded-For is read from the right, skipping trusted proxies, so
+// addresses the client put in the header itself are never used.
+func (app *application) forwardedIP(r *http.Request) string{
+	if !app.trustedProxy(clientIP(r)){
+		return ""
+	}
+
+	if values := r.Header.Values("X-Forwarded-For"); len(values) > 0{
+		hops := strings.Split(strings.Join(values, ","), ",")
+
+		for i := len(hops) - 1; i >= 0; i--{
+			addr, err := netip.ParseAddr(strings.TrimSpace(hops[i]))
+			if err != nil{
+				return ""
+			}
+
+			if i == 0 || !app.trustedProxy(addr.String()){
+				return addr.Unmap().String()
+			}
+		}
+	}
+
+	if addr, err := netip.ParseAddr(strings.TrimSpace(r.Header.Get("X-Real-IP"))); err == nil{
+		return addr.Unmap().String()
+	}
+
+	return ""
+}
+
+func (app *application) trustedProxy(ip string) bool{
+	addr, err := netip.ParseAddr(ip)
+	if err != nil{
+		return false
+	}
+	addr = addr.Unmap()
+
+	for _, prefix := range app.config.trustedProxies{
+		if prefix.Contains(addr){
+			return true
+		}
+	}
+
+	return false
+}
+
+// clientIP returns the caller's address; realIPMiddleware has already
+// replaced RemoteAddr with the forwarded one when a trusted proxy sent one.
+func clientIP(r *http.Request) string{
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil{
+		return r.RemoteAddr
+	}
+	return host
+}
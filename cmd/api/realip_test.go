@@ -0,0 +1,102 @@
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestForwardedIP(t *testing.T){
+	proxies, err := parseTrustedProxies("10.0.0.0/8, 192.168.1.5")
+	if err != nil{
+		t.Fatal(err)
+	}
+
+	app := &application{config: config{trustedProxies: proxies}}
+
+	tests := []struct{
+		name string
+		remoteAddr string
+		forwardedFor []string
+		realIP string
+		want string
+	}{
+		{
+			name: "untrusted peer's headers are ignored",
+			remoteAddr: "203.0.113.7:5000",
+			forwardedFor: []string{"198.51.100.1"},
+			realIP: "198.51.100.2",
+			want: "",
+		},
+		{
+			name: "trusted proxy",
+			remoteAddr: "10.1.2.3:5000",
+			forwardedFor: []string{"198.51.100.1"},
+			want: "198.51.100.1",
+		},
+		{
+			name: "spoofed hops left of the client are skipped",
+			remoteAddr: "10.1.2.3:5000",
+			forwardedFor: []string{"1.2.3.4, 198.51.100.1"},
+			want: "198.51.100.1",
+		},
+		{
+			name: "chained trusted proxies",
+			remoteAddr: "192.168.1.5:5000",
+			forwardedFor: []string{"198.51.100.1, 10.9.9.9", "10.0.0.1"},
+			want: "198.51.100.1",
+		},
+		{
+			name: "only proxies forwarded",
+			remoteAddr: "10.1.2.3:5000",
+			forwardedFor: []string{"10.0.0.2"},
+			want: "10.0.0.2",
+		},
+		{
+			name: "garbage in the header",
+			remoteAddr: "10.1.2.3:5000",
+			forwardedFor: []string{"not-an-ip"},
+			want: "",
+		},
+		{
+			name: "X-Real-IP from a trusted proxy",
+			remoteAddr: "10.1.2.3:5000",
+			realIP: "2001:db8::1",
+			want: "2001:db8::1",
+		},
+		{
+			name: "IPv4-mapped peer",
+			remoteAddr: "[::ffff:10.1.2.3]:5000",
+			forwardedFor: []string{"198.51.100.1"},
+			want: "198.51.100.1",
+		},
+	}
+
+	for _, tt := range tests{
+		t.Run(tt.name, func(t *testing.T){
+			r := httptest.NewRequest("GET", "/v1/health", nil)
+			r.RemoteAddr = tt.remoteAddr
+			for _, v := range tt.forwardedFor{
+				r.Header.Add("X-Forwarded-For", v)
+			}
+			if tt.realIP != ""{
+				r.Header.Set("X-Real-IP", tt.realIP)
+			}
+
+			if got := app.forwardedIP(r); got != tt.want{
+				t.Errorf("forwardedIP = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseTrustedProxies(t *testing.T){
+	if proxies, err := parseTrustedProxies(""); err != nil || len(proxies) != 0{
+		t.Errorf("parseTrustedProxies(\"\") = %v, %v; want none", proxies, err)
+	}
+
+	for _, bad := range []string{"10.0.0.0/33", "proxy.internal", "10.0.0"}{
+		if _, err := parseTrustedProxies(bad); err == nil{
+			t.Errorf("parseTrustedProxies(%q) succeeded", bad)
+		}
+	}
+}
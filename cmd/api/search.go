@@ -0,0 +1,107 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/nikhilkarle/social/internal/store"
+)
+
+// searchPostsHandler godoc
+//
+//	@Summary		Searches posts
+//	@Description	Full-text search over post titles and content, best matches first
+//	@Tags			search
+//	@Accept			json
+//	@Produce		json
+//	@Param			q		query		string	true	"Query, in websearch syntax"
+//	@Param			author	query		string	false	"Author username"
+//	@Param			tag		query		string	false	"Tag"
+//	@Param			since	query		string	false	"Since"
+//	@Param			until	query		string	false	"Until"
+//	@Param			limit	query		int		false	"Limit"
+//	@Param			offset	query		int		false	"Offset"
+//	@Success		200		{object}	[]store.PostSearchResult
+//	@Failure		400		{object}	error	"Bad request"
+//	@Failure		500		{object}	error	"Internal server error"
+//	@Security		ApiKeyAuth
+//	@Router			/search/posts [get]
+func (app *application) searchPostsHandler(w http.ResponseWriter, r *http.Request){
+	sq := store.PostSearchQuery{
+		Limit: 20,
+		Offset: 0,
+	}
+
+	sq, err := sq.Parse(r)
+	if err != nil{
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(sq); err != nil{
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	results, err := app.store.Posts.Search(r.Context(), getAuthUserID(r), sq)
+	if err != nil{
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	posts := make([]*store.Post, len(results))
+	for i := range results{
+		posts[i] = &results[i].Post
+	}
+
+	if err := app.attachPostDetails(r.Context(), getAuthUserID(r), posts...); err != nil{
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, results); err != nil{
+		app.internalServerError(w, r, err)
+	}
+}
+
+// searchUsersHandler godoc
+//
+//	@Summary		Searches users
+//	@Description	Fuzzy search over usernames and display names
+//	@Tags			search
+//	@Accept			json
+//	@Produce		json
+//	@Param			q		query		string	true	"Query"
+//	@Param			limit	query		int		false	"Limit"
+//	@Param			offset	query		int		false	"Offset"
+//	@Success		200		{object}	[]store.UserSearchResult
+//	@Failure		400		{object}	error	"Bad request"
+//	@Failure		500		{object}	error	"Internal server error"
+//	@Security		ApiKeyAuth
+//	@Router			/search/users [get]
+func (app *application) searchUsersHandler(w http.ResponseWriter, r *http.Request){
+	sq := store.UserSearchQuery{
+		Limit: 20,
+		Offset: 0,
+	}
+
+	sq, err := sq.Parse(r)
+	if err != nil{
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(sq); err != nil{
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	results, err := app.store.Users.Search(r.Context(), getAuthUserID(r), sq)
+	if err != nil{
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, results); err != nil{
+		app.internalServerError(w, r, err)
+	}
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/nikhilkarle/social/internal/events"
+)
+
+// streamHeartbeatInterval keeps idle streams from being closed by proxies.
+const streamHeartbeatInterval = 15 * time.Second
+
+// streamHandler godoc
+//
+//	@Summary		Streams live events
+//	@Description	Server-Sent Events stream of the caller's new feed items, notifications and direct messages. Reconnecting clients can send Last-Event-ID to receive events they missed.
+//	@Tags			stream
+//	@Produce		text/event-stream
+//	@Param			Last-Event-ID	header		string	false	"ID of the last event received"
+//	@Success		200				{string}	string	"Event stream"
+//	@Failure		500				{object}	error	"Internal server error"
+//	@Security		ApiKeyAuth
+//	@Router			/stream [get]
+func (app *application) streamHandler(w http.ResponseWriter, r *http.Request){
+	rc := http.NewResponseController(w)
+
+	// the server's WriteTimeout would otherwise cut the stream after 30s
+	if err := rc.SetWriteDeadline(time.Time{}); err != nil{
+		app.internalServerError(w, r, fmt.Errorf("stream: %w", err))
+		return
+	}
+
+	lastEventID := r.Header.Get("Last-Event-ID")
+	if lastEventID == ""{
+		lastEventID = r.URL.Query().Get("last_event_id")
+	}
+
+	sub := app.broker.Subscribe(events.UserTopic(getAuthUserID(r)), lastEventID)
+	defer app.broker.Unsubscribe(sub)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	for _, e := range sub.Replay{
+		if err := writeEvent(w, e); err != nil{
+			return
+		}
+	}
+
+	if err := rc.Flush(); err != nil{
+		return
+	}
+
+	heartbeat := time.NewTicker(streamHeartbeatInterval)
+	defer heartbeat.Stop()
+
+	for{
+		var err error
+
+		select{
+		case <-r.Context().Done():
+			return
+		case <-app.streams.Done():
+			// clients reconnect to another instance with Last-Event-ID
+			return
+		case <-sub.Dropped:
+			app.logger.Warnw("stream dropped slow client", "path", r.URL.Path)
+			return
+		case e := <-sub.C:
+			err = writeEvent(w, e)
+		case <-heartbeat.C:
+			_, err = fmt.Fprint(w, ": heartbeat\n\n")
+		}
+
+		if err == nil{
+			err = rc.Flush()
+		}
+
+		if err != nil{
+			if !errors.Is(err, r.Context().Err()){
+				app.logger.Warnw("stream write failed", "path", r.URL.Path, "error", err.Error())
+			}
+			return
+		}
+	}
+}
+
+func writeEvent(w http.ResponseWriter, e events.Event) error{
+	_, err := fmt.Fprintf(w, "id: %s\nevent: %s\ndata: %s\n\n", e.ID, e.Type, e.Data)
+	return err
+}
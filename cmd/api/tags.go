@@ -0,0 +1,113 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/nikhilkarle/social/internal/store"
+)
+
+// searchTagsHandler godoc
+//
+//	@Summary		Autocompletes tags
+//	@Description	Lists tags starting with the given prefix, most used first
+//	@Tags			tags
+//	@Accept			json
+//	@Produce		json
+//	@Param			prefix	query		string	false	"Prefix"
+//	@Param			limit	query		int		false	"Limit"
+//	@Success		200		{object}	[]store.Tag
+//	@Failure		400		{object}	error	"Bad request"
+//	@Failure		500		{object}	error	"Internal server error"
+//	@Security		ApiKeyAuth
+//	@Router			/tags [get]
+func (app *application) searchTagsHandler(w http.ResponseWriter, r *http.Request){
+	prefix := r.URL.Query().Get("prefix")
+	if len(prefix) > 50{
+		app.badRequestError(w, r, errors.New("prefix must be at most 50 characters"))
+		return
+	}
+
+	limit := 10
+	if l := r.URL.Query().Get("limit"); l != ""{
+		n, err := strconv.Atoi(l)
+		if err != nil || n < 1 || n > 50{
+			app.badRequestError(w, r, errors.New("limit must be between 1 and 50"))
+			return
+		}
+		limit = n
+	}
+
+	tags, err := app.store.Tags.Search(r.Context(), prefix, limit)
+	if err != nil{
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, tags); err != nil{
+		app.internalServerError(w, r, err)
+	}
+}
+
+// getTagPostsHandler godoc
+//
+//	@Summary		Fetches posts with a tag
+//	@Description	Fetches posts tagged with the given tag
+//	@Tags			tags
+//	@Accept			json
+//	@Produce		json
+//	@Param			tag		path		string	true	"Tag"
+//	@Param			limit	query		int		false	"Limit"
+//	@Param			offset	query		int		false	"Offset"
+//	@Param			sort	query		string	false	"Sort"
+//	@Success		200		{object}	[]store.PostWithMetadata
+//	@Failure		400		{object}	error	"Bad request"
+//	@Failure		500		{object}	error	"Internal server error"
+//	@Security		ApiKeyAuth
+//	@Router			/tags/{tag}/posts [get]
+func (app *application) getTagPostsHandler(w http.ResponseWriter, r *http.Request){
+	tag := store.NormalizeTags([]string{chi.URLParam(r, "tag")})
+	if len(tag) == 0 || Validate.Var(tag[0], "max=50,tag") != nil{
+		app.badRequestError(w, r, errors.New("invalid tag"))
+		return
+	}
+
+	fq := store.PaginatedFeedQuery{
+		Limit: 20,
+		Offset: 0,
+		Sort: "desc",
+	}
+
+	fq, err := fq.Parse(r)
+	if err != nil{
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(fq); err != nil{
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	if fq.Sort == "ranked"{
+		app.badRequestError(w, r, errors.New("sort must be asc or desc"))
+		return
+	}
+
+	posts, err := app.store.Tags.GetPostsByTag(r.Context(), getAuthUserID(r), tag[0], fq)
+	if err != nil{
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.attachPostDetails(r.Context(), getAuthUserID(r), feedPosts(posts)...); err != nil{
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, posts); err != nil{
+		app.internalServerError(w, r, err)
+	}
+}
@@ -3,6 +3,7 @@ package main
 import (
 	"context"
 	"errors"
+	"fmt"
 	"net/http"
 	"strconv"
 
@@ -12,6 +13,7 @@ import (
 
 type userKey string
 const userCtx userKey = "user"
+const authUserCtx userKey = "authUser"
 
 // GetUser godoc
 //	@Summary		Fetches a user profile
@@ -47,6 +49,7 @@ type FollowUser struct{
 //	@Param			userID	path		int		true	"User ID"
 //	@Success		204		{string}	string	"User followed"
 //	@Failure		400		{object}	error	"User payload missing"
+//	@Failure		403		{object}	error	"A block exists between the users"
 //	@Failure		404		{object}	error	"User not found"
 //	@Security		ApiKeyAuth
 //	@Router			/users/{userID}/follow [put]
@@ -60,22 +63,28 @@ func(app *application) followUserHandler(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	if err := app.jsonResponse(w, http.StatusNoContent, payload); err != nil{
-		app.internalServerError(w,r,err)
-	}
-
 	if err := app.store.Followers.Follow(r.Context(), followerUser.ID, payload.UserID); err != nil{
 		switch err{
 		case store.ErrConflict:
 			app.conflictError(w,r,err)
 			return
 
+		case store.ErrCannotFollow:
+			app.forbiddenError(w,r,err)
+			return
+
 		default:
 			app.internalServerError(w,r,err)
 		}
 		return
 	}
 
+	app.notify(r.Context(), &store.Notification{
+		UserID: payload.UserID,
+		ActorID: followerUser.ID,
+		Type: store.NotificationFollow,
+	})
+
 	if err := app.jsonResponse(w, http.StatusNoContent, nil); err != nil{
 		app.internalServerError(w,r,err)
 		return
@@ -105,6 +114,101 @@ func(app *application) unfollowUserHandler(w http.ResponseWriter, r *http.Reques
 	}
 }
 
+// BlockUser godoc
+//	@Summary		Blocks a user
+//	@Description	Blocks a user by ID and removes any follow between the two users
+//	@Tags			users
+//	@Accept			json
+//	@Produce		json
+//	@Param			userID	path		int		true	"User ID"
+//	@Success		204		{string}	string	"User blocked"
+//	@Failure		400		{object}	error	"Can't block yourself"
+//	@Failure		404		{object}	error	"User not found"
+//	@Security		ApiKeyAuth
+//	@Router			/users/{userID}/block [put]
+func (app *application) blockUserHandler(w http.ResponseWriter, r *http.Request){
+	blockedUser := getUserFromCtx(r)
+	blockerID := getAuthUserID(r)
+
+	if blockedUser.ID == blockerID{
+		app.badRequestError(w, r, errors.New("you can't block yourself"))
+		return
+	}
+
+	if err := app.store.Blocks.Block(r.Context(), blockerID, blockedUser.ID); err != nil{
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// UnblockUser godoc
+//	@Summary		Unblocks a user
+//	@Description	Unblocks a user by ID
+//	@Tags			users
+//	@Accept			json
+//	@Produce		json
+//	@Param			userID	path		int		true	"User ID"
+//	@Success		204		{string}	string	"User unblocked"
+//	@Failure		404		{object}	error	"User not found"
+//	@Security		ApiKeyAuth
+//	@Router			/users/{userID}/unblock [put]
+func (app *application) unblockUserHandler(w http.ResponseWriter, r *http.Request){
+	blockedUser := getUserFromCtx(r)
+
+	if err := app.store.Blocks.Unblock(r.Context(), getAuthUserID(r), blockedUser.ID); err != nil{
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+type UpdatePrivacyPayload struct{
+	IsPrivate *bool `json:"is_private" validate:"required"`
+}
+
+// updatePrivacyHandler godoc
+//
+//	@Summary		Updates the caller's privacy
+//	@Description	Private accounts only receive direct messages from users they follow
+//	@Tags			users
+//	@Accept			json
+//	@Produce		json
+//	@Param			payload	body		UpdatePrivacyPayload	true	"Privacy"
+//	@Success		200		{object}	UpdatePrivacyPayload
+//	@Failure		400		{object}	error	"Bad request"
+//	@Failure		500		{object}	error	"Internal server error"
+//	@Security		ApiKeyAuth
+//	@Router			/users/privacy [put]
+func (app *application) updatePrivacyHandler(w http.ResponseWriter, r *http.Request){
+	var payload UpdatePrivacyPayload
+	if err := readJSON(w, r, &payload); err != nil{
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	if err := Validate.Struct(payload); err != nil{
+		app.badRequestError(w, r, err)
+		return
+	}
+
+	ctx := r.Context()
+	userID := getAuthUserID(r)
+
+	if err := app.store.Users.SetPrivate(ctx, userID, *payload.IsPrivate); err != nil{
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	app.invalidateUser(ctx, userID)
+
+	if err := app.jsonResponse(w, http.StatusOK, payload); err != nil{
+		app.internalServerError(w, r, err)
+	}
+}
+
 func (app *application) userContextMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request){
 		userIDStr := chi.URLParam(r, "userID")
@@ -117,7 +221,7 @@ func (app *application) userContextMiddleware(next http.Handler) http.Handler {
 
 		ctx := r.Context()
 
-		user, err := app.store.Users.GetByID(ctx, userID)
+		user, err := app.getUser(ctx, userID)
 
 		if err != nil{
 			switch{
@@ -139,4 +243,49 @@ func (app *application) userContextMiddleware(next http.Handler) http.Handler {
 func getUserFromCtx(r *http.Request) *store.User{
 	user, _ := r.Context().Value(userCtx).(*store.User)
 	return user
-}
\ No newline at end of file
+}
+
+// getAuthUserID returns the ID of the user making the request.
+func getAuthUserID(r *http.Request) int64{
+	//TODO: change after auth
+	return 1
+}
+
+// activeAccountMiddleware loads the user making the request and turns away
+// suspended and banned accounts. Shadow banned users get through unaware.
+func (app *application) activeAccountMiddleware(next http.Handler) http.Handler{
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request){
+		ctx := r.Context()
+
+		user, err := app.getUser(ctx, getAuthUserID(r))
+		if err != nil{
+			switch{
+			case errors.Is(err, store.ErrNotFound):
+				app.unauthorizedError(w, r, err)
+			default:
+				app.internalServerError(w, r, err)
+			}
+			return
+		}
+
+		switch user.EffectiveStatus(){
+		case store.AccountSuspended:
+			app.forbiddenError(w, r, fmt.Errorf("your account is suspended until %s", *user.SuspendedUntil))
+			return
+		case store.AccountBanned:
+			app.forbiddenError(w, r, errors.New("your account is banned"))
+			return
+		}
+
+		ctx = context.WithValue(ctx, authUserCtx, user)
+
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// getAuthUser returns the user making the request, as loaded by
+// activeAccountMiddleware.
+func getAuthUser(r *http.Request) *store.User{
+	user, _ := r.Context().Value(authUserCtx).(*store.User)
+	return user
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/nikhilkarle/social/internal/store"
+	"go.uber.org/zap"
+)
+
+// privacyUsers records SetPrivate calls; the rest of the store isn't used.
+type privacyUsers struct{
+	*store.UserStore
+	userID int64
+	private *bool
+}
+
+func (u *privacyUsers) SetPrivate(ctx context.Context, userID int64, private bool) error{
+	u.userID = userID
+	u.private = &private
+	return nil
+}
+
+func TestUpdatePrivacyHandler(t *testing.T){
+	tests := []struct{
+		name string
+		body string
+		wantStatus int
+		wantPrivate *bool
+	}{
+		{name: "make private", body: `{"is_private": true}`, wantStatus: http.StatusOK, wantPrivate: ptr(true)},
+		{name: "make public", body: `{"is_private": false}`, wantStatus: http.StatusOK, wantPrivate: ptr(false)},
+		{name: "missing setting", body: `{}`, wantStatus: http.StatusBadRequest},
+		{name: "unknown field", body: `{"is_private": true, "role": "admin"}`, wantStatus: http.StatusBadRequest},
+		{name: "not JSON", body: `private`, wantStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests{
+		t.Run(tt.name, func(t *testing.T){
+			users := &privacyUsers{}
+			app := &application{logger: zap.NewNop().Sugar()}
+			app.store.Users = users
+
+			r := httptest.NewRequest(http.MethodPut, "/v1/users/privacy", strings.NewReader(tt.body))
+			w := httptest.NewRecorder()
+
+			app.updatePrivacyHandler(w, r)
+
+			if w.Code != tt.wantStatus{
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body)
+			}
+
+			if tt.wantPrivate == nil{
+				if users.private != nil{
+					t.Errorf("setting changed to %v on a bad request", *users.private)
+				}
+				return
+			}
+
+			if users.private == nil || *users.private != *tt.wantPrivate || users.userID != getAuthUserID(r){
+				t.Errorf("SetPrivate(%d, %v), want SetPrivate(%d, %v)", users.userID, users.private, getAuthUserID(r), *tt.wantPrivate)
+			}
+		})
+	}
+}
+
+func ptr[T any](v T) *T{
+	return &v
+}
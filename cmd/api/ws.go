@@ -0,0 +1,417 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nikhilkarle/social/internal/events"
+	"github.com/nikhilkarle/social/internal/store"
+	"golang.org/x/net/websocket"
+)
+
+const (
+	wsMaxMessageBytes = 4 << 10
+	wsMaxSubscriptions = 20
+	// outgoing messages queued per connection before it's closed as too slow
+	wsSendQueue = 64
+	wsWriteTimeout = 10 * time.Second
+	wsPingInterval = 30 * time.Second
+	// clients must send something, e.g. a pong, at least this often
+	wsReadTimeout = 2 * wsPingInterval
+	// typing indicators are forwarded at most this often per conversation
+	wsTypingInterval = 3 * time.Second
+)
+
+var (
+	errUnknownTopic = errors.New("unknown topic")
+	errTooManySubscriptions = errors.New("too many subscriptions")
+	errNotSubscribed = errors.New("not subscribed to a conversation topic")
+	errOriginNotAllowed = errors.New("origin not allowed")
+)
+
+// wsClientMessage is sent by clients. Actions are subscribe, unsubscribe,
+// typing, ping and pong; ID is echoed back in the ack. Typing needs a
+// subscription to the conversation's topic.
+type wsClientMessage struct{
+	Action string `json:"action"`
+	Topic string `json:"topic"`
+	ID string `json:"id,omitempty"`
+}
+
+// wsServerMessage is sent to clients with type event, ack, error, ping or pong.
+type wsServerMessage struct{
+	Type string `json:"type"`
+	ID string `json:"id,omitempty"`
+	Topic string `json:"topic,omitempty"`
+	Event *events.Event `json:"event,omitempty"`
+	Error string `json:"error,omitempty"`
+}
+
+// wsTopic is what a client topic name maps to on the broker. An empty
+// eventType forwards every event on the broker topic.
+type wsTopic struct{
+	brokerTopic string
+	eventType string
+}
+
+type wsSubscription struct{
+	brokerTopic string
+	sub *events.Subscription
+	cancel context.CancelFunc
+}
+
+type wsConn struct{
+	app *application
+	ws *websocket.Conn
+	userID int64
+	out chan wsServerMessage
+	subs map[string]*wsSubscription
+	typedAt map[string]time.Time
+	closeOnce sync.Once
+}
+
+// wsTyping is published to a conversation while a member is typing.
+type wsTyping struct{
+	UserID int64 `json:"user_id"`
+}
+
+// wsHandler godoc
+//
+//	@Summary		Opens a WebSocket
+//	@Description	Upgrades to a WebSocket. Clients subscribe to topics (notifications, feed, messages, post:{id}:comments, conversation:{id}) with {"action":"subscribe","topic":"..."} and receive {"type":"event"} messages.
+//	@Tags			stream
+//	@Success		101	{string}	string	"Switching protocols"
+//	@Failure		403	{string}	string	"Origin not in WS_ALLOWED_ORIGINS"
+//	@Security		ApiKeyAuth
+//	@Router			/ws [get]
+func (app *application) wsHandler(w http.ResponseWriter, r *http.Request){
+	userID := getAuthUserID(r)
+
+	srv := websocket.Server{
+		Handshake: func(cfg *websocket.Config, r *http.Request) error{
+			return app.checkWSOrigin(cfg.Origin)
+		},
+		Handler: func(ws *websocket.Conn){
+			app.serveWS(ws, userID)
+		},
+	}
+
+	srv.ServeHTTP(w, r)
+}
+
+// checkWSOrigin only lets browsers connect from the allowed origins. The
+// same-origin policy doesn't cover WebSockets and browsers send the visitor's
+// credentials with the upgrade, so otherwise any site could open a socket as
+// them. Clients other than browsers send no Origin and are let through.
+func (app *application) checkWSOrigin(origin *url.URL) error{
+	if origin == nil{
+		return nil
+	}
+
+	if !slices.Contains(app.config.wsAllowedOrigins, strings.ToLower(origin.Scheme + "://" + origin.Host)){
+		return errOriginNotAllowed
+	}
+
+	return nil
+}
+
+// parseAllowedOrigins reads a comma-separated list of origins such as
+// https://app.example.com.
+func parseAllowedOrigins(s string) ([]string, error){
+	var origins []string
+
+	for _, entry := range strings.Split(s, ","){
+		entry = strings.TrimSpace(entry)
+		if entry == ""{
+			continue
+		}
+
+		u, err := url.Parse(entry)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || (u.Path != "" && u.Path != "/") || u.RawQuery != ""{
+			return nil, fmt.Errorf("allowed origin %q: want scheme://host[:port]", entry)
+		}
+
+		origins = append(origins, strings.ToLower(u.Scheme + "://" + u.Host))
+	}
+
+	return origins, nil
+}
+
+func (app *application) serveWS(ws *websocket.Conn, userID int64){
+	ws.MaxPayloadBytes = wsMaxMessageBytes
+
+	// the hijacked connection keeps the server's read and write deadlines
+	if err := ws.SetDeadline(time.Time{}); err != nil{
+		ws.Close()
+		return
+	}
+
+	c := &wsConn{
+		app: app,
+		ws: ws,
+		userID: userID,
+		out: make(chan wsServerMessage, wsSendQueue),
+		subs: map[string]*wsSubscription{},
+		typedAt: map[string]time.Time{},
+	}
+
+	// hijacked connections aren't drained by the server's shutdown, so they're
+	// closed when streams end
+	ctx, cancel := context.WithCancel(app.streams)
+	defer cancel()
+	defer c.cleanup()
+
+	go c.writeLoop(ctx)
+	c.readLoop(ctx)
+}
+
+func (c *wsConn) readLoop(ctx context.Context){
+	for{
+		if err := c.ws.SetReadDeadline(time.Now().Add(wsReadTimeout)); err != nil{
+			return
+		}
+
+		var msg wsClientMessage
+		if err := websocket.JSON.Receive(c.ws, &msg); err != nil{
+			if errors.Is(err, websocket.ErrFrameTooLarge){
+				c.sendError("", "message too large")
+			}
+			return
+		}
+
+		switch msg.Action{
+		case "subscribe":
+			if err := c.subscribe(ctx, msg.Topic); err != nil{
+				if !errors.Is(err, errUnknownTopic) && !errors.Is(err, errTooManySubscriptions){
+					c.app.logger.Errorw("websocket subscribe failed", "topic", msg.Topic, "error", err.Error())
+					err = errors.New("the server encountered a problem")
+				}
+				c.sendError(msg.ID, err.Error())
+				continue
+			}
+			c.send(wsServerMessage{Type: "ack", ID: msg.ID, Topic: msg.Topic})
+		case "unsubscribe":
+			c.unsubscribe(msg.Topic)
+			c.send(wsServerMessage{Type: "ack", ID: msg.ID, Topic: msg.Topic})
+		case "typing":
+			if err := c.typing(ctx, msg.Topic); err != nil{
+				c.sendError(msg.ID, err.Error())
+			}
+		case "ping":
+			c.send(wsServerMessage{Type: "pong", ID: msg.ID})
+		case "pong":
+		default:
+			c.sendError(msg.ID, "unknown action")
+		}
+	}
+}
+
+func (c *wsConn) writeLoop(ctx context.Context){
+	ping := time.NewTicker(wsPingInterval)
+	defer ping.Stop()
+
+	for{
+		var msg wsServerMessage
+
+		select{
+		case <-ctx.Done():
+			// unblocks readLoop
+			c.close()
+			return
+		case msg = <-c.out:
+		case <-ping.C:
+			msg = wsServerMessage{Type: "ping"}
+		}
+
+		if err := c.ws.SetWriteDeadline(time.Now().Add(wsWriteTimeout)); err != nil{
+			c.close()
+			return
+		}
+
+		if err := websocket.JSON.Send(c.ws, msg); err != nil{
+			c.close()
+			return
+		}
+	}
+}
+
+func (c *wsConn) subscribe(ctx context.Context, name string) error{
+	if _, ok := c.subs[name]; ok{
+		return nil
+	}
+
+	if len(c.subs) >= wsMaxSubscriptions{
+		return errTooManySubscriptions
+	}
+
+	topic, err := c.app.resolveWSTopic(ctx, c.userID, name)
+	if err != nil{
+		return err
+	}
+
+	subCtx, cancel := context.WithCancel(ctx)
+	sub := c.app.broker.Subscribe(topic.brokerTopic, "")
+	c.subs[name] = &wsSubscription{brokerTopic: topic.brokerTopic, sub: sub, cancel: cancel}
+
+	go func(){
+		for{
+			select{
+			case <-subCtx.Done():
+				return
+			case <-sub.Dropped:
+				c.close()
+				return
+			case e := <-sub.C:
+				if topic.eventType != "" && e.Type != topic.eventType{
+					continue
+				}
+				c.send(wsServerMessage{Type: "event", Topic: name, Event: &e})
+			}
+		}
+	}()
+
+	return nil
+}
+
+func (c *wsConn) unsubscribe(name string){
+	s, ok := c.subs[name]
+	if !ok{
+		return
+	}
+
+	s.cancel()
+	c.app.broker.Unsubscribe(s.sub)
+	delete(c.subs, name)
+}
+
+// typing tells the other members of a conversation the user is typing.
+// Repeats within wsTypingInterval are dropped.
+func (c *wsConn) typing(ctx context.Context, name string) error{
+	if !strings.HasPrefix(name, "conversation:") || c.subs[name] == nil{
+		return errNotSubscribed
+	}
+
+	if time.Since(c.typedAt[name]) < wsTypingInterval{
+		return nil
+	}
+	c.typedAt[name] = time.Now()
+
+	data, err := json.Marshal(wsTyping{UserID: c.userID})
+	if err != nil{
+		return err
+	}
+
+	topic := c.subs[name].brokerTopic
+	if err := c.app.broker.Publish(ctx, events.Event{Topic: topic, Type: events.TypeTyping, Data: data}); err != nil{
+		c.app.logger.Errorw("websocket typing failed", "topic", name, "error", err.Error())
+	}
+
+	return nil
+}
+
+// send queues a message, closing the connection if the client isn't reading
+// fast enough to keep the queue from filling up.
+func (c *wsConn) send(msg wsServerMessage){
+	select{
+	case c.out <- msg:
+	default:
+		c.close()
+	}
+}
+
+func (c *wsConn) sendError(id string, message string){
+	c.send(wsServerMessage{Type: "error", ID: id, Error: message})
+}
+
+func (c *wsConn) close(){
+	c.closeOnce.Do(func(){
+		c.ws.Close()
+	})
+}
+
+func (c *wsConn) cleanup(){
+	for name := range c.subs{
+		c.unsubscribe(name)
+	}
+	c.close()
+}
+
+// resolveWSTopic checks that the user may subscribe to a client topic and maps
+// it to the broker.
+func (app *application) resolveWSTopic(ctx context.Context, userID int64, name string) (wsTopic, error){
+	switch name{
+	case "notifications":
+		return wsTopic{brokerTopic: events.UserTopic(userID), eventType: events.TypeNotification}, nil
+	case "feed":
+		return wsTopic{brokerTopic: events.UserTopic(userID), eventType: events.TypeFeed}, nil
+	case "messages":
+		return wsTopic{brokerTopic: events.UserTopic(userID), eventType: events.TypeMessage}, nil
+	}
+
+	if idStr, ok := strings.CutPrefix(name, "conversation:"); ok{
+		conversationID, err := strconv.ParseInt(idStr, 10, 64)
+		if err != nil{
+			return wsTopic{}, errUnknownTopic
+		}
+
+		if _, err := app.store.Conversations.GetByID(ctx, userID, conversationID); err != nil{
+			if errors.Is(err, store.ErrNotFound){
+				return wsTopic{}, errUnknownTopic
+			}
+			return wsTopic{}, err
+		}
+
+		return wsTopic{brokerTopic: events.ConversationTopic(conversationID)}, nil
+	}
+
+	if rest, ok := strings.CutPrefix(name, "post:"); ok{
+		idStr, ok := strings.CutSuffix(rest, ":comments")
+		if !ok{
+			return wsTopic{}, errUnknownTopic
+		}
+
+		postID, err := strconv.ParseInt(idStr, 10, 64)
+		if err != nil{
+			return wsTopic{}, errUnknownTopic
+		}
+
+		post, err := app.store.Posts.GetByID(ctx, postID)
+		if err != nil{
+			if errors.Is(err, store.ErrNotFound){
+				return wsTopic{}, errUnknownTopic
+			}
+			return wsTopic{}, err
+		}
+
+		blocked, err := app.store.Blocks.IsBlocked(ctx, userID, post.UserID)
+		if err != nil{
+			return wsTopic{}, err
+		}
+
+		if blocked{
+			return wsTopic{}, errUnknownTopic
+		}
+
+		visible, err := app.canViewPost(ctx, userID, post)
+		if err != nil{
+			return wsTopic{}, err
+		}
+
+		if !visible{
+			return wsTopic{}, errUnknownTopic
+		}
+
+		return wsTopic{brokerTopic: events.PostCommentsTopic(postID)}, nil
+	}
+
+	return wsTopic{}, errUnknownTopic
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"errors"
+	"net/url"
+	"slices"
+	"testing"
+)
+
+func TestParseAllowedOrigins(t *testing.T){
+	origins, err := parseAllowedOrigins(" https://App.Example.com , http://localhost:3000/,")
+	if err != nil{
+		t.Fatal(err)
+	}
+
+	want := []string{"https://app.example.com", "http://localhost:3000"}
+	if !slices.Equal(origins, want){
+		t.Errorf("origins = %q, want %q", origins, want)
+	}
+
+	for _, bad := range []string{"app.example.com", "ftp://example.com", "https://example.com/app", "https://"}{
+		if _, err := parseAllowedOrigins(bad); err == nil{
+			t.Errorf("parseAllowedOrigins(%q) accepted it", bad)
+		}
+	}
+}
+
+func TestCheckWSOrigin(t *testing.T){
+	app := &application{config: config{wsAllowedOrigins: []string{"https://app.example.com", "http://localhost:3000"}}}
+
+	tests := []struct{
+		origin string
+		allowed bool
+	}{
+		{origin: "", allowed: true},
+		{origin: "https://app.example.com", allowed: true},
+		{origin: "HTTPS://APP.EXAMPLE.COM", allowed: true},
+		{origin: "http://localhost:3000", allowed: true},
+		{origin: "http://app.example.com", allowed: false},
+		{origin: "https://evil.example.com", allowed: false},
+		{origin: "https://app.example.com.evil.com", allowed: false},
+		{origin: "http://localhost:3001", allowed: false},
+		{origin: "null", allowed: false},
+	}
+
+	for _, tt := range tests{
+		var origin *url.URL
+		if tt.origin != ""{
+			origin, _ = url.Parse(tt.origin)
+		}
+
+		err := app.checkWSOrigin(origin)
+		if tt.allowed && err != nil{
+			t.Errorf("origin %q refused: %v", tt.origin, err)
+		}
+		if !tt.allowed && !errors.Is(err, errOriginNotAllowed){
+			t.Errorf("origin %q error = %v, want %v", tt.origin, err, errOriginNotAllowed)
+		}
+	}
+}
@@ -0,0 +1,4 @@
+DROP TRIGGER IF EXISTS trg_post_tags_usage_count ON post_tags;
+DROP FUNCTION IF EXISTS post_tags_usage_count;
+DROP TABLE IF EXISTS post_tags;
+DROP TABLE IF EXISTS tags;
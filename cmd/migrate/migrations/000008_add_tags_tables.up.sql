@@ -0,0 +1,51 @@
+CREATE TABLE IF NOT EXISTS tags (
+    id          BIGSERIAL PRIMARY KEY,
+    name        VARCHAR(100) UNIQUE NOT NULL,
+    usage_count INT NOT NULL DEFAULT 0,
+    created_at  TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS post_tags (
+    post_id BIGINT NOT NULL,
+    tag_id  BIGINT NOT NULL,
+
+    PRIMARY KEY (post_id, tag_id),
+    FOREIGN KEY (post_id) REFERENCES posts (id) ON DELETE CASCADE,
+    FOREIGN KEY (tag_id) REFERENCES tags (id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_post_tags_tag_id ON post_tags (tag_id);
+CREATE INDEX IF NOT EXISTS idx_tags_name_prefix ON tags (name varchar_pattern_ops);
+
+-- usage_count follows post_tags, including rows removed by the posts cascade
+CREATE OR REPLACE FUNCTION post_tags_usage_count() RETURNS TRIGGER AS $$
+BEGIN
+    IF TG_OP = 'INSERT' THEN
+        UPDATE tags SET usage_count = usage_count + 1 WHERE id = NEW.tag_id;
+    ELSIF TG_OP = 'DELETE' THEN
+        UPDATE tags SET usage_count = usage_count - 1 WHERE id = OLD.tag_id;
+    END IF;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER trg_post_tags_usage_count
+AFTER INSERT OR DELETE ON post_tags
+FOR EACH ROW EXECUTE FUNCTION post_tags_usage_count();
+
+-- normalize what is already stored and mirror it into the new tables
+UPDATE posts
+SET tags = ARRAY(
+    SELECT DISTINCT LOWER(TRIM(t)) FROM UNNEST(tags) AS t WHERE TRIM(t) <> ''
+)
+WHERE tags IS NOT NULL;
+
+INSERT INTO tags (name)
+SELECT DISTINCT UNNEST(tags) FROM posts
+ON CONFLICT (name) DO NOTHING;
+
+INSERT INTO post_tags (post_id, tag_id)
+SELECT p.id, t.id
+FROM posts p
+JOIN tags t ON t.name = ANY(p.tags)
+ON CONFLICT DO NOTHING;
@@ -0,0 +1,5 @@
+DROP TRIGGER IF EXISTS trg_followers_follower_count ON followers;
+DROP FUNCTION IF EXISTS followers_follower_count;
+ALTER TABLE users DROP COLUMN IF EXISTS follower_count;
+DROP INDEX IF EXISTS idx_followers_follower_id;
+DROP TABLE IF EXISTS timelines;
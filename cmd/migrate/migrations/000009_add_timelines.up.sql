@@ -0,0 +1,49 @@
+CREATE TABLE IF NOT EXISTS timelines (
+    user_id    BIGINT NOT NULL,
+    post_id    BIGINT NOT NULL,
+    author_id  BIGINT NOT NULL,
+    created_at TIMESTAMP(0) WITH TIME ZONE NOT NULL,
+
+    PRIMARY KEY (user_id, post_id),
+    FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE,
+    FOREIGN KEY (post_id) REFERENCES posts (id) ON DELETE CASCADE,
+    FOREIGN KEY (author_id) REFERENCES users (id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_timelines_user_created ON timelines (user_id, created_at DESC, post_id DESC);
+CREATE INDEX IF NOT EXISTS idx_timelines_user_author ON timelines (user_id, author_id);
+CREATE INDEX IF NOT EXISTS idx_followers_follower_id ON followers (follower_id);
+
+-- follower_count decides between fan-out on write and on read, so it's kept
+-- on the user rather than counted on every feed read and post
+ALTER TABLE users ADD COLUMN IF NOT EXISTS follower_count INT NOT NULL DEFAULT 0;
+
+CREATE OR REPLACE FUNCTION followers_follower_count() RETURNS TRIGGER AS $$
+BEGIN
+    IF TG_OP = 'INSERT' THEN
+        UPDATE users SET follower_count = follower_count + 1 WHERE id = NEW.user_id;
+    ELSIF TG_OP = 'DELETE' THEN
+        UPDATE users SET follower_count = follower_count - 1 WHERE id = OLD.user_id;
+    END IF;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER trg_followers_follower_count
+AFTER INSERT OR DELETE ON followers
+FOR EACH ROW EXECUTE FUNCTION followers_follower_count();
+
+UPDATE users u
+SET follower_count = (SELECT COUNT(*) FROM followers f WHERE f.user_id = u.id);
+
+-- authors see their own posts
+INSERT INTO timelines (user_id, post_id, author_id, created_at)
+SELECT p.user_id, p.id, p.user_id, p.created_at FROM posts p
+ON CONFLICT DO NOTHING;
+
+-- followers see the posts of everyone they follow
+INSERT INTO timelines (user_id, post_id, author_id, created_at)
+SELECT f.follower_id, p.id, p.user_id, p.created_at
+FROM posts p
+JOIN followers f ON f.user_id = p.user_id
+ON CONFLICT DO NOTHING;
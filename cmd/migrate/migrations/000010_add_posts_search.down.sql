@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS idx_posts_tags;
+DROP INDEX IF EXISTS idx_posts_search_vector;
+
+ALTER TABLE posts
+DROP COLUMN IF EXISTS search_vector;
@@ -0,0 +1,7 @@
+DROP TABLE IF EXISTS blocks;
+
+DROP INDEX IF EXISTS idx_users_display_name_trgm;
+DROP INDEX IF EXISTS idx_users_username_trgm;
+
+ALTER TABLE users
+DROP COLUMN IF EXISTS display_name;
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_posts_created_at;
+DROP TABLE IF EXISTS trending_tags;
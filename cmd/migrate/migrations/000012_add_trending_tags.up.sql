@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS trending_tags (
+    tag          VARCHAR(100) PRIMARY KEY,
+    hour_count   INT NOT NULL,
+    day_count    INT NOT NULL,
+    score        DOUBLE PRECISION NOT NULL,
+    refreshed_at TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_trending_tags_score ON trending_tags (score DESC);
+CREATE INDEX IF NOT EXISTS idx_posts_created_at ON posts (created_at DESC);
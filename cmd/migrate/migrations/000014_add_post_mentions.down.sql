@@ -0,0 +1,4 @@
+ALTER TABLE posts
+DROP COLUMN IF EXISTS entities;
+
+DROP TABLE IF EXISTS post_mentions;
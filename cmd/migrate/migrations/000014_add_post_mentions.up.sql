@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS post_mentions (
+    post_id BIGINT NOT NULL,
+    user_id BIGINT NOT NULL,
+
+    PRIMARY KEY (post_id, user_id),
+    FOREIGN KEY (post_id) REFERENCES posts (id) ON DELETE CASCADE,
+    FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_post_mentions_user_id ON post_mentions (user_id);
+
+ALTER TABLE posts
+ADD COLUMN entities JSONB NOT NULL DEFAULT '[]';
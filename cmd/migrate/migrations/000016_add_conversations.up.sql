@@ -0,0 +1,42 @@
+ALTER TABLE users
+ADD COLUMN is_private BOOLEAN NOT NULL DEFAULT FALSE;
+
+CREATE TABLE IF NOT EXISTS conversations (
+    id              BIGSERIAL PRIMARY KEY,
+    is_group        BOOLEAN NOT NULL DEFAULT FALSE,
+    title           VARCHAR(100) NOT NULL DEFAULT '',
+    -- "lowID:highID" for one-to-one conversations so each pair has only one
+    direct_key      VARCHAR(50) UNIQUE,
+    created_by      BIGINT NOT NULL,
+    last_message_at TIMESTAMP(0) WITH TIME ZONE,
+    created_at      TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+
+    FOREIGN KEY (created_by) REFERENCES users (id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS conversation_members (
+    conversation_id      BIGINT NOT NULL,
+    user_id              BIGINT NOT NULL,
+    last_read_message_id BIGINT,
+    joined_at            TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    left_at              TIMESTAMP(0) WITH TIME ZONE,
+
+    PRIMARY KEY (conversation_id, user_id),
+    FOREIGN KEY (conversation_id) REFERENCES conversations (id) ON DELETE CASCADE,
+    FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_conversation_members_user_id ON conversation_members (user_id) WHERE left_at IS NULL;
+
+CREATE TABLE IF NOT EXISTS messages (
+    id              BIGSERIAL PRIMARY KEY,
+    conversation_id BIGINT NOT NULL,
+    sender_id       BIGINT NOT NULL,
+    content         TEXT NOT NULL,
+    created_at      TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+
+    FOREIGN KEY (conversation_id) REFERENCES conversations (id) ON DELETE CASCADE,
+    FOREIGN KEY (sender_id) REFERENCES users (id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_messages_conversation_created ON messages (conversation_id, created_at DESC, id DESC);
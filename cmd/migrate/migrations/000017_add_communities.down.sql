@@ -0,0 +1,9 @@
+DROP INDEX IF EXISTS idx_posts_community_created;
+
+ALTER TABLE posts
+DROP COLUMN IF EXISTS community_id;
+
+DROP TABLE IF EXISTS community_bans;
+DROP TABLE IF EXISTS community_join_requests;
+DROP TABLE IF EXISTS community_members;
+DROP TABLE IF EXISTS communities;
@@ -0,0 +1,53 @@
+CREATE TABLE IF NOT EXISTS communities (
+    id          BIGSERIAL PRIMARY KEY,
+    name        VARCHAR(50) NOT NULL,
+    description TEXT NOT NULL DEFAULT '',
+    visibility  VARCHAR(10) NOT NULL DEFAULT 'public' CHECK (visibility IN ('public', 'private')),
+    created_by  BIGINT NOT NULL,
+    created_at  TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+
+    FOREIGN KEY (created_by) REFERENCES users (id) ON DELETE CASCADE
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_communities_name ON communities (LOWER(name));
+
+CREATE TABLE IF NOT EXISTS community_members (
+    community_id BIGINT NOT NULL,
+    user_id      BIGINT NOT NULL,
+    role         VARCHAR(10) NOT NULL DEFAULT 'member' CHECK (role IN ('owner', 'moderator', 'member')),
+    joined_at    TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+
+    PRIMARY KEY (community_id, user_id),
+    FOREIGN KEY (community_id) REFERENCES communities (id) ON DELETE CASCADE,
+    FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_community_members_user_id ON community_members (user_id);
+
+CREATE TABLE IF NOT EXISTS community_join_requests (
+    community_id BIGINT NOT NULL,
+    user_id      BIGINT NOT NULL,
+    created_at   TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+
+    PRIMARY KEY (community_id, user_id),
+    FOREIGN KEY (community_id) REFERENCES communities (id) ON DELETE CASCADE,
+    FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS community_bans (
+    community_id BIGINT NOT NULL,
+    user_id      BIGINT NOT NULL,
+    banned_by    BIGINT NOT NULL,
+    reason       VARCHAR(255) NOT NULL DEFAULT '',
+    created_at   TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+
+    PRIMARY KEY (community_id, user_id),
+    FOREIGN KEY (community_id) REFERENCES communities (id) ON DELETE CASCADE,
+    FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE,
+    FOREIGN KEY (banned_by) REFERENCES users (id) ON DELETE CASCADE
+);
+
+ALTER TABLE posts
+ADD COLUMN community_id BIGINT REFERENCES communities (id) ON DELETE CASCADE;
+
+CREATE INDEX IF NOT EXISTS idx_posts_community_created ON posts (community_id, created_at DESC, id DESC) WHERE community_id IS NOT NULL;
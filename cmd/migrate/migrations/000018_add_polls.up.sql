@@ -0,0 +1,35 @@
+CREATE TABLE IF NOT EXISTS polls (
+    id           BIGSERIAL PRIMARY KEY,
+    post_id      BIGINT NOT NULL UNIQUE,
+    -- hide_results keeps counts from users who haven't voted until the poll closes
+    hide_results BOOLEAN NOT NULL DEFAULT FALSE,
+    expires_at   TIMESTAMP(0) WITH TIME ZONE NOT NULL,
+    created_at   TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+
+    FOREIGN KEY (post_id) REFERENCES posts (id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS poll_options (
+    id       BIGSERIAL PRIMARY KEY,
+    poll_id  BIGINT NOT NULL,
+    position SMALLINT NOT NULL,
+    text     VARCHAR(80) NOT NULL,
+
+    UNIQUE (poll_id, position),
+    UNIQUE (poll_id, id),
+    FOREIGN KEY (poll_id) REFERENCES polls (id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS poll_votes (
+    poll_id    BIGINT NOT NULL,
+    option_id  BIGINT NOT NULL,
+    user_id    BIGINT NOT NULL,
+    created_at TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+
+    -- one vote per user and poll
+    PRIMARY KEY (poll_id, user_id),
+    FOREIGN KEY (poll_id, option_id) REFERENCES poll_options (poll_id, id) ON DELETE CASCADE,
+    FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_poll_votes_option_id ON poll_votes (option_id);
@@ -0,0 +1,19 @@
+CREATE TABLE IF NOT EXISTS media (
+    id            BIGSERIAL PRIMARY KEY,
+    user_id       BIGINT NOT NULL,
+    -- post_id is set once the upload is attached to a post
+    post_id       BIGINT,
+    position      SMALLINT NOT NULL DEFAULT 0,
+    content_type  VARCHAR(32) NOT NULL,
+    width         INT NOT NULL,
+    height        INT NOT NULL,
+    size_bytes    INT NOT NULL,
+    key           VARCHAR(255) NOT NULL UNIQUE,
+    thumbnail_key VARCHAR(255) NOT NULL UNIQUE,
+    created_at    TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+
+    FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE,
+    FOREIGN KEY (post_id) REFERENCES posts (id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_media_post_id ON media (post_id, position);
@@ -0,0 +1,8 @@
+ALTER TABLE posts ADD COLUMN IF NOT EXISTS content_html TEXT NOT NULL DEFAULT '';
+
+-- existing posts were plain text, so they render as one escaped paragraph
+UPDATE posts SET content_html = '<p>' || REPLACE(
+    REPLACE(REPLACE(REPLACE(REPLACE(REPLACE(content, '&', '&amp;'), '<', '&lt;'), '>', '&gt;'), '"', '&#34;'), '''', '&#39;'),
+    E'\n', '<br>'
+) || '</p>'
+WHERE content_html = '';
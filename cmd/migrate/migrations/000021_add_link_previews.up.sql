@@ -0,0 +1,20 @@
+-- previews are cached by normalized URL and shared between posts
+CREATE TABLE IF NOT EXISTS link_previews (
+    url         TEXT PRIMARY KEY,
+    title       VARCHAR(200) NOT NULL DEFAULT '',
+    description VARCHAR(500) NOT NULL DEFAULT '',
+    image_url   TEXT NOT NULL DEFAULT '',
+    site_name   VARCHAR(200) NOT NULL DEFAULT '',
+    -- failed fetches are remembered so they aren't retried on every post
+    failed      BOOLEAN NOT NULL DEFAULT FALSE,
+    fetched_at  TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS post_links (
+    post_id  BIGINT NOT NULL,
+    position SMALLINT NOT NULL,
+    url      TEXT NOT NULL,
+
+    PRIMARY KEY (post_id, position),
+    FOREIGN KEY (post_id) REFERENCES posts (id) ON DELETE CASCADE
+);
@@ -0,0 +1,55 @@
+ALTER TABLE users
+ADD COLUMN IF NOT EXISTS role VARCHAR(16) NOT NULL DEFAULT 'user' CHECK (role IN ('user', 'moderator', 'admin'));
+
+ALTER TABLE users
+ADD COLUMN IF NOT EXISTS suspended_until TIMESTAMP(0) WITH TIME ZONE;
+
+-- hidden content stays visible to its author and moderators only
+ALTER TABLE posts ADD COLUMN IF NOT EXISTS hidden_at TIMESTAMP(0) WITH TIME ZONE;
+ALTER TABLE comments ADD COLUMN IF NOT EXISTS hidden_at TIMESTAMP(0) WITH TIME ZONE;
+
+CREATE TABLE IF NOT EXISTS reports (
+    id             BIGSERIAL PRIMARY KEY,
+    reporter_id    BIGINT NOT NULL,
+    target_type    VARCHAR(16) NOT NULL CHECK (target_type IN ('post', 'comment', 'user')),
+    target_id      BIGINT NOT NULL,
+    -- target_user_id is the reported user or the author of the reported content
+    target_user_id BIGINT NOT NULL,
+    reason         VARCHAR(32) NOT NULL,
+    details        VARCHAR(1000) NOT NULL DEFAULT '',
+    status         VARCHAR(16) NOT NULL DEFAULT 'open' CHECK (status IN ('open', 'claimed', 'resolved')),
+    claimed_by     BIGINT,
+    claimed_at     TIMESTAMP(0) WITH TIME ZONE,
+    resolution     VARCHAR(16) CHECK (resolution IN ('dismiss', 'hide', 'suspend')),
+    resolved_by    BIGINT,
+    resolved_at    TIMESTAMP(0) WITH TIME ZONE,
+    created_at     TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+
+    FOREIGN KEY (reporter_id) REFERENCES users (id) ON DELETE CASCADE,
+    FOREIGN KEY (target_user_id) REFERENCES users (id) ON DELETE CASCADE,
+    FOREIGN KEY (claimed_by) REFERENCES users (id) ON DELETE SET NULL,
+    FOREIGN KEY (resolved_by) REFERENCES users (id) ON DELETE SET NULL
+);
+
+-- one pending report per reporter and target
+CREATE UNIQUE INDEX IF NOT EXISTS idx_reports_pending_reporter ON reports (reporter_id, target_type, target_id)
+WHERE status <> 'resolved';
+
+CREATE INDEX IF NOT EXISTS idx_reports_status_created_at ON reports (status, created_at);
+CREATE INDEX IF NOT EXISTS idx_reports_target ON reports (target_type, target_id);
+
+-- moderation_actions is the audit trail of moderation decisions; it has no
+-- foreign keys so entries outlive the reports and users they mention
+CREATE TABLE IF NOT EXISTS moderation_actions (
+    id             BIGSERIAL PRIMARY KEY,
+    report_id      BIGINT NOT NULL,
+    moderator_id   BIGINT NOT NULL,
+    action         VARCHAR(16) NOT NULL,
+    target_type    VARCHAR(16) NOT NULL,
+    target_id      BIGINT NOT NULL,
+    target_user_id BIGINT NOT NULL,
+    note           VARCHAR(500) NOT NULL DEFAULT '',
+    created_at     TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_moderation_actions_report_id ON moderation_actions (report_id);
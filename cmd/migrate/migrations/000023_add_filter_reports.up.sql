@@ -0,0 +1,2 @@
+-- reports filed by the content filter have no reporter
+ALTER TABLE reports ALTER COLUMN reporter_id DROP NOT NULL;
@@ -0,0 +1,8 @@
+-- suspensions stay in suspended_until, so a suspension ends on its own and
+-- leaves the status underneath in place
+ALTER TABLE users
+ADD COLUMN IF NOT EXISTS status VARCHAR(16) NOT NULL DEFAULT 'active' CHECK (status IN ('active', 'banned', 'shadow_banned'));
+
+ALTER TABLE users ADD COLUMN IF NOT EXISTS status_reason VARCHAR(500) NOT NULL DEFAULT '';
+ALTER TABLE users ADD COLUMN IF NOT EXISTS status_changed_by BIGINT REFERENCES users (id) ON DELETE SET NULL;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS status_changed_at TIMESTAMP(0) WITH TIME ZONE;
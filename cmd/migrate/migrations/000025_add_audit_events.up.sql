@@ -0,0 +1,20 @@
+-- audit_events has no foreign keys so entries outlive the users and content
+-- they mention
+CREATE TABLE IF NOT EXISTS audit_events (
+    id           BIGSERIAL PRIMARY KEY,
+    actor_id     BIGINT,
+    action       VARCHAR(32) NOT NULL,
+    target_type  VARCHAR(16) NOT NULL,
+    target_id    BIGINT NOT NULL,
+    -- community_id is set for actions taken within a community
+    community_id BIGINT,
+    request_id   VARCHAR(64) NOT NULL DEFAULT '',
+    ip           VARCHAR(64) NOT NULL DEFAULT '',
+    -- changes maps each changed field to its old and new value
+    changes      JSONB NOT NULL DEFAULT '{}',
+    created_at   TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_audit_events_created_at ON audit_events (created_at, id);
+CREATE INDEX IF NOT EXISTS idx_audit_events_actor_id ON audit_events (actor_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_audit_events_target ON audit_events (target_type, target_id);
@@ -17,7 +17,7 @@ func main(){
 	
 	defer conn.Close()
 
-	store := store.NewStorage(conn)
+	store := store.NewStorage(conn, nil)
 
 	db.Seed(store)
 
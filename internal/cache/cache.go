@@ -0,0 +1,190 @@
+// Package cache keeps recently read users and posts out of Postgres. Get
+// returns nil on a miss; callers read through to the store and Set what they
+// find, and delete entries when the row changes. Entries also expire after a
+// TTL, which bounds how stale another API instance's cache can get.
+package cache
+
+import (
+	"bytes"
+	"context"
+	"encoding/gob"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/nikhilkarle/social/internal/redis"
+	"github.com/nikhilkarle/social/internal/store"
+)
+
+type Storage struct{
+	Users interface{
+		Get(context.Context, int64) (*store.User, error)
+		Set(context.Context, *store.User) error
+		Delete(context.Context, int64) error
+	}
+
+	Posts interface{
+		Get(context.Context, int64) (*store.Post, error)
+		Set(context.Context, *store.Post) error
+		Delete(context.Context, int64) error
+	}
+
+	Stats *Stats
+}
+
+// Stats counts lookups per cache.
+type Stats struct{
+	Users Counter
+	Posts Counter
+}
+
+// Vars reports the counters in the shape expvar publishes.
+func (s *Stats) Vars() map[string]any{
+	return map[string]any{
+		"users": s.Users.Vars(),
+		"posts": s.Posts.Vars(),
+	}
+}
+
+type Counter struct{
+	hits atomic.Int64
+	misses atomic.Int64
+}
+
+func (c *Counter) Hits() int64{
+	return c.hits.Load()
+}
+
+func (c *Counter) Misses() int64{
+	return c.misses.Load()
+}
+
+// HitRatio is the share of lookups that were hits, 0 before any lookups.
+func (c *Counter) HitRatio() float64{
+	hits, misses := c.Hits(), c.Misses()
+	if hits + misses == 0{
+		return 0
+	}
+	return float64(hits) / float64(hits + misses)
+}
+
+func (c *Counter) Vars() map[string]any{
+	return map[string]any{
+		"hits": c.Hits(),
+		"misses": c.Misses(),
+		"hit_ratio": c.HitRatio(),
+	}
+}
+
+// backend stores encoded entries by key.
+type backend interface{
+	get(ctx context.Context, key string) ([]byte, bool, error)
+	set(ctx context.Context, key string, value []byte) error
+	del(ctx context.Context, key string) error
+}
+
+// NewLRUStorage keeps up to size users and size posts in memory, each cache
+// dropping its least recently used entries first.
+func NewLRUStorage(size int, ttl time.Duration) Storage{
+	return newStorage(func(string) backend{
+		return newLRU(size, ttl)
+	})
+}
+
+// NewRedisStorage keeps entries in Redis, shared by every API instance.
+func NewRedisStorage(client *redis.Client, ttl time.Duration) Storage{
+	return newStorage(func(prefix string) backend{
+		return &redisBackend{client: client, prefix: "cache:" + prefix + ":", ttl: ttl}
+	})
+}
+
+func newStorage(newBackend func(prefix string) backend) Storage{
+	stats := &Stats{}
+
+	return Storage{
+		Users: &entityCache[store.User]{
+			backend: newBackend("user"),
+			counter: &stats.Users,
+			id: func(u *store.User) int64{ return u.ID },
+			// Redis is shared, so password hashes stay out of it
+			stripped: func(u *store.User){
+				u.Password = ""
+			},
+		},
+		Posts: &entityCache[store.Post]{
+			backend: newBackend("post"),
+			counter: &stats.Posts,
+			id: func(p *store.Post) int64{ return p.ID },
+			decoded: func(p *store.Post){
+				// gob drops empty slices, which the store returns as [] in JSON
+				if p.Tags == nil{
+					p.Tags = []string{}
+				}
+				if p.Entities == nil{
+					p.Entities = store.Entities{}
+				}
+			},
+		},
+		Stats: stats,
+	}
+}
+
+// entityCache caches one kind of row by ID. Entries are gob encoded, which
+// keeps fields hidden from JSON, such as a user's status, and means callers
+// always get their own copy. Users are cached with their stored
+// status and suspension end, so a suspension still lifts on time.
+type entityCache[T any] struct{
+	backend backend
+	counter *Counter
+	id func(*T) int64
+	// stripped, if set, clears what mustn't be cached from a copy of the
+	// entry before it's encoded
+	stripped func(*T)
+	// decoded, if set, restores what encoding lost
+	decoded func(*T)
+}
+
+func (c *entityCache[T]) Get(ctx context.Context, id int64) (*T, error){
+	data, ok, err := c.backend.get(ctx, strconv.FormatInt(id, 10))
+	if err != nil{
+		return nil, err
+	}
+
+	if !ok{
+		c.counter.misses.Add(1)
+		return nil, nil
+	}
+
+	var v T
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&v); err != nil{
+		// entries from an older version of the type are dropped
+		c.counter.misses.Add(1)
+		return nil, c.backend.del(ctx, strconv.FormatInt(id, 10))
+	}
+
+	if c.decoded != nil{
+		c.decoded(&v)
+	}
+
+	c.counter.hits.Add(1)
+	return &v, nil
+}
+
+func (c *entityCache[T]) Set(ctx context.Context, v *T) error{
+	if c.stripped != nil{
+		entry := *v
+		c.stripped(&entry)
+		v = &entry
+	}
+
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(v); err != nil{
+		return err
+	}
+
+	return c.backend.set(ctx, strconv.FormatInt(c.id(v), 10), buf.Bytes())
+}
+
+func (c *entityCache[T]) Delete(ctx context.Context, id int64) error{
+	return c.backend.del(ctx, strconv.FormatInt(id, 10))
+}
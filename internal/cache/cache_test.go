@@ -0,0 +1,63 @@
+package cache
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/nikhilkarle/social/internal/store"
+)
+
+func TestUserCacheStripsPassword(t *testing.T){
+	storage := NewLRUStorage(10, time.Minute)
+	ctx := context.Background()
+
+	user := &store.User{ID: 1, Username: "alice", Password: "hash", Status: store.AccountActive}
+	if err := storage.Users.Set(ctx, user); err != nil{
+		t.Fatal(err)
+	}
+
+	if user.Password != "hash"{
+		t.Errorf("Set cleared the caller's password")
+	}
+
+	cached, err := storage.Users.Get(ctx, 1)
+	if err != nil{
+		t.Fatal(err)
+	}
+	if cached == nil{
+		t.Fatal("cached user missing")
+	}
+	if cached.Password != ""{
+		t.Errorf("cached password = %q, want it cleared", cached.Password)
+	}
+}
+
+func TestUserCacheSuspensionExpires(t *testing.T){
+	storage := NewLRUStorage(10, time.Minute)
+	ctx := context.Background()
+
+	until := time.Now().Add(50 * time.Millisecond).Format(time.RFC3339Nano)
+	user := &store.User{ID: 1, Status: store.AccountActive, SuspendedUntil: &until}
+	if err := storage.Users.Set(ctx, user); err != nil{
+		t.Fatal(err)
+	}
+
+	cached, err := storage.Users.Get(ctx, 1)
+	if err != nil{
+		t.Fatal(err)
+	}
+	if got := cached.EffectiveStatus(); got != store.AccountSuspended{
+		t.Errorf("status during suspension = %q, want %q", got, store.AccountSuspended)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+
+	cached, err = storage.Users.Get(ctx, 1)
+	if err != nil{
+		t.Fatal(err)
+	}
+	if got := cached.EffectiveStatus(); got != store.AccountActive{
+		t.Errorf("status after suspension = %q, want %q", got, store.AccountActive)
+	}
+}
@@ -0,0 +1,93 @@
+package cache
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+)
+
+type lruEntry struct{
+	key string
+	value []byte
+	expires time.Time
+}
+
+// lru is an in-memory backend holding up to size entries.
+type lru struct{
+	size int
+	ttl time.Duration
+
+	mu sync.Mutex
+	// order has the most recently used entry at the front
+	order *list.List
+	entries map[string]*list.Element
+	now func() time.Time
+}
+
+func newLRU(size int, ttl time.Duration) *lru{
+	return &lru{
+		size: size,
+		ttl: ttl,
+		order: list.New(),
+		entries: map[string]*list.Element{},
+		now: time.Now,
+	}
+}
+
+func (c *lru) get(ctx context.Context, key string) ([]byte, bool, error){
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.entries[key]
+	if !ok{
+		return nil, false, nil
+	}
+
+	entry := el.Value.(*lruEntry)
+	if !c.now().Before(entry.expires){
+		c.remove(el)
+		return nil, false, nil
+	}
+
+	c.order.MoveToFront(el)
+	return entry.value, true, nil
+}
+
+func (c *lru) set(ctx context.Context, key string, value []byte) error{
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	expires := c.now().Add(c.ttl)
+
+	if el, ok := c.entries[key]; ok{
+		entry := el.Value.(*lruEntry)
+		entry.value = value
+		entry.expires = expires
+		c.order.MoveToFront(el)
+		return nil
+	}
+
+	c.entries[key] = c.order.PushFront(&lruEntry{key: key, value: value, expires: expires})
+
+	for c.order.Len() > c.size{
+		c.remove(c.order.Back())
+	}
+
+	return nil
+}
+
+func (c *lru) del(ctx context.Context, key string) error{
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.entries[key]; ok{
+		c.remove(el)
+	}
+	return nil
+}
+
+func (c *lru) remove(el *list.Element){
+	c.order.Remove(el)
+	delete(c.entries, el.Value.(*lruEntry).key)
+}
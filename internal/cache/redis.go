@@ -0,0 +1,34 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/nikhilkarle/social/internal/redis"
+)
+
+type redisBackend struct{
+	client *redis.Client
+	prefix string
+	ttl time.Duration
+}
+
+func (c *redisBackend) get(ctx context.Context, key string) ([]byte, bool, error){
+	data, err := c.client.Get(ctx, c.prefix + key)
+	if errors.Is(err, redis.Nil){
+		return nil, false, nil
+	}
+	if err != nil{
+		return nil, false, err
+	}
+	return data, true, nil
+}
+
+func (c *redisBackend) set(ctx context.Context, key string, value []byte) error{
+	return c.client.Set(ctx, c.prefix + key, value, c.ttl)
+}
+
+func (c *redisBackend) del(ctx context.Context, key string) error{
+	return c.client.Del(ctx, c.prefix + key)
+}
@@ -6,6 +6,7 @@ import (
 	"log"
 	"math/rand"
 
+	"github.com/nikhilkarle/social/internal/markdown"
 	"github.com/nikhilkarle/social/internal/store"
 )
 
@@ -147,10 +148,13 @@ func generatePosts(num int, users []*store.User) []*store.Post{
 	for i := 0; i < num; i++{
 		user := users[rand.Intn(len(users))]
 		
+		content := contents[rand.Intn(len(contents))]
+
 		posts[i] = &store.Post{
 			UserID: user.ID,
 			Title: titles[rand.Intn(len(titles))],
-			Content: contents[rand.Intn(len(contents))],
+			Content: content,
+			ContentHTML: markdown.Render(content),
 			Tags: []string{
 				tags[rand.Intn(len(tags))],
 				tags[rand.Intn(len(tags))],
@@ -27,4 +27,18 @@ func GetInt(key string, fallback int) int{
 	}
 
 	return valAsInt
-}
\ No newline at end of file
+}
+func GetBool(key string, fallback bool) bool{
+	val, ok := os.LookupEnv(key)
+	if !ok{
+		return fallback
+	}
+
+	valAsBool, err := strconv.ParseBool(val)
+
+	if err != nil{
+		return fallback
+	}
+
+	return valAsBool
+}
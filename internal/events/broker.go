@@ -0,0 +1,277 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	TypeFeed = "feed"
+	TypeNotification = "notification"
+	TypeComment = "comment"
+	TypeMessage = "message"
+	TypeRead = "read"
+	TypeTyping = "typing"
+)
+
+var (
+	// how long published events stay available for Last-Event-ID resumes
+	ReplayWindow = 2 * time.Minute
+	// per-subscriber buffer; subscribers that fall this far behind are dropped
+	SubscriberBuffer = 64
+)
+
+// Event is pushed to the clients subscribed to its topic. IDs grow over time
+// so clients can resume after the last one they saw.
+type Event struct{
+	ID string `json:"id"`
+	Topic string `json:"topic"`
+	// Topics, when set, sends the event to each of these topics instead of
+	// Topic, so one publish can reach many users
+	Topics []string `json:"topics,omitempty"`
+	Type string `json:"type"`
+	Data json.RawMessage `json:"data"`
+	publishedAt time.Time
+}
+
+// MaxPayloadBytes is the most an encoded event may take; pg_notify refuses
+// payloads of 8000 bytes or more.
+const MaxPayloadBytes = 7999
+
+// SplitTopics groups topics so that e, sent to each group through Topics,
+// encodes to at most MaxPayloadBytes once published. A topic that can't fit
+// with the rest of the event still gets a group of its own.
+func SplitTopics(e Event, topics []string) [][]string{
+	// IDs are assigned on publish and are at most 20 digits
+	e.ID = "00000000000000000000"
+	e.Topics = nil
+	base, err := json.Marshal(e)
+	if err != nil{
+		return [][]string{topics}
+	}
+	size := len(base) + len(`,"topics":[]`)
+
+	var groups [][]string
+	var group []string
+	groupSize := size
+
+	for _, topic := range topics{
+		quoted, _ := json.Marshal(topic)
+		// the comma before every topic but the first is counted anyway
+		n := len(quoted) + 1
+
+		if len(group) > 0 && groupSize + n > MaxPayloadBytes{
+			groups = append(groups, group)
+			group, groupSize = nil, size
+		}
+
+		group = append(group, topic)
+		groupSize += n
+	}
+
+	if len(group) > 0{
+		groups = append(groups, group)
+	}
+
+	return groups
+}
+
+// UserTopic carries a user's own feed items, notifications and messages.
+func UserTopic(userID int64) string{
+	return "user:" + strconv.FormatInt(userID, 10)
+}
+
+// PostCommentsTopic carries new comments on a post.
+func PostCommentsTopic(postID int64) string{
+	return "post:" + strconv.FormatInt(postID, 10) + ":comments"
+}
+
+// ConversationTopic carries a conversation's messages, read receipts and
+// typing indicators.
+func ConversationTopic(conversationID int64) string{
+	return "conversation:" + strconv.FormatInt(conversationID, 10)
+}
+
+// Transport carries published events to the brokers of every API instance,
+// including the one that published them.
+type Transport interface{
+	Send(context.Context, Event) error
+}
+
+type Subscription struct{
+	C <-chan Event
+	// Replay holds the buffered events after the requested Last-Event-ID
+	Replay []Event
+	// Dropped is closed when the broker gives up on a subscriber that couldn't keep up
+	Dropped <-chan struct{}
+
+	ch chan Event
+	dropped chan struct{}
+	topic string
+	once sync.Once
+}
+
+type Broker struct{
+	mu sync.Mutex
+	subs map[string]map[*Subscription]struct{}
+	history map[string][]Event
+	lastID atomic.Int64
+	transport Transport
+}
+
+func NewBroker() *Broker{
+	return &Broker{
+		subs: map[string]map[*Subscription]struct{}{},
+		history: map[string][]Event{},
+	}
+}
+
+// SetTransport routes published events through t. Without a transport events
+// only reach subscribers of this broker.
+func (b *Broker) SetTransport(t Transport){
+	b.transport = t
+}
+
+// Publish assigns the event an ID and sends it to the topic's subscribers.
+func (b *Broker) Publish(ctx context.Context, e Event) error{
+	e.ID = b.nextID()
+
+	if b.transport != nil{
+		return b.transport.Send(ctx, e)
+	}
+
+	b.Deliver(e)
+	return nil
+}
+
+// nextID returns a unique, increasing ID based on the current time in nanoseconds.
+func (b *Broker) nextID() string{
+	for{
+		last := b.lastID.Load()
+		id := max(time.Now().UnixNano(), last+1)
+		if b.lastID.CompareAndSwap(last, id){
+			return strconv.FormatInt(id, 10)
+		}
+	}
+}
+
+// Deliver hands an event that went through the transport to local subscribers.
+func (b *Broker) Deliver(e Event){
+	e.publishedAt = time.Now()
+
+	topics := e.Topics
+	if len(topics) == 0{
+		topics = []string{e.Topic}
+	}
+	e.Topics = nil
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for _, topic := range topics{
+		e.Topic = topic
+		b.history[topic] = append(prune(b.history[topic]), e)
+
+		for sub := range b.subs[topic]{
+			select{
+			case sub.ch <- e:
+			default:
+				b.drop(sub)
+			}
+		}
+	}
+}
+
+// Subscribe registers for the topic's events. When lastEventID is set, the
+// buffered events published after it are returned in Replay.
+func (b *Broker) Subscribe(topic string, lastEventID string) *Subscription{
+	sub := &Subscription{
+		ch: make(chan Event, SubscriberBuffer),
+		dropped: make(chan struct{}),
+		topic: topic,
+	}
+	sub.C = sub.ch
+	sub.Dropped = sub.dropped
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if lastEventID != ""{
+		if after, err := strconv.ParseInt(lastEventID, 10, 64); err == nil{
+			for _, e := range prune(b.history[topic]){
+				if id, _ := strconv.ParseInt(e.ID, 10, 64); id > after{
+					sub.Replay = append(sub.Replay, e)
+				}
+			}
+		}
+	}
+
+	if b.subs[topic] == nil{
+		b.subs[topic] = map[*Subscription]struct{}{}
+	}
+	b.subs[topic][sub] = struct{}{}
+
+	return sub
+}
+
+func (b *Broker) Unsubscribe(sub *Subscription){
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.remove(sub)
+}
+
+// drop disconnects a subscriber whose buffer is full. Callers hold b.mu.
+func (b *Broker) drop(sub *Subscription){
+	b.remove(sub)
+	sub.once.Do(func(){
+		close(sub.dropped)
+	})
+}
+
+func (b *Broker) remove(sub *Subscription){
+	subs := b.subs[sub.topic]
+	delete(subs, sub)
+	if len(subs) == 0{
+		delete(b.subs, sub.topic)
+	}
+}
+
+// Run prunes expired replay history until ctx is done.
+func (b *Broker) Run(ctx context.Context){
+	ticker := time.NewTicker(ReplayWindow)
+	defer ticker.Stop()
+
+	for{
+		select{
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			b.mu.Lock()
+			for topic, events := range b.history{
+				if events = prune(events); len(events) == 0{
+					delete(b.history, topic)
+				} else{
+					b.history[topic] = events
+				}
+			}
+			b.mu.Unlock()
+		}
+	}
+}
+
+// prune drops events older than ReplayWindow.
+func prune(events []Event) []Event{
+	cutoff := time.Now().Add(-ReplayWindow)
+
+	i := 0
+	for i < len(events) && events[i].publishedAt.Before(cutoff){
+		i++
+	}
+
+	return events[i:]
+}
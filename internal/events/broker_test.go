@@ -0,0 +1,186 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// publish publishes e on a broker without a transport and returns its ID.
+func publish(t *testing.T, b *Broker, e Event) string{
+	t.Helper()
+
+	if err := b.Publish(context.Background(), e); err != nil{
+		t.Fatal(err)
+	}
+
+	return strconv.FormatInt(b.lastID.Load(), 10)
+}
+
+func receive(t *testing.T, sub *Subscription) Event{
+	t.Helper()
+
+	select{
+	case e := <-sub.C:
+		return e
+	case <-time.After(time.Second):
+		t.Fatal("no event received")
+		return Event{}
+	}
+}
+
+func assertNoEvent(t *testing.T, sub *Subscription){
+	t.Helper()
+
+	select{
+	case e := <-sub.C:
+		t.Fatalf("unexpected event %+v", e)
+	default:
+	}
+}
+
+func TestBrokerRoutesByTopic(t *testing.T){
+	b := NewBroker()
+
+	alice := b.Subscribe(UserTopic(1), "")
+	bob := b.Subscribe(UserTopic(2), "")
+	carol := b.Subscribe(UserTopic(3), "")
+
+	publish(t, b, Event{Topic: UserTopic(1), Type: TypeNotification, Data: json.RawMessage(`{}`)})
+
+	if e := receive(t, alice); e.Topic != UserTopic(1) || e.Type != TypeNotification{
+		t.Errorf("alice got %+v", e)
+	}
+	assertNoEvent(t, bob)
+
+	publish(t, b, Event{Topics: []string{UserTopic(2), UserTopic(3)}, Type: TypeFeed, Data: json.RawMessage(`{}`)})
+
+	for _, sub := range []*Subscription{bob, carol}{
+		e := receive(t, sub)
+		if e.Topic != sub.topic || e.Topics != nil{
+			t.Errorf("%s got topic %q, topics %q", sub.topic, e.Topic, e.Topics)
+		}
+	}
+	assertNoEvent(t, alice)
+
+	b.Unsubscribe(alice)
+	publish(t, b, Event{Topic: UserTopic(1), Type: TypeNotification})
+	assertNoEvent(t, alice)
+}
+
+func TestBrokerReplay(t *testing.T){
+	b := NewBroker()
+	topic := PostCommentsTopic(7)
+
+	first := publish(t, b, Event{Topic: topic, Type: TypeComment, Data: json.RawMessage(`1`)})
+	publish(t, b, Event{Topic: topic, Type: TypeComment, Data: json.RawMessage(`2`)})
+	publish(t, b, Event{Topic: PostCommentsTopic(8), Type: TypeComment, Data: json.RawMessage(`3`)})
+	publish(t, b, Event{Topic: topic, Type: TypeComment, Data: json.RawMessage(`4`)})
+
+	sub := b.Subscribe(topic, first)
+	if len(sub.Replay) != 2 || string(sub.Replay[0].Data) != "2" || string(sub.Replay[1].Data) != "4"{
+		t.Errorf("replay after the first event = %+v, want events 2 and 4", sub.Replay)
+	}
+
+	if sub := b.Subscribe(topic, ""); sub.Replay != nil{
+		t.Errorf("replay without Last-Event-ID = %+v, want none", sub.Replay)
+	}
+
+	if sub := b.Subscribe(topic, "not-an-id"); sub.Replay != nil{
+		t.Errorf("replay with a bad Last-Event-ID = %+v, want none", sub.Replay)
+	}
+
+	// events older than the replay window are gone
+	window := ReplayWindow
+	ReplayWindow = 0
+	defer func(){ ReplayWindow = window }()
+
+	if sub := b.Subscribe(topic, first); sub.Replay != nil{
+		t.Errorf("replay past the window = %+v, want none", sub.Replay)
+	}
+}
+
+func TestBrokerDropsSlowSubscribers(t *testing.T){
+	b := NewBroker()
+	topic := UserTopic(1)
+
+	slow := b.Subscribe(topic, "")
+	fast := b.Subscribe(topic, "")
+
+	for i := 0; i < SubscriberBuffer; i++{
+		publish(t, b, Event{Topic: topic, Type: TypeFeed})
+		receive(t, fast)
+	}
+
+	select{
+	case <-slow.Dropped:
+		t.Fatal("dropped with room left in its buffer")
+	default:
+	}
+
+	publish(t, b, Event{Topic: topic, Type: TypeFeed})
+	receive(t, fast)
+
+	select{
+	case <-slow.Dropped:
+	default:
+		t.Fatal("slow subscriber wasn't dropped")
+	}
+
+	// dropping twice, or unsubscribing afterwards, mustn't panic
+	publish(t, b, Event{Topic: topic, Type: TypeFeed})
+	b.Unsubscribe(slow)
+
+	if len(slow.C) != SubscriberBuffer{
+		t.Errorf("slow subscriber has %d events queued, want %d", len(slow.C), SubscriberBuffer)
+	}
+}
+
+func TestSplitTopics(t *testing.T){
+	data, _ := json.Marshal(map[string]any{"post_id": 123, "author_id": 456, "created_at": "2024-01-02T03:04:05Z"})
+	e := Event{Type: TypeFeed, Data: data}
+
+	var topics []string
+	for i := int64(1); i <= 3000; i++{
+		topics = append(topics, UserTopic(i * 1_000_000_007))
+	}
+
+	groups := SplitTopics(e, topics)
+	if len(groups) < 2{
+		t.Fatalf("got %d groups, want the topics split", len(groups))
+	}
+
+	var all []string
+	for _, group := range groups{
+		e.ID = strings.Repeat("9", 20)
+		e.Topics = group
+		payload, err := json.Marshal(e)
+		if err != nil{
+			t.Fatal(err)
+		}
+		if len(payload) > MaxPayloadBytes{
+			t.Errorf("group of %d topics encodes to %d bytes, over %d", len(group), len(payload), MaxPayloadBytes)
+		}
+		all = append(all, group...)
+	}
+
+	if strings.Join(all, ",") != strings.Join(topics, ","){
+		t.Error("groups don't hold every topic once, in order")
+	}
+
+	if groups := SplitTopics(e, []string{UserTopic(1)}); len(groups) != 1 || len(groups[0]) != 1{
+		t.Errorf("one topic split into %q", groups)
+	}
+
+	if groups := SplitTopics(e, nil); len(groups) != 0{
+		t.Errorf("no topics split into %q", groups)
+	}
+
+	huge := strings.Repeat("x", MaxPayloadBytes)
+	if groups := SplitTopics(e, []string{"a", huge, "b"}); len(groups) != 3{
+		t.Errorf("a topic too big to share got grouped: %d groups", len(groups))
+	}
+}
@@ -0,0 +1,81 @@
+package events
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/lib/pq"
+	"go.uber.org/zap"
+)
+
+// pg_notify payloads must stay under 8000 bytes, so events only carry IDs and
+// small summaries.
+const notifyChannel = "social_events"
+
+// PostgresTransport fans events out to every API instance through Postgres
+// LISTEN/NOTIFY.
+type PostgresTransport struct{
+	db *sql.DB
+	addr string
+	broker *Broker
+	logger *zap.SugaredLogger
+}
+
+func NewPostgresTransport(db *sql.DB, addr string, broker *Broker, logger *zap.SugaredLogger) *PostgresTransport{
+	return &PostgresTransport{db: db, addr: addr, broker: broker, logger: logger}
+}
+
+func (t *PostgresTransport) Send(ctx context.Context, e Event) error{
+	payload, err := json.Marshal(e)
+	if err != nil{
+		return err
+	}
+
+	_, err = t.db.ExecContext(ctx, `SELECT pg_notify($1, $2)`, notifyChannel, string(payload))
+	return err
+}
+
+// Run listens for events from all instances and delivers them to the local
+// broker until ctx is done.
+func (t *PostgresTransport) Run(ctx context.Context) error{
+	listener := pq.NewListener(t.addr, time.Second, time.Minute, func(ev pq.ListenerEventType, err error){
+		if err != nil{
+			t.logger.Warnw("events listener", "event", ev, "error", err.Error())
+		}
+	})
+	defer listener.Close()
+
+	if err := listener.Listen(notifyChannel); err != nil{
+		return err
+	}
+
+	ping := time.NewTicker(time.Minute)
+	defer ping.Stop()
+
+	for{
+		select{
+		case <-ctx.Done():
+			return nil
+		case n := <-listener.Notify:
+			// nil after a reconnect. Postgres doesn't queue notifications for
+			// a listener that's gone, so events sent meanwhile are lost and
+			// clients only get them on their next full read
+			if n == nil{
+				t.logger.Warnw("events listener reconnected; events sent while it was disconnected were lost")
+				continue
+			}
+
+			var e Event
+			if err := json.Unmarshal([]byte(n.Extra), &e); err != nil{
+				t.logger.Warnw("events listener: bad payload", "error", err.Error())
+				continue
+			}
+
+			t.broker.Deliver(e)
+		case <-ping.C:
+			go listener.Ping()
+		}
+	}
+}
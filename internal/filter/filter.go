@@ -0,0 +1,187 @@
+// Package filter screens user content before it's stored. A Filter runs a
+// pipeline of rules; each rule that matches applies its mode, and the
+// strictest mode wins.
+package filter
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+)
+
+// Modes, from least to most strict.
+const (
+	ModeAllow = "allow"
+	// ModeFlag stores the content and queues it for moderator review
+	ModeFlag = "flag"
+	// ModeHold stores the content hidden until a moderator approves it
+	ModeHold = "hold"
+	// ModeReject refuses the content
+	ModeReject = "reject"
+)
+
+var modeRank = map[string]int{ModeAllow: 0, ModeFlag: 1, ModeHold: 2, ModeReject: 3}
+
+// Content is what gets screened.
+type Content struct{
+	UserID int64
+	// Kind is "post" or "comment"
+	Kind string
+	Text string
+}
+
+// Rule checks content, returning a reason when it matches.
+type Rule interface{
+	Name() string
+	Check(ctx context.Context, c Content) (reason string, matched bool, err error)
+}
+
+type Match struct{
+	Rule string `json:"rule"`
+	Mode string `json:"mode"`
+	Reason string `json:"reason"`
+}
+
+type Verdict struct{
+	Mode string
+	Matches []Match
+}
+
+// Reasons describes the matches for moderators and users.
+func (v Verdict) Reasons() []string{
+	reasons := make([]string, len(v.Matches))
+	for i, m := range v.Matches{
+		reasons[i] = m.Rule + ": " + m.Reason
+	}
+	return reasons
+}
+
+type step struct{
+	rule Rule
+	mode string
+}
+
+type Filter struct{
+	steps []step
+}
+
+// New returns a filter without rules, which allows everything.
+func New() *Filter{
+	return &Filter{}
+}
+
+// Add appends a rule applying mode when it matches.
+func (f *Filter) Add(rule Rule, mode string) error{
+	if _, ok := modeRank[mode]; !ok{
+		return fmt.Errorf("rule %s: unknown mode %q", rule.Name(), mode)
+	}
+
+	f.steps = append(f.steps, step{rule: rule, mode: mode})
+	return nil
+}
+
+// Check runs every rule. Rules run even after a match so that moderators see
+// all the reasons.
+func (f *Filter) Check(ctx context.Context, c Content) (Verdict, error){
+	verdict := Verdict{Mode: ModeAllow}
+
+	for _, s := range f.steps{
+		reason, matched, err := s.rule.Check(ctx, c)
+		if err != nil{
+			return verdict, fmt.Errorf("rule %s: %w", s.rule.Name(), err)
+		}
+
+		if !matched{
+			continue
+		}
+
+		verdict.Matches = append(verdict.Matches, Match{Rule: s.rule.Name(), Mode: s.mode, Reason: reason})
+		if modeRank[s.mode] > modeRank[verdict.Mode]{
+			verdict.Mode = s.mode
+		}
+	}
+
+	return verdict, nil
+}
+
+// Config is the file format Load reads.
+//
+//	{"rules": [
+//		{"type": "banned_words", "mode": "reject", "words": ["..."]},
+//		{"type": "denied_domains", "mode": "hold", "domains": ["example.com"]},
+//		{"type": "duplicate", "mode": "reject", "window": "10m", "max_repeats": 2}
+//	]}
+type Config struct{
+	Rules []RuleConfig `json:"rules"`
+}
+
+type RuleConfig struct{
+	Type string `json:"type"`
+	Mode string `json:"mode"`
+	Words []string `json:"words"`
+	Domains []string `json:"domains"`
+	Window string `json:"window"`
+	MaxRepeats int `json:"max_repeats"`
+}
+
+// Load builds a filter from a JSON config file. An empty path gives a filter
+// without rules.
+func Load(path string) (*Filter, error){
+	f := New()
+	if path == ""{
+		return f, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil{
+		return nil, err
+	}
+
+	var cfg Config
+	if err := json.Unmarshal(data, &cfg); err != nil{
+		return nil, fmt.Errorf("content filter config %s: %w", path, err)
+	}
+
+	for i, rc := range cfg.Rules{
+		rule, err := newRule(rc)
+		if err != nil{
+			return nil, fmt.Errorf("content filter config %s: rule %d: %w", path, i, err)
+		}
+
+		if err := f.Add(rule, rc.Mode); err != nil{
+			return nil, fmt.Errorf("content filter config %s: rule %d: %w", path, i, err)
+		}
+	}
+
+	return f, nil
+}
+
+func newRule(rc RuleConfig) (Rule, error){
+	switch rc.Type{
+	case "banned_words":
+		if len(rc.Words) == 0{
+			return nil, fmt.Errorf("banned_words needs words")
+		}
+		return NewBannedWords(rc.Words), nil
+
+	case "denied_domains":
+		if len(rc.Domains) == 0{
+			return nil, fmt.Errorf("denied_domains needs domains")
+		}
+		return NewDeniedDomains(rc.Domains), nil
+
+	case "duplicate":
+		window, err := time.ParseDuration(rc.Window)
+		if err != nil || window <= 0{
+			return nil, fmt.Errorf("duplicate needs a positive window")
+		}
+		if rc.MaxRepeats < 1{
+			return nil, fmt.Errorf("duplicate needs max_repeats of at least 1")
+		}
+		return NewDuplicate(window, rc.MaxRepeats), nil
+	}
+
+	return nil, fmt.Errorf("unknown rule type %q", rc.Type)
+}
@@ -0,0 +1,233 @@
+package filter
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestNormalize(t *testing.T){
+	tests := []struct{
+		text string
+		want []string
+	}{
+		{text: "", want: nil},
+		{text: "Hello World", want: []string{"hello", "world"}},
+		{text: "b4d", want: []string{"bad"}},
+		{text: "B.4.d", want: []string{"bad"}},
+		{text: "b00b", want: []string{"boob"}},
+		{text: "sc@m", want: []string{"scam"}},
+		{text: "this is a scam!", want: []string{"this", "is", "a", "scam"}},
+		{text: "SCAM!!!", want: []string{"scam"}},
+		{text: "(scam)", want: []string{"scam"}},
+		{text: "$scam$ |scam| +scam+ @scam", want: []string{"scam", "scam", "scam", "scam"}},
+		{text: "b a d!", want: []string{"bad"}},
+		{text: "a bad day", want: []string{"a", "bad", "day"}},
+		{text: "123 !!!", want: nil},
+		{text: "don't", want: []string{"dont"}},
+	}
+
+	for _, tt := range tests{
+		if got := Normalize(tt.text); !reflect.DeepEqual(got, tt.want){
+			t.Errorf("Normalize(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestBannedWords(t *testing.T){
+	rule := NewBannedWords([]string{"scam", "bad", "free money"})
+
+	tests := []struct{
+		text string
+		matched bool
+	}{
+		{text: "this is a scam!", matched: true},
+		{text: "SCAM!!!", matched: true},
+		{text: "sc4m", matched: true},
+		{text: "b a d", matched: true},
+		{text: "baaad", matched: true},
+		{text: "get FREE m0ney now", matched: true},
+		{text: "free, money", matched: true},
+		{text: "scampi", matched: false},
+		{text: "ba", matched: false},
+		{text: "free and money", matched: false},
+		{text: "all good", matched: false},
+	}
+
+	for _, tt := range tests{
+		_, matched, err := rule.Check(context.Background(), Content{Text: tt.text})
+		if err != nil{
+			t.Fatalf("Check(%q): %v", tt.text, err)
+		}
+		if matched != tt.matched{
+			t.Errorf("Check(%q) matched = %v, want %v", tt.text, matched, tt.matched)
+		}
+	}
+}
+
+func TestDeniedDomains(t *testing.T){
+	rule := NewDeniedDomains([]string{" Spam.example. ", ""})
+
+	tests := []struct{
+		text string
+		matched bool
+	}{
+		{text: "see https://spam.example/offer", matched: true},
+		{text: "see spam.example", matched: true},
+		{text: "see WWW.SPAM.EXAMPLE/x", matched: true},
+		{text: "see spam[.]example", matched: true},
+		{text: "see spam dot example", matched: true},
+		{text: "see notspam.example", matched: false},
+		{text: "see spam.example.org", matched: false},
+		{text: "no links here", matched: false},
+	}
+
+	for _, tt := range tests{
+		_, matched, err := rule.Check(context.Background(), Content{Text: tt.text})
+		if err != nil{
+			t.Fatalf("Check(%q): %v", tt.text, err)
+		}
+		if matched != tt.matched{
+			t.Errorf("Check(%q) matched = %v, want %v", tt.text, matched, tt.matched)
+		}
+	}
+}
+
+func TestDuplicate(t *testing.T){
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	rule := NewDuplicate(10*time.Minute, 2)
+	rule.now = func() time.Time{ return now }
+
+	check := func(userID int64, text string) bool{
+		t.Helper()
+		_, matched, err := rule.Check(context.Background(), Content{UserID: userID, Text: text})
+		if err != nil{
+			t.Fatal(err)
+		}
+		return matched
+	}
+
+	tests := []struct{
+		name string
+		advance time.Duration
+		userID int64
+		text string
+		matched bool
+	}{
+		{name: "first post", userID: 1, text: "hello there", matched: false},
+		{name: "first repeat", advance: time.Minute, userID: 1, text: "hello there", matched: false},
+		{name: "whitespace and case don't make it new", advance: time.Minute, userID: 1, text: "  HELLO   there ", matched: true},
+		{name: "other users count on their own", userID: 2, text: "hello there", matched: false},
+		{name: "other text", userID: 1, text: "something else", matched: false},
+		{name: "older posts leave the window", advance: 9 * time.Minute, userID: 1, text: "hello there", matched: true},
+		{name: "only one repeat is left in the window", advance: 2 * time.Minute, userID: 1, text: "hello there", matched: false},
+		{name: "window passed", advance: 11 * time.Minute, userID: 1, text: "hello there", matched: false},
+	}
+
+	for _, tt := range tests{
+		now = now.Add(tt.advance)
+		if got := check(tt.userID, tt.text); got != tt.matched{
+			t.Errorf("%s: matched = %v, want %v", tt.name, got, tt.matched)
+		}
+	}
+}
+
+type fixedRule struct{
+	name string
+	matched bool
+	err error
+}
+
+func (r fixedRule) Name() string{
+	return r.name
+}
+
+func (r fixedRule) Check(ctx context.Context, c Content) (string, bool, error){
+	return r.name + " matched", r.matched, r.err
+}
+
+func TestFilterModes(t *testing.T){
+	tests := []struct{
+		name string
+		rules []fixedRule
+		modes []string
+		wantMode string
+		wantReasons []string
+	}{
+		{
+			name: "no rules allows",
+			wantMode: ModeAllow,
+		},
+		{
+			name: "no match allows",
+			rules: []fixedRule{{name: "a"}},
+			modes: []string{ModeReject},
+			wantMode: ModeAllow,
+		},
+		{
+			name: "strictest mode wins",
+			rules: []fixedRule{{name: "a", matched: true}, {name: "b", matched: true}, {name: "c", matched: true}},
+			modes: []string{ModeFlag, ModeReject, ModeHold},
+			wantMode: ModeReject,
+			wantReasons: []string{"a: a matched", "b: b matched", "c: c matched"},
+		},
+		{
+			name: "a later milder match doesn't lower the mode",
+			rules: []fixedRule{{name: "a", matched: true}, {name: "b", matched: true}},
+			modes: []string{ModeHold, ModeFlag},
+			wantMode: ModeHold,
+			wantReasons: []string{"a: a matched", "b: b matched"},
+		},
+		{
+			name: "unmatched rules leave no reason",
+			rules: []fixedRule{{name: "a"}, {name: "b", matched: true}},
+			modes: []string{ModeReject, ModeFlag},
+			wantMode: ModeFlag,
+			wantReasons: []string{"b: b matched"},
+		},
+	}
+
+	for _, tt := range tests{
+		t.Run(tt.name, func(t *testing.T){
+			f := New()
+			for i, rule := range tt.rules{
+				if err := f.Add(rule, tt.modes[i]); err != nil{
+					t.Fatal(err)
+				}
+			}
+
+			verdict, err := f.Check(context.Background(), Content{Text: "text"})
+			if err != nil{
+				t.Fatal(err)
+			}
+
+			if verdict.Mode != tt.wantMode{
+				t.Errorf("mode = %q, want %q", verdict.Mode, tt.wantMode)
+			}
+
+			if reasons := verdict.Reasons(); !slices.Equal(reasons, tt.wantReasons){
+				t.Errorf("reasons = %q, want %q", reasons, tt.wantReasons)
+			}
+		})
+	}
+}
+
+func TestFilterErrors(t *testing.T){
+	f := New()
+
+	if err := f.Add(fixedRule{name: "a"}, "block"); err == nil{
+		t.Error("Add accepted an unknown mode")
+	}
+
+	boom := errors.New("boom")
+	if err := f.Add(fixedRule{name: "a", err: boom}, ModeFlag); err != nil{
+		t.Fatal(err)
+	}
+
+	if _, err := f.Check(context.Background(), Content{}); !errors.Is(err, boom){
+		t.Errorf("Check error = %v, want %v", err, boom)
+	}
+}
@@ -0,0 +1,292 @@
+package filter
+
+import (
+	"context"
+	"hash/fnv"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+// leet maps look-alike characters to the letters they stand in for.
+var leet = map[rune]rune{
+	'0': 'o', '1': 'i', '3': 'e', '4': 'a', '5': 's', '7': 't', '8': 'b', '9': 'g',
+	'@': 'a', '$': 's', '!': 'i', '|': 'i', '+': 't', '€': 'e',
+}
+
+// Normalize splits text into lowercase words of letters only, undoing
+// leetspeak and dropping separators inside words, so "B.4.d" and "b4d" both
+// become "bad". Look-alikes only count between letters, so the "!" of "bad!"
+// is punctuation rather than an "i". Runs of single letters are joined,
+// catching "b a d".
+func Normalize(text string) []string{
+	var words []string
+	var letters []string
+
+	flush := func(){
+		if len(letters) > 1{
+			words = append(words, strings.Join(letters, ""))
+		} else if len(letters) == 1{
+			words = append(words, letters[0])
+		}
+		letters = nil
+	}
+
+	for _, field := range strings.Fields(strings.ToLower(text)){
+		word := normalizeWord(field)
+		switch{
+		case word == "":
+		case len([]rune(word)) == 1:
+			letters = append(letters, word)
+		default:
+			flush()
+			words = append(words, word)
+		}
+	}
+	flush()
+
+	return words
+}
+
+// normalizeWord trims what surrounds the letters of field, then keeps the
+// letters and look-alikes between them.
+func normalizeWord(field string) string{
+	runes := []rune(field)
+
+	first, last := -1, -1
+	for i, r := range runes{
+		if unicode.IsLetter(r){
+			if first < 0{
+				first = i
+			}
+			last = i
+		}
+	}
+
+	if first < 0{
+		return ""
+	}
+
+	var b strings.Builder
+	for _, r := range runes[first:last+1]{
+		if l, ok := leet[r]; ok{
+			r = l
+		}
+		if unicode.IsLetter(r){
+			b.WriteRune(r)
+		}
+	}
+
+	return b.String()
+}
+
+type run struct{
+	letter rune
+	count int
+}
+
+func runs(word string) []run{
+	var rs []run
+	for _, r := range word{
+		if n := len(rs); n > 0 && rs[n-1].letter == r{
+			rs[n-1].count++
+			continue
+		}
+		rs = append(rs, run{letter: r, count: 1})
+	}
+	return rs
+}
+
+// stretches reports whether word is banned with letters repeated, such as
+// "baaad" for "bad", without "as" matching "ass".
+func stretches(word []run, banned []run) bool{
+	if len(word) != len(banned){
+		return false
+	}
+	for i := range word{
+		if word[i].letter != banned[i].letter || word[i].count < banned[i].count{
+			return false
+		}
+	}
+	return true
+}
+
+// BannedWords matches whole words or phrases from a list, after
+// normalization.
+type BannedWords struct{
+	phrases [][][]run
+	texts []string
+}
+
+func NewBannedWords(words []string) *BannedWords{
+	b := &BannedWords{}
+	for _, w := range words{
+		normalized := Normalize(w)
+		if len(normalized) == 0{
+			continue
+		}
+
+		phrase := make([][]run, len(normalized))
+		for i, word := range normalized{
+			phrase[i] = runs(word)
+		}
+
+		b.phrases = append(b.phrases, phrase)
+		b.texts = append(b.texts, strings.Join(normalized, " "))
+	}
+	return b
+}
+
+func (b *BannedWords) Name() string{
+	return "banned_words"
+}
+
+func (b *BannedWords) Check(ctx context.Context, c Content) (string, bool, error){
+	words := Normalize(c.Text)
+	wordRuns := make([][]run, len(words))
+	for i, w := range words{
+		wordRuns[i] = runs(w)
+	}
+
+	for p, phrase := range b.phrases{
+		for i := 0; i+len(phrase) <= len(wordRuns); i++{
+			matched := true
+			for j := range phrase{
+				if !stretches(wordRuns[i+j], phrase[j]){
+					matched = false
+					break
+				}
+			}
+
+			if matched{
+				return "contains banned word \"" + b.texts[p] + "\"", true, nil
+			}
+		}
+	}
+
+	return "", false, nil
+}
+
+var (
+	domainPattern = regexp.MustCompile(`(?i)\b(?:[a-z0-9](?:[a-z0-9-]*[a-z0-9])?\.)+[a-z]{2,}\b`)
+	// obfuscated dots such as "example[.]com" or "example dot com"
+	obfuscatedDot = regexp.MustCompile(`(?i)\s*(?:\[\.\]|\(\.\)|\[dot\]|\(dot\)|\s+dot\s+)\s*`)
+)
+
+// DeniedDomains matches links to listed domains and their subdomains, with
+// or without a scheme.
+type DeniedDomains struct{
+	domains []string
+}
+
+func NewDeniedDomains(domains []string) *DeniedDomains{
+	d := &DeniedDomains{}
+	for _, domain := range domains{
+		domain = strings.Trim(strings.ToLower(strings.TrimSpace(domain)), ".")
+		if domain != ""{
+			d.domains = append(d.domains, domain)
+		}
+	}
+	return d
+}
+
+func (d *DeniedDomains) Name() string{
+	return "denied_domains"
+}
+
+func (d *DeniedDomains) Check(ctx context.Context, c Content) (string, bool, error){
+	text := obfuscatedDot.ReplaceAllString(c.Text, ".")
+
+	for _, host := range domainPattern.FindAllString(text, -1){
+		host = strings.ToLower(host)
+		for _, domain := range d.domains{
+			if host == domain || strings.HasSuffix(host, "."+domain){
+				return "links to denied domain " + domain, true, nil
+			}
+		}
+	}
+
+	return "", false, nil
+}
+
+// Duplicate matches a user posting the same text more than MaxRepeats times
+// within the window. History is kept in memory, so each API instance counts
+// on its own.
+type Duplicate struct{
+	window time.Duration
+	maxRepeats int
+
+	mu sync.Mutex
+	seen map[int64][]fingerprint
+	lastSweep time.Time
+	now func() time.Time
+}
+
+type fingerprint struct{
+	hash uint64
+	at time.Time
+}
+
+func NewDuplicate(window time.Duration, maxRepeats int) *Duplicate{
+	return &Duplicate{
+		window: window,
+		maxRepeats: maxRepeats,
+		seen: map[int64][]fingerprint{},
+		now: time.Now,
+	}
+}
+
+func (d *Duplicate) Name() string{
+	return "duplicate"
+}
+
+func (d *Duplicate) Check(ctx context.Context, c Content) (string, bool, error){
+	h := fnv.New64a()
+	h.Write([]byte(strings.Join(strings.Fields(strings.ToLower(c.Text)), " ")))
+	hash := h.Sum64()
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	now := d.now()
+	cutoff := now.Add(-d.window)
+
+	if now.Sub(d.lastSweep) > d.window{
+		for userID, prints := range d.seen{
+			if prints = recent(prints, cutoff); len(prints) == 0{
+				delete(d.seen, userID)
+			} else{
+				d.seen[userID] = prints
+			}
+		}
+		d.lastSweep = now
+	}
+
+	prints := recent(d.seen[c.UserID], cutoff)
+
+	repeats := 0
+	for _, p := range prints{
+		if p.hash == hash{
+			repeats++
+		}
+	}
+
+	d.seen[c.UserID] = append(prints, fingerprint{hash: hash, at: now})
+
+	if repeats >= d.maxRepeats{
+		return "same content posted repeatedly", true, nil
+	}
+
+	return "", false, nil
+}
+
+// recent drops fingerprints from before cutoff; they're in time order.
+func recent(prints []fingerprint, cutoff time.Time) []fingerprint{
+	i := 0
+	for i < len(prints) && prints[i].at.Before(cutoff){
+		i++
+	}
+	return prints[i:]
+}
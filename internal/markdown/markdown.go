@@ -0,0 +1,359 @@
+// Package markdown renders the Markdown subset allowed in posts to HTML.
+//
+// The output is safe by construction rather than sanitized afterwards: raw
+// HTML in the source is escaped as text, and the renderer only ever emits the
+// tags p, br, strong, em, del, code, pre, blockquote, ul, ol, li and a. Links
+// only carry href and rel="nofollow", and only for http, https and mailto
+// URLs.
+//
+// Supported syntax: paragraphs, hard line breaks, > blockquotes, - and 1.
+// lists, ``` fenced code, `code`, **strong**, *em* or _em_, ~~strike~~,
+// [text](url) links and bare http(s) URLs.
+package markdown
+
+import (
+	"html"
+	"net/url"
+	"strings"
+)
+
+// maxQuoteDepth bounds nested blockquotes; deeper markers are left as text.
+const maxQuoteDepth = 3
+
+// Render converts Markdown source to HTML.
+func Render(src string) string{
+	src = strings.ReplaceAll(src, "\r\n", "\n")
+	lines := strings.Split(src, "\n")
+
+	var b strings.Builder
+	renderBlocks(&b, lines, 0)
+	return b.String()
+}
+
+func renderBlocks(b *strings.Builder, lines []string, depth int){
+	for i := 0; i < len(lines); {
+		line := lines[i]
+		trimmed := strings.TrimSpace(line)
+
+		switch{
+		case trimmed == "":
+			i++
+
+		case strings.HasPrefix(trimmed, "```"):
+			i++
+			var code []string
+			for i < len(lines) && !strings.HasPrefix(strings.TrimSpace(lines[i]), "```"){
+				code = append(code, lines[i])
+				i++
+			}
+			// skip the closing fence; an unclosed fence runs to the end
+			i++
+
+			b.WriteString("<pre><code>")
+			b.WriteString(html.EscapeString(strings.Join(code, "\n")))
+			b.WriteString("</code></pre>")
+
+		case strings.HasPrefix(trimmed, ">") && depth < maxQuoteDepth:
+			var quoted []string
+			for i < len(lines){
+				t := strings.TrimSpace(lines[i])
+				if !strings.HasPrefix(t, ">"){
+					break
+				}
+				t = strings.TrimPrefix(t, ">")
+				quoted = append(quoted, strings.TrimPrefix(t, " "))
+				i++
+			}
+
+			b.WriteString("<blockquote>")
+			renderBlocks(b, quoted, depth+1)
+			b.WriteString("</blockquote>")
+
+		case listMarker(trimmed) != "":
+			i = renderList(b, lines, i)
+
+		default:
+			var para []string
+			for i < len(lines){
+				t := strings.TrimSpace(lines[i])
+				if t == "" || len(para) > 0 && startsBlock(t, depth){
+					break
+				}
+				para = append(para, t)
+				i++
+			}
+
+			b.WriteString("<p>")
+			b.WriteString(renderInline(strings.Join(para, "\n"), true))
+			b.WriteString("</p>")
+		}
+	}
+}
+
+func startsBlock(line string, depth int) bool{
+	return strings.HasPrefix(line, "```") ||
+		strings.HasPrefix(line, ">") && depth < maxQuoteDepth ||
+		listMarker(line) != ""
+}
+
+// listMarker returns "ul" or "ol" when line starts a list item.
+func listMarker(line string) string{
+	if len(line) >= 2 && strings.ContainsRune("-*+", rune(line[0])) && line[1] == ' '{
+		return "ul"
+	}
+
+	digits := 0
+	for digits < len(line) && digits < 9 && line[digits] >= '0' && line[digits] <= '9'{
+		digits++
+	}
+	if digits > 0 && len(line) > digits+1 && (line[digits] == '.' || line[digits] == ')') && line[digits+1] == ' '{
+		return "ol"
+	}
+
+	return ""
+}
+
+// renderList renders the list starting at lines[i], made of items of the same
+// kind. Indented lines continue the previous item.
+func renderList(b *strings.Builder, lines []string, i int) int{
+	kind := listMarker(strings.TrimSpace(lines[i]))
+
+	b.WriteString("<" + kind + ">")
+	for i < len(lines){
+		line := lines[i]
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || listMarker(trimmed) != kind{
+			break
+		}
+
+		item := []string{strings.TrimSpace(trimmed[strings.IndexByte(trimmed, ' '):])}
+		i++
+
+		for i < len(lines){
+			next := lines[i]
+			t := strings.TrimSpace(next)
+			if t == "" || next[0] != ' ' && next[0] != '\t' || listMarker(t) != ""{
+				break
+			}
+			item = append(item, t)
+			i++
+		}
+
+		b.WriteString("<li>")
+		b.WriteString(renderInline(strings.Join(item, "\n"), true))
+		b.WriteString("</li>")
+	}
+	b.WriteString("</" + kind + ">")
+
+	return i
+}
+
+// renderInline renders spans within a block. Links can't nest, so link text
+// is rendered with links off.
+func renderInline(s string, links bool) string{
+	var b strings.Builder
+
+	for i := 0; i < len(s); {
+		c := s[i]
+
+		switch{
+		case c == '\\' && i+1 < len(s) && isPunct(s[i+1]):
+			b.WriteString(html.EscapeString(s[i+1 : i+2]))
+			i += 2
+			continue
+
+		case c == '\n':
+			b.WriteString("<br>")
+			i++
+			continue
+
+		case c == '`':
+			run := runLength(s, i, '`')
+			fence := s[i : i+run]
+			if end := strings.Index(s[i+run:], fence); end >= 0{
+				code := s[i+run : i+run+end]
+				b.WriteString("<code>")
+				b.WriteString(html.EscapeString(code))
+				b.WriteString("</code>")
+				i += run + end + run
+				continue
+			}
+			b.WriteString(fence)
+			i += run
+			continue
+
+		case c == '[' && links:
+			if text, href, n := parseLink(s[i:]); n > 0{
+				writeLink(&b, href, renderInline(text, false))
+				i += n
+				continue
+			}
+
+		case (c == 'h' || c == 'H') && links && (i == 0 || !isWordByte(s[i-1])):
+			if href := autolink(s[i:]); href != ""{
+				writeLink(&b, href, html.EscapeString(href))
+				i += len(href)
+				continue
+			}
+
+		case c == '*' || c == '_' || c == '~':
+			if tag, inner, n := parseEmphasis(s, i); n > 0{
+				b.WriteString("<" + tag + ">")
+				b.WriteString(renderInline(inner, links))
+				b.WriteString("</" + tag + ">")
+				i += n
+				continue
+			}
+		}
+
+		// copy the rest of a delimiter run as text so its parts aren't
+		// retried as shorter delimiters
+		n := 1
+		if c == '*' || c == '_' || c == '~'{
+			n = runLength(s, i, c)
+		}
+		b.WriteString(html.EscapeString(s[i : i+n]))
+		i += n
+	}
+
+	return b.String()
+}
+
+// parseEmphasis matches **strong**, __strong__, *em*, _em_ or ~~del~~ at
+// s[i], returning the tag, the inner text and the length consumed.
+func parseEmphasis(s string, i int) (string, string, int){
+	c := s[i]
+	run := runLength(s, i, c)
+
+	var tag string
+	switch{
+	case c == '~' && run == 2:
+		tag = "del"
+	case c != '~' && run == 2:
+		tag = "strong"
+	case c != '~' && run == 1:
+		tag = "em"
+	default:
+		return "", "", 0
+	}
+
+	// the opening delimiter must be followed by text, and _ must not be in
+	// the middle of a word like snake_case
+	start := i + run
+	if start >= len(s) || isSpace(s[start]){
+		return "", "", 0
+	}
+	if c == '_' && i > 0 && isWordByte(s[i-1]){
+		return "", "", 0
+	}
+
+	delim := s[i:start]
+	for j := start + 1; j+run <= len(s); j++{
+		if s[j:j+run] != delim || isSpace(s[j-1]){
+			continue
+		}
+
+		// the closing run must be exactly as long as the opening one
+		if runLength(s, j, c) != run{
+			j += runLength(s, j, c) - 1
+			continue
+		}
+		if c == '_' && j+run < len(s) && isWordByte(s[j+run]){
+			continue
+		}
+
+		return tag, s[start:j], j + run - i
+	}
+
+	return "", "", 0
+}
+
+// parseLink matches [text](url) at the start of s, returning the link text,
+// the URL and the length consumed. Links to unsafe URLs don't match.
+func parseLink(s string) (string, string, int){
+	close := strings.Index(s, "](")
+	if close < 0 || strings.ContainsAny(s[1:close], "[]\n"){
+		return "", "", 0
+	}
+
+	end := strings.IndexByte(s[close+2:], ')')
+	if end < 0{
+		return "", "", 0
+	}
+
+	text := s[1:close]
+	href := s[close+2 : close+2+end]
+	if text == "" || strings.ContainsAny(href, " \t\n") || !safeURL(href){
+		return "", "", 0
+	}
+
+	return text, href, close + 2 + end + 1
+}
+
+// autolink returns the bare http(s) URL at the start of s, without trailing
+// punctuation.
+func autolink(s string) string{
+	lower := strings.ToLower(s[:min(len(s), 8)])
+	if !strings.HasPrefix(lower, "http://") && !strings.HasPrefix(lower, "https://"){
+		return ""
+	}
+
+	end := strings.IndexAny(s, " \t\n<>\"")
+	if end < 0{
+		end = len(s)
+	}
+
+	href := strings.TrimRight(s[:end], ".,:;!?'*_~")
+	// keep a closing paren only when the URL opened one, as in wiki links
+	for strings.HasSuffix(href, ")") && strings.Count(href, "(") < strings.Count(href, ")"){
+		href = strings.TrimRight(href[:len(href)-1], ".,:;!?'*_~")
+	}
+
+	if !safeURL(href){
+		return ""
+	}
+	return href
+}
+
+func safeURL(href string) bool{
+	u, err := url.Parse(href)
+	if err != nil{
+		return false
+	}
+
+	switch strings.ToLower(u.Scheme){
+	case "http", "https":
+		return u.Host != ""
+	case "mailto":
+		return u.Opaque != ""
+	}
+	return false
+}
+
+func writeLink(b *strings.Builder, href string, text string){
+	b.WriteString(`<a href="`)
+	b.WriteString(html.EscapeString(href))
+	b.WriteString(`" rel="nofollow">`)
+	b.WriteString(text)
+	b.WriteString("</a>")
+}
+
+func runLength(s string, i int, c byte) int{
+	n := 0
+	for i+n < len(s) && s[i+n] == c{
+		n++
+	}
+	return n
+}
+
+func isSpace(c byte) bool{
+	return c == ' ' || c == '\t' || c == '\n'
+}
+
+func isWordByte(c byte) bool{
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c >= 0x80
+}
+
+func isPunct(c byte) bool{
+	return strings.IndexByte("!\"#$%&'()*+,-./:;<=>?@[\\]^_`{|}~", c) >= 0
+}
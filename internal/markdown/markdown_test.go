@@ -0,0 +1,238 @@
+package markdown
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRender(t *testing.T){
+	tests := []struct{
+		name string
+		src string
+		want string
+	}{
+		{
+			name: "paragraphs and line breaks",
+			src: "one\ntwo\n\nthree",
+			want: "<p>one<br>two</p><p>three</p>",
+		},
+		{
+			name: "windows line endings",
+			src: "one\r\ntwo",
+			want: "<p>one<br>two</p>",
+		},
+		{
+			name: "link",
+			src: "[site](https://example.com/a?b=1&c=2)",
+			want: `<p><a href="https://example.com/a?b=1&amp;c=2" rel="nofollow">site</a></p>`,
+		},
+		{
+			name: "mailto link",
+			src: "[mail](mailto:a@example.com)",
+			want: `<p><a href="mailto:a@example.com" rel="nofollow">mail</a></p>`,
+		},
+		{
+			name: "javascript link stays text",
+			src: "[x](javascript:alert(1))",
+			want: "<p>[x](javascript:alert(1))</p>",
+		},
+		{
+			name: "javascript link in another case stays text",
+			src: "[x](JavaScript:alert(1))",
+			want: "<p>[x](JavaScript:alert(1))</p>",
+		},
+		{
+			name: "data link stays text",
+			src: "[x](data:text/html;base64,PHNjcmlwdD4=)",
+			want: "<p>[x](data:text/html;base64,PHNjcmlwdD4=)</p>",
+		},
+		{
+			name: "protocol-relative link stays text",
+			src: "[x](//evil.example/a)",
+			want: "<p>[x](//evil.example/a)</p>",
+		},
+		{
+			name: "relative link stays text",
+			src: "[x](/admin)",
+			want: "<p>[x](/admin)</p>",
+		},
+		{
+			name: "quotes in href are escaped",
+			src: `[x](https://example.com/"onmouseover="alert(1))`,
+			want: `<p><a href="https://example.com/&#34;onmouseover=&#34;alert(1" rel="nofollow">x</a>)</p>`,
+		},
+		{
+			name: "link text is rendered without nested links",
+			src: "[**bold** https://a.example](https://b.example)",
+			want: `<p><a href="https://b.example" rel="nofollow"><strong>bold</strong> https://a.example</a></p>`,
+		},
+		{
+			name: "script tags are escaped",
+			src: "<script>alert(1)</script>",
+			want: "<p>&lt;script&gt;alert(1)&lt;/script&gt;</p>",
+		},
+		{
+			name: "img onerror is escaped",
+			src: `<img src=x onerror="alert(1)">`,
+			want: "<p>&lt;img src=x onerror=&#34;alert(1)&#34;&gt;</p>",
+		},
+		{
+			name: "html inside emphasis is escaped",
+			src: "*<b>hi</b>*",
+			want: "<p><em>&lt;b&gt;hi&lt;/b&gt;</em></p>",
+		},
+		{
+			name: "autolink",
+			src: "see https://example.com/path now",
+			want: `<p>see <a href="https://example.com/path" rel="nofollow">https://example.com/path</a> now</p>`,
+		},
+		{
+			name: "autolink drops trailing punctuation",
+			src: "see https://example.com/path.",
+			want: `<p>see <a href="https://example.com/path" rel="nofollow">https://example.com/path</a>.</p>`,
+		},
+		{
+			name: "autolink drops several trailing marks",
+			src: "is it https://example.com?!",
+			want: `<p>is it <a href="https://example.com" rel="nofollow">https://example.com</a>?!</p>`,
+		},
+		{
+			name: "autolink drops an unopened closing paren",
+			src: "(see https://example.com/a)",
+			want: `<p>(see <a href="https://example.com/a" rel="nofollow">https://example.com/a</a>)</p>`,
+		},
+		{
+			name: "autolink keeps balanced parens",
+			src: "https://en.wikipedia.org/wiki/Go_(language)",
+			want: `<p><a href="https://en.wikipedia.org/wiki/Go_(language)" rel="nofollow">https://en.wikipedia.org/wiki/Go_(language)</a></p>`,
+		},
+		{
+			name: "autolink stops at a quote",
+			src: `https://example.com/"onclick="x`,
+			want: `<p><a href="https://example.com/" rel="nofollow">https://example.com/</a>&#34;onclick=&#34;x</p>`,
+		},
+		{
+			name: "no autolink inside words",
+			src: "xhttps://example.com",
+			want: "<p>xhttps://example.com</p>",
+		},
+		{
+			name: "emphasis",
+			src: "**strong** *em* _em_ ~~del~~",
+			want: "<p><strong>strong</strong> <em>em</em> <em>em</em> <del>del</del></p>",
+		},
+		{
+			name: "nested emphasis",
+			src: "**bold *and em* inside**",
+			want: "<p><strong>bold <em>and em</em> inside</strong></p>",
+		},
+		{
+			name: "emphasis inside strike",
+			src: "~~gone **for good**~~",
+			want: "<p><del>gone <strong>for good</strong></del></p>",
+		},
+		{
+			name: "unclosed emphasis stays text",
+			src: "**not closed and *neither",
+			want: "<p>**not closed and *neither</p>",
+		},
+		{
+			name: "underscores inside words",
+			src: "snake_case_name",
+			want: "<p>snake_case_name</p>",
+		},
+		{
+			name: "escaped delimiters",
+			src: `\*not em\*`,
+			want: "<p>*not em*</p>",
+		},
+		{
+			name: "inline code is escaped and not parsed",
+			src: "`<b>**x**</b>`",
+			want: "<p><code>&lt;b&gt;**x**&lt;/b&gt;</code></p>",
+		},
+		{
+			name: "fenced code",
+			src: "```\n<script>\n**x**\n```\nafter",
+			want: "<pre><code>&lt;script&gt;\n**x**</code></pre><p>after</p>",
+		},
+		{
+			name: "unclosed fence runs to the end",
+			src: "```go\nfunc main(){}\n\n<b>",
+			want: "<pre><code>func main(){}\n\n&lt;b&gt;</code></pre>",
+		},
+		{
+			name: "blockquote",
+			src: "> quoted\n> more\n\nafter",
+			want: "<blockquote><p>quoted<br>more</p></blockquote><p>after</p>",
+		},
+		{
+			name: "blockquotes nest to a limit",
+			src: ">>>> deep",
+			want: "<blockquote><blockquote><blockquote><p>&gt; deep</p></blockquote></blockquote></blockquote>",
+		},
+		{
+			name: "lists",
+			src: "- one\n- two\n  continued\n\n1. first\n2) second",
+			want: "<ul><li>one</li><li>two<br>continued</li></ul><ol><li>first</li><li>second</li></ol>",
+		},
+		{
+			name: "list ends a paragraph",
+			src: "intro\n- item",
+			want: "<p>intro</p><ul><li>item</li></ul>",
+		},
+	}
+
+	for _, tt := range tests{
+		t.Run(tt.name, func(t *testing.T){
+			if got := Render(tt.src); got != tt.want{
+				t.Errorf("Render(%q)\n got %s\nwant %s", tt.src, got, tt.want)
+			}
+		})
+	}
+}
+
+// TestRenderOnlyAllowedTags feeds hostile input through every construct and
+// checks no tag outside the allowed set, and no attribute other than href
+// and rel, makes it into the output.
+func TestRenderOnlyAllowedTags(t *testing.T){
+	allowed := map[string]bool{
+		"p": true, "br": true, "strong": true, "em": true, "del": true, "code": true,
+		"pre": true, "blockquote": true, "ul": true, "ol": true, "li": true, "a": true,
+	}
+
+	src := strings.Join([]string{
+		`<svg onload=alert(1)>`,
+		`**<iframe src="javascript:alert(1)">**`,
+		`[<img src=x onerror=alert(1)>](https://example.com/"><script>)`,
+		`- <style>*{}</style>`,
+		`> <a href="javascript:alert(1)">x</a>`,
+		"`</code><script>`",
+		`https://example.com/<script>alert(1)</script>`,
+		"```\n</code></pre><script>\n```",
+	}, "\n\n")
+
+	out := Render(src)
+
+	for rest := out; ; {
+		open := strings.IndexByte(rest, '<')
+		if open < 0{
+			break
+		}
+		end := strings.IndexByte(rest[open:], '>')
+		if end < 0{
+			t.Fatalf("unterminated tag in %s", out)
+		}
+
+		tag := strings.TrimPrefix(rest[open+1:open+end], "/")
+		name, attrs, _ := strings.Cut(tag, " ")
+		if !allowed[name]{
+			t.Errorf("tag <%s> in output %s", tag, out)
+		}
+		if attrs != "" && (name != "a" || !strings.HasPrefix(attrs, `href="`) || !strings.HasSuffix(attrs, `" rel="nofollow"`)){
+			t.Errorf("attributes %q in output %s", attrs, out)
+		}
+
+		rest = rest[open+end+1:]
+	}
+}
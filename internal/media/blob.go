@@ -0,0 +1,117 @@
+package media
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+var ErrInvalidKey = errors.New("invalid blob key")
+
+// BlobStore keeps uploaded files. Keys are slash separated paths made of
+// [a-z0-9._-] segments.
+type BlobStore interface{
+	Put(ctx context.Context, key string, data []byte, contentType string) error
+	Delete(ctx context.Context, key string) error
+	// URL is where clients download the blob from
+	URL(key string) string
+}
+
+// LocalStore keeps blobs in a directory and serves them itself, which suits
+// development and single-instance deployments.
+type LocalStore struct{
+	dir string
+	baseURL string
+	files http.Handler
+}
+
+// NewLocalStore stores blobs under dir. baseURL is the URL the store's
+// handler is mounted at.
+func NewLocalStore(dir string, baseURL string) (*LocalStore, error){
+	if err := os.MkdirAll(dir, 0o755); err != nil{
+		return nil, err
+	}
+
+	return &LocalStore{
+		dir: dir,
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		files: http.FileServer(http.Dir(dir)),
+	}, nil
+}
+
+func (s *LocalStore) Put(ctx context.Context, key string, data []byte, contentType string) error{
+	path, err := s.path(key)
+	if err != nil{
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil{
+		return err
+	}
+
+	// write then rename so readers never see a partial file
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil{
+		return err
+	}
+
+	return os.Rename(tmp, path)
+}
+
+func (s *LocalStore) Delete(ctx context.Context, key string) error{
+	path, err := s.path(key)
+	if err != nil{
+		return err
+	}
+
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist){
+		return err
+	}
+
+	return nil
+}
+
+func (s *LocalStore) URL(key string) string{
+	return s.baseURL + "/" + key
+}
+
+// ServeHTTP serves blobs by key, with the store's base path already stripped.
+func (s *LocalStore) ServeHTTP(w http.ResponseWriter, r *http.Request){
+	if strings.HasSuffix(r.URL.Path, "/"){
+		http.NotFound(w, r)
+		return
+	}
+
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	s.files.ServeHTTP(w, r)
+}
+
+func (s *LocalStore) path(key string) (string, error){
+	if !validKey(key){
+		return "", ErrInvalidKey
+	}
+	return filepath.Join(s.dir, filepath.FromSlash(key)), nil
+}
+
+func validKey(key string) bool{
+	if key == ""{
+		return false
+	}
+
+	for _, segment := range strings.Split(key, "/"){
+		if segment == "" || segment == "." || segment == ".."{
+			return false
+		}
+
+		for _, r := range segment{
+			if !(r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r == '.' || r == '_' || r == '-'){
+				return false
+			}
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,392 @@
+package media
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/draw"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"net/http"
+)
+
+var (
+	ErrUnsupportedType = errors.New("only JPEG, PNG and GIF images are supported")
+	ErrImageTooLarge = errors.New("image dimensions are too large")
+
+	errGIFFormat = errors.New("gif: malformed block structure")
+)
+
+const (
+	// MaxDimension bounds width and height, checked before decoding so a small
+	// file can't claim a huge canvas
+	MaxDimension = 8192
+	// MaxPixels bounds width times height, which sets the memory a decoded
+	// image takes: 4 bytes a pixel, twice over when a JPEG is rotated
+	MaxPixels = 16_000_000
+	// MaxGIFFrames and MaxGIFPixels bound animated GIFs, whose frames are
+	// all decoded at once; MaxGIFPixels is the sum over the frames
+	MaxGIFFrames = 300
+	MaxGIFPixels = 64_000_000
+	ThumbnailSize = 320
+	jpegQuality = 90
+)
+
+// Image is an upload re-encoded without its metadata, plus a thumbnail.
+type Image struct{
+	ContentType string
+	Data []byte
+	Width int
+	Height int
+	Thumbnail []byte
+	ThumbnailType string
+}
+
+// Process sniffs the upload's type and re-encodes it, dropping EXIF and any
+// other metadata. JPEG orientation is applied to the pixels first so photos
+// keep displaying upright without the tag.
+func Process(data []byte) (*Image, error){
+	contentType := http.DetectContentType(data)
+	switch contentType{
+	case "image/jpeg", "image/png", "image/gif":
+	default:
+		return nil, ErrUnsupportedType
+	}
+
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil{
+		return nil, ErrUnsupportedType
+	}
+
+	if cfg.Width <= 0 || cfg.Height <= 0 || cfg.Width > MaxDimension || cfg.Height > MaxDimension{
+		return nil, ErrImageTooLarge
+	}
+
+	if cfg.Width * cfg.Height > MaxPixels{
+		return nil, ErrImageTooLarge
+	}
+
+	if contentType == "image/gif"{
+		frames, pixels, err := gifFrames(data)
+		if err != nil{
+			return nil, ErrUnsupportedType
+		}
+
+		if frames > MaxGIFFrames || pixels > MaxGIFPixels{
+			return nil, ErrImageTooLarge
+		}
+	}
+
+	img := &Image{ContentType: contentType}
+	var frame image.Image
+	var buf bytes.Buffer
+
+	switch contentType{
+	case "image/gif":
+		// keep every frame of animated GIFs, dropping comment and application
+		// extensions
+		g, err := gif.DecodeAll(bytes.NewReader(data))
+		if err != nil{
+			return nil, ErrUnsupportedType
+		}
+
+		if err := gif.EncodeAll(&buf, g); err != nil{
+			return nil, err
+		}
+
+		frame = g.Image[0]
+	case "image/png":
+		decoded, err := png.Decode(bytes.NewReader(data))
+		if err != nil{
+			return nil, ErrUnsupportedType
+		}
+
+		if err := png.Encode(&buf, decoded); err != nil{
+			return nil, err
+		}
+
+		frame = decoded
+	default:
+		decoded, err := jpeg.Decode(bytes.NewReader(data))
+		if err != nil{
+			return nil, ErrUnsupportedType
+		}
+
+		rgba := orient(toRGBA(decoded), jpegOrientation(data))
+		if err := jpeg.Encode(&buf, rgba, &jpeg.Options{Quality: jpegQuality}); err != nil{
+			return nil, err
+		}
+
+		frame = rgba
+	}
+
+	img.Data = buf.Bytes()
+	img.Width = frame.Bounds().Dx()
+	img.Height = frame.Bounds().Dy()
+
+	var thumb bytes.Buffer
+	scaled := scaleDown(toRGBA(frame), ThumbnailSize)
+
+	// thumbnails of PNGs and GIFs may be transparent, so they stay PNG
+	if contentType == "image/jpeg"{
+		err = jpeg.Encode(&thumb, scaled, &jpeg.Options{Quality: jpegQuality})
+		img.ThumbnailType = "image/jpeg"
+	} else{
+		err = png.Encode(&thumb, scaled)
+		img.ThumbnailType = "image/png"
+	}
+	if err != nil{
+		return nil, err
+	}
+
+	img.Thumbnail = thumb.Bytes()
+	return img, nil
+}
+
+// gifFrames walks a GIF's blocks without decoding them and returns how many
+// frames it has and their total area. It stops counting once either is over
+// its limit.
+func gifFrames(data []byte) (int, int, error){
+	var frames, pixels int
+
+	// header and logical screen descriptor
+	if len(data) < 13{
+		return 0, 0, errGIFFormat
+	}
+	i := 13
+	if flags := data[10]; flags&0x80 != 0{
+		i += 3 << ((flags & 0x07) + 1)
+	}
+
+	// skipSubBlocks moves i past a run of data sub-blocks and its terminator
+	skipSubBlocks := func() error{
+		for{
+			if i >= len(data){
+				return errGIFFormat
+			}
+			n := int(data[i])
+			i++
+			if n == 0{
+				return nil
+			}
+			i += n
+		}
+	}
+
+	for frames <= MaxGIFFrames && pixels <= MaxGIFPixels{
+		if i >= len(data){
+			return 0, 0, errGIFFormat
+		}
+
+		switch data[i]{
+		case 0x21: // extension: label, then sub-blocks
+			i += 2
+			if err := skipSubBlocks(); err != nil{
+				return 0, 0, err
+			}
+		case 0x2C: // image descriptor
+			if i+10 > len(data){
+				return 0, 0, errGIFFormat
+			}
+			w := int(binary.LittleEndian.Uint16(data[i+5:]))
+			h := int(binary.LittleEndian.Uint16(data[i+7:]))
+			flags := data[i+9]
+
+			frames++
+			pixels += w * h
+
+			i += 10
+			if flags&0x80 != 0{
+				i += 3 << ((flags & 0x07) + 1)
+			}
+			// LZW minimum code size, then the image data
+			i++
+			if err := skipSubBlocks(); err != nil{
+				return 0, 0, err
+			}
+		case 0x3B: // trailer
+			return frames, pixels, nil
+		default:
+			return 0, 0, errGIFFormat
+		}
+	}
+
+	return frames, pixels, nil
+}
+
+// Extension returns the file extension for the content types Process accepts.
+func Extension(contentType string) string{
+	switch contentType{
+	case "image/jpeg":
+		return ".jpg"
+	case "image/png":
+		return ".png"
+	case "image/gif":
+		return ".gif"
+	}
+	return ""
+}
+
+func toRGBA(src image.Image) *image.RGBA{
+	if rgba, ok := src.(*image.RGBA); ok && rgba.Rect.Min == (image.Point{}){
+		return rgba
+	}
+
+	b := src.Bounds()
+	dst := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(dst, dst.Rect, src, b.Min, draw.Src)
+	return dst
+}
+
+// scaleDown shrinks src so its longer side is at most size, averaging the
+// source pixels that fall into each destination pixel. Smaller images are
+// returned as they are.
+func scaleDown(src *image.RGBA, size int) *image.RGBA{
+	sw, sh := src.Rect.Dx(), src.Rect.Dy()
+	if sw <= size && sh <= size{
+		return src
+	}
+
+	dw, dh := size, size
+	if sw > sh{
+		dh = max(1, sh*size/sw)
+	} else{
+		dw = max(1, sw*size/sh)
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+
+	for dy := 0; dy < dh; dy++{
+		y0, y1 := dy*sh/dh, (dy+1)*sh/dh
+		for dx := 0; dx < dw; dx++{
+			x0, x1 := dx*sw/dw, (dx+1)*sw/dw
+
+			var r, g, b, a, n int
+			for y := y0; y < y1; y++{
+				row := src.Pix[y*src.Stride:]
+				for x := x0; x < x1; x++{
+					p := row[x*4 : x*4+4]
+					r += int(p[0])
+					g += int(p[1])
+					b += int(p[2])
+					a += int(p[3])
+					n++
+				}
+			}
+
+			d := dst.Pix[dy*dst.Stride+dx*4:]
+			d[0] = uint8(r / n)
+			d[1] = uint8(g / n)
+			d[2] = uint8(b / n)
+			d[3] = uint8(a / n)
+		}
+	}
+
+	return dst
+}
+
+// orient applies an EXIF orientation (1-8) to the pixels.
+func orient(src *image.RGBA, orientation int) *image.RGBA{
+	if orientation < 2 || orientation > 8{
+		return src
+	}
+
+	w, h := src.Rect.Dx(), src.Rect.Dy()
+
+	// orientations 5-8 swap the axes
+	dw, dh := w, h
+	if orientation >= 5{
+		dw, dh = h, w
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+
+	for y := 0; y < h; y++{
+		for x := 0; x < w; x++{
+			var nx, ny int
+			switch orientation{
+			case 2: // mirrored
+				nx, ny = w-1-x, y
+			case 3: // rotated 180
+				nx, ny = w-1-x, h-1-y
+			case 4: // mirrored vertically
+				nx, ny = x, h-1-y
+			case 5: // transposed
+				nx, ny = y, x
+			case 6: // rotated 90 clockwise
+				nx, ny = h-1-y, x
+			case 7: // transversed
+				nx, ny = h-1-y, w-1-x
+			case 8: // rotated 90 counter-clockwise
+				nx, ny = y, w-1-x
+			}
+
+			copy(dst.Pix[ny*dst.Stride+nx*4:ny*dst.Stride+nx*4+4], src.Pix[y*src.Stride+x*4:y*src.Stride+x*4+4])
+		}
+	}
+
+	return dst
+}
+
+// jpegOrientation reads the orientation tag from a JPEG's EXIF segment,
+// returning 1 (upright) when there is none or it can't be parsed.
+func jpegOrientation(data []byte) int{
+	// skip SOI, then walk the segments up to the start of scan
+	for i := 2; i+4 <= len(data); {
+		if data[i] != 0xFF{
+			return 1
+		}
+
+		marker := data[i+1]
+		length := int(binary.BigEndian.Uint16(data[i+2:]))
+		if marker == 0xDA || length < 2 || i+2+length > len(data){
+			return 1
+		}
+
+		segment := data[i+4 : i+2+length]
+		if marker == 0xE1 && bytes.HasPrefix(segment, []byte("Exif\x00\x00")){
+			return exifOrientation(segment[6:])
+		}
+
+		i += 2 + length
+	}
+
+	return 1
+}
+
+func exifOrientation(tiff []byte) int{
+	if len(tiff) < 8{
+		return 1
+	}
+
+	var order binary.ByteOrder
+	switch string(tiff[:2]){
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 1
+	}
+
+	ifd := int(order.Uint32(tiff[4:]))
+	if ifd < 8 || ifd+2 > len(tiff){
+		return 1
+	}
+
+	entries := int(order.Uint16(tiff[ifd:]))
+	for i := 0; i < entries; i++{
+		entry := ifd + 2 + i*12
+		if entry+12 > len(tiff){
+			return 1
+		}
+
+		// orientation is a SHORT stored inline in the value field
+		if order.Uint16(tiff[entry:]) == 0x0112{
+			return int(order.Uint16(tiff[entry+8:]))
+		}
+	}
+
+	return 1
+}
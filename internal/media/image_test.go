@@ -0,0 +1,89 @@
+package media
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/png"
+	"testing"
+)
+
+func encodePNG(t *testing.T, w, h int) []byte{
+	t.Helper()
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewGray(image.Rect(0, 0, w, h))); err != nil{
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func encodeGIF(t *testing.T, w, h, frames int) []byte{
+	t.Helper()
+
+	palette := color.Palette{color.Black, color.White}
+	g := &gif.GIF{}
+	for i := 0; i < frames; i++{
+		g.Image = append(g.Image, image.NewPaletted(image.Rect(0, 0, w, h), palette))
+		g.Delay = append(g.Delay, 10)
+	}
+
+	var buf bytes.Buffer
+	if err := gif.EncodeAll(&buf, g); err != nil{
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// withCanvas rewrites the dimensions a PNG's header claims.
+func withCanvas(data []byte, w, h int) []byte{
+	data = bytes.Clone(data)
+	binary.BigEndian.PutUint32(data[16:], uint32(w))
+	binary.BigEndian.PutUint32(data[20:], uint32(h))
+	// the IHDR checksum covers its type and data
+	binary.BigEndian.PutUint32(data[29:], crc32.ChecksumIEEE(data[12:29]))
+	return data
+}
+
+func TestProcessLimits(t *testing.T){
+	tests := []struct{
+		name string
+		data []byte
+		wantErr error
+	}{
+		{"small png", encodePNG(t, 40, 30), nil},
+		{"too wide", withCanvas(encodePNG(t, 1, 1), MaxDimension + 1, 1), ErrImageTooLarge},
+		{"too many pixels", withCanvas(encodePNG(t, 1, 1), 8000, 8000), ErrImageTooLarge},
+		{"animated gif", encodeGIF(t, 20, 20, 3), nil},
+		{"too many frames", encodeGIF(t, 1, 1, MaxGIFFrames + 1), ErrImageTooLarge},
+		{"too many frame pixels", encodeGIF(t, 4000, 4000, MaxGIFPixels / (4000 * 4000) + 1), ErrImageTooLarge},
+		{"truncated gif", encodeGIF(t, 20, 20, 2)[:40], ErrUnsupportedType},
+		{"not an image", []byte("hello, world"), ErrUnsupportedType},
+	}
+
+	for _, tt := range tests{
+		t.Run(tt.name, func(t *testing.T){
+			img, err := Process(tt.data)
+			if !errors.Is(err, tt.wantErr){
+				t.Fatalf("Process error = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && (img.Width == 0 || len(img.Thumbnail) == 0){
+				t.Errorf("Process = %+v, want an image with a thumbnail", img)
+			}
+		})
+	}
+}
+
+func TestGIFFrames(t *testing.T){
+	frames, pixels, err := gifFrames(encodeGIF(t, 10, 5, 4))
+	if err != nil{
+		t.Fatal(err)
+	}
+	if frames != 4 || pixels != 200{
+		t.Errorf("gifFrames = %d frames, %d pixels; want 4, 200", frames, pixels)
+	}
+}
@@ -0,0 +1,212 @@
+package media
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// S3Config points an S3Store at AWS S3 or any S3-compatible service, such as
+// MinIO running locally.
+type S3Config struct{
+	// Endpoint is the service URL, e.g. https://s3.us-east-1.amazonaws.com
+	// or http://localhost:9000
+	Endpoint string
+	Region string
+	Bucket string
+	AccessKey string
+	SecretKey string
+	// PublicURL is prefixed to keys to build download URLs; it defaults to
+	// the bucket's URL on the endpoint
+	PublicURL string
+}
+
+// S3Store keeps blobs in an S3 bucket, addressed path-style so it also works
+// with S3-compatible services. Requests are signed with AWS Signature V4.
+type S3Store struct{
+	cfg S3Config
+	client *http.Client
+	now func() time.Time
+}
+
+func NewS3Store(cfg S3Config) *S3Store{
+	cfg.Endpoint = strings.TrimSuffix(cfg.Endpoint, "/")
+
+	if cfg.PublicURL == ""{
+		cfg.PublicURL = cfg.Endpoint + "/" + cfg.Bucket
+	}
+	cfg.PublicURL = strings.TrimSuffix(cfg.PublicURL, "/")
+
+	return &S3Store{
+		cfg: cfg,
+		client: &http.Client{Timeout: 30 * time.Second},
+		now: time.Now,
+	}
+}
+
+func (s *S3Store) Put(ctx context.Context, key string, data []byte, contentType string) error{
+	if !validKey(key){
+		return ErrInvalidKey
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, s.objectURL(key), bytes.NewReader(data))
+	if err != nil{
+		return err
+	}
+
+	req.Header.Set("Content-Type", contentType)
+
+	return s.do(req, data)
+}
+
+func (s *S3Store) Delete(ctx context.Context, key string) error{
+	if !validKey(key){
+		return ErrInvalidKey
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, s.objectURL(key), nil)
+	if err != nil{
+		return err
+	}
+
+	return s.do(req, nil)
+}
+
+func (s *S3Store) URL(key string) string{
+	return s.cfg.PublicURL + "/" + key
+}
+
+func (s *S3Store) objectURL(key string) string{
+	return s.cfg.Endpoint + "/" + s.cfg.Bucket + "/" + key
+}
+
+func (s *S3Store) do(req *http.Request, body []byte) error{
+	s.sign(req, body, s.now())
+
+	res, err := s.client.Do(req)
+	if err != nil{
+		return err
+	}
+
+	defer res.Body.Close()
+
+	if res.StatusCode >= 300{
+		msg, _ := io.ReadAll(io.LimitReader(res.Body, 1024))
+		return fmt.Errorf("s3 %s %s: %s: %s", req.Method, req.URL.Path, res.Status, bytes.TrimSpace(msg))
+	}
+
+	return nil
+}
+
+// sign adds an AWS Signature Version 4 Authorization header covering the
+// host and every header already set on the request.
+func (s *S3Store) sign(req *http.Request, body []byte, now time.Time){
+	payloadHash := sha256.Sum256(body)
+	payloadHex := hex.EncodeToString(payloadHash[:])
+
+	amzDate := now.UTC().Format("20060102T150405Z")
+	date := amzDate[:8]
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHex)
+
+	host := req.Host
+	if host == ""{
+		host = req.URL.Host
+	}
+
+	headers := map[string]string{"host": host}
+	for name, values := range req.Header{
+		headers[strings.ToLower(name)] = strings.Join(values, ",")
+	}
+
+	names := make([]string, 0, len(headers))
+	for name := range headers{
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var canonicalHeaders strings.Builder
+	for _, name := range names{
+		canonicalHeaders.WriteString(name + ":" + strings.TrimSpace(headers[name]) + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		canonicalURI(req.URL.Path),
+		canonicalQuery(req.URL.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHex,
+	}, "\n")
+
+	scope := date + "/" + s.cfg.Region + "/s3/aws4_request"
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+
+	key := hmacSHA256([]byte("AWS4"+s.cfg.SecretKey), date)
+	key = hmacSHA256(key, s.cfg.Region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf(
+		"AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.cfg.AccessKey, scope, signedHeaders, signature,
+	))
+}
+
+func hmacSHA256(key []byte, data string) []byte{
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// canonicalURI encodes each path segment as S3 expects, leaving the slashes.
+func canonicalURI(path string) string{
+	if path == ""{
+		return "/"
+	}
+
+	segments := strings.Split(path, "/")
+	for i, segment := range segments{
+		segments[i] = uriEncode(segment)
+	}
+	return strings.Join(segments, "/")
+}
+
+func canonicalQuery(values url.Values) string{
+	pairs := make([]string, 0, len(values))
+	for name, vs := range values{
+		for _, v := range vs{
+			pairs = append(pairs, uriEncode(name)+"="+uriEncode(v))
+		}
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, "&")
+}
+
+// uriEncode percent-encodes everything except the RFC 3986 unreserved
+// characters.
+func uriEncode(s string) string{
+	var b strings.Builder
+	for i := 0; i < len(s); i++{
+		c := s[i]
+		if c >= 'A' && c <= 'Z' || c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '-' || c == '_' || c == '.' || c == '~'{
+			b.WriteByte(c)
+			continue
+		}
+		fmt.Fprintf(&b, "%%%02X", c)
+	}
+	return b.String()
+}
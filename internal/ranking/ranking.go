@@ -0,0 +1,155 @@
+package ranking
+
+import (
+	"hash/fnv"
+	"math"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/nikhilkarle/social/internal/store"
+)
+
+// Signals is everything a Ranker may use besides the post itself.
+type Signals struct{
+	Now time.Time
+	Affinity store.Affinity
+}
+
+// Ranker scores a candidate post for a user; higher scores rank first. Scores
+// must depend only on the post and the signals so rankers can be compared on
+// fixed inputs.
+type Ranker interface{
+	Name() string
+	Score(post store.PostWithMetadata, signals Signals) float64
+}
+
+// Rank orders posts by descending score, falling back to newest first for ties.
+func Rank(r Ranker, posts []store.PostWithMetadata, signals Signals) []store.PostWithMetadata{
+	scores := make(map[int64]float64, len(posts))
+	for _, p := range posts{
+		scores[p.ID] = r.Score(p, signals)
+	}
+
+	ranked := make([]store.PostWithMetadata, len(posts))
+	copy(ranked, posts)
+
+	sort.SliceStable(ranked, func(i, j int) bool{
+		si, sj := scores[ranked[i].ID], scores[ranked[j].ID]
+		if si != sj{
+			return si > sj
+		}
+		if ranked[i].CreatedAt != ranked[j].CreatedAt{
+			return ranked[i].CreatedAt > ranked[j].CreatedAt
+		}
+		return ranked[i].ID > ranked[j].ID
+	})
+
+	return ranked
+}
+
+// Experiment splits users between two rankers. The split is a stable hash of
+// the user ID, so a user always sees the same arm.
+type Experiment struct{
+	Control Ranker
+	Treatment Ranker
+	// TreatmentPercent of users, from 0 to 100, get Treatment
+	TreatmentPercent int
+}
+
+func (e Experiment) For(userID int64) Ranker{
+	if e.Treatment == nil || e.TreatmentPercent <= 0{
+		return e.Control
+	}
+
+	h := fnv.New32a()
+	h.Write([]byte(strconv.FormatInt(userID, 10)))
+
+	if int(h.Sum32()%100) < e.TreatmentPercent{
+		return e.Treatment
+	}
+
+	return e.Control
+}
+
+// Weighted multiplies an exponential recency decay with engagement and
+// affinity boosts:
+//
+//	score = decay(age) * (1 + engagement) * (1 + affinity)
+type Weighted struct{
+	// HalfLife is the age at which the recency factor halves
+	HalfLife time.Duration
+	CommentWeight float64
+	ReactionWeight float64
+	AuthorWeight float64
+	TagWeight float64
+	// AffinitySaturation is the interaction count at which an affinity is worth half its weight
+	AffinitySaturation float64
+}
+
+func NewWeighted() *Weighted{
+	return &Weighted{
+		HalfLife: 12 * time.Hour,
+		CommentWeight: 1.0,
+		ReactionWeight: 0.5,
+		AuthorWeight: 1.5,
+		TagWeight: 0.75,
+		AffinitySaturation: 5,
+	}
+}
+
+func (w *Weighted) Name() string{
+	return "weighted-v1"
+}
+
+func (w *Weighted) Score(post store.PostWithMetadata, signals Signals) float64{
+	decay := 1.0
+	if createdAt, err := time.Parse(time.RFC3339Nano, post.CreatedAt); err == nil && w.HalfLife > 0{
+		age := signals.Now.Sub(createdAt)
+		if age < 0{
+			age = 0
+		}
+		decay = math.Exp2(-age.Hours() / w.HalfLife.Hours())
+	}
+
+	engagement := w.CommentWeight*math.Log1p(float64(post.CommentsCount)) +
+		w.ReactionWeight*math.Log1p(float64(post.ReactionsCount))
+
+	affinity := w.AuthorWeight*w.saturate(signals.Affinity.Authors[post.UserID]) +
+		w.TagWeight*w.tagAffinity(post.Tags, signals.Affinity.Tags)
+
+	return decay * (1 + engagement) * (1 + affinity)
+}
+
+// tagAffinity is the strongest affinity among the post's tags.
+func (w *Weighted) tagAffinity(tags []string, counts map[string]int) float64{
+	best := 0.0
+	for _, tag := range tags{
+		best = math.Max(best, w.saturate(counts[tag]))
+	}
+	return best
+}
+
+// saturate maps an interaction count onto [0, 1).
+func (w *Weighted) saturate(count int) float64{
+	if count <= 0{
+		return 0
+	}
+	return float64(count) / (float64(count) + w.AffinitySaturation)
+}
+
+// Chronological ignores engagement and affinity. It's the baseline to compare
+// other rankers against.
+type Chronological struct{}
+
+func (Chronological) Name() string{
+	return "chronological"
+}
+
+func (Chronological) Score(post store.PostWithMetadata, signals Signals) float64{
+	createdAt, err := time.Parse(time.RFC3339Nano, post.CreatedAt)
+	if err != nil{
+		return 0
+	}
+	return float64(createdAt.Unix())
+}
@@ -0,0 +1,165 @@
+package ranking
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/nikhilkarle/social/internal/store"
+)
+
+var now = time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+
+func post(id int64, userID int64, age time.Duration) store.PostWithMetadata{
+	var p store.PostWithMetadata
+	p.ID = id
+	p.UserID = userID
+	p.CreatedAt = now.Add(-age).Format(time.RFC3339Nano)
+	return p
+}
+
+func TestWeightedScore(t *testing.T){
+	w := NewWeighted()
+
+	withComments := post(1, 1, 0)
+	withComments.CommentsCount = 1
+
+	withReactions := post(1, 1, 0)
+	withReactions.ReactionsCount = 3
+
+	tagged := post(1, 2, 0)
+	tagged.Tags = []string{"go", "rust"}
+
+	badTime := post(1, 1, 0)
+	badTime.CreatedAt = "yesterday"
+
+	affinity := store.Affinity{
+		Authors: map[int64]int{1: 5},
+		Tags: map[string]int{"go": 5, "rust": 15},
+	}
+
+	tests := []struct{
+		name string
+		post store.PostWithMetadata
+		affinity store.Affinity
+		want float64
+	}{
+		{"new post without signals", post(1, 2, 0), store.Affinity{}, 1},
+		{"one half-life old", post(1, 2, 12 * time.Hour), store.Affinity{}, 0.5},
+		{"two half-lives old", post(1, 2, 24 * time.Hour), store.Affinity{}, 0.25},
+		{"future post isn't boosted", post(1, 2, -time.Hour), store.Affinity{}, 1},
+		{"unparsable time isn't decayed", badTime, store.Affinity{}, 1},
+		{"comments", withComments, store.Affinity{}, 1 + math.Log(2)},
+		{"reactions", withReactions, store.Affinity{}, 1 + 0.5 * math.Log(4)},
+		// 5 interactions saturate to 0.5, weighted 1.5
+		{"author affinity", post(1, 1, 0), affinity, 1.75},
+		// the strongest tag counts: 15 / (15 + 5) * 0.75
+		{"tag affinity", tagged, affinity, 1.5625},
+		{"author affinity decays", post(1, 1, 12 * time.Hour), affinity, 0.875},
+	}
+
+	for _, tt := range tests{
+		t.Run(tt.name, func(t *testing.T){
+			got := w.Score(tt.post, Signals{Now: now, Affinity: tt.affinity})
+			if math.Abs(got - tt.want) > 1e-9{
+				t.Errorf("Score = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// fixedRanker scores posts from a table.
+type fixedRanker map[int64]float64
+
+func (fixedRanker) Name() string{
+	return "fixed"
+}
+
+func (r fixedRanker) Score(post store.PostWithMetadata, signals Signals) float64{
+	return r[post.ID]
+}
+
+func TestRank(t *testing.T){
+	posts := []store.PostWithMetadata{
+		post(1, 1, 3 * time.Hour),
+		post(2, 1, 2 * time.Hour),
+		post(3, 1, time.Hour),
+		post(4, 1, time.Hour),
+		post(5, 1, 0),
+	}
+
+	tests := []struct{
+		name string
+		ranker Ranker
+		want []int64
+	}{
+		{"by score", fixedRanker{1: 5, 2: 4, 3: 3, 4: 2, 5: 1}, []int64{1, 2, 3, 4, 5}},
+		// equal scores fall back to newest first, then the higher ID
+		{"ties", fixedRanker{1: 1, 2: 1, 3: 1, 4: 1, 5: 1}, []int64{5, 4, 3, 2, 1}},
+		{"mixed", fixedRanker{1: 2, 2: 0, 3: 2, 4: 0, 5: 1}, []int64{3, 1, 5, 4, 2}},
+		{"chronological", Chronological{}, []int64{5, 4, 3, 2, 1}},
+	}
+
+	for _, tt := range tests{
+		t.Run(tt.name, func(t *testing.T){
+			ranked := Rank(tt.ranker, posts, Signals{Now: now})
+
+			if len(ranked) != len(tt.want){
+				t.Fatalf("got %d posts, want %d", len(ranked), len(tt.want))
+			}
+			for i, p := range ranked{
+				if p.ID != tt.want[i]{
+					t.Fatalf("position %d is post %d, want %d", i, p.ID, tt.want[i])
+				}
+			}
+		})
+	}
+
+	if posts[0].ID != 1 || posts[4].ID != 5{
+		t.Error("Rank reordered its input")
+	}
+}
+
+func TestExperimentFor(t *testing.T){
+	control, treatment := fixedRanker{}, Chronological{}
+
+	tests := []struct{
+		name string
+		experiment Experiment
+		want Ranker
+	}{
+		{"no treatment", Experiment{Control: control, TreatmentPercent: 100}, control},
+		{"zero percent", Experiment{Control: control, Treatment: treatment}, control},
+		{"negative percent", Experiment{Control: control, Treatment: treatment, TreatmentPercent: -1}, control},
+		{"everyone", Experiment{Control: control, Treatment: treatment, TreatmentPercent: 100}, treatment},
+	}
+
+	for _, tt := range tests{
+		t.Run(tt.name, func(t *testing.T){
+			for userID := int64(1); userID <= 100; userID++{
+				if got := tt.experiment.For(userID); got.Name() != tt.want.Name(){
+					t.Fatalf("For(%d) = %s, want %s", userID, got.Name(), tt.want.Name())
+				}
+			}
+		})
+	}
+
+	t.Run("split is stable and close to the percentage", func(t *testing.T){
+		e := Experiment{Control: control, Treatment: treatment, TreatmentPercent: 30}
+
+		treated := 0
+		for userID := int64(1); userID <= 10000; userID++{
+			arm := e.For(userID).Name()
+			if e.For(userID).Name() != arm{
+				t.Fatalf("user %d switched arms", userID)
+			}
+			if arm == treatment.Name(){
+				treated++
+			}
+		}
+
+		if treated < 2700 || treated > 3300{
+			t.Errorf("%d of 10000 users got the treatment, want about 3000", treated)
+		}
+	})
+}
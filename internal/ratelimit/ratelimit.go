@@ -0,0 +1,203 @@
+// Package ratelimit counts requests against quotas. Limiters are keyed by
+// the caller, so one Limiter serves every route and client; each call says
+// which quota applies.
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Algorithms a Limiter can use.
+const (
+	// FixedWindow allows Requests per Window, resetting at the end of each
+	// window. It's cheap but lets a burst of twice the limit through across
+	// a window boundary.
+	FixedWindow = "fixed_window"
+	// TokenBucket refills Requests tokens evenly over Window, smoothing
+	// bursts out.
+	TokenBucket = "token_bucket"
+)
+
+// Limit is a quota of Requests per Window.
+type Limit struct{
+	Requests int
+	Window time.Duration
+}
+
+// Result describes a key's quota after a request.
+type Result struct{
+	Allowed bool
+	Limit int
+	Remaining int
+	// Reset is how long until the quota is fully available again
+	Reset time.Duration
+	// RetryAfter is how long to wait before the next request is allowed; it's
+	// zero while requests are allowed
+	RetryAfter time.Duration
+}
+
+type Limiter interface{
+	// Allow counts a request for key against limit.
+	Allow(ctx context.Context, key string, limit Limit) (Result, error)
+}
+
+// New returns an in-memory limiter for the algorithm. In-memory limiters
+// count per API instance.
+func New(algorithm string) Limiter{
+	if algorithm == TokenBucket{
+		return NewMemoryTokenBucket()
+	}
+	return NewMemoryFixedWindow()
+}
+
+// sweepInterval is how often in-memory limiters drop idle keys.
+const sweepInterval = time.Minute
+
+type window struct{
+	start time.Time
+	count int
+	expires time.Time
+}
+
+type MemoryFixedWindow struct{
+	mu sync.Mutex
+	windows map[string]*window
+	lastSweep time.Time
+	now func() time.Time
+}
+
+func NewMemoryFixedWindow() *MemoryFixedWindow{
+	return &MemoryFixedWindow{windows: map[string]*window{}, now: time.Now}
+}
+
+func (l *MemoryFixedWindow) Allow(ctx context.Context, key string, limit Limit) (Result, error){
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.sweep(now)
+
+	w, ok := l.windows[key]
+	if !ok || !now.Before(w.start.Add(limit.Window)){
+		w = &window{start: now}
+		l.windows[key] = w
+	}
+	w.expires = w.start.Add(limit.Window)
+	w.count++
+
+	return fixedWindowResult(w.count, limit, w.expires.Sub(now)), nil
+}
+
+func (l *MemoryFixedWindow) sweep(now time.Time){
+	if now.Sub(l.lastSweep) < sweepInterval{
+		return
+	}
+
+	for key, w := range l.windows{
+		if !now.Before(w.expires){
+			delete(l.windows, key)
+		}
+	}
+	l.lastSweep = now
+}
+
+// fixedWindowResult builds the result for the count-th request of a window
+// that resets after reset. Rejected requests count too, so a client that
+// keeps retrying stays limited until the window ends.
+func fixedWindowResult(count int, limit Limit, reset time.Duration) Result{
+	res := Result{Limit: limit.Requests, Reset: reset}
+
+	if count > limit.Requests{
+		res.RetryAfter = reset
+		return res
+	}
+
+	res.Allowed = true
+	res.Remaining = limit.Requests - count
+	return res
+}
+
+type bucket struct{
+	tokens float64
+	updated time.Time
+	expires time.Time
+}
+
+type MemoryTokenBucket struct{
+	mu sync.Mutex
+	buckets map[string]*bucket
+	lastSweep time.Time
+	now func() time.Time
+}
+
+func NewMemoryTokenBucket() *MemoryTokenBucket{
+	return &MemoryTokenBucket{buckets: map[string]*bucket{}, now: time.Now}
+}
+
+func (l *MemoryTokenBucket) Allow(ctx context.Context, key string, limit Limit) (Result, error){
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.sweep(now)
+
+	capacity := float64(limit.Requests)
+	rate := capacity / limit.Window.Seconds()
+
+	b, ok := l.buckets[key]
+	if !ok{
+		b = &bucket{tokens: capacity, updated: now}
+		l.buckets[key] = b
+	}
+
+	b.tokens = min(capacity, b.tokens + now.Sub(b.updated).Seconds() * rate)
+	b.updated = now
+
+	allowed := b.tokens >= 1
+	if allowed{
+		b.tokens--
+	}
+
+	res := tokenBucketResult(allowed, b.tokens, limit)
+	b.expires = now.Add(res.Reset)
+	return res, nil
+}
+
+func (l *MemoryTokenBucket) sweep(now time.Time){
+	if now.Sub(l.lastSweep) < sweepInterval{
+		return
+	}
+
+	// a bucket that has refilled is the same as no bucket
+	for key, b := range l.buckets{
+		if !now.Before(b.expires){
+			delete(l.buckets, key)
+		}
+	}
+	l.lastSweep = now
+}
+
+// tokenBucketResult builds the result for a bucket left with tokens.
+func tokenBucketResult(allowed bool, tokens float64, limit Limit) Result{
+	capacity := float64(limit.Requests)
+	rate := capacity / limit.Window.Seconds()
+
+	res := Result{
+		Allowed: allowed,
+		Limit: limit.Requests,
+		Remaining: int(tokens),
+		Reset: seconds((capacity - tokens) / rate),
+	}
+
+	if !allowed{
+		res.RetryAfter = seconds((1 - tokens) / rate)
+	}
+
+	return res
+}
+
+func seconds(s float64) time.Duration{
+	return time.Duration(s * float64(time.Second))
+}
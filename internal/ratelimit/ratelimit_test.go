@@ -0,0 +1,127 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// clock is a settable time source for the limiters' now hook.
+type clock struct{
+	t time.Time
+}
+
+func (c *clock) now() time.Time{
+	return c.t
+}
+
+func (c *clock) advance(d time.Duration){
+	c.t = c.t.Add(d)
+}
+
+type step struct{
+	advance time.Duration
+	key string
+	want Result
+}
+
+func runSteps(t *testing.T, l Limiter, c *clock, limit Limit, steps []step){
+	t.Helper()
+
+	for i, s := range steps{
+		c.advance(s.advance)
+
+		key := s.key
+		if key == ""{
+			key = "a"
+		}
+
+		got, err := l.Allow(context.Background(), key, limit)
+		if err != nil{
+			t.Fatalf("step %d: %v", i, err)
+		}
+		if got != s.want{
+			t.Errorf("step %d (key %s, +%s): got %+v, want %+v", i, key, s.advance, got, s.want)
+		}
+	}
+}
+
+func TestMemoryFixedWindow(t *testing.T){
+	c := &clock{t: time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)}
+	l := NewMemoryFixedWindow()
+	l.now = c.now
+
+	limit := Limit{Requests: 3, Window: time.Minute}
+
+	runSteps(t, l, c, limit, []step{
+		{want: Result{Allowed: true, Limit: 3, Remaining: 2, Reset: time.Minute}},
+		{advance: 10 * time.Second, want: Result{Allowed: true, Limit: 3, Remaining: 1, Reset: 50 * time.Second}},
+		{advance: 10 * time.Second, want: Result{Allowed: true, Limit: 3, Remaining: 0, Reset: 40 * time.Second}},
+		// over the limit until the window ends, retries included
+		{advance: 10 * time.Second, want: Result{Limit: 3, Reset: 30 * time.Second, RetryAfter: 30 * time.Second}},
+		{advance: 29 * time.Second, want: Result{Limit: 3, Reset: time.Second, RetryAfter: time.Second}},
+		// other keys have their own windows
+		{key: "b", want: Result{Allowed: true, Limit: 3, Remaining: 2, Reset: time.Minute}},
+		// a new window starts with the first request after the old one ends
+		{advance: time.Second, want: Result{Allowed: true, Limit: 3, Remaining: 2, Reset: time.Minute}},
+	})
+}
+
+func TestMemoryTokenBucket(t *testing.T){
+	c := &clock{t: time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)}
+	l := NewMemoryTokenBucket()
+	l.now = c.now
+
+	// one token a second, up to 4
+	limit := Limit{Requests: 4, Window: 4 * time.Second}
+
+	runSteps(t, l, c, limit, []step{
+		{want: Result{Allowed: true, Limit: 4, Remaining: 3, Reset: time.Second}},
+		{want: Result{Allowed: true, Limit: 4, Remaining: 2, Reset: 2 * time.Second}},
+		{want: Result{Allowed: true, Limit: 4, Remaining: 1, Reset: 3 * time.Second}},
+		{want: Result{Allowed: true, Limit: 4, Remaining: 0, Reset: 4 * time.Second}},
+		{want: Result{Limit: 4, Remaining: 0, Reset: 4 * time.Second, RetryAfter: time.Second}},
+		// half a token has come back
+		{advance: 500 * time.Millisecond, want: Result{Limit: 4, Remaining: 0, Reset: 3500 * time.Millisecond, RetryAfter: 500 * time.Millisecond}},
+		{advance: 500 * time.Millisecond, want: Result{Allowed: true, Limit: 4, Remaining: 0, Reset: 4 * time.Second}},
+		// other keys have their own buckets
+		{key: "b", want: Result{Allowed: true, Limit: 4, Remaining: 3, Reset: time.Second}},
+		// the bucket never holds more than its capacity
+		{advance: time.Hour, want: Result{Allowed: true, Limit: 4, Remaining: 3, Reset: time.Second}},
+	})
+}
+
+func TestMemoryLimitersSweepIdleKeys(t *testing.T){
+	c := &clock{t: time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)}
+	limit := Limit{Requests: 1, Window: time.Second}
+
+	fixed := NewMemoryFixedWindow()
+	fixed.now = c.now
+	bucket := NewMemoryTokenBucket()
+	bucket.now = c.now
+
+	for _, key := range []string{"a", "b", "c"}{
+		fixed.Allow(context.Background(), key, limit)
+		bucket.Allow(context.Background(), key, limit)
+	}
+
+	c.advance(2 * sweepInterval)
+	fixed.Allow(context.Background(), "d", limit)
+	bucket.Allow(context.Background(), "d", limit)
+
+	if len(fixed.windows) != 1{
+		t.Errorf("fixed window kept %d keys, want 1", len(fixed.windows))
+	}
+	if len(bucket.buckets) != 1{
+		t.Errorf("token bucket kept %d keys, want 1", len(bucket.buckets))
+	}
+}
+
+func TestNew(t *testing.T){
+	if _, ok := New(TokenBucket).(*MemoryTokenBucket); !ok{
+		t.Error("New(TokenBucket) isn't a token bucket")
+	}
+	if _, ok := New(FixedWindow).(*MemoryFixedWindow); !ok{
+		t.Error("New(FixedWindow) isn't a fixed window")
+	}
+}
@@ -0,0 +1,121 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/nikhilkarle/social/internal/redis"
+)
+
+// fixedWindowScript counts a request and returns the count and the window's
+// remaining milliseconds; the key expires with its window.
+const fixedWindowScript = `
+local count = redis.call('INCR', KEYS[1])
+if count == 1 then
+	redis.call('PEXPIRE', KEYS[1], ARGV[1])
+end
+local ttl = redis.call('PTTL', KEYS[1])
+if ttl < 0 then
+	redis.call('PEXPIRE', KEYS[1], ARGV[1])
+	ttl = tonumber(ARGV[1])
+end
+return {count, ttl}
+`
+
+// tokenBucketScript refills the bucket by the time passed on the server's
+// clock, takes a token if there is one and returns whether it did and the
+// tokens left as a string, since Lua numbers are truncated to integers in
+// replies. Buckets expire once they'd be full again.
+const tokenBucketScript = `
+local capacity = tonumber(ARGV[1])
+local rate = tonumber(ARGV[2])
+local t = redis.call('TIME')
+local now = tonumber(t[1]) + tonumber(t[2]) / 1000000
+
+local state = redis.call('HMGET', KEYS[1], 'tokens', 'updated')
+local tokens = tonumber(state[1]) or capacity
+local updated = tonumber(state[2]) or now
+
+tokens = math.min(capacity, tokens + math.max(0, now - updated) * rate)
+
+local allowed = 0
+if tokens >= 1 then
+	tokens = tokens - 1
+	allowed = 1
+end
+
+redis.call('HSET', KEYS[1], 'tokens', tostring(tokens), 'updated', tostring(now))
+redis.call('PEXPIRE', KEYS[1], math.ceil((capacity - tokens) / rate * 1000) + 1000)
+
+return {allowed, tostring(tokens)}
+`
+
+// Redis counts requests in Redis, so every API instance shares the same
+// quotas.
+type Redis struct{
+	client *redis.Client
+	algorithm string
+	prefix string
+}
+
+// NewRedis returns a limiter for the algorithm keeping its state under keys
+// starting with prefix.
+func NewRedis(client *redis.Client, algorithm string, prefix string) *Redis{
+	return &Redis{client: client, algorithm: algorithm, prefix: prefix}
+}
+
+func (l *Redis) Allow(ctx context.Context, key string, limit Limit) (Result, error){
+	if l.algorithm == TokenBucket{
+		return l.tokenBucket(ctx, key, limit)
+	}
+	return l.fixedWindow(ctx, key, limit)
+}
+
+func (l *Redis) fixedWindow(ctx context.Context, key string, limit Limit) (Result, error){
+	reply, err := l.client.Eval(ctx, fixedWindowScript, []string{l.prefix + key}, limit.Window.Milliseconds())
+	if err != nil{
+		return Result{}, err
+	}
+
+	values, ok := reply.([]any)
+	if !ok || len(values) != 2{
+		return Result{}, fmt.Errorf("ratelimit: unexpected reply %v", reply)
+	}
+
+	count, ok1 := values[0].(int64)
+	ttl, ok2 := values[1].(int64)
+	if !ok1 || !ok2{
+		return Result{}, fmt.Errorf("ratelimit: unexpected reply %v", reply)
+	}
+
+	return fixedWindowResult(int(count), limit, time.Duration(ttl) * time.Millisecond), nil
+}
+
+func (l *Redis) tokenBucket(ctx context.Context, key string, limit Limit) (Result, error){
+	rate := float64(limit.Requests) / limit.Window.Seconds()
+
+	reply, err := l.client.Eval(ctx, tokenBucketScript, []string{l.prefix + key}, limit.Requests, rate)
+	if err != nil{
+		return Result{}, err
+	}
+
+	values, ok := reply.([]any)
+	if !ok || len(values) != 2{
+		return Result{}, fmt.Errorf("ratelimit: unexpected reply %v", reply)
+	}
+
+	allowed, ok1 := values[0].(int64)
+	tokensReply, ok2 := values[1].([]byte)
+	if !ok1 || !ok2{
+		return Result{}, fmt.Errorf("ratelimit: unexpected reply %v", reply)
+	}
+
+	tokens, err := strconv.ParseFloat(string(tokensReply), 64)
+	if err != nil{
+		return Result{}, fmt.Errorf("ratelimit: unexpected reply %v", reply)
+	}
+
+	return tokenBucketResult(allowed == 1, tokens, limit), nil
+}
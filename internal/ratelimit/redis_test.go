@@ -0,0 +1,137 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/nikhilkarle/social/internal/redis"
+)
+
+func newTestRedis(t *testing.T, algorithm string) (*Redis, *miniredis.Miniredis){
+	t.Helper()
+
+	m := miniredis.RunT(t)
+	client := redis.NewClient(redis.Config{Addr: m.Addr()})
+	t.Cleanup(func(){ client.Close() })
+
+	return NewRedis(client, algorithm, "ratelimit:"), m
+}
+
+type redisStep struct{
+	advance time.Duration
+	key string
+	want Result
+}
+
+func runRedisSteps(t *testing.T, l *Redis, advance func(time.Duration), limit Limit, steps []redisStep){
+	t.Helper()
+
+	for i, s := range steps{
+		advance(s.advance)
+
+		key := s.key
+		if key == ""{
+			key = "a"
+		}
+
+		got, err := l.Allow(context.Background(), key, limit)
+		if err != nil{
+			t.Fatalf("step %d: %v", i, err)
+		}
+		if got != s.want{
+			t.Errorf("step %d (key %s, +%s): got %+v, want %+v", i, key, s.advance, got, s.want)
+		}
+	}
+}
+
+func TestRedisFixedWindow(t *testing.T){
+	l, m := newTestRedis(t, FixedWindow)
+	limit := Limit{Requests: 3, Window: time.Minute}
+
+	runRedisSteps(t, l, m.FastForward, limit, []redisStep{
+		{want: Result{Allowed: true, Limit: 3, Remaining: 2, Reset: time.Minute}},
+		{advance: 10 * time.Second, want: Result{Allowed: true, Limit: 3, Remaining: 1, Reset: 50 * time.Second}},
+		{advance: 10 * time.Second, want: Result{Allowed: true, Limit: 3, Remaining: 0, Reset: 40 * time.Second}},
+		{advance: 10 * time.Second, want: Result{Limit: 3, Reset: 30 * time.Second, RetryAfter: 30 * time.Second}},
+		{key: "b", want: Result{Allowed: true, Limit: 3, Remaining: 2, Reset: time.Minute}},
+		// the key expires with its window
+		{advance: 30 * time.Second, want: Result{Allowed: true, Limit: 3, Remaining: 2, Reset: time.Minute}},
+	})
+
+	if !m.Exists("ratelimit:a"){
+		t.Error("the window isn't kept under the prefix")
+	}
+}
+
+func TestRedisFixedWindowRestoresLostExpiry(t *testing.T){
+	l, m := newTestRedis(t, FixedWindow)
+	limit := Limit{Requests: 3, Window: time.Minute}
+
+	// a counter left without a TTL would otherwise block the key for good
+	m.Set("ratelimit:a", "5")
+
+	got, err := l.Allow(context.Background(), "a", limit)
+	if err != nil{
+		t.Fatal(err)
+	}
+	if want := (Result{Limit: 3, Reset: time.Minute, RetryAfter: time.Minute}); got != want{
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+	if ttl := m.TTL("ratelimit:a"); ttl != time.Minute{
+		t.Errorf("TTL = %s, want %s", ttl, time.Minute)
+	}
+}
+
+func TestRedisTokenBucket(t *testing.T){
+	l, m := newTestRedis(t, TokenBucket)
+
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	m.SetTime(now)
+	advance := func(d time.Duration){
+		now = now.Add(d)
+		m.SetTime(now)
+		m.FastForward(d)
+	}
+
+	limit := Limit{Requests: 4, Window: 4 * time.Second}
+
+	runRedisSteps(t, l, advance, limit, []redisStep{
+		{want: Result{Allowed: true, Limit: 4, Remaining: 3, Reset: time.Second}},
+		{want: Result{Allowed: true, Limit: 4, Remaining: 2, Reset: 2 * time.Second}},
+		{want: Result{Allowed: true, Limit: 4, Remaining: 1, Reset: 3 * time.Second}},
+		{want: Result{Allowed: true, Limit: 4, Remaining: 0, Reset: 4 * time.Second}},
+		{want: Result{Limit: 4, Remaining: 0, Reset: 4 * time.Second, RetryAfter: time.Second}},
+		{advance: 500 * time.Millisecond, want: Result{Limit: 4, Remaining: 0, Reset: 3500 * time.Millisecond, RetryAfter: 500 * time.Millisecond}},
+		{advance: 500 * time.Millisecond, want: Result{Allowed: true, Limit: 4, Remaining: 0, Reset: 4 * time.Second}},
+		{key: "b", want: Result{Allowed: true, Limit: 4, Remaining: 3, Reset: time.Second}},
+		{advance: 2 * time.Second, want: Result{Allowed: true, Limit: 4, Remaining: 1, Reset: 3 * time.Second}},
+	})
+
+	// the bucket expires a second after it would be full again
+	if ttl := m.TTL("ratelimit:a"); ttl != 4 * time.Second{
+		t.Errorf("TTL = %s, want %s", ttl, 4 * time.Second)
+	}
+
+	advance(time.Hour)
+	if m.Exists("ratelimit:a"){
+		t.Error("a full bucket wasn't expired")
+	}
+}
+
+func TestRedisErrors(t *testing.T){
+	l, m := newTestRedis(t, FixedWindow)
+	limit := Limit{Requests: 3, Window: time.Minute}
+
+	// a key of the wrong type makes the script fail
+	m.HSet("ratelimit:a", "tokens", "1")
+	if _, err := l.Allow(context.Background(), "a", limit); err == nil{
+		t.Error("no error from a failing script")
+	}
+
+	m.Close()
+	if _, err := l.Allow(context.Background(), "b", limit); err == nil{
+		t.Error("no error with the server down")
+	}
+}
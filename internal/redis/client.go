@@ -0,0 +1,337 @@
+// Package redis is a small Redis client speaking RESP2. It covers what the
+// API needs, plain commands and Lua scripts over pooled connections, without
+// pulling in a full client library.
+package redis
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Nil is returned by the helpers when a key doesn't exist; Do returns a nil
+// reply instead.
+var Nil = errors.New("redis: nil")
+
+var errClosed = errors.New("redis: client closed")
+
+// Error is an error reply from the server, such as a script failing. The
+// connection stays usable after one.
+type Error string
+
+func (e Error) Error() string{
+	return string(e)
+}
+
+type Config struct{
+	Addr string
+	Password string
+	DB int
+	// PoolSize is how many idle connections are kept; it defaults to 10
+	PoolSize int
+	DialTimeout time.Duration
+}
+
+type Client struct{
+	cfg Config
+
+	mu sync.Mutex
+	idle []*conn
+	closed bool
+}
+
+type conn struct{
+	nc net.Conn
+	r *bufio.Reader
+	w *bufio.Writer
+}
+
+func NewClient(cfg Config) *Client{
+	if cfg.PoolSize <= 0{
+		cfg.PoolSize = 10
+	}
+	if cfg.DialTimeout <= 0{
+		cfg.DialTimeout = 5 * time.Second
+	}
+
+	return &Client{cfg: cfg}
+}
+
+// Do sends a command and returns its reply: a string for simple strings, an
+// int64 for integers, []byte for bulk strings, []any for arrays and nil for
+// nil replies. Arguments can be strings, byte slices, integers or floats.
+func (c *Client) Do(ctx context.Context, args ...any) (any, error){
+	cn, err := c.get(ctx)
+	if err != nil{
+		return nil, err
+	}
+
+	if deadline, ok := ctx.Deadline(); ok{
+		cn.nc.SetDeadline(deadline)
+	} else{
+		cn.nc.SetDeadline(time.Time{})
+	}
+
+	reply, err := cn.do(args)
+
+	var replyErr Error
+	if err != nil && !errors.As(err, &replyErr){
+		// the connection is in an unknown state after I/O or protocol errors
+		cn.nc.Close()
+		return nil, err
+	}
+
+	c.put(cn)
+	return reply, err
+}
+
+// Ping checks the server is reachable.
+func (c *Client) Ping(ctx context.Context) error{
+	_, err := c.Do(ctx, "PING")
+	return err
+}
+
+// Get returns the value at key, or Nil.
+func (c *Client) Get(ctx context.Context, key string) ([]byte, error){
+	reply, err := c.Do(ctx, "GET", key)
+	if err != nil{
+		return nil, err
+	}
+	if reply == nil{
+		return nil, Nil
+	}
+
+	b, ok := reply.([]byte)
+	if !ok{
+		return nil, fmt.Errorf("redis: unexpected GET reply %T", reply)
+	}
+	return b, nil
+}
+
+// Set stores value at key, expiring after ttl if it's positive.
+func (c *Client) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error{
+	args := []any{"SET", key, value}
+	if ttl > 0{
+		args = append(args, "PX", ttl.Milliseconds())
+	}
+
+	_, err := c.Do(ctx, args...)
+	return err
+}
+
+// Del removes keys.
+func (c *Client) Del(ctx context.Context, keys ...string) error{
+	if len(keys) == 0{
+		return nil
+	}
+
+	args := []any{"DEL"}
+	for _, k := range keys{
+		args = append(args, k)
+	}
+
+	_, err := c.Do(ctx, args...)
+	return err
+}
+
+// Eval runs a Lua script with the given keys and arguments.
+func (c *Client) Eval(ctx context.Context, script string, keys []string, args ...any) (any, error){
+	cmd := []any{"EVAL", script, len(keys)}
+	for _, k := range keys{
+		cmd = append(cmd, k)
+	}
+	cmd = append(cmd, args...)
+
+	return c.Do(ctx, cmd...)
+}
+
+// Close closes the idle connections. Connections in use are closed when
+// they're returned.
+func (c *Client) Close() error{
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.closed = true
+	for _, cn := range c.idle{
+		cn.nc.Close()
+	}
+	c.idle = nil
+
+	return nil
+}
+
+func (c *Client) get(ctx context.Context) (*conn, error){
+	c.mu.Lock()
+	if c.closed{
+		c.mu.Unlock()
+		return nil, errClosed
+	}
+	if n := len(c.idle); n > 0{
+		cn := c.idle[n-1]
+		c.idle = c.idle[:n-1]
+		c.mu.Unlock()
+		return cn, nil
+	}
+	c.mu.Unlock()
+
+	return c.dial(ctx)
+}
+
+func (c *Client) put(cn *conn){
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.closed || len(c.idle) >= c.cfg.PoolSize{
+		cn.nc.Close()
+		return
+	}
+	c.idle = append(c.idle, cn)
+}
+
+func (c *Client) dial(ctx context.Context) (*conn, error){
+	d := net.Dialer{Timeout: c.cfg.DialTimeout}
+	nc, err := d.DialContext(ctx, "tcp", c.cfg.Addr)
+	if err != nil{
+		return nil, err
+	}
+
+	cn := &conn{nc: nc, r: bufio.NewReader(nc), w: bufio.NewWriter(nc)}
+
+	if deadline, ok := ctx.Deadline(); ok{
+		nc.SetDeadline(deadline)
+	}
+
+	if c.cfg.Password != ""{
+		if _, err := cn.do([]any{"AUTH", c.cfg.Password}); err != nil{
+			nc.Close()
+			return nil, err
+		}
+	}
+
+	if c.cfg.DB != 0{
+		if _, err := cn.do([]any{"SELECT", c.cfg.DB}); err != nil{
+			nc.Close()
+			return nil, err
+		}
+	}
+
+	return cn, nil
+}
+
+func (cn *conn) do(args []any) (any, error){
+	if err := writeCommand(cn.w, args); err != nil{
+		return nil, err
+	}
+	if err := cn.w.Flush(); err != nil{
+		return nil, err
+	}
+	return readReply(cn.r)
+}
+
+func writeCommand(w *bufio.Writer, args []any) error{
+	fmt.Fprintf(w, "*%d\r\n", len(args))
+
+	for _, arg := range args{
+		var b []byte
+		switch v := arg.(type){
+		case string:
+			b = []byte(v)
+		case []byte:
+			b = v
+		case int:
+			b = strconv.AppendInt(nil, int64(v), 10)
+		case int64:
+			b = strconv.AppendInt(nil, v, 10)
+		case float64:
+			b = strconv.AppendFloat(nil, v, 'f', -1, 64)
+		default:
+			return fmt.Errorf("redis: unsupported argument type %T", arg)
+		}
+
+		fmt.Fprintf(w, "$%d\r\n", len(b))
+		w.Write(b)
+		w.WriteString("\r\n")
+	}
+
+	return nil
+}
+
+func readReply(r *bufio.Reader) (any, error){
+	line, err := readLine(r)
+	if err != nil{
+		return nil, err
+	}
+	if len(line) == 0{
+		return nil, errors.New("redis: empty reply")
+	}
+
+	switch line[0]{
+	case '+':
+		return string(line[1:]), nil
+
+	case '-':
+		return nil, Error(line[1:])
+
+	case ':':
+		return strconv.ParseInt(string(line[1:]), 10, 64)
+
+	case '$':
+		n, err := strconv.Atoi(string(line[1:]))
+		if err != nil{
+			return nil, fmt.Errorf("redis: bad bulk length %q", line)
+		}
+		if n < 0{
+			return nil, nil
+		}
+
+		b := make([]byte, n+2)
+		if _, err := io.ReadFull(r, b); err != nil{
+			return nil, err
+		}
+		return b[:n], nil
+
+	case '*':
+		n, err := strconv.Atoi(string(line[1:]))
+		if err != nil{
+			return nil, fmt.Errorf("redis: bad array length %q", line)
+		}
+		if n < 0{
+			return nil, nil
+		}
+
+		items := make([]any, n)
+		for i := range items{
+			item, err := readReply(r)
+			// an error inside an array, such as from EXEC, is a value
+			var replyErr Error
+			if errors.As(err, &replyErr){
+				items[i] = replyErr
+				continue
+			}
+			if err != nil{
+				return nil, err
+			}
+			items[i] = item
+		}
+		return items, nil
+	}
+
+	return nil, fmt.Errorf("redis: unknown reply %q", line)
+}
+
+func readLine(r *bufio.Reader) ([]byte, error){
+	line, err := r.ReadSlice('\n')
+	if err != nil{
+		return nil, err
+	}
+	if len(line) < 2 || line[len(line)-2] != '\r'{
+		return nil, fmt.Errorf("redis: malformed line %q", line)
+	}
+	return line[:len(line)-2], nil
+}
@@ -0,0 +1,238 @@
+package redis
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+func newTestClient(t *testing.T, cfg Config) (*Client, *miniredis.Miniredis){
+	t.Helper()
+
+	m := miniredis.RunT(t)
+	cfg.Addr = m.Addr()
+
+	c := NewClient(cfg)
+	t.Cleanup(func(){ c.Close() })
+
+	return c, m
+}
+
+func TestClientCommands(t *testing.T){
+	c, m := newTestClient(t, Config{})
+	ctx := context.Background()
+
+	if err := c.Ping(ctx); err != nil{
+		t.Fatalf("Ping: %v", err)
+	}
+
+	if _, err := c.Get(ctx, "missing"); !errors.Is(err, Nil){
+		t.Errorf("Get of a missing key = %v, want Nil", err)
+	}
+	if reply, err := c.Do(ctx, "GET", "missing"); reply != nil || err != nil{
+		t.Errorf("Do GET of a missing key = %v, %v, want a nil reply", reply, err)
+	}
+
+	if err := c.Set(ctx, "k", []byte("v\r\nwith a newline"), 0); err != nil{
+		t.Fatalf("Set: %v", err)
+	}
+	if got, err := c.Get(ctx, "k"); err != nil || string(got) != "v\r\nwith a newline"{
+		t.Errorf("Get = %q, %v", got, err)
+	}
+	if ttl := m.TTL("k"); ttl != 0{
+		t.Errorf("Set without a ttl left TTL %s", ttl)
+	}
+
+	if err := c.Set(ctx, "expiring", []byte("v"), 1500 * time.Millisecond); err != nil{
+		t.Fatalf("Set: %v", err)
+	}
+	if ttl := m.TTL("expiring"); ttl != 1500 * time.Millisecond{
+		t.Errorf("TTL = %s, want 1.5s", ttl)
+	}
+	m.FastForward(2 * time.Second)
+	if _, err := c.Get(ctx, "expiring"); !errors.Is(err, Nil){
+		t.Errorf("Get after the ttl = %v, want Nil", err)
+	}
+
+	if err := c.Del(ctx, "k", "missing"); err != nil{
+		t.Fatalf("Del: %v", err)
+	}
+	if m.Exists("k"){
+		t.Error("Del left the key")
+	}
+	if err := c.Del(ctx); err != nil{
+		t.Errorf("Del of no keys: %v", err)
+	}
+}
+
+func TestClientEvalReplies(t *testing.T){
+	c, _ := newTestClient(t, Config{})
+	ctx := context.Background()
+
+	tests := []struct{
+		name string
+		script string
+		args []any
+		want any
+	}{
+		{name: "integer", script: `return 42`, want: int64(42)},
+		{name: "bulk string", script: `return ARGV[1]`, args: []any{"hello"}, want: []byte("hello")},
+		{name: "status", script: `return redis.status_reply('OK')`, want: "OK"},
+		{name: "nil", script: `return nil`, want: nil},
+		{name: "float argument", script: `return ARGV[1]`, args: []any{0.25}, want: []byte("0.25")},
+		{name: "int64 argument", script: `return tonumber(ARGV[1]) + 1`, args: []any{int64(41)}, want: int64(42)},
+		{name: "key", script: `return KEYS[1]`, want: []byte("key")},
+		{
+			name: "array",
+			script: `return {1, 'two', {3}}`,
+			want: []any{int64(1), []byte("two"), []any{int64(3)}},
+		},
+	}
+
+	for _, tt := range tests{
+		t.Run(tt.name, func(t *testing.T){
+			got, err := c.Eval(ctx, tt.script, []string{"key"}, tt.args...)
+			if err != nil{
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want){
+				t.Errorf("got %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := c.Do(ctx, "SET", "k", struct{}{}); err == nil{
+		t.Error("Do accepted an unsupported argument type")
+	}
+}
+
+func TestClientErrorReplyKeepsConnection(t *testing.T){
+	c, m := newTestClient(t, Config{})
+	ctx := context.Background()
+
+	if err := c.Ping(ctx); err != nil{
+		t.Fatal(err)
+	}
+
+	_, err := c.Eval(ctx, `return redis.error_reply('boom')`, nil)
+	var replyErr Error
+	if !errors.As(err, &replyErr) || !strings.Contains(string(replyErr), "boom"){
+		t.Fatalf("Eval error = %v, want an error reply", err)
+	}
+
+	if err := c.Ping(ctx); err != nil{
+		t.Fatal(err)
+	}
+	if n := m.TotalConnectionCount(); n != 1{
+		t.Errorf("opened %d connections, want the one reused", n)
+	}
+}
+
+func TestClientAuthAndDB(t *testing.T){
+	c, m := newTestClient(t, Config{Password: "secret", DB: 2})
+	m.RequireAuth("secret")
+	ctx := context.Background()
+
+	if err := c.Set(ctx, "k", []byte("v"), 0); err != nil{
+		t.Fatalf("Set: %v", err)
+	}
+
+	m.Select(2)
+	if got, err := m.Get("k"); err != nil || got != "v"{
+		t.Errorf("DB 2 holds %q, %v", got, err)
+	}
+
+	bad := NewClient(Config{Addr: m.Addr(), Password: "wrong"})
+	defer bad.Close()
+	if err := bad.Ping(ctx); err == nil{
+		t.Error("Ping with a wrong password succeeded")
+	}
+}
+
+func TestClientClose(t *testing.T){
+	c, _ := newTestClient(t, Config{})
+	ctx := context.Background()
+
+	if err := c.Ping(ctx); err != nil{
+		t.Fatal(err)
+	}
+
+	c.Close()
+	if err := c.Ping(ctx); !errors.Is(err, errClosed){
+		t.Errorf("Ping after Close = %v, want %v", err, errClosed)
+	}
+}
+
+func TestClientServerGone(t *testing.T){
+	c, m := newTestClient(t, Config{})
+	ctx := context.Background()
+
+	if err := c.Ping(ctx); err != nil{
+		t.Fatal(err)
+	}
+
+	m.Close()
+	if err := c.Ping(ctx); err == nil{
+		t.Error("Ping with the server gone succeeded")
+	}
+}
+
+func TestReadReply(t *testing.T){
+	tests := []struct{
+		name string
+		raw string
+		want any
+		wantErr bool
+	}{
+		{name: "simple string", raw: "+OK\r\n", want: "OK"},
+		{name: "integer", raw: ":-7\r\n", want: int64(-7)},
+		{name: "bulk string", raw: "$5\r\nhe\r\nl\r\n", want: []byte("he\r\nl")},
+		{name: "empty bulk string", raw: "$0\r\n\r\n", want: []byte{}},
+		{name: "nil bulk string", raw: "$-1\r\n", want: nil},
+		{name: "nil array", raw: "*-1\r\n", want: nil},
+		{name: "empty array", raw: "*0\r\n", want: []any{}},
+		{
+			name: "nested array",
+			raw: "*3\r\n:1\r\n*1\r\n$1\r\na\r\n$-1\r\n",
+			want: []any{int64(1), []any{[]byte("a")}, nil},
+		},
+		{
+			name: "error inside an array is a value",
+			raw: "*2\r\n-ERR one\r\n:2\r\n",
+			want: []any{Error("ERR one"), int64(2)},
+		},
+		{name: "error", raw: "-ERR bad\r\n", wantErr: true},
+		{name: "unknown type", raw: "%1\r\n", wantErr: true},
+		{name: "bad bulk length", raw: "$x\r\n", wantErr: true},
+		{name: "bad array length", raw: "*x\r\n", wantErr: true},
+		{name: "bad integer", raw: ":x\r\n", wantErr: true},
+		{name: "short bulk string", raw: "$5\r\nab", wantErr: true},
+		{name: "missing carriage return", raw: "+OK\n", wantErr: true},
+		{name: "empty line", raw: "\r\n", wantErr: true},
+		{name: "truncated", raw: "+OK", wantErr: true},
+	}
+
+	for _, tt := range tests{
+		t.Run(tt.name, func(t *testing.T){
+			got, err := readReply(bufio.NewReader(strings.NewReader(tt.raw)))
+			if tt.wantErr{
+				if err == nil{
+					t.Errorf("got %#v, want an error", got)
+				}
+				return
+			}
+			if err != nil{
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want){
+				t.Errorf("got %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,279 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"slices"
+	"strconv"
+)
+
+// Audited actions and the types of their targets.
+const (
+	AuditTargetPost = "post"
+	AuditTargetUser = "user"
+	AuditTargetReport = "report"
+
+	AuditPostDelete = "post.delete"
+	AuditCommunityRoleChange = "community.role_change"
+	AuditCommunityBan = "community.ban"
+	AuditCommunityUnban = "community.unban"
+	AuditReportClaim = "report.claim"
+	AuditReportResolve = "report.resolve"
+	AuditAccountStatusChange = "account.status_change"
+)
+
+// AuditChange is a field's value before and after an action; From is nil for
+// new fields and To for removed ones.
+type AuditChange struct{
+	From any `json:"from"`
+	To any `json:"to"`
+}
+
+// AuditChanges maps changed fields to their old and new values.
+type AuditChanges map[string]AuditChange
+
+// Diff compares before and after by their JSON fields and returns the ones
+// that differ. Either can be nil, for things created or deleted; values that
+// don't encode to JSON objects count as empty.
+func Diff(before, after any) AuditChanges{
+	from, to := jsonFields(before), jsonFields(after)
+
+	changes := AuditChanges{}
+	for field, value := range from{
+		if other, ok := to[field]; !ok || !reflect.DeepEqual(value, other){
+			changes[field] = AuditChange{From: value, To: to[field]}
+		}
+	}
+	for field, value := range to{
+		if _, ok := from[field]; !ok{
+			changes[field] = AuditChange{To: value}
+		}
+	}
+
+	return changes
+}
+
+func jsonFields(v any) map[string]any{
+	fields := map[string]any{}
+	if v == nil{
+		return fields
+	}
+
+	data, err := json.Marshal(v)
+	if err != nil{
+		return fields
+	}
+
+	_ = json.Unmarshal(data, &fields)
+	return fields
+}
+
+type AuditEvent struct{
+	ID int64 `json:"id"`
+	// ActorID is the user who acted, nil for the system
+	ActorID *int64 `json:"actor_id"`
+	Action string `json:"action"`
+	TargetType string `json:"target_type"`
+	TargetID int64 `json:"target_id"`
+	CommunityID *int64 `json:"community_id"`
+	RequestID string `json:"request_id"`
+	IP string `json:"ip"`
+	Changes AuditChanges `json:"changes"`
+	CreatedAt string `json:"created_at"`
+}
+
+type AuditQuery struct{
+	ActorID int64 `json:"actor_id" validate:"gte=0"`
+	Action string `json:"action" validate:"max=32"`
+	TargetType string `json:"target_type" validate:"max=16"`
+	TargetID int64 `json:"target_id" validate:"gte=0"`
+	CommunityID int64 `json:"community_id" validate:"gte=0"`
+	Since string `json:"since"`
+	Until string `json:"until"`
+	Limit int `json:"limit" validate:"gte=1,lte=100"`
+	// Cursor is decoded from the signed "cursor" query parameter by the caller
+	Cursor *FeedCursor `json:"-"`
+}
+
+func (aq AuditQuery) Parse(r *http.Request) (AuditQuery, error){
+	qs := r.URL.Query()
+
+	aq.Action = qs.Get("action")
+	aq.TargetType = qs.Get("target_type")
+
+	ids := map[string]*int64{
+		"actor_id": &aq.ActorID,
+		"target_id": &aq.TargetID,
+		"community_id": &aq.CommunityID,
+	}
+	for name, id := range ids{
+		if v := qs.Get(name); v != ""{
+			n, err := strconv.ParseInt(v, 10, 64)
+			if err != nil{
+				return aq, fmt.Errorf("invalid %s: %w", name, err)
+			}
+
+			*id = n
+		}
+	}
+
+	if since := qs.Get("since"); since != ""{
+		t, err := parseTime(since)
+		if err != nil{
+			return aq, fmt.Errorf("invalid since: %w", err)
+		}
+
+		aq.Since = t
+	}
+
+	if until := qs.Get("until"); until != ""{
+		t, err := parseTime(until)
+		if err != nil{
+			return aq, fmt.Errorf("invalid until: %w", err)
+		}
+
+		aq.Until = t
+	}
+
+	if aq.Since != "" && aq.Until != "" && aq.Since > aq.Until{
+		return aq, fmt.Errorf("since must not be after until")
+	}
+
+	if limit := qs.Get("limit"); limit != ""{
+		l, err := strconv.Atoi(limit)
+		if err != nil{
+			return aq, err
+		}
+
+		aq.Limit = l
+	}
+
+	return aq, nil
+}
+
+type AuditStore struct{
+	db *sql.DB
+}
+
+func (s *AuditStore) Create(ctx context.Context, event *AuditEvent) error{
+	query := `
+		INSERT INTO audit_events (actor_id, action, target_type, target_id, community_id, request_id, ip, changes)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		RETURNING id, created_at
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	if event.Changes == nil{
+		event.Changes = AuditChanges{}
+	}
+
+	changes, err := json.Marshal(event.Changes)
+	if err != nil{
+		return err
+	}
+
+	return s.db.QueryRowContext(
+		ctx,
+		query,
+		event.ActorID,
+		event.Action,
+		event.TargetType,
+		event.TargetID,
+		event.CommunityID,
+		event.RequestID,
+		event.IP,
+		changes,
+	).Scan(
+		&event.ID,
+		&event.CreatedAt,
+	)
+}
+
+// List returns audit events newest first. Cursors page towards older events,
+// or newer ones when paging back.
+func (s *AuditStore) List(ctx context.Context, aq AuditQuery) ([]AuditEvent, error){
+	sort, cmp := "DESC", "<"
+
+	var cursorAt sql.NullString
+	var cursorID int64
+
+	if aq.Cursor != nil{
+		cursorAt = nullString(aq.Cursor.CreatedAt)
+		cursorID = aq.Cursor.ID
+
+		if aq.Cursor.Prev{
+			sort, cmp = "ASC", ">"
+		}
+	}
+
+	query := `
+		SELECT id, actor_id, action, target_type, target_id, community_id, request_id, ip, changes, created_at
+		FROM audit_events
+		WHERE
+			($1::bigint = 0 OR actor_id = $1) AND
+			($2::varchar = '' OR action = $2) AND
+			($3::varchar = '' OR target_type = $3) AND
+			($4::bigint = 0 OR target_id = $4) AND
+			($5::bigint = 0 OR community_id = $5) AND
+			($6::timestamptz IS NULL OR created_at >= $6) AND
+			($7::timestamptz IS NULL OR created_at <= $7) AND
+			($8::timestamptz IS NULL OR (created_at, id) ` + cmp + ` ($8, $9))
+		ORDER BY created_at ` + sort + `, id ` + sort + `
+		LIMIT $10
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(
+		ctx,
+		query,
+		aq.ActorID,
+		aq.Action,
+		aq.TargetType,
+		aq.TargetID,
+		aq.CommunityID,
+		nullString(aq.Since),
+		nullString(aq.Until),
+		cursorAt,
+		cursorID,
+		aq.Limit,
+	)
+	if err != nil{
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	events := []AuditEvent{}
+
+	for rows.Next(){
+		var e AuditEvent
+		var changes []byte
+
+		err := rows.Scan(&e.ID, &e.ActorID, &e.Action, &e.TargetType, &e.TargetID, &e.CommunityID, &e.RequestID, &e.IP, &changes, &e.CreatedAt)
+		if err != nil{
+			return nil, err
+		}
+
+		if err := json.Unmarshal(changes, &e.Changes); err != nil{
+			return nil, err
+		}
+
+		events = append(events, e)
+	}
+
+	if err := rows.Err(); err != nil{
+		return nil, err
+	}
+
+	if aq.Cursor != nil && aq.Cursor.Prev{
+		slices.Reverse(events)
+	}
+
+	return events, nil
+}
@@ -0,0 +1,68 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+)
+
+type BlockStore struct{
+	db *sql.DB
+}
+
+func (s *BlockStore) Block(ctx context.Context, blockerID int64, blockedID int64) error{
+	query := `
+		INSERT INTO blocks (blocker_id, blocked_id) VALUES ($1, $2)
+		ON CONFLICT DO NOTHING
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	// blocking also ends any follow relationship in both directions
+	return withTx(s.db, ctx, func(tx *sql.Tx) error{
+		if _, err := tx.ExecContext(ctx, query, blockerID, blockedID); err != nil{
+			return err
+		}
+
+		unfollow := `
+			DELETE FROM followers
+			WHERE (user_id = $1 AND follower_id = $2) OR (user_id = $2 AND follower_id = $1)
+		`
+		if _, err := tx.ExecContext(ctx, unfollow, blockerID, blockedID); err != nil{
+			return err
+		}
+
+		if err := removeFromTimeline(ctx, tx, blockerID, blockedID); err != nil{
+			return err
+		}
+
+		return removeFromTimeline(ctx, tx, blockedID, blockerID)
+	})
+}
+
+func (s *BlockStore) Unblock(ctx context.Context, blockerID int64, blockedID int64) error{
+	query := `
+		DELETE FROM blocks
+		WHERE blocker_id = $1 AND blocked_id = $2
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, query, blockerID, blockedID)
+	return err
+}
+
+// IsBlocked reports whether either user has blocked the other.
+func (s *BlockStore) IsBlocked(ctx context.Context, userID int64, otherID int64) (bool, error){
+	query := `
+		SELECT EXISTS (
+			SELECT 1 FROM blocks
+			WHERE (blocker_id = $1 AND blocked_id = $2) OR (blocker_id = $2 AND blocked_id = $1)
+		)
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var blocked bool
+	err := s.db.QueryRowContext(ctx, query, userID, otherID).Scan(&blocked)
+	return blocked, err
+}
@@ -3,6 +3,10 @@ package store
 import (
 	"context"
 	"database/sql"
+	"errors"
+	"strconv"
+
+	"github.com/nikhilkarle/social/internal/events"
 )
 
 type Comment struct{
@@ -11,50 +15,133 @@ type Comment struct{
 	UserID  int64 	`json:"user_id"`
 	Content string `json:"content"`
 	CreatedAt string `json:"created_at"`
+	// HiddenAt is set when the comment is hidden pending review
+	HiddenAt *string `json:"hidden_at,omitempty"`
+	// Screening is set by the content filter to queue the comment for review
+	Screening *Screening `json:"-"`
 	User User `json:"user"`
 }
 
+// CommentEvent is published for a new comment. It carries a preview of the
+// content; clients fetch truncated comments with the post.
+type CommentEvent struct{
+	ID string `json:"id"`
+	PostID int64 `json:"post_id"`
+	UserID int64 `json:"user_id"`
+	Preview string `json:"preview"`
+	Truncated bool `json:"truncated"`
+	CreatedAt string `json:"created_at"`
+}
+
 type CommentStore struct{
 	db *sql.DB 
+	publisher Publisher
 }
 
 func(s *CommentStore) Create(ctx context.Context, comment *Comment) error{
 	query := `
-	INSERT INTO comments (content, user_id, post_id)
-	VALUES ($1, $2, $3) Returning id, created_at
+	INSERT INTO comments (content, user_id, post_id, hidden_at)
+	VALUES ($1, $2, $3, CASE WHEN $4::boolean THEN NOW() END)
+	Returning id, created_at, hidden_at, (SELECT status = 'shadow_banned' FROM users WHERE id = $2)
 	`
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
 	defer cancel()
 
-	err := s.db.QueryRowContext(
-		ctx, 
-		query,
-		comment.Content,
-		comment.UserID,
-		comment.PostID,
-	 ).Scan(
-		&comment.ID,
-		&comment.CreatedAt,
-	 )
+	var shadowBanned bool
+	err := withTx(s.db, ctx, func(tx *sql.Tx) error{
+		err := tx.QueryRowContext(
+			ctx, 
+			query,
+			comment.Content,
+			comment.UserID,
+			comment.PostID,
+			comment.Screening.held(),
+		).Scan(
+			&comment.ID,
+			&comment.CreatedAt,
+			&comment.HiddenAt,
+			&shadowBanned,
+		)
+		if err != nil{
+			return err
+		}
 
-	 if err != nil{
+		if comment.Screening == nil{
+			return nil
+		}
+
+		commentID, err := strconv.ParseInt(comment.ID, 10, 64)
+		if err != nil{
+			return err
+		}
+
+		return fileScreeningReport(ctx, tx, ReportTargetComment, commentID, comment.UserID, comment.Screening)
+	})
+	if err != nil{
 		return err
-	 }
+	}
+
+	// held comments reach subscribers once approved and reloaded, and shadow
+	// banned users' comments never do
+	if comment.HiddenAt == nil && !shadowBanned{
+		event := CommentEvent{
+			ID: comment.ID,
+			PostID: comment.PostID,
+			UserID: comment.UserID,
+			CreatedAt: comment.CreatedAt,
+		}
+		event.Preview, event.Truncated = eventPreview(comment.Content)
+
+		publish(ctx, s.publisher, events.TypeComment, events.PostCommentsTopic(comment.PostID), event)
+	}
+
+	return nil
+}
+
+// GetByID returns a comment, including a hidden one, without its user.
+func(s *CommentStore) GetByID(ctx context.Context, commentID int64) (*Comment, error){
+	query := `
+	SELECT id, post_id, user_id, content, created_at, hidden_at FROM comments
+	WHERE id = $1
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var comment Comment
+	err := s.db.QueryRowContext(ctx, query, commentID).Scan(
+		&comment.ID,
+		&comment.PostID,
+		&comment.UserID,
+		&comment.Content,
+		&comment.CreatedAt,
+		&comment.HiddenAt,
+	)
+	if err != nil{
+		switch{
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrNotFound
+		default:
+			return nil, err
+		}
+	}
 
-	 return nil
+	return &comment, nil
 }
 
-func(s *CommentStore) GetByPostID(ctx context.Context, postID int64) ([]Comment, error){
+// GetByPostID lists a post's comments as the viewer sees them, leaving out
+// other users' comments while they're shadow banned. Hidden comments are only
+// listed for their author and, when moderator is set, for moderators.
+func(s *CommentStore) GetByPostID(ctx context.Context, postID int64, viewerID int64, moderator bool) ([]Comment, error){
 	query := `
-	SELECT c.id, c.post_id, c.user_id, c.content, c.created_at, users.username, users.id FROM comments c
+	SELECT c.id, c.post_id, c.user_id, c.content, c.created_at, c.hidden_at, users.username, users.id FROM comments c
 	JOIN users on users.id = c.user_id
-	WHERE c.post_id = $1
+	WHERE c.post_id = $1 AND (c.hidden_at IS NULL OR c.user_id = $2 OR $3) AND (users.status <> 'shadow_banned' OR c.user_id = $2)
 	ORDER BY c.created_at DESC
 	`
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
 	defer cancel()
 
-	rows, err := s.db.QueryContext(ctx, query, postID)
+	rows, err := s.db.QueryContext(ctx, query, postID, viewerID, moderator)
 	if err != nil{
 		return nil, err
 	}
@@ -66,7 +153,7 @@ func(s *CommentStore) GetByPostID(ctx context.Context, postID int64) ([]Comment,
 	for rows.Next(){
 		var c Comment
 		c.User = User{}
-		err := rows.Scan(&c.ID, &c.PostID, &c.UserID, &c.Content, &c.CreatedAt, &c.User.Username, &c.User.ID)
+		err := rows.Scan(&c.ID, &c.PostID, &c.UserID, &c.Content, &c.CreatedAt, &c.HiddenAt, &c.User.Username, &c.User.ID)
 		if err != nil{
 			return nil, err
 		}
@@ -0,0 +1,620 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"slices"
+	"strconv"
+
+	"github.com/lib/pq"
+)
+
+const (
+	CommunityPublic = "public"
+	CommunityPrivate = "private"
+
+	RoleOwner = "owner"
+	RoleModerator = "moderator"
+	RoleMember = "member"
+)
+
+var (
+	ErrBanned = errors.New("banned from this community")
+	ErrOwnerCannotLeave = errors.New("the owner can't leave the community")
+)
+
+// publicPostCondition keeps hidden posts and posts from private communities
+// out of listings that anyone can see, such as search and explore. It expects
+// posts as p.
+const publicPostCondition = `p.hidden_at IS NULL AND (p.community_id IS NULL OR EXISTS (
+	SELECT 1 FROM communities cv WHERE cv.id = p.community_id AND cv.visibility = 'public'
+))`
+
+// communityRoles ranks the roles from least to most privileged.
+var communityRoles = []string{RoleMember, RoleModerator, RoleOwner}
+
+type Community struct{
+	ID int64 `json:"id"`
+	Name string `json:"name"`
+	Description string `json:"description"`
+	Visibility string `json:"visibility"`
+	CreatedBy int64 `json:"created_by"`
+	MembersCount int `json:"members_count"`
+	CreatedAt string `json:"created_at"`
+}
+
+type CommunityMember struct{
+	CommunityID int64 `json:"community_id"`
+	UserID int64 `json:"user_id"`
+	Username string `json:"username"`
+	Role string `json:"role"`
+	JoinedAt string `json:"joined_at"`
+}
+
+// HasRole reports whether the member's role is at least role. A nil member,
+// someone who hasn't joined, has no role.
+func (m *CommunityMember) HasRole(role string) bool{
+	if m == nil{
+		return false
+	}
+	return slices.Index(communityRoles, m.Role) >= slices.Index(communityRoles, role)
+}
+
+type CommunityJoinRequest struct{
+	CommunityID int64 `json:"community_id"`
+	UserID int64 `json:"user_id"`
+	Username string `json:"username"`
+	CreatedAt string `json:"created_at"`
+}
+
+type CommunityBan struct{
+	CommunityID int64 `json:"community_id"`
+	UserID int64 `json:"user_id"`
+	BannedBy int64 `json:"banned_by"`
+	Reason string `json:"reason"`
+	CreatedAt string `json:"created_at"`
+}
+
+type CommunityQuery struct{
+	Limit int `json:"limit" validate:"gte=1,lte=100"`
+	Offset int `json:"offset" validate:"gte=0"`
+}
+
+type CommunityStore struct{
+	db *sql.DB
+}
+
+func (cq CommunityQuery) Parse(r *http.Request) (CommunityQuery, error){
+	qs := r.URL.Query()
+
+	if limit := qs.Get("limit"); limit != ""{
+		l, err := strconv.Atoi(limit)
+		if err != nil{
+			return cq, err
+		}
+
+		cq.Limit = l
+	}
+
+	if offset := qs.Get("offset"); offset != ""{
+		o, err := strconv.Atoi(offset)
+		if err != nil{
+			return cq, err
+		}
+
+		cq.Offset = o
+	}
+
+	return cq, nil
+}
+
+// Create stores the community and makes its creator the owner. Names are
+// unique regardless of case.
+func (s *CommunityStore) Create(ctx context.Context, community *Community) error{
+	query := `
+		INSERT INTO communities (name, description, visibility, created_by)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, created_at
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	return withTx(s.db, ctx, func(tx *sql.Tx) error{
+		err := tx.QueryRowContext(
+			ctx,
+			query,
+			community.Name,
+			community.Description,
+			community.Visibility,
+			community.CreatedBy,
+		).Scan(&community.ID, &community.CreatedAt)
+		if err != nil{
+			if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505"{
+				return ErrConflict
+			}
+			return err
+		}
+
+		member := `
+			INSERT INTO community_members (community_id, user_id, role) VALUES ($1, $2, $3)
+		`
+		if _, err := tx.ExecContext(ctx, member, community.ID, community.CreatedBy, RoleOwner); err != nil{
+			return err
+		}
+
+		community.MembersCount = 1
+		return nil
+	})
+}
+
+func (s *CommunityStore) GetByID(ctx context.Context, communityID int64) (*Community, error){
+	query := `
+		SELECT
+			c.id, c.name, c.description, c.visibility, c.created_by, c.created_at,
+			(SELECT COUNT(*) FROM community_members m WHERE m.community_id = c.id)
+		FROM communities c
+		WHERE c.id = $1
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var c Community
+	err := s.db.QueryRowContext(ctx, query, communityID).Scan(
+		&c.ID,
+		&c.Name,
+		&c.Description,
+		&c.Visibility,
+		&c.CreatedBy,
+		&c.CreatedAt,
+		&c.MembersCount,
+	)
+	if err != nil{
+		switch{
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &c, nil
+}
+
+// GetMember returns ErrNotFound when the user isn't a member.
+func (s *CommunityStore) GetMember(ctx context.Context, communityID int64, userID int64) (*CommunityMember, error){
+	query := `
+		SELECT m.community_id, m.user_id, u.username, m.role, m.joined_at
+		FROM community_members m
+		JOIN users u ON u.id = m.user_id
+		WHERE m.community_id = $1 AND m.user_id = $2
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var m CommunityMember
+	err := s.db.QueryRowContext(ctx, query, communityID, userID).Scan(&m.CommunityID, &m.UserID, &m.Username, &m.Role, &m.JoinedAt)
+	if err != nil{
+		switch{
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &m, nil
+}
+
+// GetMembers lists members, owner and moderators first.
+func (s *CommunityStore) GetMembers(ctx context.Context, communityID int64, cq CommunityQuery) ([]CommunityMember, error){
+	query := `
+		SELECT m.community_id, m.user_id, u.username, m.role, m.joined_at
+		FROM community_members m
+		JOIN users u ON u.id = m.user_id
+		WHERE m.community_id = $1
+		ORDER BY
+			CASE m.role WHEN 'owner' THEN 0 WHEN 'moderator' THEN 1 ELSE 2 END,
+			m.joined_at, m.user_id
+		LIMIT $2 OFFSET $3
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, communityID, cq.Limit, cq.Offset)
+	if err != nil{
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	members := []CommunityMember{}
+
+	for rows.Next(){
+		var m CommunityMember
+		if err := rows.Scan(&m.CommunityID, &m.UserID, &m.Username, &m.Role, &m.JoinedAt); err != nil{
+			return nil, err
+		}
+		members = append(members, m)
+	}
+
+	return members, rows.Err()
+}
+
+// Join adds the user to a public community or files a join request for a
+// private one. Banned users get ErrBanned.
+func (s *CommunityStore) Join(ctx context.Context, community *Community, userID int64) error{
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	return withTx(s.db, ctx, func(tx *sql.Tx) error{
+		if err := checkNotBanned(ctx, tx, community.ID, userID); err != nil{
+			return err
+		}
+
+		query := `
+			INSERT INTO community_members (community_id, user_id, role) VALUES ($1, $2, 'member')
+			ON CONFLICT DO NOTHING
+		`
+		if community.Visibility == CommunityPrivate{
+			query = `
+				INSERT INTO community_join_requests (community_id, user_id)
+				SELECT $1::bigint, $2::bigint
+				WHERE NOT EXISTS (
+					SELECT 1 FROM community_members WHERE community_id = $1 AND user_id = $2
+				)
+				ON CONFLICT DO NOTHING
+			`
+		}
+
+		_, err := tx.ExecContext(ctx, query, community.ID, userID)
+		return err
+	})
+}
+
+func checkNotBanned(ctx context.Context, tx *sql.Tx, communityID int64, userID int64) error{
+	query := `
+		SELECT EXISTS (SELECT 1 FROM community_bans WHERE community_id = $1 AND user_id = $2)
+	`
+	var banned bool
+	if err := tx.QueryRowContext(ctx, query, communityID, userID).Scan(&banned); err != nil{
+		return err
+	}
+
+	if banned{
+		return ErrBanned
+	}
+	return nil
+}
+
+// Leave removes the user from the community and withdraws any join request.
+// The owner has to stay.
+func (s *CommunityStore) Leave(ctx context.Context, communityID int64, userID int64) error{
+	query := `
+		DELETE FROM community_members
+		WHERE community_id = $1 AND user_id = $2 AND role <> 'owner'
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	return withTx(s.db, ctx, func(tx *sql.Tx) error{
+		res, err := tx.ExecContext(ctx, query, communityID, userID)
+		if err != nil{
+			return err
+		}
+
+		rows, err := res.RowsAffected()
+		if err != nil{
+			return err
+		}
+
+		if rows == 0{
+			var owner bool
+			check := `
+				SELECT EXISTS (
+					SELECT 1 FROM community_members
+					WHERE community_id = $1 AND user_id = $2 AND role = 'owner'
+				)
+			`
+			if err := tx.QueryRowContext(ctx, check, communityID, userID).Scan(&owner); err != nil{
+				return err
+			}
+
+			if owner{
+				return ErrOwnerCannotLeave
+			}
+		}
+
+		withdraw := `
+			DELETE FROM community_join_requests WHERE community_id = $1 AND user_id = $2
+		`
+		_, err = tx.ExecContext(ctx, withdraw, communityID, userID)
+		return err
+	})
+}
+
+// GetJoinRequests lists pending join requests, oldest first.
+func (s *CommunityStore) GetJoinRequests(ctx context.Context, communityID int64, cq CommunityQuery) ([]CommunityJoinRequest, error){
+	query := `
+		SELECT r.community_id, r.user_id, u.username, r.created_at
+		FROM community_join_requests r
+		JOIN users u ON u.id = r.user_id
+		WHERE r.community_id = $1
+		ORDER BY r.created_at, r.user_id
+		LIMIT $2 OFFSET $3
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, communityID, cq.Limit, cq.Offset)
+	if err != nil{
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	requests := []CommunityJoinRequest{}
+
+	for rows.Next(){
+		var r CommunityJoinRequest
+		if err := rows.Scan(&r.CommunityID, &r.UserID, &r.Username, &r.CreatedAt); err != nil{
+			return nil, err
+		}
+		requests = append(requests, r)
+	}
+
+	return requests, rows.Err()
+}
+
+// ResolveJoinRequest approves or rejects a pending request, returning
+// ErrNotFound if there is none.
+func (s *CommunityStore) ResolveJoinRequest(ctx context.Context, communityID int64, userID int64, approve bool) error{
+	query := `
+		DELETE FROM community_join_requests WHERE community_id = $1 AND user_id = $2
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	return withTx(s.db, ctx, func(tx *sql.Tx) error{
+		res, err := tx.ExecContext(ctx, query, communityID, userID)
+		if err != nil{
+			return err
+		}
+
+		rows, err := res.RowsAffected()
+		if err != nil{
+			return err
+		}
+
+		if rows == 0{
+			return ErrNotFound
+		}
+
+		if !approve{
+			return nil
+		}
+
+		member := `
+			INSERT INTO community_members (community_id, user_id, role) VALUES ($1, $2, 'member')
+			ON CONFLICT DO NOTHING
+		`
+		_, err = tx.ExecContext(ctx, member, communityID, userID)
+		return err
+	})
+}
+
+// SetRole changes a member's role between member and moderator. Ownership
+// can't be handed over this way, so the owner's row is never touched.
+func (s *CommunityStore) SetRole(ctx context.Context, communityID int64, userID int64, role string) error{
+	query := `
+		UPDATE community_members SET role = $3
+		WHERE community_id = $1 AND user_id = $2 AND role <> 'owner'
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctx, query, communityID, userID, role)
+	if err != nil{
+		return err
+	}
+
+	rows, err := res.RowsAffected()
+	if err != nil{
+		return err
+	}
+
+	if rows == 0{
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// Ban removes the user from the community, drops any join request and stops
+// them joining again until unbanned.
+func (s *CommunityStore) Ban(ctx context.Context, ban *CommunityBan) error{
+	query := `
+		INSERT INTO community_bans (community_id, user_id, banned_by, reason) VALUES ($1, $2, $3, $4)
+		ON CONFLICT (community_id, user_id) DO UPDATE SET banned_by = EXCLUDED.banned_by, reason = EXCLUDED.reason
+		RETURNING created_at
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	return withTx(s.db, ctx, func(tx *sql.Tx) error{
+		err := tx.QueryRowContext(ctx, query, ban.CommunityID, ban.UserID, ban.BannedBy, ban.Reason).Scan(&ban.CreatedAt)
+		if err != nil{
+			return err
+		}
+
+		remove := `
+			DELETE FROM community_members WHERE community_id = $1 AND user_id = $2
+		`
+		if _, err := tx.ExecContext(ctx, remove, ban.CommunityID, ban.UserID); err != nil{
+			return err
+		}
+
+		withdraw := `
+			DELETE FROM community_join_requests WHERE community_id = $1 AND user_id = $2
+		`
+		_, err = tx.ExecContext(ctx, withdraw, ban.CommunityID, ban.UserID)
+		return err
+	})
+}
+
+func (s *CommunityStore) Unban(ctx context.Context, communityID int64, userID int64) error{
+	query := `
+		DELETE FROM community_bans WHERE community_id = $1 AND user_id = $2
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctx, query, communityID, userID)
+	if err != nil{
+		return err
+	}
+
+	rows, err := res.RowsAffected()
+	if err != nil{
+		return err
+	}
+
+	if rows == 0{
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// RemovePost deletes a post published to the community, returning
+// ErrNotFound for posts that belong elsewhere.
+func (s *CommunityStore) RemovePost(ctx context.Context, communityID int64, postID int64) error{
+	query := `
+		DELETE FROM posts WHERE id = $1 AND community_id = $2
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctx, query, postID, communityID)
+	if err != nil{
+		return err
+	}
+
+	rows, err := res.RowsAffected()
+	if err != nil{
+		return err
+	}
+
+	if rows == 0{
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// GetFeed pages through the community's posts by cursor or offset, like the
+// user feed. Authors the user has blocked, or who blocked them, are left out.
+func (s *CommunityStore) GetFeed(ctx context.Context, communityID int64, userID int64, fq PaginatedFeedQuery) ([]PostWithMetadata, error){
+	sort, cmp := fq.Sort, "<"
+	if sort == "asc"{
+		cmp = ">"
+	}
+
+	var cursorAt sql.NullString
+	var cursorID int64
+	offset := fq.Offset
+
+	if fq.Cursor != nil{
+		cursorAt = nullString(fq.Cursor.CreatedAt)
+		cursorID = fq.Cursor.ID
+		offset = 0
+
+		if fq.Cursor.Prev{
+			sort, cmp = reverseSort(sort), reverseCmp(cmp)
+		}
+	}
+
+	query := `
+		SELECT
+			p.id, p.user_id, p.community_id, p.title, p.content, p.content_html, p.created_at, p.version, p.tags, p.entities,
+			u.username,
+			(SELECT COUNT(*) FROM comments c WHERE c.post_id = p.id) AS comments_count,
+			(SELECT COUNT(*) FROM post_reactions r WHERE r.post_id = p.id) AS reactions_count
+		FROM posts p
+		JOIN users u ON u.id = p.user_id
+		WHERE
+			p.community_id = $1 AND
+			p.hidden_at IS NULL AND
+			` + shadowBanCondition("$2") + ` AND
+			NOT EXISTS (
+				SELECT 1 FROM blocks b
+				WHERE (b.blocker_id = $2 AND b.blocked_id = p.user_id) OR (b.blocker_id = p.user_id AND b.blocked_id = $2)
+			) AND
+			(p.title ILIKE '%' || $5 || '%' OR p.content ILIKE '%' || $5 || '%') AND
+			(COALESCE(CARDINALITY($6::varchar[]), 0) = 0 OR p.tags @> $6) AND
+			($7::timestamptz IS NULL OR p.created_at >= $7) AND
+			($8::timestamptz IS NULL OR p.created_at <= $8) AND
+			($9::timestamptz IS NULL OR (p.created_at, p.id) ` + cmp + ` ($9, $10))
+		ORDER BY p.created_at ` + sort + `, p.id ` + sort + `
+		LIMIT $3 OFFSET $4
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(
+		ctx,
+		query,
+		communityID,
+		userID,
+		fq.Limit,
+		offset,
+		fq.Search,
+		pq.Array(fq.Tags),
+		nullString(fq.Since),
+		nullString(fq.Until),
+		cursorAt,
+		cursorID,
+	)
+	if err != nil{
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	feed := []PostWithMetadata{}
+
+	for rows.Next(){
+		var post PostWithMetadata
+		err := rows.Scan(
+			&post.ID,
+			&post.UserID,
+			&post.CommunityID,
+			&post.Title,
+			&post.Content,
+			&post.ContentHTML,
+			&post.CreatedAt,
+			&post.Version,
+			pq.Array(&post.Tags),
+			&post.Entities,
+			&post.User.Username,
+			&post.CommentsCount,
+			&post.ReactionsCount,
+		)
+		if err != nil{
+			return nil, err
+		}
+
+		feed = append(feed, post)
+	}
+
+	if err := rows.Err(); err != nil{
+		return nil, err
+	}
+
+	if fq.Cursor != nil && fq.Cursor.Prev{
+		slices.Reverse(feed)
+	}
+
+	return feed, nil
+}
@@ -0,0 +1,613 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+
+	"github.com/lib/pq"
+	"github.com/nikhilkarle/social/internal/events"
+)
+
+var (
+	ErrCannotMessage = errors.New("can't message this user")
+	ErrNotGroup = errors.New("not a group conversation")
+)
+
+// MaxConversationMembers includes the user who started the conversation.
+const MaxConversationMembers = 10
+
+type Conversation struct{
+	ID int64 `json:"id"`
+	IsGroup bool `json:"is_group"`
+	Title string `json:"title"`
+	CreatedBy int64 `json:"created_by"`
+	LastMessageAt *string `json:"last_message_at"`
+	CreatedAt string `json:"created_at"`
+	Members []ConversationMember `json:"members"`
+	LastMessage *Message `json:"last_message,omitempty"`
+	UnreadCount int `json:"unread_count"`
+}
+
+type ConversationMember struct{
+	UserID int64 `json:"user_id"`
+	Username string `json:"username"`
+	LastReadMessageID *int64 `json:"last_read_message_id"`
+	JoinedAt string `json:"joined_at"`
+}
+
+type Message struct{
+	ID int64 `json:"id"`
+	ConversationID int64 `json:"conversation_id"`
+	SenderID int64 `json:"sender_id"`
+	Content string `json:"content"`
+	CreatedAt string `json:"created_at"`
+	// ReadBy lists the other members who have read up to this message
+	ReadBy []int64 `json:"read_by"`
+}
+
+// MessageEvent is published for a new message. It carries a preview of the
+// content; clients fetch truncated messages in full.
+type MessageEvent struct{
+	ID int64 `json:"id"`
+	ConversationID int64 `json:"conversation_id"`
+	SenderID int64 `json:"sender_id"`
+	Preview string `json:"preview"`
+	Truncated bool `json:"truncated"`
+	CreatedAt string `json:"created_at"`
+}
+
+// ReadReceipt is published to a conversation when a member reads it.
+type ReadReceipt struct{
+	ConversationID int64 `json:"conversation_id"`
+	UserID int64 `json:"user_id"`
+	MessageID int64 `json:"message_id"`
+}
+
+type ConversationQuery struct{
+	Limit int `json:"limit" validate:"gte=1,lte=50"`
+	Offset int `json:"offset" validate:"gte=0"`
+}
+
+type MessageQuery struct{
+	Limit int `json:"limit" validate:"gte=1,lte=50"`
+	// Cursor is decoded from the signed "cursor" query parameter by the caller
+	Cursor *FeedCursor `json:"-"`
+}
+
+type ConversationStore struct{
+	db *sql.DB
+	publisher Publisher
+}
+
+func (cq ConversationQuery) Parse(r *http.Request) (ConversationQuery, error){
+	qs := r.URL.Query()
+
+	if limit := qs.Get("limit"); limit != ""{
+		l, err := strconv.Atoi(limit)
+		if err != nil{
+			return cq, err
+		}
+
+		cq.Limit = l
+	}
+
+	if offset := qs.Get("offset"); offset != ""{
+		o, err := strconv.Atoi(offset)
+		if err != nil{
+			return cq, err
+		}
+
+		cq.Offset = o
+	}
+
+	return cq, nil
+}
+
+func (mq MessageQuery) Parse(r *http.Request) (MessageQuery, error){
+	if limit := r.URL.Query().Get("limit"); limit != ""{
+		l, err := strconv.Atoi(limit)
+		if err != nil{
+			return mq, err
+		}
+
+		mq.Limit = l
+	}
+
+	return mq, nil
+}
+
+// Create starts a conversation between conv.CreatedBy and memberIDs. Every
+// member has to be active, not blocking or blocked by the creator, and, for
+// private accounts, following the creator; otherwise ErrCannotMessage is
+// returned. A pair of users only ever has one one-to-one conversation, so
+// creating it again returns the existing one.
+func (s *ConversationStore) Create(ctx context.Context, conv *Conversation, memberIDs []int64) error{
+	var others []int64
+	for _, id := range memberIDs{
+		if id != conv.CreatedBy && !slices.Contains(others, id){
+			others = append(others, id)
+		}
+	}
+
+	if len(others) == 0 || len(others) >= MaxConversationMembers{
+		return ErrCannotMessage
+	}
+
+	var directKey sql.NullString
+	if !conv.IsGroup{
+		if len(others) != 1{
+			return ErrCannotMessage
+		}
+
+		low, high := min(conv.CreatedBy, others[0]), max(conv.CreatedBy, others[0])
+		directKey = nullString(fmt.Sprintf("%d:%d", low, high))
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	err := withTx(s.db, ctx, func(tx *sql.Tx) error{
+		query := `
+			SELECT COUNT(*) FROM users u
+			WHERE
+				u.id = ANY($1::bigint[]) AND
+				` + activeUserCondition + ` AND
+				(NOT u.is_private OR EXISTS (
+					SELECT 1 FROM followers f
+					WHERE f.user_id = $2 AND f.follower_id = u.id
+				)) AND
+				NOT EXISTS (
+					SELECT 1 FROM blocks b
+					WHERE (b.blocker_id = $2 AND b.blocked_id = u.id) OR (b.blocker_id = u.id AND b.blocked_id = $2)
+				)
+		`
+		var allowed int
+		if err := tx.QueryRowContext(ctx, query, pq.Array(others), conv.CreatedBy).Scan(&allowed); err != nil{
+			return err
+		}
+
+		if allowed != len(others){
+			return ErrCannotMessage
+		}
+
+		// the no-op update makes RETURNING yield the existing one-to-one row
+		query = `
+			INSERT INTO conversations (is_group, title, direct_key, created_by)
+			VALUES ($1, $2, $3, $4)
+			ON CONFLICT (direct_key) DO UPDATE SET direct_key = EXCLUDED.direct_key
+			RETURNING id, is_group, title, created_by, last_message_at, created_at
+		`
+		err := tx.QueryRowContext(ctx, query, conv.IsGroup, conv.Title, directKey, conv.CreatedBy).Scan(
+			&conv.ID,
+			&conv.IsGroup,
+			&conv.Title,
+			&conv.CreatedBy,
+			&conv.LastMessageAt,
+			&conv.CreatedAt,
+		)
+		if err != nil{
+			return err
+		}
+
+		query = `
+			INSERT INTO conversation_members (conversation_id, user_id)
+			SELECT $1::bigint, UNNEST($2::bigint[])
+			ON CONFLICT DO NOTHING
+		`
+		_, err = tx.ExecContext(ctx, query, conv.ID, pq.Array(append(others, conv.CreatedBy)))
+		return err
+	})
+	if err != nil{
+		return err
+	}
+
+	members, err := s.getMembers(ctx, []int64{conv.ID})
+	if err != nil{
+		return err
+	}
+
+	conv.Members = members[conv.ID]
+	return nil
+}
+
+// GetByID returns the conversation if userID is one of its current members
+// and ErrNotFound otherwise.
+func (s *ConversationStore) GetByID(ctx context.Context, userID int64, conversationID int64) (*Conversation, error){
+	query := `
+		SELECT c.id, c.is_group, c.title, c.created_by, c.last_message_at, c.created_at
+		FROM conversations c
+		JOIN conversation_members cm ON cm.conversation_id = c.id
+		WHERE c.id = $1 AND cm.user_id = $2 AND cm.left_at IS NULL
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var conv Conversation
+	err := s.db.QueryRowContext(ctx, query, conversationID, userID).Scan(
+		&conv.ID,
+		&conv.IsGroup,
+		&conv.Title,
+		&conv.CreatedBy,
+		&conv.LastMessageAt,
+		&conv.CreatedAt,
+	)
+	if err != nil{
+		switch{
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	members, err := s.getMembers(ctx, []int64{conv.ID})
+	if err != nil{
+		return nil, err
+	}
+
+	conv.Members = members[conv.ID]
+	return &conv, nil
+}
+
+// List returns the user's conversations with their latest message and unread
+// count, most recently active first. Messages from users the caller blocked
+// are left out of both.
+func (s *ConversationStore) List(ctx context.Context, userID int64, cq ConversationQuery) ([]Conversation, error){
+	query := `
+		SELECT
+			c.id, c.is_group, c.title, c.created_by, c.last_message_at, c.created_at,
+			lm.id, lm.sender_id, lm.content, lm.created_at,
+			(
+				SELECT COUNT(*) FROM messages m
+				WHERE
+					m.conversation_id = c.id AND
+					m.sender_id <> $1 AND
+					m.id > COALESCE(cm.last_read_message_id, 0) AND
+					NOT EXISTS (SELECT 1 FROM blocks b WHERE b.blocker_id = $1 AND b.blocked_id = m.sender_id)
+			) AS unread_count
+		FROM conversations c
+		JOIN conversation_members cm ON cm.conversation_id = c.id
+		LEFT JOIN LATERAL (
+			SELECT m.id, m.sender_id, m.content, m.created_at FROM messages m
+			WHERE
+				m.conversation_id = c.id AND
+				NOT EXISTS (SELECT 1 FROM blocks b WHERE b.blocker_id = $1 AND b.blocked_id = m.sender_id)
+			ORDER BY m.created_at DESC, m.id DESC
+			LIMIT 1
+		) lm ON TRUE
+		WHERE cm.user_id = $1 AND cm.left_at IS NULL
+		ORDER BY COALESCE(c.last_message_at, c.created_at) DESC, c.id DESC
+		LIMIT $2 OFFSET $3
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, userID, cq.Limit, cq.Offset)
+	if err != nil{
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	conversations := []Conversation{}
+	var ids []int64
+
+	for rows.Next(){
+		var c Conversation
+		var lastID, lastSenderID sql.NullInt64
+		var lastContent, lastCreatedAt sql.NullString
+
+		err := rows.Scan(
+			&c.ID,
+			&c.IsGroup,
+			&c.Title,
+			&c.CreatedBy,
+			&c.LastMessageAt,
+			&c.CreatedAt,
+			&lastID,
+			&lastSenderID,
+			&lastContent,
+			&lastCreatedAt,
+			&c.UnreadCount,
+		)
+		if err != nil{
+			return nil, err
+		}
+
+		if lastID.Valid{
+			c.LastMessage = &Message{
+				ID: lastID.Int64,
+				ConversationID: c.ID,
+				SenderID: lastSenderID.Int64,
+				Content: lastContent.String,
+				CreatedAt: lastCreatedAt.String,
+			}
+		}
+
+		conversations = append(conversations, c)
+		ids = append(ids, c.ID)
+	}
+
+	if err := rows.Err(); err != nil{
+		return nil, err
+	}
+
+	members, err := s.getMembers(ctx, ids)
+	if err != nil{
+		return nil, err
+	}
+
+	for i := range conversations{
+		conversations[i].Members = members[conversations[i].ID]
+	}
+
+	return conversations, nil
+}
+
+// getMembers returns the current members of each conversation.
+func (s *ConversationStore) getMembers(ctx context.Context, conversationIDs []int64) (map[int64][]ConversationMember, error){
+	members := map[int64][]ConversationMember{}
+	if len(conversationIDs) == 0{
+		return members, nil
+	}
+
+	query := `
+		SELECT cm.conversation_id, cm.user_id, u.username, cm.last_read_message_id, cm.joined_at
+		FROM conversation_members cm
+		JOIN users u ON u.id = cm.user_id
+		WHERE cm.conversation_id = ANY($1::bigint[]) AND cm.left_at IS NULL
+		ORDER BY cm.joined_at, cm.user_id
+	`
+	rows, err := s.db.QueryContext(ctx, query, pq.Array(conversationIDs))
+	if err != nil{
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next(){
+		var conversationID int64
+		var m ConversationMember
+		if err := rows.Scan(&conversationID, &m.UserID, &m.Username, &m.LastReadMessageID, &m.JoinedAt); err != nil{
+			return nil, err
+		}
+		members[conversationID] = append(members[conversationID], m)
+	}
+
+	return members, rows.Err()
+}
+
+// SendMessage adds a message from msg.SenderID, who has to be a current
+// member. One-to-one conversations stop accepting messages once either user
+// blocks the other or the other account is deactivated.
+func (s *ConversationStore) SendMessage(ctx context.Context, msg *Message) error{
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var recipients []int64
+
+	err := withTx(s.db, ctx, func(tx *sql.Tx) error{
+		query := `
+			SELECT c.is_group, ARRAY(
+				SELECT o.user_id FROM conversation_members o
+				WHERE o.conversation_id = c.id AND o.left_at IS NULL AND o.user_id <> $2
+			)
+			FROM conversations c
+			JOIN conversation_members cm ON cm.conversation_id = c.id
+			WHERE c.id = $1 AND cm.user_id = $2 AND cm.left_at IS NULL
+		`
+		var isGroup bool
+		err := tx.QueryRowContext(ctx, query, msg.ConversationID, msg.SenderID).Scan(&isGroup, pq.Array(&recipients))
+		if err != nil{
+			if errors.Is(err, sql.ErrNoRows){
+				return ErrNotFound
+			}
+			return err
+		}
+
+		if !isGroup{
+			query = `
+				SELECT EXISTS (
+					SELECT 1 FROM users u
+					WHERE u.id = ANY($2::bigint[]) AND (
+						NOT ` + activeUserCondition + ` OR EXISTS (
+							SELECT 1 FROM blocks b
+							WHERE (b.blocker_id = $1 AND b.blocked_id = u.id) OR (b.blocker_id = u.id AND b.blocked_id = $1)
+						)
+					)
+				)
+			`
+			var blocked bool
+			if err := tx.QueryRowContext(ctx, query, msg.SenderID, pq.Array(recipients)).Scan(&blocked); err != nil{
+				return err
+			}
+
+			if blocked{
+				return ErrCannotMessage
+			}
+		}
+
+		query = `
+			INSERT INTO messages (conversation_id, sender_id, content) VALUES ($1, $2, $3)
+			RETURNING id, created_at
+		`
+		if err := tx.QueryRowContext(ctx, query, msg.ConversationID, msg.SenderID, msg.Content).Scan(&msg.ID, &msg.CreatedAt); err != nil{
+			return err
+		}
+
+		query = `UPDATE conversations SET last_message_at = $2 WHERE id = $1`
+		if _, err := tx.ExecContext(ctx, query, msg.ConversationID, msg.CreatedAt); err != nil{
+			return err
+		}
+
+		// senders have read their own messages
+		query = `
+			UPDATE conversation_members SET last_read_message_id = $3
+			WHERE conversation_id = $1 AND user_id = $2
+		`
+		_, err = tx.ExecContext(ctx, query, msg.ConversationID, msg.SenderID, msg.ID)
+		return err
+	})
+	if err != nil{
+		return err
+	}
+
+	msg.ReadBy = []int64{}
+
+	event := MessageEvent{
+		ID: msg.ID,
+		ConversationID: msg.ConversationID,
+		SenderID: msg.SenderID,
+		CreatedAt: msg.CreatedAt,
+	}
+	event.Preview, event.Truncated = eventPreview(msg.Content)
+
+	publish(ctx, s.publisher, events.TypeMessage, events.ConversationTopic(msg.ConversationID), event)
+	for _, id := range recipients{
+		publish(ctx, s.publisher, events.TypeMessage, events.UserTopic(id), event)
+	}
+
+	return nil
+}
+
+// GetMessages returns a page of the conversation's messages, newest first,
+// for one of its current members. Messages from users the member blocked are
+// left out.
+func (s *ConversationStore) GetMessages(ctx context.Context, userID int64, conversationID int64, mq MessageQuery) ([]Message, error){
+	if _, err := s.GetByID(ctx, userID, conversationID); err != nil{
+		return nil, err
+	}
+
+	// keyset pagination towards older messages, or newer ones when paging back
+	sort, cmp := "DESC", "<"
+
+	var cursorAt sql.NullString
+	var cursorID int64
+
+	if mq.Cursor != nil{
+		cursorAt = nullString(mq.Cursor.CreatedAt)
+		cursorID = mq.Cursor.ID
+
+		if mq.Cursor.Prev{
+			sort, cmp = "ASC", ">"
+		}
+	}
+
+	query := `
+		SELECT
+			m.id, m.conversation_id, m.sender_id, m.content, m.created_at,
+			ARRAY(
+				SELECT r.user_id FROM conversation_members r
+				WHERE
+					r.conversation_id = m.conversation_id AND
+					r.user_id <> m.sender_id AND
+					r.left_at IS NULL AND
+					r.last_read_message_id >= m.id
+				ORDER BY r.user_id
+			)
+		FROM messages m
+		WHERE
+			m.conversation_id = $1 AND
+			NOT EXISTS (SELECT 1 FROM blocks b WHERE b.blocker_id = $2 AND b.blocked_id = m.sender_id) AND
+			($3::timestamptz IS NULL OR (m.created_at, m.id) ` + cmp + ` ($3, $4))
+		ORDER BY m.created_at ` + sort + `, m.id ` + sort + `
+		LIMIT $5
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, conversationID, userID, cursorAt, cursorID, mq.Limit)
+	if err != nil{
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	messages := []Message{}
+
+	for rows.Next(){
+		var m Message
+		err := rows.Scan(&m.ID, &m.ConversationID, &m.SenderID, &m.Content, &m.CreatedAt, pq.Array(&m.ReadBy))
+		if err != nil{
+			return nil, err
+		}
+		messages = append(messages, m)
+	}
+
+	if err := rows.Err(); err != nil{
+		return nil, err
+	}
+
+	if mq.Cursor != nil && mq.Cursor.Prev{
+		slices.Reverse(messages)
+	}
+
+	return messages, nil
+}
+
+// MarkRead records that the user has read the conversation up to messageID,
+// or up to its latest message when messageID is zero, and publishes a read
+// receipt. Read positions never move backwards.
+func (s *ConversationStore) MarkRead(ctx context.Context, userID int64, conversationID int64, messageID int64) error{
+	if _, err := s.GetByID(ctx, userID, conversationID); err != nil{
+		return err
+	}
+
+	query := `
+		UPDATE conversation_members cm
+		SET last_read_message_id = GREATEST(COALESCE(cm.last_read_message_id, 0), m.id)
+		FROM (
+			SELECT MAX(id) AS id FROM messages
+			WHERE conversation_id = $1 AND ($3::bigint = 0 OR id = $3)
+		) m
+		WHERE cm.conversation_id = $1 AND cm.user_id = $2 AND cm.left_at IS NULL AND m.id IS NOT NULL
+		RETURNING cm.last_read_message_id
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	receipt := ReadReceipt{ConversationID: conversationID, UserID: userID}
+
+	err := s.db.QueryRowContext(ctx, query, conversationID, userID, messageID).Scan(&receipt.MessageID)
+	if err != nil{
+		// nothing to read yet, or a message from another conversation
+		if errors.Is(err, sql.ErrNoRows){
+			if messageID == 0{
+				return nil
+			}
+			return ErrNotFound
+		}
+		return err
+	}
+
+	publish(ctx, s.publisher, events.TypeRead, events.ConversationTopic(conversationID), receipt)
+	return nil
+}
+
+// Leave removes the user from a group conversation. One-to-one conversations
+// can't be left and return ErrNotGroup.
+func (s *ConversationStore) Leave(ctx context.Context, userID int64, conversationID int64) error{
+	conv, err := s.GetByID(ctx, userID, conversationID)
+	if err != nil{
+		return err
+	}
+
+	if !conv.IsGroup{
+		return ErrNotGroup
+	}
+
+	query := `
+		UPDATE conversation_members SET left_at = NOW()
+		WHERE conversation_id = $1 AND user_id = $2 AND left_at IS NULL
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err = s.db.ExecContext(ctx, query, conversationID, userID)
+	return err
+}
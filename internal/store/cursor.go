@@ -0,0 +1,70 @@
+package store
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+)
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// FeedCursor marks a position in a feed ordered by (created_at, id). Prev
+// cursors page back towards the start of the feed.
+type FeedCursor struct{
+	CreatedAt string `json:"t"`
+	ID int64 `json:"id"`
+	Sort string `json:"s"`
+	Prev bool `json:"p,omitempty"`
+}
+
+// EncodeCursor returns the cursor as an opaque token signed with secret so
+// clients can't forge positions.
+func EncodeCursor(secret []byte, c FeedCursor) string{
+	payload, _ := json.Marshal(c)
+
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(payload)
+
+	enc := base64.RawURLEncoding
+	return enc.EncodeToString(payload) + "." + enc.EncodeToString(mac.Sum(nil))
+}
+
+func DecodeCursor(secret []byte, token string) (FeedCursor, error){
+	var c FeedCursor
+
+	payloadPart, sigPart, ok := strings.Cut(token, ".")
+	if !ok{
+		return c, ErrInvalidCursor
+	}
+
+	enc := base64.RawURLEncoding
+
+	payload, err := enc.DecodeString(payloadPart)
+	if err != nil{
+		return c, ErrInvalidCursor
+	}
+
+	sig, err := enc.DecodeString(sigPart)
+	if err != nil{
+		return c, ErrInvalidCursor
+	}
+
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(payload)
+	if !hmac.Equal(sig, mac.Sum(nil)){
+		return c, ErrInvalidCursor
+	}
+
+	if err := json.Unmarshal(payload, &c); err != nil{
+		return c, ErrInvalidCursor
+	}
+
+	if c.Sort != "asc" && c.Sort != "desc"{
+		return c, ErrInvalidCursor
+	}
+
+	return c, nil
+}
@@ -0,0 +1,73 @@
+package store
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestCursorRoundTrip(t *testing.T){
+	secret := []byte("secret")
+
+	cursors := []FeedCursor{
+		{CreatedAt: "2024-01-02T03:04:05Z", ID: 42, Sort: "desc"},
+		{CreatedAt: "2024-01-02T03:04:05.123456Z", ID: 7, Sort: "asc", Prev: true},
+	}
+
+	for _, want := range cursors{
+		got, err := DecodeCursor(secret, EncodeCursor(secret, want))
+		if err != nil{
+			t.Fatalf("DecodeCursor(EncodeCursor(%+v)): %v", want, err)
+		}
+		if got != want{
+			t.Errorf("round trip = %+v, want %+v", got, want)
+		}
+	}
+}
+
+func TestDecodeCursorRejects(t *testing.T){
+	secret := []byte("secret")
+	enc := base64.RawURLEncoding
+
+	valid := EncodeCursor(secret, FeedCursor{CreatedAt: "2024-01-02T03:04:05Z", ID: 42, Sort: "desc"})
+	payload, sig, _ := strings.Cut(valid, ".")
+
+	tests := []struct{
+		name string
+		token string
+	}{
+		{name: "empty", token: ""},
+		{name: "no signature", token: payload},
+		{name: "payload not base64", token: "!!!." + sig},
+		{name: "signature not base64", token: payload + ".!!!"},
+		{name: "other secret", token: EncodeCursor([]byte("other"), FeedCursor{ID: 42, Sort: "desc"})},
+		{
+			name: "tampered sort",
+			token: enc.EncodeToString([]byte(`{"t":"2024-01-02T03:04:05Z","id":42,"s":"asc"}`)) + "." + sig,
+		},
+		{
+			name: "tampered id",
+			token: enc.EncodeToString([]byte(`{"t":"2024-01-02T03:04:05Z","id":1,"s":"desc"}`)) + "." + sig,
+		},
+		{name: "signed but unknown sort", token: EncodeCursor(secret, FeedCursor{ID: 42, Sort: "sideways"})},
+		{name: "signed but not JSON", token: signed(secret, "not json")},
+	}
+
+	for _, tt := range tests{
+		if _, err := DecodeCursor(secret, tt.token); !errors.Is(err, ErrInvalidCursor){
+			t.Errorf("%s: DecodeCursor error = %v, want %v", tt.name, err, ErrInvalidCursor)
+		}
+	}
+}
+
+// signed signs an arbitrary payload the way EncodeCursor does.
+func signed(secret []byte, payload string) string{
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(payload))
+
+	enc := base64.RawURLEncoding
+	return enc.EncodeToString([]byte(payload)) + "." + enc.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,206 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"strings"
+	"unicode"
+
+	"github.com/lib/pq"
+)
+
+const (
+	EntityMention = "mention"
+	EntityHashtag = "hashtag"
+)
+
+// Entity is a mention or hashtag found in post content. Start and End are
+// offsets in Unicode code points, End exclusive, and include the leading @ or #.
+type Entity struct{
+	Type string `json:"type"`
+	Text string `json:"text"`
+	Start int `json:"start"`
+	End int `json:"end"`
+	UserID int64 `json:"user_id,omitempty"`
+}
+
+// Entities is stored as a JSON array.
+type Entities []Entity
+
+func (e Entities) Value() (driver.Value, error){
+	if e == nil{
+		return []byte("[]"), nil
+	}
+	return json.Marshal(e)
+}
+
+func (e *Entities) Scan(src any) error{
+	switch v := src.(type){
+	case nil:
+		*e = Entities{}
+		return nil
+	case []byte:
+		return json.Unmarshal(v, e)
+	case string:
+		return json.Unmarshal([]byte(v), e)
+	default:
+		return errors.New("entities: unsupported type")
+	}
+}
+
+// ParseEntities finds @mentions and #hashtags in content. A marker only counts
+// at the start of the text or after a character that can't be part of a name,
+// so emails and URL fragments are skipped. Mention text keeps its case;
+// hashtags are lowercased and dropped unless they are valid tags.
+func ParseEntities(content string) Entities{
+	runes := []rune(content)
+	entities := Entities{}
+
+	for i := 0; i < len(runes); i++{
+		marker := runes[i]
+		if marker != '@' && marker != '#'{
+			continue
+		}
+
+		if i > 0 && (isNameRune(runes[i-1]) || runes[i-1] == '-'){
+			continue
+		}
+
+		end := i + 1
+		for end < len(runes) && (isNameRune(runes[end]) || marker == '#' && runes[end] == '-'){
+			end++
+		}
+
+		if end == i+1{
+			continue
+		}
+
+		name := string(runes[i+1 : end])
+
+		if marker == '@'{
+			entities = append(entities, Entity{Type: EntityMention, Text: name, Start: i, End: end})
+		} else if name = strings.ToLower(name); TagPattern.MatchString(name){
+			entities = append(entities, Entity{Type: EntityHashtag, Text: name, Start: i, End: end})
+		}
+
+		i = end - 1
+	}
+
+	return entities
+}
+
+func isNameRune(r rune) bool{
+	return r == '_' || r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r))
+}
+
+// Hashtags returns the hashtags in content, normalized like tags.
+func Hashtags(content string) []string{
+	var tags []string
+	for _, e := range ParseEntities(content){
+		if e.Type == EntityHashtag{
+			tags = append(tags, e.Text)
+		}
+	}
+	return NormalizeTags(tags)
+}
+
+// MergeHashtags adds the hashtags in content to tags.
+func MergeHashtags(tags []string, content string) []string{
+	merged := NormalizeTags(append(append([]string{}, tags...), Hashtags(content)...))
+	if merged == nil{
+		return []string{}
+	}
+	return merged
+}
+
+// resolveEntities parses the post's content and resolves mentions to active
+// users. Mentions of unknown users, or of users blocking or blocked by the
+// author, are dropped.
+func resolveEntities(ctx context.Context, tx *sql.Tx, post *Post) error{
+	entities := ParseEntities(post.Content)
+
+	var usernames []string
+	for _, e := range entities{
+		if e.Type == EntityMention{
+			usernames = append(usernames, strings.ToLower(e.Text))
+		}
+	}
+
+	ids := map[string]int64{}
+
+	if len(usernames) > 0{
+		query := `
+			SELECT u.id, LOWER(u.username) FROM users u
+			WHERE
+				LOWER(u.username) = ANY($1) AND
+				` + activeUserCondition + ` AND
+				NOT EXISTS (
+					SELECT 1 FROM blocks b
+					WHERE (b.blocker_id = $2 AND b.blocked_id = u.id) OR (b.blocker_id = u.id AND b.blocked_id = $2)
+				)
+		`
+		rows, err := tx.QueryContext(ctx, query, pq.Array(usernames), post.UserID)
+		if err != nil{
+			return err
+		}
+
+		defer rows.Close()
+
+		for rows.Next(){
+			var id int64
+			var username string
+			if err := rows.Scan(&id, &username); err != nil{
+				return err
+			}
+			ids[username] = id
+		}
+
+		if err := rows.Err(); err != nil{
+			return err
+		}
+	}
+
+	resolved := Entities{}
+	for _, e := range entities{
+		if e.Type == EntityMention{
+			id, ok := ids[strings.ToLower(e.Text)]
+			if !ok{
+				continue
+			}
+			e.UserID = id
+		}
+		resolved = append(resolved, e)
+	}
+
+	post.Entities = resolved
+	return nil
+}
+
+// syncPostMentions makes post_mentions match the post's resolved mentions.
+func syncPostMentions(ctx context.Context, tx *sql.Tx, post *Post) error{
+	userIDs := []int64{}
+	for _, e := range post.Entities{
+		if e.Type == EntityMention{
+			userIDs = append(userIDs, e.UserID)
+		}
+	}
+
+	query := `
+		DELETE FROM post_mentions
+		WHERE post_id = $1 AND NOT (user_id = ANY($2::bigint[]))
+	`
+	if _, err := tx.ExecContext(ctx, query, post.ID, pq.Array(userIDs)); err != nil{
+		return err
+	}
+
+	query = `
+		INSERT INTO post_mentions (post_id, user_id)
+		SELECT $1::bigint, UNNEST($2::bigint[])
+		ON CONFLICT DO NOTHING
+	`
+	_, err := tx.ExecContext(ctx, query, post.ID, pq.Array(userIDs))
+	return err
+}
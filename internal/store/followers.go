@@ -3,10 +3,13 @@ package store
 import (
 	"context"
 	"database/sql"
+	"errors"
 
 	"github.com/lib/pq"
 )
 
+var ErrCannotFollow = errors.New("can't follow this user")
+
 type Follower struct {
 	UserID int64 `json:"user_id"`
 	FollowerID int64 `json:"follower_id"`
@@ -24,14 +27,34 @@ func (s *FollowesStore) Follow(ctx context.Context, followerID int64, userID int
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
 	defer cancel()
 
-	_, err := s.db.ExecContext(ctx, query, userID, followerID)
-	if err != nil{
-		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code =="23505"{
-			return ErrConflict
+	return withTx(s.db, ctx, func(tx *sql.Tx) error{
+		// a block in either direction rules out following, or the blocked
+		// user could follow again and backfill the blocker's posts
+		blocked := `
+			SELECT EXISTS (
+				SELECT 1 FROM blocks
+				WHERE (blocker_id = $1 AND blocked_id = $2) OR (blocker_id = $2 AND blocked_id = $1)
+			)
+		`
+		var isBlocked bool
+		if err := tx.QueryRowContext(ctx, blocked, userID, followerID).Scan(&isBlocked); err != nil{
+			return err
+		}
+
+		if isBlocked{
+			return ErrCannotFollow
 		}
-	}
 
-	return nil
+		_, err := tx.ExecContext(ctx, query, userID, followerID)
+		if err != nil{
+			if pqErr, ok := err.(*pq.Error); ok && pqErr.Code =="23505"{
+				return ErrConflict
+			}
+			return err
+		}
+
+		return backfillTimeline(ctx, tx, followerID, userID)
+	})
 }
 
 func (s *FollowesStore) Unfollow(ctx context.Context, followerID int64, userID int64) error{
@@ -42,6 +65,11 @@ func (s *FollowesStore) Unfollow(ctx context.Context, followerID int64, userID i
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
 	defer cancel()
 
-	_, err := s.db.ExecContext(ctx, query, userID, followerID)
-	return err
+	return withTx(s.db, ctx, func(tx *sql.Tx) error{
+		if _, err := tx.ExecContext(ctx, query, userID, followerID); err != nil{
+			return err
+		}
+
+		return removeFromTimeline(ctx, tx, followerID, userID)
+	})
 }
\ No newline at end of file
@@ -0,0 +1,150 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/nikhilkarle/social/internal/unfurl"
+)
+
+var (
+	// how long a fetched preview is served before it's fetched again
+	LinkPreviewTTL = 7 * 24 * time.Hour
+	// how long to wait before retrying a URL whose fetch failed
+	LinkPreviewRetryAfter = time.Hour
+)
+
+type LinkPreview struct{
+	URL string `json:"url"`
+	Title string `json:"title"`
+	Description string `json:"description"`
+	ImageURL string `json:"image_url"`
+	SiteName string `json:"site_name"`
+}
+
+type LinkPreviewStore struct{
+	db *sql.DB
+}
+
+// syncPostLinks records the URLs in the post's content, which previews are
+// attached by.
+func syncPostLinks(ctx context.Context, tx *sql.Tx, post *Post) error{
+	if _, err := tx.ExecContext(ctx, `DELETE FROM post_links WHERE post_id = $1`, post.ID); err != nil{
+		return err
+	}
+
+	urls := unfurl.ExtractURLs(post.Content)
+	if len(urls) == 0{
+		return nil
+	}
+
+	query := `
+		INSERT INTO post_links (post_id, position, url)
+		SELECT $1::bigint, ord - 1, url FROM UNNEST($2::text[]) WITH ORDINALITY AS u(url, ord)
+	`
+	_, err := tx.ExecContext(ctx, query, post.ID, pq.Array(urls))
+	return err
+}
+
+// GetByPostIDs returns the fetched previews of the given posts' links in
+// order, keyed by post ID. Links still being fetched or that failed are left
+// out.
+func (s *LinkPreviewStore) GetByPostIDs(ctx context.Context, postIDs []int64) (map[int64][]LinkPreview, error){
+	query := `
+		SELECT pl.post_id, lp.url, lp.title, lp.description, lp.image_url, lp.site_name
+		FROM post_links pl
+		JOIN link_previews lp ON lp.url = pl.url
+		WHERE pl.post_id = ANY($1::bigint[]) AND NOT lp.failed
+		ORDER BY pl.post_id, pl.position
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, pq.Array(postIDs))
+	if err != nil{
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	previews := map[int64][]LinkPreview{}
+	for rows.Next(){
+		var postID int64
+		var p LinkPreview
+		if err := rows.Scan(&postID, &p.URL, &p.Title, &p.Description, &p.ImageURL, &p.SiteName); err != nil{
+			return nil, err
+		}
+		previews[postID] = append(previews[postID], p)
+	}
+
+	return previews, rows.Err()
+}
+
+// Stale returns the URLs that have no preview yet or whose preview is due to
+// be fetched again.
+func (s *LinkPreviewStore) Stale(ctx context.Context, urls []string) ([]string, error){
+	query := `
+		SELECT u.url FROM UNNEST($1::text[]) AS u(url)
+		LEFT JOIN link_previews lp ON lp.url = u.url
+		WHERE lp.url IS NULL
+			OR NOT lp.failed AND lp.fetched_at < NOW() - $2::float8 * INTERVAL '1 second'
+			OR lp.failed AND lp.fetched_at < NOW() - $3::float8 * INTERVAL '1 second'
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, pq.Array(urls), LinkPreviewTTL.Seconds(), LinkPreviewRetryAfter.Seconds())
+	if err != nil{
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	stale := []string{}
+	for rows.Next(){
+		var url string
+		if err := rows.Scan(&url); err != nil{
+			return nil, err
+		}
+		stale = append(stale, url)
+	}
+
+	return stale, rows.Err()
+}
+
+// Save stores a fetched preview, replacing any earlier one for the URL.
+func (s *LinkPreviewStore) Save(ctx context.Context, p *LinkPreview) error{
+	query := `
+		INSERT INTO link_previews (url, title, description, image_url, site_name, failed, fetched_at)
+		VALUES ($1, $2, $3, $4, $5, FALSE, NOW())
+		ON CONFLICT (url) DO UPDATE SET
+			title = EXCLUDED.title,
+			description = EXCLUDED.description,
+			image_url = EXCLUDED.image_url,
+			site_name = EXCLUDED.site_name,
+			failed = FALSE,
+			fetched_at = EXCLUDED.fetched_at
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, query, p.URL, p.Title, p.Description, p.ImageURL, p.SiteName)
+	return err
+}
+
+// SaveFailure records a failed fetch. A preview fetched earlier is kept
+// until it expires, so a transient failure doesn't remove it.
+func (s *LinkPreviewStore) SaveFailure(ctx context.Context, url string) error{
+	query := `
+		INSERT INTO link_previews (url, failed, fetched_at) VALUES ($1, TRUE, NOW())
+		ON CONFLICT (url) DO UPDATE SET fetched_at = NOW()
+		WHERE link_previews.failed
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, query, url)
+	return err
+}
@@ -0,0 +1,154 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/lib/pq"
+)
+
+var ErrInvalidMedia = errors.New("media must be your own uploads not attached to another post")
+
+const MaxPostMedia = 4
+
+type Media struct{
+	ID int64 `json:"id"`
+	UserID int64 `json:"user_id"`
+	PostID *int64 `json:"post_id"`
+	ContentType string `json:"content_type"`
+	Width int `json:"width"`
+	Height int `json:"height"`
+	Size int `json:"size"`
+	Key string `json:"-"`
+	ThumbnailKey string `json:"-"`
+	// URL and ThumbnailURL are filled in from the blob store that holds the files
+	URL string `json:"url"`
+	ThumbnailURL string `json:"thumbnail_url"`
+	CreatedAt string `json:"created_at"`
+}
+
+type MediaStore struct{
+	db *sql.DB
+}
+
+func (s *MediaStore) Create(ctx context.Context, media *Media) error{
+	query := `
+		INSERT INTO media (user_id, content_type, width, height, size_bytes, key, thumbnail_key)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING id, created_at
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	return s.db.QueryRowContext(
+		ctx,
+		query,
+		media.UserID,
+		media.ContentType,
+		media.Width,
+		media.Height,
+		media.Size,
+		media.Key,
+		media.ThumbnailKey,
+	).Scan(&media.ID, &media.CreatedAt)
+}
+
+// GetByPostIDs returns the media attached to the given posts in their order,
+// keyed by post ID.
+func (s *MediaStore) GetByPostIDs(ctx context.Context, postIDs []int64) (map[int64][]Media, error){
+	query := `
+		SELECT ` + mediaColumns + `
+		FROM media
+		WHERE post_id = ANY($1::bigint[])
+		ORDER BY post_id, position
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, pq.Array(postIDs))
+	if err != nil{
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	media := map[int64][]Media{}
+	for rows.Next(){
+		m, err := scanMedia(rows)
+		if err != nil{
+			return nil, err
+		}
+		media[*m.PostID] = append(media[*m.PostID], *m)
+	}
+
+	return media, rows.Err()
+}
+
+const mediaColumns = `id, user_id, post_id, content_type, width, height, size_bytes, key, thumbnail_key, created_at`
+
+func scanMedia(rows *sql.Rows) (*Media, error){
+	var m Media
+	err := rows.Scan(
+		&m.ID,
+		&m.UserID,
+		&m.PostID,
+		&m.ContentType,
+		&m.Width,
+		&m.Height,
+		&m.Size,
+		&m.Key,
+		&m.ThumbnailKey,
+		&m.CreatedAt,
+	)
+	return &m, err
+}
+
+// attachMedia links the uploads listed in post.Media to the post in the given
+// order and loads them in full. Only the author's own uploads that aren't on
+// a post yet can be attached.
+func attachMedia(ctx context.Context, tx *sql.Tx, post *Post) error{
+	ids := make([]int64, len(post.Media))
+	for i, m := range post.Media{
+		ids[i] = m.ID
+	}
+
+	query := `
+		UPDATE media m SET post_id = $1, position = ids.ord
+		FROM UNNEST($2::bigint[]) WITH ORDINALITY AS ids(id, ord)
+		WHERE m.id = ids.id AND m.user_id = $3 AND m.post_id IS NULL
+		RETURNING
+			m.id, m.user_id, m.post_id, m.content_type, m.width, m.height,
+			m.size_bytes, m.key, m.thumbnail_key, m.created_at
+	`
+	rows, err := tx.QueryContext(ctx, query, post.ID, pq.Array(ids), post.UserID)
+	if err != nil{
+		return err
+	}
+
+	defer rows.Close()
+
+	attached := map[int64]Media{}
+	for rows.Next(){
+		m, err := scanMedia(rows)
+		if err != nil{
+			return err
+		}
+		attached[m.ID] = *m
+	}
+
+	if err := rows.Err(); err != nil{
+		return err
+	}
+
+	// duplicates and other users' or already attached uploads are missing
+	if len(attached) != len(ids){
+		return ErrInvalidMedia
+	}
+
+	for i, id := range ids{
+		post.Media[i] = attached[id]
+	}
+
+	return nil
+}
@@ -0,0 +1,334 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/lib/pq"
+	"github.com/nikhilkarle/social/internal/events"
+)
+
+const (
+	NotificationFollow = "follow"
+	NotificationComment = "comment"
+	NotificationReaction = "reaction"
+	NotificationMention = "mention"
+)
+
+var NotificationTypes = []string{
+	NotificationFollow,
+	NotificationComment,
+	NotificationReaction,
+	NotificationMention,
+}
+
+type Notification struct{
+	ID int64 `json:"id"`
+	UserID int64 `json:"user_id"`
+	ActorID int64 `json:"actor_id"`
+	Type string `json:"type"`
+	PostID *int64 `json:"post_id"`
+	CommentID *int64 `json:"comment_id"`
+	ReadAt *string `json:"read_at"`
+	CreatedAt string `json:"created_at"`
+}
+
+type NotificationActor struct{
+	ID int64 `json:"id"`
+	Username string `json:"username"`
+}
+
+// NotificationGroup folds notifications of the same kind about the same
+// thing, e.g. every reaction to one post, into a single entry.
+type NotificationGroup struct{
+	Type string `json:"type"`
+	PostID *int64 `json:"post_id"`
+	Summary string `json:"summary"`
+	// Actors holds the most recent actors, up to three
+	Actors []NotificationActor `json:"actors"`
+	ActorsCount int `json:"actors_count"`
+	NotificationIDs []int64 `json:"notification_ids"`
+	Unread bool `json:"unread"`
+	LatestAt string `json:"latest_at"`
+}
+
+type NotificationQuery struct{
+	UnreadOnly bool `json:"unread"`
+	Limit int `json:"limit" validate:"gte=1,lte=50"`
+	Offset int `json:"offset" validate:"gte=0"`
+}
+
+type NotificationStore struct{
+	db *sql.DB
+	publisher Publisher
+}
+
+func (nq NotificationQuery) Parse(r *http.Request) (NotificationQuery, error){
+	qs := r.URL.Query()
+
+	if unread := qs.Get("unread"); unread != ""{
+		u, err := strconv.ParseBool(unread)
+		if err != nil{
+			return nq, err
+		}
+
+		nq.UnreadOnly = u
+	}
+
+	if limit := qs.Get("limit"); limit != ""{
+		l, err := strconv.Atoi(limit)
+		if err != nil{
+			return nq, err
+		}
+
+		nq.Limit = l
+	}
+
+	if offset := qs.Get("offset"); offset != ""{
+		o, err := strconv.Atoi(offset)
+		if err != nil{
+			return nq, err
+		}
+
+		nq.Offset = o
+	}
+
+	return nq, nil
+}
+
+// Create stores a notification unless it would notify users about their own
+// actions, the two users have blocked each other, or the recipient turned
+// that type of notification off. Skipped notifications leave ID at zero.
+func (s *NotificationStore) Create(ctx context.Context, n *Notification) error{
+	query := `
+		INSERT INTO notifications (user_id, actor_id, type, post_id, comment_id, group_key)
+		SELECT $1::bigint, $2::bigint, $3::varchar, $4::bigint, $5::bigint, $6::varchar
+		WHERE
+			$1 <> $2 AND
+			NOT EXISTS (
+				SELECT 1 FROM notification_preferences np
+				WHERE np.user_id = $1 AND np.type = $3 AND NOT np.enabled
+			) AND
+			NOT EXISTS (
+				SELECT 1 FROM blocks b
+				WHERE (b.blocker_id = $1 AND b.blocked_id = $2) OR (b.blocker_id = $2 AND b.blocked_id = $1)
+			)
+		RETURNING id, created_at
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	err := s.db.QueryRowContext(
+		ctx,
+		query,
+		n.UserID,
+		n.ActorID,
+		n.Type,
+		n.PostID,
+		n.CommentID,
+		notificationGroupKey(n),
+	).Scan(&n.ID, &n.CreatedAt)
+
+	if err != nil{
+		if errors.Is(err, sql.ErrNoRows){
+			return nil
+		}
+		return err
+	}
+
+	publish(ctx, s.publisher, events.TypeNotification, events.UserTopic(n.UserID), n)
+	return nil
+}
+
+// notificationGroupKey decides which notifications are folded together:
+// follows all go together, everything else per type and post.
+func notificationGroupKey(n *Notification) string{
+	if n.PostID == nil{
+		return n.Type
+	}
+	return fmt.Sprintf("%s:%d", n.Type, *n.PostID)
+}
+
+// List returns the user's notifications grouped, newest group first. Read and
+// unread notifications are grouped separately.
+func (s *NotificationStore) List(ctx context.Context, userID int64, nq NotificationQuery) ([]NotificationGroup, error){
+	query := `
+		SELECT
+			n.type,
+			MIN(n.post_id),
+			ARRAY_AGG(n.id ORDER BY n.created_at DESC, n.id DESC),
+			ARRAY_AGG(n.actor_id ORDER BY n.created_at DESC, n.id DESC),
+			ARRAY_AGG(u.username ORDER BY n.created_at DESC, n.id DESC),
+			n.read_at IS NULL AS unread,
+			MAX(n.created_at) AS latest_at
+		FROM notifications n
+		JOIN users u ON u.id = n.actor_id
+		WHERE n.user_id = $1 AND (NOT $2 OR n.read_at IS NULL)
+		GROUP BY n.group_key, n.type, n.read_at IS NULL
+		ORDER BY latest_at DESC
+		LIMIT $3 OFFSET $4
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, userID, nq.UnreadOnly, nq.Limit, nq.Offset)
+	if err != nil{
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	groups := []NotificationGroup{}
+
+	for rows.Next(){
+		var g NotificationGroup
+		var postID sql.NullInt64
+		var actorIDs []int64
+		var usernames []string
+
+		err := rows.Scan(
+			&g.Type,
+			&postID,
+			pq.Array(&g.NotificationIDs),
+			pq.Array(&actorIDs),
+			pq.Array(&usernames),
+			&g.Unread,
+			&g.LatestAt,
+		)
+		if err != nil{
+			return nil, err
+		}
+
+		if postID.Valid{
+			g.PostID = &postID.Int64
+		}
+
+		seen := map[int64]bool{}
+		g.Actors = []NotificationActor{}
+		for i, id := range actorIDs{
+			if seen[id]{
+				continue
+			}
+			seen[id] = true
+
+			if len(g.Actors) < 3{
+				g.Actors = append(g.Actors, NotificationActor{ID: id, Username: usernames[i]})
+			}
+		}
+		g.ActorsCount = len(seen)
+		g.Summary = notificationSummary(g)
+
+		groups = append(groups, g)
+	}
+
+	return groups, rows.Err()
+}
+
+// notificationSummary renders a group as e.g. "alice and 3 others reacted to your post".
+func notificationSummary(g NotificationGroup) string{
+	if len(g.Actors) == 0{
+		return ""
+	}
+
+	who := g.Actors[0].Username
+	switch others := g.ActorsCount - 1; others{
+	case 0:
+	case 1:
+		who += " and 1 other"
+	default:
+		who += fmt.Sprintf(" and %d others", others)
+	}
+
+	switch g.Type{
+	case NotificationFollow:
+		return who + " followed you"
+	case NotificationComment:
+		return who + " commented on your post"
+	case NotificationReaction:
+		return who + " reacted to your post"
+	case NotificationMention:
+		return who + " mentioned you in a post"
+	default:
+		return who
+	}
+}
+
+func (s *NotificationStore) MarkRead(ctx context.Context, userID int64, ids []int64) error{
+	query := `
+		UPDATE notifications SET read_at = NOW()
+		WHERE user_id = $1 AND id = ANY($2::bigint[]) AND read_at IS NULL
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, query, userID, pq.Array(ids))
+	return err
+}
+
+func (s *NotificationStore) MarkAllRead(ctx context.Context, userID int64) error{
+	query := `
+		UPDATE notifications SET read_at = NOW()
+		WHERE user_id = $1 AND read_at IS NULL
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, query, userID)
+	return err
+}
+
+// GetPreferences returns whether each notification type is enabled for the
+// user; types without a stored preference are enabled.
+func (s *NotificationStore) GetPreferences(ctx context.Context, userID int64) (map[string]bool, error){
+	query := `
+		SELECT type, enabled FROM notification_preferences
+		WHERE user_id = $1
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, userID)
+	if err != nil{
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	prefs := make(map[string]bool, len(NotificationTypes))
+	for _, t := range NotificationTypes{
+		prefs[t] = true
+	}
+
+	for rows.Next(){
+		var t string
+		var enabled bool
+		if err := rows.Scan(&t, &enabled); err != nil{
+			return nil, err
+		}
+		prefs[t] = enabled
+	}
+
+	return prefs, rows.Err()
+}
+
+func (s *NotificationStore) SetPreferences(ctx context.Context, userID int64, prefs map[string]bool) error{
+	query := `
+		INSERT INTO notification_preferences (user_id, type, enabled) VALUES ($1, $2, $3)
+		ON CONFLICT (user_id, type) DO UPDATE SET enabled = EXCLUDED.enabled
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	return withTx(s.db, ctx, func(tx *sql.Tx) error{
+		for t, enabled := range prefs{
+			if _, err := tx.ExecContext(ctx, query, userID, t, enabled); err != nil{
+				return err
+			}
+		}
+		return nil
+	})
+}
@@ -1,6 +1,7 @@
 package store
 
 import (
+	"fmt"
 	"net/http"
 	"strconv"
 	"strings"
@@ -10,11 +11,14 @@ import (
 type PaginatedFeedQuery struct {
 	Limit int `json:"limit" validate:"gte=1,lte=20"`
 	Offset int `json:"offset" validate:"gte=0"`
-	Sort string `json:"sort" validate:"oneof=asc desc"`
-	Tags []string `json:"tags" validate:"max=5"`
+	Sort string `json:"sort" validate:"oneof=asc desc ranked"`
+	Tags []string `json:"tags" validate:"max=5,dive,max=50,tag"`
 	Search string `json:"search" validate:"max=100"`
 	Since string `json:"since"`
 	Until string `json:"until"`
+	// Cursor is decoded from the signed "cursor" query parameter by the caller
+	// and takes precedence over Offset, which is kept for older clients.
+	Cursor *FeedCursor `json:"-"`
 }
 
 func (fq PaginatedFeedQuery) Parse(r *http.Request) (PaginatedFeedQuery, error){
@@ -49,7 +53,7 @@ func (fq PaginatedFeedQuery) Parse(r *http.Request) (PaginatedFeedQuery, error){
 
 	tags := qs.Get("tags")
 	if tags != ""{
-		fq.Tags = strings.Split(tags, ",")
+		fq.Tags = NormalizeTags(strings.Split(tags, ","))
 	}
 
 	search := qs.Get("search")
@@ -59,22 +63,41 @@ func (fq PaginatedFeedQuery) Parse(r *http.Request) (PaginatedFeedQuery, error){
 
 	since := qs.Get("since")
 	if since != ""{
-		fq.Since = parseTime(since)
+		t, err := parseTime(since)
+		if err != nil{
+			return fq, fmt.Errorf("invalid since: %w", err)
+		}
+
+		fq.Since = t
 	}
 
 	until := qs.Get("until")
-	if since != ""{
-		fq.Until = parseTime(until)
+	if until != ""{
+		t, err := parseTime(until)
+		if err != nil{
+			return fq, fmt.Errorf("invalid until: %w", err)
+		}
+
+		fq.Until = t
+	}
+
+	if fq.Since != "" && fq.Until != "" && fq.Since > fq.Until{
+		return fq, fmt.Errorf("since must not be after until")
 	}
 
 	return fq, nil
 }
 
-func parseTime(s string) string {
-	t, err := time.Parse(time.DateTime, s)
+// parseTime accepts RFC 3339 timestamps as well as time.DateTime, which is
+// read as UTC, and returns the time in UTC formatted as RFC 3339.
+func parseTime(s string) (string, error){
+	t, err := time.Parse(time.RFC3339, s)
 	if err != nil{
-		return ""
+		t, err = time.Parse(time.DateTime, s)
+		if err != nil{
+			return "", fmt.Errorf("%q is not an RFC 3339 or %q date", s, time.DateTime)
+		}
 	}
 
-	return t.Format(time.DateTime)
-}
\ No newline at end of file
+	return t.UTC().Format(time.RFC3339), nil
+}
@@ -0,0 +1,119 @@
+package store
+
+import (
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestPaginatedFeedQueryParse(t *testing.T){
+	defaults := PaginatedFeedQuery{Limit: 20, Offset: 0, Sort: "desc"}
+
+	tests := []struct{
+		name string
+		query string
+		want PaginatedFeedQuery
+		wantErr bool
+	}{
+		{
+			name: "no parameters keeps defaults",
+			query: "",
+			want: defaults,
+		},
+		{
+			name: "limit and offset",
+			query: "limit=5&offset=10",
+			want: PaginatedFeedQuery{Limit: 5, Offset: 10, Sort: "desc"},
+		},
+		{
+			name: "invalid limit",
+			query: "limit=five",
+			wantErr: true,
+		},
+		{
+			name: "invalid offset",
+			query: "offset=-",
+			wantErr: true,
+		},
+		{
+			name: "sort",
+			query: "sort=asc",
+			want: PaginatedFeedQuery{Limit: 20, Sort: "asc"},
+		},
+		{
+			name: "tags are normalized",
+			query: "tags=Go,%20rust%20,go,,",
+			want: PaginatedFeedQuery{Limit: 20, Sort: "desc", Tags: []string{"go", "rust"}},
+		},
+		{
+			name: "search",
+			query: "search=hello",
+			want: PaginatedFeedQuery{Limit: 20, Sort: "desc", Search: "hello"},
+		},
+		{
+			name: "since as RFC 3339 is converted to UTC",
+			query: "since=2024-01-02T03:04:05%2B02:00",
+			want: PaginatedFeedQuery{Limit: 20, Sort: "desc", Since: "2024-01-02T01:04:05Z"},
+		},
+		{
+			name: "until as date time is read as UTC",
+			query: "until=2024-01-02%2003:04:05",
+			want: PaginatedFeedQuery{Limit: 20, Sort: "desc", Until: "2024-01-02T03:04:05Z"},
+		},
+		{
+			name: "invalid since",
+			query: "since=yesterday",
+			wantErr: true,
+		},
+		{
+			name: "invalid until",
+			query: "until=2024-13-01",
+			wantErr: true,
+		},
+		{
+			name: "since and until",
+			query: "since=2024-01-01T00:00:00Z&until=2024-02-01T00:00:00Z",
+			want: PaginatedFeedQuery{Limit: 20, Sort: "desc", Since: "2024-01-01T00:00:00Z", Until: "2024-02-01T00:00:00Z"},
+		},
+		{
+			name: "since after until",
+			query: "since=2024-02-01T00:00:00Z&until=2024-01-01T00:00:00Z",
+			wantErr: true,
+		},
+		{
+			name: "every filter",
+			query: "limit=3&offset=6&sort=ranked&tags=go&search=gc&since=2024-01-01%2000:00:00&until=2024-01-31T00:00:00Z",
+			want: PaginatedFeedQuery{
+				Limit: 3,
+				Offset: 6,
+				Sort: "ranked",
+				Tags: []string{"go"},
+				Search: "gc",
+				Since: "2024-01-01T00:00:00Z",
+				Until: "2024-01-31T00:00:00Z",
+			},
+		},
+	}
+
+	for _, tt := range tests{
+		t.Run(tt.name, func(t *testing.T){
+			r := httptest.NewRequest("GET", "/v1/users/feed?" + tt.query, nil)
+
+			got, err := defaults.Parse(r)
+			if tt.wantErr{
+				if err == nil{
+					t.Fatalf("Parse(%q) = %+v, want an error", tt.query, got)
+				}
+				return
+			}
+
+			if err != nil{
+				t.Fatalf("Parse(%q): %v", tt.query, err)
+			}
+
+			if !reflect.DeepEqual(got, tt.want){
+				t.Errorf("Parse(%q) = %+v, want %+v", tt.query, got, tt.want)
+			}
+		})
+	}
+}
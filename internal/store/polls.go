@@ -0,0 +1,230 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"math"
+
+	"github.com/lib/pq"
+)
+
+var (
+	ErrPollClosed = errors.New("poll is closed")
+	ErrInvalidPollOption = errors.New("option is not part of this poll")
+)
+
+type Poll struct{
+	ID int64 `json:"id"`
+	PostID int64 `json:"post_id"`
+	HideResults bool `json:"hide_results"`
+	ExpiresAt string `json:"expires_at"`
+	Closed bool `json:"closed"`
+	Options []PollOption `json:"options"`
+	// TotalVotes and the options' counts are left out while results are hidden
+	TotalVotes *int `json:"total_votes,omitempty"`
+	ResultsHidden bool `json:"results_hidden"`
+	// UserVote is the option the requesting user voted for
+	UserVote *int64 `json:"user_vote"`
+}
+
+type PollOption struct{
+	ID int64 `json:"id"`
+	Position int `json:"position"`
+	Text string `json:"text"`
+	Votes *int `json:"votes,omitempty"`
+	Percentage *float64 `json:"percentage,omitempty"`
+}
+
+type PollVote struct{
+	PostID int64 `json:"post_id"`
+	OptionID int64 `json:"option_id"`
+	UserID int64 `json:"user_id"`
+}
+
+type PollStore struct{
+	db *sql.DB
+}
+
+// createPoll stores post.Poll and its options, filling in their IDs.
+func createPoll(ctx context.Context, tx *sql.Tx, post *Post) error{
+	poll := post.Poll
+
+	query := `
+		INSERT INTO polls (post_id, hide_results, expires_at) VALUES ($1, $2, $3)
+		RETURNING id, expires_at
+	`
+	if err := tx.QueryRowContext(ctx, query, post.ID, poll.HideResults, poll.ExpiresAt).Scan(&poll.ID, &poll.ExpiresAt); err != nil{
+		return err
+	}
+
+	poll.PostID = post.ID
+
+	query = `
+		INSERT INTO poll_options (poll_id, position, text) VALUES ($1, $2, $3)
+		RETURNING id
+	`
+	for i := range poll.Options{
+		poll.Options[i].Position = i
+		if err := tx.QueryRowContext(ctx, query, poll.ID, i, poll.Options[i].Text).Scan(&poll.Options[i].ID); err != nil{
+			return err
+		}
+	}
+
+	poll.withResults(post.UserID, post.UserID, map[int64]int{})
+	return nil
+}
+
+// GetByPostIDs returns the polls attached to the given posts, keyed by post
+// ID, with results as userID is allowed to see them.
+func (s *PollStore) GetByPostIDs(ctx context.Context, userID int64, postIDs []int64) (map[int64]*Poll, error){
+	query := `
+		SELECT
+			p.id, p.post_id, ps.user_id, p.hide_results, p.expires_at, p.expires_at <= NOW(),
+			(SELECT v.option_id FROM poll_votes v WHERE v.poll_id = p.id AND v.user_id = $2),
+			o.id, o.position, o.text,
+			(SELECT COUNT(*) FROM poll_votes v WHERE v.poll_id = p.id AND v.option_id = o.id)
+		FROM polls p
+		JOIN posts ps ON ps.id = p.post_id
+		JOIN poll_options o ON o.poll_id = p.id
+		WHERE p.post_id = ANY($1::bigint[])
+		ORDER BY p.id, o.position
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, pq.Array(postIDs), userID)
+	if err != nil{
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	polls := map[int64]*Poll{}
+	authors := map[int64]int64{}
+	counts := map[int64]int{}
+
+	for rows.Next(){
+		var p Poll
+		var authorID int64
+		var userVote sql.NullInt64
+		var o PollOption
+		var votes int
+
+		err := rows.Scan(
+			&p.ID,
+			&p.PostID,
+			&authorID,
+			&p.HideResults,
+			&p.ExpiresAt,
+			&p.Closed,
+			&userVote,
+			&o.ID,
+			&o.Position,
+			&o.Text,
+			&votes,
+		)
+		if err != nil{
+			return nil, err
+		}
+
+		poll, ok := polls[p.PostID]
+		if !ok{
+			if userVote.Valid{
+				p.UserVote = &userVote.Int64
+			}
+			poll = &p
+			polls[p.PostID] = poll
+			authors[p.PostID] = authorID
+		}
+
+		poll.Options = append(poll.Options, o)
+		counts[o.ID] = votes
+	}
+
+	if err := rows.Err(); err != nil{
+		return nil, err
+	}
+
+	for postID, poll := range polls{
+		poll.withResults(userID, authors[postID], counts)
+	}
+
+	return polls, nil
+}
+
+// withResults fills in vote counts and percentages unless the poll hides its
+// results from the viewer: results are hidden until the viewer votes or the
+// poll closes, except from the post's author.
+func (p *Poll) withResults(viewerID int64, authorID int64, counts map[int64]int){
+	p.ResultsHidden = p.HideResults && !p.Closed && p.UserVote == nil && viewerID != authorID
+	if p.ResultsHidden{
+		return
+	}
+
+	total := 0
+	for _, o := range p.Options{
+		total += counts[o.ID]
+	}
+	p.TotalVotes = &total
+
+	for i := range p.Options{
+		votes := counts[p.Options[i].ID]
+		percentage := 0.0
+		if total > 0{
+			percentage = math.Round(float64(votes)*1000/float64(total)) / 10
+		}
+
+		p.Options[i].Votes = &votes
+		p.Options[i].Percentage = &percentage
+	}
+}
+
+// Vote records the user's vote. Each user votes once per poll, which the
+// poll_votes primary key enforces; a second vote returns ErrConflict.
+func (s *PollStore) Vote(ctx context.Context, vote *PollVote) error{
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	return withTx(s.db, ctx, func(tx *sql.Tx) error{
+		query := `
+			SELECT id, expires_at <= NOW() FROM polls WHERE post_id = $1
+		`
+		var pollID int64
+		var closed bool
+		if err := tx.QueryRowContext(ctx, query, vote.PostID).Scan(&pollID, &closed); err != nil{
+			if errors.Is(err, sql.ErrNoRows){
+				return ErrNotFound
+			}
+			return err
+		}
+
+		if closed{
+			return ErrPollClosed
+		}
+
+		query = `
+			INSERT INTO poll_votes (poll_id, option_id, user_id)
+			SELECT o.poll_id, o.id, $3::bigint FROM poll_options o
+			WHERE o.poll_id = $1 AND o.id = $2
+		`
+		res, err := tx.ExecContext(ctx, query, pollID, vote.OptionID, vote.UserID)
+		if err != nil{
+			if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505"{
+				return ErrConflict
+			}
+			return err
+		}
+
+		rows, err := res.RowsAffected()
+		if err != nil{
+			return err
+		}
+
+		if rows == 0{
+			return ErrInvalidPollOption
+		}
+
+		return nil
+	})
+}
@@ -4,7 +4,7 @@ import (
 	"context"
 	"database/sql"
 	"errors"
-	"log"
+	"slices"
 
 	"github.com/lib/pq"
 )
@@ -12,40 +12,94 @@ import (
 type Post struct{
 	ID 		int64 `json:"id"`
 	Content string `json:"content"`
+	// ContentHTML is Content rendered from Markdown
+	ContentHTML string `json:"content_html"`
 	Title   string `json:"title"`
 	UserID  int64 `json:"user_id"`
+	// CommunityID is set for posts published to a community rather than to
+	// the author's followers
+	CommunityID *int64 `json:"community_id"`
 	Tags 	[]string `json:"tags"`
+	Entities Entities `json:"entities"`
 	CreatedAt string `json:"created_at"`
 	UpdatedAt string `json:"updated_at"`
 	Version int `json:"version"`
+	// HiddenAt is set when moderators hid the post or the content filter held
+	// it for review
+	HiddenAt *string `json:"hidden_at,omitempty"`
+	// Screening is set by the content filter to queue the post for review
+	Screening *Screening `json:"-"`
 	Comments []Comment `json:"comments"`
 	User User `json:"user"`
+	Poll *Poll `json:"poll,omitempty"`
+	Media []Media `json:"media,omitempty"`
+	LinkPreviews []LinkPreview `json:"link_previews,omitempty"`
 }
 
 type PostWithMetadata struct{
 	Post
 	CommentsCount int `json:"comments_count"`
+	ReactionsCount int `json:"reactions_count"`
 }
 
 type PostStore struct{
 	db *sql.DB 
+	timelines *TimelineStore
 }
 
 func (s *PostStore) GetUserFeed(ctx context.Context, userID int64, fq PaginatedFeedQuery) ([]PostWithMetadata, error){
+	// keyset pagination: walk (created_at, id) from the cursor in the feed's
+	// sort order, or against it when paging back
+	sort, cmp := fq.Sort, "<"
+	if sort == "asc"{
+		cmp = ">"
+	}
+
+	var cursorAt sql.NullString
+	var cursorID int64
+	offset := fq.Offset
+
+	if fq.Cursor != nil{
+		cursorAt = nullString(fq.Cursor.CreatedAt)
+		cursorID = fq.Cursor.ID
+		offset = 0
+
+		if fq.Cursor.Prev{
+			sort, cmp = reverseSort(sort), reverseCmp(cmp)
+		}
+	}
+
+	// candidates are the precomputed timeline plus recent posts from followed
+	// authors too big to fan out on write
 	query := `
+		WITH candidates AS (
+			SELECT t.post_id FROM timelines t
+			WHERE t.user_id = $1
+			UNION
+			SELECT p.id FROM followers f
+			JOIN users a ON a.id = f.user_id
+			JOIN posts p ON p.user_id = f.user_id
+			WHERE f.follower_id = $1 AND p.community_id IS NULL AND a.follower_count > $10
+		)
 		SELECT
-			p.id, p.user_id, p.title, p.content, p.created_at, p.version, p.tags,
+			p.id, p.user_id, p.title, p.content, p.content_html, p.created_at, p.version, p.tags, p.entities,
 			u.username,
-			COUNT(c.id) AS comments_count
-		FROM posts p
+			COUNT(c.id) AS comments_count,
+			(SELECT COUNT(*) FROM post_reactions r WHERE r.post_id = p.id) AS reactions_count
+		FROM candidates cd
+		JOIN posts p ON p.id = cd.post_id
 		LEFT JOIN comments c ON c.post_id = p.id
 		LEFT JOIN users u ON p.user_id = u.id
-		JOIN followers f ON f.follower_id = p.user_id OR p.user_id = $1
 		WHERE
-			f.user_id = $1 AND
-			(p.title ILIKE '%' || $4 || '%' OR p.content ILIKE '%' || $4 || '%')
+			p.hidden_at IS NULL AND
+			` + shadowBanCondition("$1") + ` AND
+			(p.title ILIKE '%' || $4 || '%' OR p.content ILIKE '%' || $4 || '%') AND
+			(COALESCE(CARDINALITY($5::varchar[]), 0) = 0 OR p.tags @> $5) AND
+			($6::timestamptz IS NULL OR p.created_at >= $6) AND
+			($7::timestamptz IS NULL OR p.created_at <= $7) AND
+			($8::timestamptz IS NULL OR (p.created_at, p.id) ` + cmp + ` ($8, $9))
 		GROUP BY p.id, u.username
-		ORDER BY p.created_at ` + fq.Sort + `
+		ORDER BY p.created_at ` + sort + `, p.id ` + sort + `
 		LIMIT $2 OFFSET $3;
 		`
 
@@ -53,8 +107,20 @@ func (s *PostStore) GetUserFeed(ctx context.Context, userID int64, fq PaginatedF
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
 	defer cancel()
 
-	rows, err := s.db.QueryContext(ctx, query, userID, fq.Limit, fq.Offset, fq.Search)
-	log.Println((rows))
+	rows, err := s.db.QueryContext(
+		ctx,
+		query,
+		userID,
+		fq.Limit,
+		offset,
+		fq.Search,
+		pq.Array(fq.Tags),
+		nullString(fq.Since),
+		nullString(fq.Until),
+		cursorAt,
+		cursorID,
+		TimelineFanoutThreshold,
+	)
 	if err != nil{
 		return nil, err
 	}
@@ -70,11 +136,14 @@ func (s *PostStore) GetUserFeed(ctx context.Context, userID int64, fq PaginatedF
 			&post.UserID,
 			&post.Title,
 			&post.Content,
+			&post.ContentHTML,
 			&post.CreatedAt,
 			&post.Version,
 			pq.Array(&post.Tags),
+			&post.Entities,
 			&post.User.Username,
 			&post.CommentsCount,
+			&post.ReactionsCount,
 		)
 
 		if err != nil{
@@ -84,43 +153,117 @@ func (s *PostStore) GetUserFeed(ctx context.Context, userID int64, fq PaginatedF
 		feed = append(feed, post)
 	}
 
+	if fq.Cursor != nil && fq.Cursor.Prev{
+		slices.Reverse(feed)
+	}
 
 	return feed, nil
 }
 
+func reverseSort(sort string) string{
+	if sort == "asc"{
+		return "desc"
+	}
+	return "asc"
+}
+
+func reverseCmp(cmp string) string{
+	if cmp == "<"{
+		return ">"
+	}
+	return "<"
+}
+
 func (s *PostStore) Create(ctx context.Context, post *Post) error {
 	query := `
-	INSERT INTO posts (content, title, user_id, tags)
-	VALUES ($1, $2, $3, $4)
-	RETURNING id, created_at, updated_at
+	INSERT INTO posts (content, content_html, title, user_id, community_id, tags, entities, hidden_at)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, CASE WHEN $8::boolean THEN NOW() END)
+	RETURNING id, created_at, updated_at, hidden_at
 	`
 
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
 	defer cancel()
 
-	err := s.db.QueryRowContext(
-		ctx, 
-		query,
-		post.Content,
-		post.Title,
-		post.UserID,
-		pq.Array(post.Tags),
-	).Scan(
-		&post.ID,
-		&post.CreatedAt,
-		&post.UpdatedAt,
-	)
-	if err != nil {
+	post.Tags = MergeHashtags(post.Tags, post.Content)
+
+	err := withTx(s.db, ctx, func(tx *sql.Tx) error{
+		if err := resolveEntities(ctx, tx, post); err != nil{
+			return err
+		}
+
+		err := tx.QueryRowContext(
+			ctx, 
+			query,
+			post.Content,
+			post.ContentHTML,
+			post.Title,
+			post.UserID,
+			post.CommunityID,
+			pq.Array(post.Tags),
+			post.Entities,
+			post.Screening.held(),
+		).Scan(
+			&post.ID,
+			&post.CreatedAt,
+			&post.UpdatedAt,
+			&post.HiddenAt,
+		)
+		if err != nil {
+			return err
+		}
+
+		if post.Screening != nil{
+			if err := fileScreeningReport(ctx, tx, ReportTargetPost, post.ID, post.UserID, post.Screening); err != nil{
+				return err
+			}
+		}
+
+		if err := syncPostTags(ctx, tx, post.ID, post.Tags); err != nil{
+			return err
+		}
+
+		if err := syncPostMentions(ctx, tx, post); err != nil{
+			return err
+		}
+
+		if err := syncPostLinks(ctx, tx, post); err != nil{
+			return err
+		}
+
+		if post.Poll != nil{
+			if err := createPoll(ctx, tx, post); err != nil{
+				return err
+			}
+		}
+
+		if len(post.Media) > 0{
+			if err := attachMedia(ctx, tx, post); err != nil{
+				return err
+			}
+		}
+
+		// community posts are read from the community feed, not timelines
+		if post.CommunityID != nil{
+			return nil
+		}
+
+		return addToAuthorTimeline(ctx, tx, post)
+	})
+	if err != nil{
 		return err
 	}
 
-	return nil
+	if post.CommunityID != nil{
+		return nil
+	}
+
+	return s.timelines.enqueue(ctx, post.ID)
 }
 
 
 func (s *PostStore) GetByID(ctx context.Context, postID int64) (*Post, error){
 	query := `
-	Select id, user_id, title, content, created_at, updated_at, tags, version  from posts
+	Select id, user_id, community_id, title, content, content_html, created_at, updated_at, tags, entities, version, hidden_at  from posts
 	Where ID = $1
 	`
 
@@ -131,12 +274,16 @@ func (s *PostStore) GetByID(ctx context.Context, postID int64) (*Post, error){
 	err := s.db.QueryRowContext(ctx, query, postID).Scan(
 		&post.ID,
 		&post.UserID,
+		&post.CommunityID,
 		&post.Title,
 		&post.Content,
+		&post.ContentHTML,
 		&post.CreatedAt,
 		&post.UpdatedAt,
 		pq.Array(&post.Tags),
+		&post.Entities,
 		&post.Version,
+		&post.HiddenAt,
 	)
 
 	if err != nil{
@@ -154,30 +301,60 @@ func (s *PostStore) GetByID(ctx context.Context, postID int64) (*Post, error){
 func (s *PostStore) Update(ctx context.Context, post *Post) (error){
 	query := `
 		UPDATE posts
-		SET title = $1, content = $2, updated_at = NOW(), version = version +1
-		WHERE id = $3 and version = $4
-		RETURNING version
+		SET title = $1, content = $2, content_html = $3, tags = $4, entities = $5, updated_at = NOW(), version = version +1,
+			hidden_at = CASE WHEN $8::boolean THEN COALESCE(hidden_at, NOW()) ELSE hidden_at END
+		WHERE id = $6 and version = $7
+		RETURNING version, hidden_at
 	`
 
-	err := s.db.QueryRowContext(
-		ctx, 
-		query, 
-		post.Title, 
-		post.Content, 
-		post.ID,
-		post.Version,
-	).Scan(&post.Version)
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
 
-	if err != nil{
-		switch{
-		case errors.Is(err, sql.ErrNoRows):
-			return ErrNotFound
-		default:
+	post.Tags = MergeHashtags(post.Tags, post.Content)
+
+	return withTx(s.db, ctx, func(tx *sql.Tx) error{
+		if err := resolveEntities(ctx, tx, post); err != nil{
 			return err
 		}
-	}
 
-	return nil
+		err := tx.QueryRowContext(
+			ctx, 
+			query, 
+			post.Title, 
+			post.Content, 
+			post.ContentHTML,
+			pq.Array(post.Tags),
+			post.Entities,
+			post.ID,
+			post.Version,
+			post.Screening.held(),
+		).Scan(&post.Version, &post.HiddenAt)
+
+		if err != nil{
+			switch{
+			case errors.Is(err, sql.ErrNoRows):
+				return ErrNotFound
+			default:
+				return err
+			}
+		}
+
+		if err := syncPostTags(ctx, tx, post.ID, post.Tags); err != nil{
+			return err
+		}
+
+		if err := syncPostMentions(ctx, tx, post); err != nil{
+			return err
+		}
+
+		if post.Screening != nil{
+			if err := fileScreeningReport(ctx, tx, ReportTargetPost, post.ID, post.UserID, post.Screening); err != nil{
+				return err
+			}
+		}
+
+		return syncPostLinks(ctx, tx, post)
+	})
 }
 
 func (s *PostStore) Delete(ctx context.Context, postID int64) error{
@@ -0,0 +1,137 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+type Reaction struct{
+	PostID int64 `json:"post_id"`
+	UserID int64 `json:"user_id"`
+	Kind string `json:"kind"`
+	CreatedAt string `json:"created_at"`
+}
+
+// Affinity counts how often a user interacted (commented or reacted) with
+// each author and tag over a recent window.
+type Affinity struct{
+	Authors map[int64]int
+	Tags map[string]int
+}
+
+type ReactionStore struct{
+	db *sql.DB
+}
+
+// AffinityWindow is how far back interactions count towards Affinity.
+var AffinityWindow = 90 * 24 * time.Hour
+
+// React sets the user's reaction on a post, replacing any earlier one.
+func (s *ReactionStore) React(ctx context.Context, reaction *Reaction) error{
+	query := `
+		INSERT INTO post_reactions (post_id, user_id, kind) VALUES ($1, $2, $3)
+		ON CONFLICT (post_id, user_id) DO UPDATE SET kind = EXCLUDED.kind, created_at = NOW()
+		RETURNING created_at
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	return s.db.QueryRowContext(ctx, query, reaction.PostID, reaction.UserID, reaction.Kind).Scan(&reaction.CreatedAt)
+}
+
+func (s *ReactionStore) Unreact(ctx context.Context, postID int64, userID int64) error{
+	query := `
+		DELETE FROM post_reactions
+		WHERE post_id = $1 AND user_id = $2
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctx, query, postID, userID)
+	if err != nil{
+		return err
+	}
+
+	rows, err := res.RowsAffected()
+	if err != nil{
+		return err
+	}
+
+	if rows == 0{
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+func (s *ReactionStore) GetAffinity(ctx context.Context, userID int64) (*Affinity, error){
+	interactions := `
+		WITH interactions AS (
+			SELECT post_id FROM comments
+			WHERE user_id = $1 AND created_at >= NOW() - $2::float8 * INTERVAL '1 second'
+			UNION ALL
+			SELECT post_id FROM post_reactions
+			WHERE user_id = $1 AND created_at >= NOW() - $2::float8 * INTERVAL '1 second'
+		)
+	`
+	authorsQuery := interactions + `
+		SELECT p.user_id, COUNT(*)
+		FROM interactions i
+		JOIN posts p ON p.id = i.post_id
+		WHERE p.user_id <> $1
+		GROUP BY p.user_id
+	`
+	tagsQuery := interactions + `
+		SELECT t.tag, COUNT(*)
+		FROM interactions i
+		JOIN posts p ON p.id = i.post_id
+		CROSS JOIN LATERAL UNNEST(p.tags) AS t(tag)
+		GROUP BY t.tag
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	affinity := &Affinity{
+		Authors: map[int64]int{},
+		Tags: map[string]int{},
+	}
+
+	rows, err := s.db.QueryContext(ctx, authorsQuery, userID, AffinityWindow.Seconds())
+	if err != nil{
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next(){
+		var authorID int64
+		var count int
+		if err := rows.Scan(&authorID, &count); err != nil{
+			return nil, err
+		}
+		affinity.Authors[authorID] = count
+	}
+
+	if err := rows.Err(); err != nil{
+		return nil, err
+	}
+
+	tagRows, err := s.db.QueryContext(ctx, tagsQuery, userID, AffinityWindow.Seconds())
+	if err != nil{
+		return nil, err
+	}
+
+	defer tagRows.Close()
+
+	for tagRows.Next(){
+		var tag string
+		var count int
+		if err := tagRows.Scan(&tag, &count); err != nil{
+			return nil, err
+		}
+		affinity.Tags[tag] = count
+	}
+
+	return affinity, tagRows.Err()
+}
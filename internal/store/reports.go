@@ -0,0 +1,504 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+const (
+	ReportTargetPost = "post"
+	ReportTargetComment = "comment"
+	ReportTargetUser = "user"
+
+	ReportOpen = "open"
+	ReportClaimed = "claimed"
+	ReportResolved = "resolved"
+
+	// moderation actions; all but ModerationClaim resolve a report
+	ModerationClaim = "claim"
+	ModerationDismiss = "dismiss"
+	ModerationHide = "hide"
+	ModerationSuspend = "suspend"
+)
+
+// ReportReasons are the reason codes a report can give.
+var ReportReasons = []string{
+	"spam",
+	"harassment",
+	"hate",
+	"violence",
+	"sexual",
+	"self_harm",
+	"misinformation",
+	"other",
+}
+
+// ReportReasonContentFilter is the reason on reports the content filter files.
+const ReportReasonContentFilter = "content_filter"
+
+var (
+	ErrReportClaimed = errors.New("report is claimed by another moderator")
+	ErrReportResolved = errors.New("report is already resolved")
+	ErrCannotHideUser = errors.New("only posts and comments can be hidden")
+)
+
+type Report struct{
+	ID int64 `json:"id"`
+	// ReporterID is nil on reports filed by the content filter
+	ReporterID *int64 `json:"reporter_id"`
+	TargetType string `json:"target_type"`
+	TargetID int64 `json:"target_id"`
+	TargetUserID int64 `json:"target_user_id"`
+	Reason string `json:"reason"`
+	Details string `json:"details"`
+	Status string `json:"status"`
+	ClaimedBy *int64 `json:"claimed_by"`
+	ClaimedAt *string `json:"claimed_at"`
+	Resolution *string `json:"resolution"`
+	ResolvedBy *int64 `json:"resolved_by"`
+	ResolvedAt *string `json:"resolved_at"`
+	CreatedAt string `json:"created_at"`
+	// TargetReports counts the pending reports against the same target
+	TargetReports int `json:"target_reports"`
+	// Actions is the report's moderation history, loaded by GetByID
+	Actions []ModerationAction `json:"actions,omitempty"`
+}
+
+// Screening is the content filter's verdict on new content. The content is
+// queued for review with the reasons as the report details; held content is
+// also hidden until a moderator dismisses the report.
+type Screening struct{
+	Hold bool
+	Reasons []string
+}
+
+func (s *Screening) held() bool{
+	return s != nil && s.Hold
+}
+
+// ModerationAction is an entry in the moderation audit trail.
+type ModerationAction struct{
+	ID int64 `json:"id"`
+	ReportID int64 `json:"report_id"`
+	ModeratorID int64 `json:"moderator_id"`
+	Action string `json:"action"`
+	TargetType string `json:"target_type"`
+	TargetID int64 `json:"target_id"`
+	TargetUserID int64 `json:"target_user_id"`
+	Note string `json:"note"`
+	CreatedAt string `json:"created_at"`
+}
+
+// Resolution is a moderator's decision on a report.
+type Resolution struct{
+	Action string
+	Note string
+	// SuspendFor is how long the target user is suspended for ModerationSuspend
+	SuspendFor time.Duration
+}
+
+type ReportQuery struct{
+	Status string `json:"status" validate:"omitempty,oneof=open claimed resolved"`
+	TargetType string `json:"target_type" validate:"omitempty,oneof=post comment user"`
+	Reason string `json:"reason" validate:"omitempty,max=32"`
+	// ClaimedBy only returns reports claimed by this moderator
+	ClaimedBy int64 `json:"claimed_by" validate:"gte=0"`
+	Limit int `json:"limit" validate:"gte=1,lte=50"`
+	Offset int `json:"offset" validate:"gte=0"`
+}
+
+func (rq ReportQuery) Parse(r *http.Request) (ReportQuery, error){
+	qs := r.URL.Query()
+
+	if status := qs.Get("status"); status != ""{
+		rq.Status = status
+	}
+
+	rq.TargetType = qs.Get("target_type")
+	rq.Reason = qs.Get("reason")
+
+	if claimedBy := qs.Get("claimed_by"); claimedBy != ""{
+		c, err := strconv.ParseInt(claimedBy, 10, 64)
+		if err != nil{
+			return rq, err
+		}
+
+		rq.ClaimedBy = c
+	}
+
+	if limit := qs.Get("limit"); limit != ""{
+		l, err := strconv.Atoi(limit)
+		if err != nil{
+			return rq, err
+		}
+
+		rq.Limit = l
+	}
+
+	if offset := qs.Get("offset"); offset != ""{
+		o, err := strconv.Atoi(offset)
+		if err != nil{
+			return rq, err
+		}
+
+		rq.Offset = o
+	}
+
+	return rq, nil
+}
+
+type ReportStore struct{
+	db *sql.DB
+}
+
+// Create files a report. The target has to exist; ErrNotFound is returned
+// otherwise. A reporter can only have one pending report per target, so a
+// repeat returns ErrConflict.
+func (s *ReportStore) Create(ctx context.Context, report *Report) error{
+	query := `
+		INSERT INTO reports (reporter_id, target_type, target_id, target_user_id, reason, details)
+		SELECT $1::bigint, $2::varchar, $3::bigint, t.user_id, $4, $5
+		FROM (
+			SELECT CASE $2::varchar
+				WHEN 'post' THEN (SELECT user_id FROM posts WHERE id = $3)
+				WHEN 'comment' THEN (SELECT user_id FROM comments WHERE id = $3)
+				WHEN 'user' THEN (SELECT id FROM users WHERE id = $3)
+			END AS user_id
+		) t
+		WHERE t.user_id IS NOT NULL
+		RETURNING id, target_user_id, status, created_at
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	err := s.db.QueryRowContext(
+		ctx,
+		query,
+		report.ReporterID,
+		report.TargetType,
+		report.TargetID,
+		report.Reason,
+		report.Details,
+	).Scan(
+		&report.ID,
+		&report.TargetUserID,
+		&report.Status,
+		&report.CreatedAt,
+	)
+	if err != nil{
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505"{
+			return ErrConflict
+		}
+		if errors.Is(err, sql.ErrNoRows){
+			return ErrNotFound
+		}
+		return err
+	}
+
+	return nil
+}
+
+const reportColumns = `
+	r.id, r.reporter_id, r.target_type, r.target_id, r.target_user_id, r.reason, r.details,
+	r.status, r.claimed_by, r.claimed_at, r.resolution, r.resolved_by, r.resolved_at, r.created_at,
+	(
+		SELECT COUNT(*) FROM reports rt
+		WHERE rt.target_type = r.target_type AND rt.target_id = r.target_id AND rt.status <> 'resolved'
+	)
+`
+
+func scanReport(row interface{ Scan(...any) error }) (*Report, error){
+	var r Report
+	err := row.Scan(
+		&r.ID,
+		&r.ReporterID,
+		&r.TargetType,
+		&r.TargetID,
+		&r.TargetUserID,
+		&r.Reason,
+		&r.Details,
+		&r.Status,
+		&r.ClaimedBy,
+		&r.ClaimedAt,
+		&r.Resolution,
+		&r.ResolvedBy,
+		&r.ResolvedAt,
+		&r.CreatedAt,
+		&r.TargetReports,
+	)
+	return &r, err
+}
+
+// GetQueue lists reports oldest first, open ones by default.
+func (s *ReportStore) GetQueue(ctx context.Context, rq ReportQuery) ([]Report, error){
+	query := `
+		SELECT ` + reportColumns + `
+		FROM reports r
+		WHERE
+			r.status = $1 AND
+			($2::varchar = '' OR r.target_type = $2) AND
+			($3::varchar = '' OR r.reason = $3) AND
+			($4::bigint = 0 OR r.claimed_by = $4)
+		ORDER BY r.created_at, r.id
+		LIMIT $5 OFFSET $6
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	status := rq.Status
+	if status == ""{
+		status = ReportOpen
+	}
+
+	rows, err := s.db.QueryContext(ctx, query, status, rq.TargetType, rq.Reason, rq.ClaimedBy, rq.Limit, rq.Offset)
+	if err != nil{
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	reports := []Report{}
+	for rows.Next(){
+		r, err := scanReport(rows)
+		if err != nil{
+			return nil, err
+		}
+		reports = append(reports, *r)
+	}
+
+	return reports, rows.Err()
+}
+
+// GetByID returns a report with its moderation history.
+func (s *ReportStore) GetByID(ctx context.Context, reportID int64) (*Report, error){
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	query := `SELECT ` + reportColumns + ` FROM reports r WHERE r.id = $1`
+	report, err := scanReport(s.db.QueryRowContext(ctx, query, reportID))
+	if err != nil{
+		if errors.Is(err, sql.ErrNoRows){
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+
+	query = `
+		SELECT id, report_id, moderator_id, action, target_type, target_id, target_user_id, note, created_at
+		FROM moderation_actions
+		WHERE report_id = $1
+		ORDER BY created_at, id
+	`
+	rows, err := s.db.QueryContext(ctx, query, reportID)
+	if err != nil{
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	report.Actions = []ModerationAction{}
+	for rows.Next(){
+		var a ModerationAction
+		err := rows.Scan(&a.ID, &a.ReportID, &a.ModeratorID, &a.Action, &a.TargetType, &a.TargetID, &a.TargetUserID, &a.Note, &a.CreatedAt)
+		if err != nil{
+			return nil, err
+		}
+		report.Actions = append(report.Actions, a)
+	}
+
+	return report, rows.Err()
+}
+
+// Claim assigns an open report to the moderator. Claiming a report the
+// moderator already holds is a no-op.
+func (s *ReportStore) Claim(ctx context.Context, reportID int64, moderatorID int64) error{
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	return withTx(s.db, ctx, func(tx *sql.Tx) error{
+		report, err := lockReport(ctx, tx, reportID, moderatorID)
+		if err != nil{
+			return err
+		}
+
+		if report.Status == ReportClaimed && report.ClaimedBy != nil{
+			return nil
+		}
+
+		query := `
+			UPDATE reports SET status = 'claimed', claimed_by = $2, claimed_at = NOW()
+			WHERE id = $1
+		`
+		if _, err := tx.ExecContext(ctx, query, reportID, moderatorID); err != nil{
+			return err
+		}
+
+		return logModerationAction(ctx, tx, report, moderatorID, ModerationClaim, "")
+	})
+}
+
+// Resolve applies the moderator's decision to the report's target and
+// resolves every pending report against that target, recording the decision
+// in the audit trail. It reports whether a dismissal released content the
+// content filter held, which hasn't been announced yet.
+func (s *ReportStore) Resolve(ctx context.Context, reportID int64, moderatorID int64, res Resolution) (bool, error){
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var released bool
+
+	err := withTx(s.db, ctx, func(tx *sql.Tx) error{
+		report, err := lockReport(ctx, tx, reportID, moderatorID)
+		if err != nil{
+			return err
+		}
+
+		switch res.Action{
+		case ModerationDismiss:
+			// dismissing approves content the filter held
+			released, err = releaseHeld(ctx, tx, report)
+			if err != nil{
+				return err
+			}
+
+		case ModerationHide:
+			var query string
+			switch report.TargetType{
+			case ReportTargetPost:
+				query = `UPDATE posts SET hidden_at = COALESCE(hidden_at, NOW()) WHERE id = $1`
+			case ReportTargetComment:
+				query = `UPDATE comments SET hidden_at = COALESCE(hidden_at, NOW()) WHERE id = $1`
+			default:
+				return ErrCannotHideUser
+			}
+
+			if _, err := tx.ExecContext(ctx, query, report.TargetID); err != nil{
+				return err
+			}
+
+		case ModerationSuspend:
+			// an existing longer suspension is kept
+			query := `
+				UPDATE users
+				SET suspended_until = GREATEST(suspended_until, NOW() + $2::float8 * INTERVAL '1 second')
+				WHERE id = $1
+			`
+			if _, err := tx.ExecContext(ctx, query, report.TargetUserID, res.SuspendFor.Seconds()); err != nil{
+				return err
+			}
+		}
+
+		query := `
+			UPDATE reports
+			SET status = 'resolved', resolution = $3, resolved_by = $4, resolved_at = NOW()
+			WHERE target_type = $1 AND target_id = $2 AND status <> 'resolved'
+		`
+		if _, err := tx.ExecContext(ctx, query, report.TargetType, report.TargetID, res.Action, moderatorID); err != nil{
+			return err
+		}
+
+		return logModerationAction(ctx, tx, report, moderatorID, res.Action, res.Note)
+	})
+	if err != nil{
+		return false, err
+	}
+
+	return released, nil
+}
+
+// lockReport loads a report for an update by the moderator, failing if it's
+// resolved or claimed by someone else.
+func lockReport(ctx context.Context, tx *sql.Tx, reportID int64, moderatorID int64) (*Report, error){
+	query := `
+		SELECT id, target_type, target_id, target_user_id, status, claimed_by
+		FROM reports WHERE id = $1
+		FOR UPDATE
+	`
+	var r Report
+	err := tx.QueryRowContext(ctx, query, reportID).Scan(
+		&r.ID,
+		&r.TargetType,
+		&r.TargetID,
+		&r.TargetUserID,
+		&r.Status,
+		&r.ClaimedBy,
+	)
+	if err != nil{
+		if errors.Is(err, sql.ErrNoRows){
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+
+	switch{
+	case r.Status == ReportResolved:
+		return nil, ErrReportResolved
+	case r.Status == ReportClaimed && r.ClaimedBy != nil && *r.ClaimedBy != moderatorID:
+		return nil, ErrReportClaimed
+	}
+
+	return &r, nil
+}
+
+// fileScreeningReport queues new content the filter matched for review.
+func fileScreeningReport(ctx context.Context, tx *sql.Tx, targetType string, targetID int64, userID int64, s *Screening) error{
+	query := `
+		INSERT INTO reports (target_type, target_id, target_user_id, reason, details)
+		VALUES ($1, $2, $3, $4, $5)
+	`
+	details := strings.Join(s.Reasons, "; ")
+	if r := []rune(details); len(r) > 1000{
+		details = string(r[:1000])
+	}
+
+	_, err := tx.ExecContext(ctx, query, targetType, targetID, userID, ReportReasonContentFilter, details)
+	return err
+}
+
+// releaseHeld unhides the report's target if the content filter held it,
+// reporting whether it did. Content a moderator hid stays hidden.
+func releaseHeld(ctx context.Context, tx *sql.Tx, report *Report) (bool, error){
+	var table string
+	switch report.TargetType{
+	case ReportTargetPost:
+		table = "posts"
+	case ReportTargetComment:
+		table = "comments"
+	default:
+		return false, nil
+	}
+
+	query := `
+		UPDATE ` + table + ` SET hidden_at = NULL
+		WHERE id = $1 AND hidden_at IS NOT NULL AND EXISTS (
+			SELECT 1 FROM reports
+			WHERE target_type = $2 AND target_id = $1 AND reason = $3 AND status <> 'resolved'
+		) AND NOT EXISTS (
+			SELECT 1 FROM moderation_actions
+			WHERE target_type = $2 AND target_id = $1 AND action = 'hide'
+		)
+	`
+	res, err := tx.ExecContext(ctx, query, report.TargetID, report.TargetType, ReportReasonContentFilter)
+	if err != nil{
+		return false, err
+	}
+
+	rows, err := res.RowsAffected()
+	return rows > 0, err
+}
+
+func logModerationAction(ctx context.Context, tx *sql.Tx, report *Report, moderatorID int64, action string, note string) error{
+	query := `
+		INSERT INTO moderation_actions (report_id, moderator_id, action, target_type, target_id, target_user_id, note)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+	`
+	_, err := tx.ExecContext(ctx, query, report.ID, moderatorID, action, report.TargetType, report.TargetID, report.TargetUserID, note)
+	return err
+}
@@ -0,0 +1,298 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+type PostSearchQuery struct{
+	Query string `json:"q" validate:"required,max=200"`
+	Author string `json:"author" validate:"max=255"`
+	Tag string `json:"tag" validate:"omitempty,max=50,tag"`
+	Since string `json:"since"`
+	Until string `json:"until"`
+	Limit int `json:"limit" validate:"gte=1,lte=20"`
+	Offset int `json:"offset" validate:"gte=0"`
+}
+
+type PostSearchResult struct{
+	PostWithMetadata
+	Rank float64 `json:"rank"`
+	TitleHighlight string `json:"title_highlight"`
+	ContentHighlight string `json:"content_highlight"`
+}
+
+func (sq PostSearchQuery) Parse(r *http.Request) (PostSearchQuery, error){
+	qs := r.URL.Query()
+
+	sq.Query = strings.TrimSpace(qs.Get("q"))
+	sq.Author = strings.TrimSpace(qs.Get("author"))
+
+	if tag := qs.Get("tag"); tag != ""{
+		if tags := NormalizeTags([]string{tag}); len(tags) > 0{
+			sq.Tag = tags[0]
+		}
+	}
+
+	if limit := qs.Get("limit"); limit != ""{
+		l, err := strconv.Atoi(limit)
+		if err != nil{
+			return sq, err
+		}
+
+		sq.Limit = l
+	}
+
+	if offset := qs.Get("offset"); offset != ""{
+		o, err := strconv.Atoi(offset)
+		if err != nil{
+			return sq, err
+		}
+
+		sq.Offset = o
+	}
+
+	if since := qs.Get("since"); since != ""{
+		t, err := parseTime(since)
+		if err != nil{
+			return sq, fmt.Errorf("invalid since: %w", err)
+		}
+
+		sq.Since = t
+	}
+
+	if until := qs.Get("until"); until != ""{
+		t, err := parseTime(until)
+		if err != nil{
+			return sq, fmt.Errorf("invalid until: %w", err)
+		}
+
+		sq.Until = t
+	}
+
+	return sq, nil
+}
+
+// Search matches posts against a websearch_to_tsquery query ("quoted phrases",
+// OR, -excluded) and orders them by ts_rank, best first.
+func (s *PostStore) Search(ctx context.Context, viewerID int64, sq PostSearchQuery) ([]PostSearchResult, error){
+	query := `
+		WITH q AS (
+			SELECT websearch_to_tsquery('english', $1) AS query
+		)
+		SELECT
+			p.id, p.user_id, p.title, p.content, p.content_html, p.created_at, p.version, p.tags, p.entities,
+			u.username,
+			(SELECT COUNT(*) FROM comments c WHERE c.post_id = p.id) AS comments_count,
+			(SELECT COUNT(*) FROM post_reactions r WHERE r.post_id = p.id) AS reactions_count,
+			ts_rank(p.search_vector, q.query) AS rank,
+			ts_headline('english', translate(p.title, '` + highlightStart + highlightStop + `', ''), q.query, 'StartSel=` + highlightStart + `, StopSel=` + highlightStop + `, HighlightAll=true'),
+			ts_headline('english', translate(p.content, '` + highlightStart + highlightStop + `', ''), q.query, 'StartSel=` + highlightStart + `, StopSel=` + highlightStop + `, MaxFragments=2, MaxWords=30, MinWords=10')
+		FROM posts p
+		CROSS JOIN q
+		JOIN users u ON u.id = p.user_id
+		WHERE
+			p.search_vector @@ q.query AND
+			` + publicPostCondition + ` AND
+			` + shadowBanCondition("$8") + ` AND
+			($2 = '' OR u.username = $2) AND
+			($3 = '' OR p.tags @> ARRAY[$3]::varchar[]) AND
+			($4::timestamptz IS NULL OR p.created_at >= $4) AND
+			($5::timestamptz IS NULL OR p.created_at <= $5)
+		ORDER BY rank DESC, p.created_at DESC, p.id DESC
+		LIMIT $6 OFFSET $7
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(
+		ctx,
+		query,
+		sq.Query,
+		sq.Author,
+		sq.Tag,
+		nullString(sq.Since),
+		nullString(sq.Until),
+		sq.Limit,
+		sq.Offset,
+		viewerID,
+	)
+	if err != nil{
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	results := []PostSearchResult{}
+
+	for rows.Next(){
+		var res PostSearchResult
+		err := rows.Scan(
+			&res.ID,
+			&res.UserID,
+			&res.Title,
+			&res.Content,
+			&res.ContentHTML,
+			&res.CreatedAt,
+			&res.Version,
+			pq.Array(&res.Tags),
+			&res.Entities,
+			&res.User.Username,
+			&res.CommentsCount,
+			&res.ReactionsCount,
+			&res.Rank,
+			&res.TitleHighlight,
+			&res.ContentHighlight,
+		)
+		if err != nil{
+			return nil, err
+		}
+
+		res.User.ID = res.UserID
+		res.TitleHighlight = escapeHighlight(res.TitleHighlight)
+		res.ContentHighlight = escapeHighlight(res.ContentHighlight)
+		results = append(results, res)
+	}
+
+	return results, rows.Err()
+}
+
+// ts_headline wraps matches in these private use runes rather than in <mark>,
+// so a literal "<mark>" in a post can't pass for a highlight. The runes are
+// deleted from the text first for the same reason.
+const (
+	highlightStart = "\uE000"
+	highlightStop = "\uE001"
+)
+
+// escapeHighlight HTML-escapes a ts_headline fragment, then turns the
+// highlight markers into <mark> tags, so clients can render highlights as HTML.
+func escapeHighlight(s string) string{
+	s = html.EscapeString(s)
+	s = strings.ReplaceAll(s, highlightStart, "<mark>")
+	return strings.ReplaceAll(s, highlightStop, "</mark>")
+}
+
+type UserSearchQuery struct{
+	Query string `json:"q" validate:"required,max=100"`
+	Limit int `json:"limit" validate:"gte=1,lte=20"`
+	Offset int `json:"offset" validate:"gte=0"`
+}
+
+type UserSearchResult struct{
+	ID int64 `json:"id"`
+	Username string `json:"username"`
+	DisplayName string `json:"display_name"`
+	Following bool `json:"following"`
+	MutualFollowers int `json:"mutual_followers"`
+	Score float64 `json:"score"`
+}
+
+func (sq UserSearchQuery) Parse(r *http.Request) (UserSearchQuery, error){
+	qs := r.URL.Query()
+
+	sq.Query = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(qs.Get("q")), "@"))
+
+	if limit := qs.Get("limit"); limit != ""{
+		l, err := strconv.Atoi(limit)
+		if err != nil{
+			return sq, err
+		}
+
+		sq.Limit = l
+	}
+
+	if offset := qs.Get("offset"); offset != ""{
+		o, err := strconv.Atoi(offset)
+		if err != nil{
+			return sq, err
+		}
+
+		sq.Offset = o
+	}
+
+	return sq, nil
+}
+
+// Search finds active users whose username or display name is similar to the
+// query. Prefix matches, accounts the caller follows and accounts sharing
+// followers with the caller rank higher; users blocked either way are left out.
+func (s *UserStore) Search(ctx context.Context, callerID int64, sq UserSearchQuery) ([]UserSearchResult, error){
+	query := `
+		WITH matches AS (
+			SELECT
+				u.id, u.username, u.display_name,
+				GREATEST(similarity(u.username, $1), similarity(u.display_name, $1)) AS similarity,
+				(LOWER(u.username) LIKE LOWER($2) || '%' OR LOWER(u.display_name) LIKE LOWER($2) || '%') AS prefix,
+				EXISTS (
+					SELECT 1 FROM followers f WHERE f.user_id = u.id AND f.follower_id = $3
+				) AS following,
+				(
+					SELECT COUNT(*) FROM followers fu
+					JOIN followers fc ON fc.follower_id = fu.follower_id AND fc.user_id = $3
+					WHERE fu.user_id = u.id
+				) AS mutual_followers
+			FROM users u
+			WHERE
+				` + activeUserCondition + ` AND
+				u.id <> $3 AND
+				(
+					u.username % $1 OR u.display_name % $1 OR
+					LOWER(u.username) LIKE LOWER($2) || '%' OR LOWER(u.display_name) LIKE LOWER($2) || '%'
+				) AND
+				NOT EXISTS (
+					SELECT 1 FROM blocks b
+					WHERE (b.blocker_id = $3 AND b.blocked_id = u.id) OR (b.blocker_id = u.id AND b.blocked_id = $3)
+				)
+		)
+		SELECT
+			id, username, display_name, following, mutual_followers,
+			similarity +
+				CASE WHEN prefix THEN 0.5 ELSE 0 END +
+				CASE WHEN following THEN 0.3 ELSE 0 END +
+				LEAST(mutual_followers, 10) * 0.02 AS score
+		FROM matches
+		ORDER BY score DESC, username ASC
+		LIMIT $4 OFFSET $5
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, sq.Query, escapeLike(sq.Query), callerID, sq.Limit, sq.Offset)
+	if err != nil{
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	results := []UserSearchResult{}
+
+	for rows.Next(){
+		var res UserSearchResult
+		err := rows.Scan(
+			&res.ID,
+			&res.Username,
+			&res.DisplayName,
+			&res.Following,
+			&res.MutualFollowers,
+			&res.Score,
+		)
+		if err != nil{
+			return nil, err
+		}
+		results = append(results, res)
+	}
+
+	return results, rows.Err()
+}
+
+// escapeLike escapes the LIKE wildcards in s so it matches literally.
+func escapeLike(s string) string{
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
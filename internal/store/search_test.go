@@ -0,0 +1,22 @@
+package store
+
+import "testing"
+
+func TestEscapeHighlight(t *testing.T){
+	tests := []struct{
+		in string
+		want string
+	}{
+		{in: "plain text", want: "plain text"},
+		{in: "a " + highlightStart + "match" + highlightStop + " here", want: "a <mark>match</mark> here"},
+		{in: "<script>" + highlightStart + "x" + highlightStop + "</script>", want: "&lt;script&gt;<mark>x</mark>&lt;/script&gt;"},
+		{in: "literal <mark>not a match</mark>", want: "literal &lt;mark&gt;not a match&lt;/mark&gt;"},
+		{in: `"quotes" & 'apostrophes'`, want: "&#34;quotes&#34; &amp; &#39;apostrophes&#39;"},
+	}
+
+	for _, tt := range tests{
+		if got := escapeHighlight(tt.in); got != tt.want{
+			t.Errorf("escapeHighlight(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
@@ -3,8 +3,12 @@ package store
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"errors"
+	"log"
 	"time"
+
+	"github.com/nikhilkarle/social/internal/events"
 )
 
 var (
@@ -20,11 +24,16 @@ type Storage struct {
 		Update(context.Context, *Post)(error)
 		Delete(context.Context, int64) (error)
 		GetUserFeed(context.Context, int64, PaginatedFeedQuery) ([]PostWithMetadata, error)
+		Search(context.Context, int64, PostSearchQuery) ([]PostSearchResult, error)
 	}
 
 	Users interface {
 		Create(context.Context, *User) error
 		GetByID(context.Context, int64) (*User, error)
+		SetPrivate(context.Context, int64, bool) error
+		Search(context.Context, int64, UserSearchQuery) ([]UserSearchResult, error)
+		GetStatus(context.Context, int64) (*AccountStatus, error)
+		SetStatus(context.Context, int64, int64, StatusChange) (*AccountStatus, error)
 	}
 
 	Followers interface{
@@ -32,18 +41,212 @@ type Storage struct {
 		Unfollow(context.Context, int64, int64) error
 	}
 
+	Blocks interface{
+		Block(context.Context, int64, int64) error
+		Unblock(context.Context, int64, int64) error
+		IsBlocked(context.Context, int64, int64) (bool, error)
+	}
+
+	Reactions interface{
+		React(context.Context, *Reaction) error
+		Unreact(context.Context, int64, int64) error
+		GetAffinity(context.Context, int64) (*Affinity, error)
+	}
+
+	Polls interface{
+		GetByPostIDs(context.Context, int64, []int64) (map[int64]*Poll, error)
+		Vote(context.Context, *PollVote) error
+	}
+
+	Media interface{
+		Create(context.Context, *Media) error
+		GetByPostIDs(context.Context, []int64) (map[int64][]Media, error)
+	}
+
+	LinkPreviews interface{
+		GetByPostIDs(context.Context, []int64) (map[int64][]LinkPreview, error)
+		Stale(context.Context, []string) ([]string, error)
+		Save(context.Context, *LinkPreview) error
+		SaveFailure(context.Context, string) error
+	}
+
+	Reports interface{
+		Create(context.Context, *Report) error
+		GetQueue(context.Context, ReportQuery) ([]Report, error)
+		GetByID(context.Context, int64) (*Report, error)
+		Claim(context.Context, int64, int64) error
+		Resolve(context.Context, int64, int64, Resolution) (bool, error)
+	}
+
+	Audit interface{
+		Create(context.Context, *AuditEvent) error
+		List(context.Context, AuditQuery) ([]AuditEvent, error)
+	}
+
 	Comments interface{
-		GetByPostID(context.Context, int64) ([]Comment, error)
+		GetByID(context.Context, int64) (*Comment, error)
+		GetByPostID(context.Context, int64, int64, bool) ([]Comment, error)
 		Create(context.Context, *Comment) error
 	}
+
+	Timelines interface{
+		Run(context.Context)
+		FanOut(context.Context, int64) error
+	}
+
+	Trending interface{
+		Refresh(context.Context) error
+		GetTags(context.Context, int) ([]TrendingTag, error)
+		GetExplore(context.Context, int64, PaginatedFeedQuery) ([]PostWithMetadata, error)
+	}
+
+	Notifications interface{
+		Create(context.Context, *Notification) error
+		List(context.Context, int64, NotificationQuery) ([]NotificationGroup, error)
+		MarkRead(context.Context, int64, []int64) error
+		MarkAllRead(context.Context, int64) error
+		GetPreferences(context.Context, int64) (map[string]bool, error)
+		SetPreferences(context.Context, int64, map[string]bool) error
+	}
+
+	Conversations interface{
+		Create(context.Context, *Conversation, []int64) error
+		GetByID(context.Context, int64, int64) (*Conversation, error)
+		List(context.Context, int64, ConversationQuery) ([]Conversation, error)
+		SendMessage(context.Context, *Message) error
+		GetMessages(context.Context, int64, int64, MessageQuery) ([]Message, error)
+		MarkRead(context.Context, int64, int64, int64) error
+		Leave(context.Context, int64, int64) error
+	}
+
+	Communities interface{
+		Create(context.Context, *Community) error
+		GetByID(context.Context, int64) (*Community, error)
+		GetMember(context.Context, int64, int64) (*CommunityMember, error)
+		GetMembers(context.Context, int64, CommunityQuery) ([]CommunityMember, error)
+		Join(context.Context, *Community, int64) error
+		Leave(context.Context, int64, int64) error
+		GetJoinRequests(context.Context, int64, CommunityQuery) ([]CommunityJoinRequest, error)
+		ResolveJoinRequest(context.Context, int64, int64, bool) error
+		SetRole(context.Context, int64, int64, string) error
+		Ban(context.Context, *CommunityBan) error
+		Unban(context.Context, int64, int64) error
+		RemovePost(context.Context, int64, int64) error
+		GetFeed(context.Context, int64, int64, PaginatedFeedQuery) ([]PostWithMetadata, error)
+	}
+
+	Tags interface{
+		Search(context.Context, string, int) ([]Tag, error)
+		GetPostsByTag(context.Context, int64, string, PaginatedFeedQuery) ([]PostWithMetadata, error)
+	}
+}
+
+
+// Publisher is told about new feed items, notifications and messages so they can be
+// pushed to connected clients.
+type Publisher interface{
+	Publish(context.Context, events.Event) error
 }
 
+func NewStorage(db *sql.DB, publisher Publisher) Storage{
+	timelines := NewTimelineStore(db, publisher)
 
-func NewStorage(db *sql.DB) Storage{
 	return Storage{
-		Posts: &PostStore{db},
+		Posts: &PostStore{db: db, timelines: timelines},
 		Users: &UserStore{db},
-		Comments: &CommentStore{db},
+		Comments: &CommentStore{db: db, publisher: publisher},
+		Reactions: &ReactionStore{db},
+		Polls: &PollStore{db},
+		Media: &MediaStore{db},
+		LinkPreviews: &LinkPreviewStore{db},
+		Reports: &ReportStore{db},
+		Audit: &AuditStore{db},
 		Followers: &FollowesStore{db},
+		Blocks: &BlockStore{db},
+		Tags: &TagStore{db},
+		Notifications: &NotificationStore{db: db, publisher: publisher},
+		Trending: &TrendingStore{db},
+		Conversations: &ConversationStore{db: db, publisher: publisher},
+		Communities: &CommunityStore{db},
+		Timelines: timelines,
 	}
-}
\ No newline at end of file
+}
+
+func withTx(db *sql.DB, ctx context.Context, fn func(*sql.Tx) error) error{
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil{
+		return err
+	}
+
+	if err := fn(tx); err != nil{
+		_ = tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// nullString maps an empty optional filter to SQL NULL.
+func nullString(s string) sql.NullString{
+	return sql.NullString{String: s, Valid: s != ""}
+}
+
+// publish sends an event if there's a publisher. Events are best effort, so
+// failures are logged rather than failing the write that caused them.
+func publish(ctx context.Context, publisher Publisher, eventType string, topic string, data any){
+	if publisher == nil{
+		return
+	}
+
+	payload, err := json.Marshal(data)
+	if err != nil{
+		log.Printf("publish %s event: %v", eventType, err)
+		return
+	}
+
+	err = publisher.Publish(ctx, events.Event{Topic: topic, Type: eventType, Data: payload})
+	if err != nil{
+		log.Printf("publish %s event: %v", eventType, err)
+	}
+}
+
+// eventPreviewLength caps the text events carry, keeping them inside the
+// pg_notify limit even when every character is escaped in the JSON.
+const eventPreviewLength = 200
+
+// eventPreview shortens text for an event and reports whether it was cut.
+func eventPreview(text string) (string, bool){
+	if r := []rune(text); len(r) > eventPreviewLength{
+		return string(r[:eventPreviewLength]), true
+	}
+	return text, false
+}
+
+// publishMany sends one event to several topics, like publish, split over as
+// many events as it takes to keep each inside events.MaxPayloadBytes. Each
+// event gets its own timeout.
+func publishMany(ctx context.Context, publisher Publisher, eventType string, topics []string, data any){
+	if publisher == nil || len(topics) == 0{
+		return
+	}
+
+	payload, err := json.Marshal(data)
+	if err != nil{
+		log.Printf("publish %s event: %v", eventType, err)
+		return
+	}
+
+	e := events.Event{Type: eventType, Data: payload}
+
+	for _, batch := range events.SplitTopics(e, topics){
+		e.Topics = batch
+
+		publishCtx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+		err := publisher.Publish(publishCtx, e)
+		cancel()
+
+		if err != nil{
+			log.Printf("publish %s event to %d topics: %v", eventType, len(batch), err)
+		}
+	}
+}
@@ -0,0 +1,167 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"regexp"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+type Tag struct{
+	ID int64 `json:"id"`
+	Name string `json:"name"`
+	UsageCount int `json:"usage_count"`
+	CreatedAt string `json:"created_at"`
+}
+
+type TagStore struct{
+	db *sql.DB
+}
+
+// TagPattern is what a normalized tag must look like.
+var TagPattern = regexp.MustCompile(`^[a-z0-9]+(?:[-_][a-z0-9]+)*$`)
+
+// NormalizeTags lowercases and trims tags, dropping empty entries and duplicates
+// while keeping the order they were given in.
+func NormalizeTags(tags []string) []string{
+	if tags == nil{
+		return nil
+	}
+
+	seen := make(map[string]bool, len(tags))
+	normalized := make([]string, 0, len(tags))
+
+	for _, tag := range tags{
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" || seen[tag]{
+			continue
+		}
+
+		seen[tag] = true
+		normalized = append(normalized, tag)
+	}
+
+	return normalized
+}
+
+func (s *TagStore) Search(ctx context.Context, prefix string, limit int) ([]Tag, error){
+	query := `
+		SELECT id, name, usage_count, created_at FROM tags
+		WHERE name LIKE $1 || '%' AND usage_count > 0
+		ORDER BY usage_count DESC, name ASC
+		LIMIT $2
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, strings.ToLower(strings.TrimSpace(prefix)), limit)
+	if err != nil{
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	tags := []Tag{}
+
+	for rows.Next(){
+		var t Tag
+		if err := rows.Scan(&t.ID, &t.Name, &t.UsageCount, &t.CreatedAt); err != nil{
+			return nil, err
+		}
+		tags = append(tags, t)
+	}
+
+	return tags, rows.Err()
+}
+
+func (s *TagStore) GetPostsByTag(ctx context.Context, viewerID int64, tag string, fq PaginatedFeedQuery) ([]PostWithMetadata, error){
+	query := `
+		SELECT
+			p.id, p.user_id, p.title, p.content, p.content_html, p.created_at, p.version, p.tags, p.entities,
+			u.username,
+			COUNT(c.id) AS comments_count,
+			(SELECT COUNT(*) FROM post_reactions r WHERE r.post_id = p.id) AS reactions_count
+		FROM tags t
+		JOIN post_tags pt ON pt.tag_id = t.id
+		JOIN posts p ON p.id = pt.post_id
+		LEFT JOIN comments c ON c.post_id = p.id
+		LEFT JOIN users u ON p.user_id = u.id
+		WHERE t.name = $1 AND ` + publicPostCondition + ` AND ` + shadowBanCondition("$4") + `
+		GROUP BY p.id, u.username
+		ORDER BY p.created_at ` + fq.Sort + `
+		LIMIT $2 OFFSET $3
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, strings.ToLower(strings.TrimSpace(tag)), fq.Limit, fq.Offset, viewerID)
+	if err != nil{
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	posts := []PostWithMetadata{}
+
+	for rows.Next(){
+		var post PostWithMetadata
+		err := rows.Scan(
+			&post.ID,
+			&post.UserID,
+			&post.Title,
+			&post.Content,
+			&post.ContentHTML,
+			&post.CreatedAt,
+			&post.Version,
+			pq.Array(&post.Tags),
+			&post.Entities,
+			&post.User.Username,
+			&post.CommentsCount,
+			&post.ReactionsCount,
+		)
+		if err != nil{
+			return nil, err
+		}
+		posts = append(posts, post)
+	}
+
+	return posts, rows.Err()
+}
+
+// syncPostTags makes post_tags mirror the given tag names for a post, creating
+// any tags that don't exist yet. Usage counts are maintained by a trigger.
+func syncPostTags(ctx context.Context, tx *sql.Tx, postID int64, tags []string) error{
+	if tags == nil{
+		tags = []string{}
+	}
+
+	if len(tags) > 0{
+		query := `
+			INSERT INTO tags (name)
+			SELECT UNNEST($1::varchar[])
+			ON CONFLICT (name) DO NOTHING
+		`
+		if _, err := tx.ExecContext(ctx, query, pq.Array(tags)); err != nil{
+			return err
+		}
+	}
+
+	query := `
+		DELETE FROM post_tags pt
+		USING tags t
+		WHERE pt.tag_id = t.id AND pt.post_id = $1 AND NOT (t.name = ANY($2::varchar[]))
+	`
+	if _, err := tx.ExecContext(ctx, query, postID, pq.Array(tags)); err != nil{
+		return err
+	}
+
+	query = `
+		INSERT INTO post_tags (post_id, tag_id)
+		SELECT $1::bigint, id FROM tags WHERE name = ANY($2::varchar[])
+		ON CONFLICT DO NOTHING
+	`
+	_, err := tx.ExecContext(ctx, query, postID, pq.Array(tags))
+	return err
+}
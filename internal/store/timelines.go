@@ -0,0 +1,222 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/nikhilkarle/social/internal/events"
+)
+
+var (
+	// authors with more followers than this aren't fanned out on write; their
+	// posts are merged into followers' feeds when the feed is read instead
+	TimelineFanoutThreshold = 10_000
+	// how many of an author's latest posts are copied into a new follower's timeline
+	TimelineBackfillLimit = 100
+	// how long Run keeps fanning out queued posts after it's told to stop
+	timelineDrainTimeout = 30 * time.Second
+)
+
+type TimelineStore struct{
+	db *sql.DB
+	publisher Publisher
+	jobs chan int64
+	// mu keeps enqueue from queueing a post once Run has stopped taking them
+	mu sync.RWMutex
+	running bool
+}
+
+// FeedItem is the event published to each follower a post is fanned out to.
+type FeedItem struct{
+	PostID int64 `json:"post_id"`
+	AuthorID int64 `json:"author_id"`
+	CreatedAt string `json:"created_at"`
+}
+
+func NewTimelineStore(db *sql.DB, publisher Publisher) *TimelineStore{
+	return &TimelineStore{
+		db: db,
+		publisher: publisher,
+		jobs: make(chan int64, 1024),
+	}
+}
+
+// Run fans queued posts out to followers until ctx is done, then fans out
+// what's still queued within timelineDrainTimeout. While no worker is
+// running, posts are fanned out inline by the caller.
+func (s *TimelineStore) Run(ctx context.Context){
+	s.setRunning(true)
+
+	for{
+		select{
+		case <-ctx.Done():
+			s.setRunning(false)
+			s.drain(ctx)
+			return
+		case postID := <-s.jobs:
+			s.fanOutJob(ctx, postID)
+		}
+	}
+}
+
+// drain fans out the posts left in the queue with a fresh context, since ctx
+// is already done. Posts it doesn't get to in time are only logged.
+func (s *TimelineStore) drain(ctx context.Context){
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), timelineDrainTimeout)
+	defer cancel()
+
+	for{
+		select{
+		case postID := <-s.jobs:
+			if ctx.Err() != nil{
+				log.Printf("timeline fan-out for post %d dropped on shutdown", postID)
+				continue
+			}
+			s.fanOutJob(ctx, postID)
+		default:
+			return
+		}
+	}
+}
+
+func (s *TimelineStore) fanOutJob(ctx context.Context, postID int64){
+	if err := s.FanOut(ctx, postID); err != nil{
+		log.Printf("timeline fan-out for post %d: %v", postID, err)
+	}
+}
+
+func (s *TimelineStore) setRunning(running bool){
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.running = running
+}
+
+// enqueue schedules a post for fan-out, doing it on the caller's goroutine when
+// there's no worker or the queue is full.
+func (s *TimelineStore) enqueue(ctx context.Context, postID int64) error{
+	if s.queue(postID){
+		return nil
+	}
+
+	return s.FanOut(ctx, postID)
+}
+
+// queue hands a post to the worker, reporting false when none is running or
+// the queue is full.
+func (s *TimelineStore) queue(postID int64) bool{
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if !s.running{
+		return false
+	}
+
+	select{
+	case s.jobs <- postID:
+		return true
+	default:
+		return false
+	}
+}
+
+// FanOut writes a post into the timelines of its author's followers, unless
+// the author is above TimelineFanoutThreshold, and publishes a feed event to
+// them.
+func (s *TimelineStore) FanOut(ctx context.Context, postID int64) error{
+	item, followerIDs, err := s.insertTimelines(ctx, postID)
+	if err != nil{
+		return err
+	}
+
+	topics := make([]string, len(followerIDs))
+	for i, id := range followerIDs{
+		topics[i] = events.UserTopic(id)
+	}
+
+	publishMany(ctx, s.publisher, events.TypeFeed, topics, item)
+	return nil
+}
+
+// insertTimelines adds the post to its followers' timelines and returns the
+// feed item along with the followers to announce it to. Held posts and
+// shadow banned authors' posts go into the timelines, where reads filter
+// them, but aren't announced.
+func (s *TimelineStore) insertTimelines(ctx context.Context, postID int64) (FeedItem, []int64, error){
+	query := `
+		WITH inserted AS (
+			INSERT INTO timelines (user_id, post_id, author_id, created_at)
+			SELECT f.follower_id, p.id, p.user_id, p.created_at
+			FROM posts p
+			JOIN users a ON a.id = p.user_id
+			JOIN followers f ON f.user_id = p.user_id
+			WHERE p.id = $1 AND p.community_id IS NULL AND a.follower_count <= $2
+			ON CONFLICT DO NOTHING
+			RETURNING user_id, post_id, author_id, created_at
+		)
+		SELECT i.user_id, i.post_id, i.author_id, i.created_at
+		FROM inserted i
+		JOIN posts p ON p.id = i.post_id
+		JOIN users u ON u.id = i.author_id
+		WHERE p.hidden_at IS NULL AND u.status <> 'shadow_banned'
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	var item FeedItem
+
+	rows, err := s.db.QueryContext(ctx, query, postID, TimelineFanoutThreshold)
+	if err != nil{
+		return item, nil, err
+	}
+
+	defer rows.Close()
+
+	var followerIDs []int64
+
+	for rows.Next(){
+		var followerID int64
+		if err := rows.Scan(&followerID, &item.PostID, &item.AuthorID, &item.CreatedAt); err != nil{
+			return item, nil, err
+		}
+		followerIDs = append(followerIDs, followerID)
+	}
+
+	return item, followerIDs, rows.Err()
+}
+
+func addToAuthorTimeline(ctx context.Context, tx *sql.Tx, post *Post) error{
+	query := `
+		INSERT INTO timelines (user_id, post_id, author_id, created_at)
+		VALUES ($1, $2, $1, $3)
+		ON CONFLICT DO NOTHING
+	`
+	_, err := tx.ExecContext(ctx, query, post.UserID, post.ID, post.CreatedAt)
+	return err
+}
+
+func backfillTimeline(ctx context.Context, tx *sql.Tx, followerID, userID int64) error{
+	query := `
+		INSERT INTO timelines (user_id, post_id, author_id, created_at)
+		SELECT $1::bigint, p.id, p.user_id, p.created_at
+		FROM posts p
+		JOIN users a ON a.id = p.user_id
+		WHERE p.user_id = $2 AND p.community_id IS NULL AND a.follower_count <= $3
+		ORDER BY p.created_at DESC
+		LIMIT $4
+		ON CONFLICT DO NOTHING
+	`
+	_, err := tx.ExecContext(ctx, query, followerID, userID, TimelineFanoutThreshold, TimelineBackfillLimit)
+	return err
+}
+
+func removeFromTimeline(ctx context.Context, tx *sql.Tx, followerID, userID int64) error{
+	query := `
+		DELETE FROM timelines
+		WHERE user_id = $1 AND author_id = $2
+	`
+	_, err := tx.ExecContext(ctx, query, followerID, userID)
+	return err
+}
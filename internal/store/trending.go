@@ -0,0 +1,158 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+var (
+	// explore only considers posts younger than this
+	ExploreWindow = 72 * time.Hour
+)
+
+type TrendingTag struct{
+	Tag string `json:"tag"`
+	HourCount int `json:"hour_count"`
+	DayCount int `json:"day_count"`
+	Score float64 `json:"score"`
+	RefreshedAt string `json:"refreshed_at"`
+}
+
+type TrendingStore struct{
+	db *sql.DB
+}
+
+// Refresh recomputes trending_tags from posts.tags. A tag's score compares its
+// rate over the last hour with its hourly average over the last 24 hours, so
+// tags that are always popular don't crowd out the ones picking up speed.
+func (s *TrendingStore) Refresh(ctx context.Context) error{
+	query := `
+		INSERT INTO trending_tags (tag, hour_count, day_count, score, refreshed_at)
+		SELECT
+			tag, hour_count, day_count,
+			(hour_count - day_count / 24.0) / SQRT(day_count / 24.0 + 1),
+			NOW()
+		FROM (
+			SELECT
+				t.tag,
+				COUNT(*) FILTER (WHERE p.created_at >= NOW() - INTERVAL '1 hour') AS hour_count,
+				COUNT(*) AS day_count
+			FROM posts p
+			JOIN users u ON u.id = p.user_id
+			CROSS JOIN LATERAL UNNEST(p.tags) AS t(tag)
+			WHERE
+				p.created_at >= NOW() - INTERVAL '24 hours' AND
+				` + publicPostCondition + ` AND
+				` + shadowBanCondition("NULL") + `
+			GROUP BY t.tag
+		) counts
+		WHERE hour_count > 0
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	return withTx(s.db, ctx, func(tx *sql.Tx) error{
+		if _, err := tx.ExecContext(ctx, `DELETE FROM trending_tags`); err != nil{
+			return err
+		}
+
+		_, err := tx.ExecContext(ctx, query)
+		return err
+	})
+}
+
+func (s *TrendingStore) GetTags(ctx context.Context, limit int) ([]TrendingTag, error){
+	query := `
+		SELECT tag, hour_count, day_count, score, refreshed_at FROM trending_tags
+		ORDER BY score DESC, hour_count DESC, tag ASC
+		LIMIT $1
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, limit)
+	if err != nil{
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	tags := []TrendingTag{}
+
+	for rows.Next(){
+		var t TrendingTag
+		if err := rows.Scan(&t.Tag, &t.HourCount, &t.DayCount, &t.Score, &t.RefreshedAt); err != nil{
+			return nil, err
+		}
+		tags = append(tags, t)
+	}
+
+	return tags, rows.Err()
+}
+
+// GetExplore lists recent posts from across the site, ranked by comment and
+// reaction activity with a decay on age. Authors the user has blocked, or who
+// blocked them, are left out.
+func (s *TrendingStore) GetExplore(ctx context.Context, userID int64, fq PaginatedFeedQuery) ([]PostWithMetadata, error){
+	query := `
+		SELECT
+			p.id, p.user_id, p.title, p.content, p.content_html, p.created_at, p.version, p.tags, p.entities,
+			u.username,
+			COUNT(c.id) AS comments_count,
+			(SELECT COUNT(*) FROM post_reactions r WHERE r.post_id = p.id) AS reactions_count
+		FROM posts p
+		JOIN users u ON u.id = p.user_id
+		LEFT JOIN comments c ON c.post_id = p.id
+		WHERE
+			p.created_at >= NOW() - $4::float8 * INTERVAL '1 second' AND
+			` + publicPostCondition + ` AND
+			` + shadowBanCondition("$1") + ` AND
+			NOT EXISTS (
+				SELECT 1 FROM blocks b
+				WHERE (b.blocker_id = $1 AND b.blocked_id = p.user_id) OR (b.blocker_id = p.user_id AND b.blocked_id = $1)
+			)
+		GROUP BY p.id, u.username
+		ORDER BY
+			(COUNT(c.id) * 2 + (SELECT COUNT(*) FROM post_reactions r WHERE r.post_id = p.id) + 1) / POWER(EXTRACT(EPOCH FROM NOW() - p.created_at) / 3600 + 2, 1.5) DESC,
+			p.id DESC
+		LIMIT $2 OFFSET $3
+	`
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, userID, fq.Limit, fq.Offset, ExploreWindow.Seconds())
+	if err != nil{
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	posts := []PostWithMetadata{}
+
+	for rows.Next(){
+		var post PostWithMetadata
+		err := rows.Scan(
+			&post.ID,
+			&post.UserID,
+			&post.Title,
+			&post.Content,
+			&post.ContentHTML,
+			&post.CreatedAt,
+			&post.Version,
+			pq.Array(&post.Tags),
+			&post.Entities,
+			&post.User.Username,
+			&post.CommentsCount,
+			&post.ReactionsCount,
+		)
+		if err != nil{
+			return nil, err
+		}
+		posts = append(posts, post)
+	}
+
+	return posts, rows.Err()
+}
@@ -4,23 +4,102 @@ import (
 	"context"
 	"database/sql"
 	"errors"
+	"slices"
+	"time"
 )
 
+const (
+	UserRoleUser = "user"
+	UserRoleModerator = "moderator"
+	UserRoleAdmin = "admin"
+)
+
+// Account statuses. Suspensions are kept apart from the stored status and
+// end on their own; AccountSuspended is reported while one runs.
+const (
+	AccountActive = "active"
+	AccountSuspended = "suspended"
+	AccountBanned = "banned"
+	// AccountShadowBanned users can keep posting, but their content is only
+	// shown to themselves
+	AccountShadowBanned = "shadow_banned"
+)
+
+// accountStatusColumn is a user's effective status: a running suspension
+// overrides the stored status, except a ban.
+const accountStatusColumn = `
+	CASE
+		WHEN status = 'banned' THEN 'banned'
+		WHEN suspended_until > NOW() THEN 'suspended'
+		ELSE status
+	END
+`
+
+// activeUserCondition matches users, aliased u, who are neither banned nor
+// suspended. Shadow banned users still match, since leaving them out would
+// give the ban away.
+const activeUserCondition = `(u.status <> 'banned' AND (u.suspended_until IS NULL OR u.suspended_until <= NOW()))`
+
+// shadowBanCondition hides the posts of shadow banned authors from everyone
+// but the authors themselves. It expects posts as p and their authors as u;
+// viewer is the placeholder holding the viewer's ID, or NULL when there's no
+// viewer.
+func shadowBanCondition(viewer string) string{
+	return `(u.status <> 'shadow_banned' OR p.user_id = ` + viewer + `)`
+}
+
+// userRoles ranks the site-wide roles from least to most privileged.
+var userRoles = []string{UserRoleUser, UserRoleModerator, UserRoleAdmin}
+
 type User struct{
 	ID int64 `json:"id"`
 	Username string `json:"username"`
+	DisplayName string `json:"display_name"`
 	Email string `json:"email"`
+	// IsPrivate accounts only receive messages from users they follow
+	IsPrivate bool `json:"is_private"`
+	Role string `json:"role"`
+	SuspendedUntil *string `json:"suspended_until,omitempty"`
+	// Status is the stored status, never serialized so users can't tell
+	// they're shadow banned. EffectiveStatus accounts for suspensions.
+	Status string `json:"-"`
 	Password string `json:"-"`
 	CreatedAt string `json:"created_at"`
 }
 
+// EffectiveStatus is the user's status right now: a running suspension
+// overrides the stored status, except a ban. It matches accountStatusColumn.
+func (u *User) EffectiveStatus() string{
+	if u.Status == AccountBanned{
+		return AccountBanned
+	}
+
+	if u.SuspendedUntil != nil{
+		until, err := time.Parse(time.RFC3339Nano, *u.SuspendedUntil)
+		// an unreadable timestamp errs on the side of the suspension
+		if err != nil || until.After(time.Now()){
+			return AccountSuspended
+		}
+	}
+
+	return u.Status
+}
+
+// HasRole reports whether the user's site-wide role is at least role.
+func (u *User) HasRole(role string) bool{
+	if u == nil{
+		return false
+	}
+	return slices.Index(userRoles, u.Role) >= slices.Index(userRoles, role)
+}
+
 type UserStore struct{
 	db *sql.DB 
 }
 
 func ( s *UserStore) Create(ctx context.Context, user *User) error{
 	query := `
-		INSERT INTO users (username, password, email) VALUES($1, $2, $3) RETURNING id,
+		INSERT INTO users (username, display_name, password, email) VALUES($1, $2, $3, $4) RETURNING id,
 		created_at
 	`
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
@@ -30,6 +109,7 @@ func ( s *UserStore) Create(ctx context.Context, user *User) error{
 		ctx,
 		query, 
 		user.Username, 
+		user.DisplayName,
 		user.Password,
 		user.Email,
 	).Scan(
@@ -46,7 +126,7 @@ func ( s *UserStore) Create(ctx context.Context, user *User) error{
 
 func (s *UserStore) GetByID(ctx context.Context, userID int64) (*User, error){
 	query := `
-	Select id, username, password, email, created_at from users
+	Select id, username, display_name, password, email, is_private, role, suspended_until, status, created_at from users
 	Where ID = $1
 	`
 
@@ -57,8 +137,13 @@ func (s *UserStore) GetByID(ctx context.Context, userID int64) (*User, error){
 	err := s.db.QueryRowContext(ctx, query, userID).Scan(
 		&user.ID,
 		&user.Username,
+		&user.DisplayName,
 		&user.Password,
 		&user.Email,
+		&user.IsPrivate,
+		&user.Role,
+		&user.SuspendedUntil,
+		&user.Status,
 		&user.CreatedAt,
 	)
 
@@ -72,4 +157,88 @@ func (s *UserStore) GetByID(ctx context.Context, userID int64) (*User, error){
 		} 
 	 }
 	 return &user, nil
-}
\ No newline at end of file
+}
+
+// SetPrivate turns the account's private setting on or off.
+func (s *UserStore) SetPrivate(ctx context.Context, userID int64, private bool) error{
+	query := `UPDATE users SET is_private = $2 WHERE id = $1`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctx, query, userID, private)
+	if err != nil{
+		return err
+	}
+
+	rows, err := res.RowsAffected()
+	if err != nil{
+		return err
+	}
+
+	if rows == 0{
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// AccountStatus is a user's status as admins see it.
+type AccountStatus struct{
+	UserID int64 `json:"user_id"`
+	Status string `json:"status"`
+	SuspendedUntil *string `json:"suspended_until"`
+	Reason string `json:"reason"`
+	ChangedBy *int64 `json:"changed_by"`
+	ChangedAt *string `json:"changed_at"`
+}
+
+// StatusChange is an admin's decision on an account.
+type StatusChange struct{
+	Status string
+	// SuspendFor is how long an AccountSuspended user is suspended for
+	SuspendFor time.Duration
+	Reason string
+}
+
+const accountStatusColumns = `id, ` + accountStatusColumn + `, suspended_until, status_reason, status_changed_by, status_changed_at`
+
+func scanAccountStatus(row *sql.Row) (*AccountStatus, error){
+	var as AccountStatus
+	err := row.Scan(&as.UserID, &as.Status, &as.SuspendedUntil, &as.Reason, &as.ChangedBy, &as.ChangedAt)
+	if err != nil{
+		if errors.Is(err, sql.ErrNoRows){
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return &as, nil
+}
+
+func (s *UserStore) GetStatus(ctx context.Context, userID int64) (*AccountStatus, error){
+	query := `SELECT ` + accountStatusColumns + ` FROM users WHERE id = $1`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	return scanAccountStatus(s.db.QueryRowContext(ctx, query, userID))
+}
+
+// SetStatus replaces the account's status. A suspension lifts any ban, and
+// any other status ends a running suspension.
+func (s *UserStore) SetStatus(ctx context.Context, userID int64, adminID int64, change StatusChange) (*AccountStatus, error){
+	query := `
+		UPDATE users SET
+			status = CASE WHEN $2::varchar = 'suspended' THEN 'active' ELSE $2::varchar END,
+			suspended_until = CASE WHEN $2::varchar = 'suspended' THEN NOW() + $3::float8 * INTERVAL '1 second' END,
+			status_reason = $4,
+			status_changed_by = $5,
+			status_changed_at = NOW()
+		WHERE id = $1
+		RETURNING ` + accountStatusColumns
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeoutDuration)
+	defer cancel()
+
+	return scanAccountStatus(s.db.QueryRowContext(ctx, query, userID, change.Status, change.SuspendFor.Seconds(), change.Reason, adminID))
+}
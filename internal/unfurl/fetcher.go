@@ -0,0 +1,192 @@
+// Package unfurl fetches link previews: the title, description and image a
+// page advertises through OpenGraph and Twitter card meta tags.
+package unfurl
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"syscall"
+	"time"
+)
+
+var (
+	ErrBlockedAddress = errors.New("address is not publicly routable")
+	ErrNotHTML = errors.New("response is not an HTML page")
+	errUnsupportedURL = errors.New("only http and https URLs with a host are supported")
+)
+
+const (
+	DefaultTimeout = 5 * time.Second
+	// DefaultMaxBytes bounds how much of a page is read; meta tags are in the
+	// head, so the start of the document is enough
+	DefaultMaxBytes = 512 << 10
+	maxRedirects = 3
+	userAgent = "SocialBot/1.0 (link preview)"
+)
+
+// Fetcher downloads pages for previews. It only connects to public addresses
+// on the standard ports: the check runs on the resolved IP at dial time, so it
+// also covers redirects and DNS names pointing at internal hosts.
+type Fetcher struct{
+	client *http.Client
+	maxBytes int64
+	// allowPrivate lifts the address checks, for tests against local servers
+	allowPrivate bool
+}
+
+func NewFetcher() *Fetcher{
+	return newFetcher(false)
+}
+
+// NewLocalFetcher returns a Fetcher that may connect to loopback and private
+// addresses, such as an httptest server. Never use it for user input.
+func NewLocalFetcher() *Fetcher{
+	return newFetcher(true)
+}
+
+func newFetcher(allowPrivate bool) *Fetcher{
+	f := &Fetcher{maxBytes: DefaultMaxBytes, allowPrivate: allowPrivate}
+
+	dialer := &net.Dialer{
+		Timeout: DefaultTimeout,
+		Control: f.checkAddress,
+	}
+
+	f.client = &http.Client{
+		Timeout: DefaultTimeout,
+		Transport: &http.Transport{
+			// a proxy would make the dial-time check see the proxy's address
+			Proxy: nil,
+			DialContext: dialer.DialContext,
+			TLSHandshakeTimeout: DefaultTimeout,
+			ResponseHeaderTimeout: DefaultTimeout,
+			MaxResponseHeaderBytes: 64 << 10,
+			DisableKeepAlives: true,
+		},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error{
+			if len(via) > maxRedirects{
+				return errors.New("too many redirects")
+			}
+			if req.URL.Scheme != "http" && req.URL.Scheme != "https"{
+				return fmt.Errorf("redirect to unsupported scheme %q", req.URL.Scheme)
+			}
+			return nil
+		},
+	}
+
+	return f
+}
+
+// Fetch downloads rawURL and extracts its preview. The returned preview's URL
+// is rawURL; relative image URLs are resolved against the final page URL.
+func (f *Fetcher) Fetch(ctx context.Context, rawURL string) (*Preview, error){
+	u, err := url.Parse(rawURL)
+	if err != nil{
+		return nil, err
+	}
+
+	if u.Scheme != "http" && u.Scheme != "https"{
+		return nil, fmt.Errorf("unsupported scheme %q", u.Scheme)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil{
+		return nil, err
+	}
+
+	req.Header.Set("User-Agent", userAgent)
+	req.Header.Set("Accept", "text/html,application/xhtml+xml")
+
+	res, err := f.client.Do(req)
+	if err != nil{
+		return nil, err
+	}
+
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK{
+		return nil, fmt.Errorf("unexpected status %s", res.Status)
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(res.Header.Get("Content-Type"))
+	if mediaType != "text/html" && mediaType != "application/xhtml+xml"{
+		return nil, ErrNotHTML
+	}
+
+	preview, err := parseMeta(io.LimitReader(res.Body, f.maxBytes), res.Request.URL)
+	if err != nil{
+		return nil, err
+	}
+
+	preview.URL = rawURL
+	return preview, nil
+}
+
+// checkAddress runs before each connection with the resolved address.
+func (f *Fetcher) checkAddress(network string, address string, _ syscall.RawConn) error{
+	if f.allowPrivate{
+		return nil
+	}
+
+	host, port, err := net.SplitHostPort(address)
+	if err != nil{
+		return err
+	}
+
+	if port != "80" && port != "443"{
+		return ErrBlockedAddress
+	}
+
+	ip := net.ParseIP(host)
+	if ip == nil || !isPublicIP(ip){
+		return ErrBlockedAddress
+	}
+
+	return nil
+}
+
+// reservedNets are special-purpose ranges not covered by the net.IP helpers.
+var reservedNets = func() []*net.IPNet{
+	var nets []*net.IPNet
+	for _, cidr := range []string{
+		"0.0.0.0/8",       // "this" network
+		"100.64.0.0/10",   // carrier-grade NAT
+		"192.0.0.0/24",    // IETF protocol assignments
+		"192.0.2.0/24",    // documentation
+		"198.18.0.0/15",   // benchmarking
+		"198.51.100.0/24", // documentation
+		"203.0.113.0/24",  // documentation
+		"240.0.0.0/4",     // reserved, including broadcast
+		"64:ff9b::/96",    // NAT64, which can reach private IPv4
+		"2001:db8::/32",   // documentation
+	}{
+		_, n, _ := net.ParseCIDR(cidr)
+		nets = append(nets, n)
+	}
+	return nets
+}()
+
+func isPublicIP(ip net.IP) bool{
+	if ip4 := ip.To4(); ip4 != nil{
+		ip = ip4
+	}
+
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() || ip.IsMulticast() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast(){
+		return false
+	}
+
+	for _, n := range reservedNets{
+		if n.Contains(ip){
+			return false
+		}
+	}
+
+	return true
+}
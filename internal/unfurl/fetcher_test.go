@@ -0,0 +1,205 @@
+package unfurl
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+const page = `<html><head>
+	<title>Hello</title>
+	<meta property="og:image" content="/cover.png">
+</head><body></body></html>`
+
+func newServer(t *testing.T, handler http.HandlerFunc) *httptest.Server{
+	t.Helper()
+
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestFetch(t *testing.T){
+	srv := newServer(t, func(w http.ResponseWriter, r *http.Request){
+		if r.Header.Get("User-Agent") != userAgent{
+			t.Errorf("User-Agent = %q", r.Header.Get("User-Agent"))
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		fmt.Fprint(w, page)
+	})
+
+	p, err := NewLocalFetcher().Fetch(context.Background(), srv.URL + "/post")
+	if err != nil{
+		t.Fatalf("Fetch: %v", err)
+	}
+
+	want := Preview{URL: srv.URL + "/post", Title: "Hello", ImageURL: srv.URL + "/cover.png"}
+	if *p != want{
+		t.Errorf("Fetch = %+v, want %+v", *p, want)
+	}
+}
+
+func TestFetchRedirects(t *testing.T){
+	srv := newServer(t, func(w http.ResponseWriter, r *http.Request){
+		switch r.URL.Path{
+		case "/short":
+			http.Redirect(w, r, "/articles/1/", http.StatusMovedPermanently)
+		case "/articles/1/":
+			w.Header().Set("Content-Type", "text/html")
+			fmt.Fprint(w, `<head><meta property="og:image" content="cover.png"></head>`)
+		case "/loop":
+			http.Redirect(w, r, "/loop", http.StatusFound)
+		case "/ftp":
+			http.Redirect(w, r, "ftp://example.com/file", http.StatusFound)
+		}
+	})
+
+	f := NewLocalFetcher()
+
+	p, err := f.Fetch(context.Background(), srv.URL + "/short")
+	if err != nil{
+		t.Fatalf("Fetch: %v", err)
+	}
+
+	// the preview keeps the requested URL but resolves images against the
+	// page it ended up on
+	if p.URL != srv.URL + "/short" || p.ImageURL != srv.URL + "/articles/1/cover.png"{
+		t.Errorf("Fetch = %+v", *p)
+	}
+
+	if _, err := f.Fetch(context.Background(), srv.URL + "/loop"); err == nil || !strings.Contains(err.Error(), "too many redirects"){
+		t.Errorf("Fetch of a redirect loop = %v, want too many redirects", err)
+	}
+
+	if _, err := f.Fetch(context.Background(), srv.URL + "/ftp"); err == nil || !strings.Contains(err.Error(), "unsupported scheme"){
+		t.Errorf("Fetch redirecting to ftp = %v, want an unsupported scheme error", err)
+	}
+}
+
+func TestFetchSizeLimit(t *testing.T){
+	srv := newServer(t, func(w http.ResponseWriter, r *http.Request){
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprint(w, `<head><title>Early</title>`)
+		fmt.Fprint(w, `<meta name="padding" content="` + strings.Repeat("x", 4096) + `">`)
+		fmt.Fprint(w, `<meta property="og:title" content="Late"></head>`)
+	})
+
+	f := NewLocalFetcher()
+	f.maxBytes = 1024
+
+	p, err := f.Fetch(context.Background(), srv.URL)
+	if err != nil{
+		t.Fatalf("Fetch: %v", err)
+	}
+
+	// the og:title past the limit is never read
+	if p.Title != "Early"{
+		t.Errorf("Title = %q, want %q", p.Title, "Early")
+	}
+}
+
+func TestFetchTimeout(t *testing.T){
+	release := make(chan struct{})
+	srv := newServer(t, func(w http.ResponseWriter, r *http.Request){
+		select{
+		case <-release:
+		case <-r.Context().Done():
+		}
+	})
+	defer close(release)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50 * time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err := NewLocalFetcher().Fetch(ctx, srv.URL)
+	if !errors.Is(err, context.DeadlineExceeded){
+		t.Errorf("Fetch = %v, want a deadline error", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second{
+		t.Errorf("Fetch took %s", elapsed)
+	}
+}
+
+func TestFetchRejects(t *testing.T){
+	srv := newServer(t, func(w http.ResponseWriter, r *http.Request){
+		switch r.URL.Path{
+		case "/json":
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprint(w, `{}`)
+		case "/missing":
+			http.NotFound(w, r)
+		}
+	})
+
+	f := NewLocalFetcher()
+
+	if _, err := f.Fetch(context.Background(), srv.URL + "/json"); !errors.Is(err, ErrNotHTML){
+		t.Errorf("Fetch of JSON = %v, want ErrNotHTML", err)
+	}
+
+	if _, err := f.Fetch(context.Background(), srv.URL + "/missing"); err == nil || !strings.Contains(err.Error(), "404"){
+		t.Errorf("Fetch of a missing page = %v, want a 404 error", err)
+	}
+
+	if _, err := f.Fetch(context.Background(), "file:///etc/passwd"); err == nil{
+		t.Error("Fetch of a file URL succeeded")
+	}
+}
+
+func TestFetchBlocksPrivateAddresses(t *testing.T){
+	srv := newServer(t, func(w http.ResponseWriter, r *http.Request){
+		t.Error("the default fetcher connected to a loopback server")
+	})
+
+	_, err := NewFetcher().Fetch(context.Background(), srv.URL)
+	if !errors.Is(err, ErrBlockedAddress){
+		t.Errorf("Fetch = %v, want ErrBlockedAddress", err)
+	}
+}
+
+func TestCheckAddress(t *testing.T){
+	f := NewFetcher()
+
+	tests := []struct{
+		address string
+		allowed bool
+	}{
+		{"93.184.216.34:80", true},
+		{"93.184.216.34:443", true},
+		{"[2606:2800:220:1:248:1893:25c8:1946]:443", true},
+		{"93.184.216.34:8080", false},
+		{"127.0.0.1:80", false},
+		{"10.1.2.3:80", false},
+		{"172.16.0.1:443", false},
+		{"192.168.1.1:80", false},
+		{"169.254.169.254:80", false},
+		{"100.64.0.1:80", false},
+		{"0.0.0.0:80", false},
+		{"255.255.255.255:80", false},
+		{"[::1]:80", false},
+		{"[fc00::1]:443", false},
+		{"[fe80::1]:443", false},
+		{"[::ffff:127.0.0.1]:80", false},
+		{"[64:ff9b::a00:1]:80", false},
+	}
+
+	for _, tt := range tests{
+		err := f.checkAddress("tcp", tt.address, nil)
+		if tt.allowed && err != nil{
+			t.Errorf("checkAddress(%s) = %v, want allowed", tt.address, err)
+		}
+		if !tt.allowed && !errors.Is(err, ErrBlockedAddress){
+			t.Errorf("checkAddress(%s) = %v, want ErrBlockedAddress", tt.address, err)
+		}
+	}
+
+	if err := f.checkAddress("tcp", "bad", nil); err == nil{
+		t.Error("checkAddress accepted a malformed address")
+	}
+}
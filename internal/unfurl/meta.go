@@ -0,0 +1,127 @@
+package unfurl
+
+import (
+	"io"
+	"net/url"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+const (
+	maxTitleLength = 200
+	maxDescriptionLength = 500
+)
+
+type Preview struct{
+	URL string `json:"url"`
+	Title string `json:"title"`
+	Description string `json:"description"`
+	ImageURL string `json:"image_url"`
+	SiteName string `json:"site_name"`
+}
+
+// parseMeta reads the document head for OpenGraph and Twitter card tags,
+// falling back to <title> and the description meta tag. base resolves
+// relative image URLs.
+func parseMeta(r io.Reader, base *url.URL) (*Preview, error){
+	meta := map[string]string{}
+	var title string
+
+	z := html.NewTokenizer(r)
+	for{
+		tt := z.Next()
+		switch tt{
+		case html.ErrorToken:
+			if z.Err() == io.EOF{
+				return buildPreview(meta, title, base), nil
+			}
+			// a truncated page still has whatever was read of the head
+			if len(meta) > 0 || title != ""{
+				return buildPreview(meta, title, base), nil
+			}
+			return nil, z.Err()
+
+		case html.StartTagToken, html.SelfClosingTagToken:
+			name, hasAttr := z.TagName()
+
+			switch atom.Lookup(name){
+			case atom.Body:
+				return buildPreview(meta, title, base), nil
+
+			case atom.Title:
+				if title == "" && z.Next() == html.TextToken{
+					title = string(z.Text())
+				}
+
+			case atom.Meta:
+				var key, content string
+				for hasAttr{
+					var k, v []byte
+					k, v, hasAttr = z.TagAttr()
+					switch string(k){
+					case "property", "name":
+						key = strings.ToLower(string(v))
+					case "content":
+						content = string(v)
+					}
+				}
+
+				if _, ok := meta[key]; key != "" && !ok{
+					meta[key] = content
+				}
+			}
+
+		case html.EndTagToken:
+			if name, _ := z.TagName(); atom.Lookup(name) == atom.Head{
+				return buildPreview(meta, title, base), nil
+			}
+		}
+	}
+}
+
+func buildPreview(meta map[string]string, title string, base *url.URL) *Preview{
+	first := func(keys ...string) string{
+		for _, k := range keys{
+			if v := strings.TrimSpace(meta[k]); v != ""{
+				return v
+			}
+		}
+		return ""
+	}
+
+	p := &Preview{
+		Title: first("og:title", "twitter:title"),
+		Description: first("og:description", "twitter:description", "description"),
+		SiteName: first("og:site_name"),
+	}
+
+	if p.Title == ""{
+		p.Title = title
+	}
+
+	p.Title = truncate(collapseSpace(p.Title), maxTitleLength)
+	p.Description = truncate(collapseSpace(p.Description), maxDescriptionLength)
+	p.SiteName = truncate(collapseSpace(p.SiteName), maxTitleLength)
+
+	if image := first("og:image:secure_url", "og:image", "twitter:image", "twitter:image:src"); image != ""{
+		if u, err := base.Parse(image); err == nil && (u.Scheme == "http" || u.Scheme == "https"){
+			p.ImageURL = u.String()
+		}
+	}
+
+	return p
+}
+
+func collapseSpace(s string) string{
+	return strings.Join(strings.Fields(s), " ")
+}
+
+func truncate(s string, max int) string{
+	if utf8.RuneCountInString(s) <= max{
+		return s
+	}
+	return string([]rune(s)[:max-1]) + "…"
+}
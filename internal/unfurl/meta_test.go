@@ -0,0 +1,89 @@
+package unfurl
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestParseMeta(t *testing.T){
+	base, _ := url.Parse("https://example.com/blog/post")
+
+	tests := []struct{
+		name string
+		html string
+		want Preview
+	}{
+		{
+			name: "opengraph",
+			html: `<html><head>
+				<meta property="og:title" content="OG title">
+				<meta property="og:description" content="OG description">
+				<meta property="og:image" content="https://cdn.example.com/a.png">
+				<meta property="og:site_name" content="Example">
+				<title>Page title</title>
+			</head></html>`,
+			want: Preview{Title: "OG title", Description: "OG description", ImageURL: "https://cdn.example.com/a.png", SiteName: "Example"},
+		},
+		{
+			name: "twitter card",
+			html: `<head>
+				<meta name="twitter:title" content="Card title">
+				<meta name="twitter:description" content="Card description">
+				<meta name="twitter:image" content="/img/card.jpg">
+			</head>`,
+			want: Preview{Title: "Card title", Description: "Card description", ImageURL: "https://example.com/img/card.jpg"},
+		},
+		{
+			name: "title and description fallbacks",
+			html: `<head><title> Plain
+				title </title><meta name="Description" content="Plain description"></head>`,
+			want: Preview{Title: "Plain title", Description: "Plain description"},
+		},
+		{
+			name: "secure image wins and relative paths resolve against the page",
+			html: `<head>
+				<meta property="og:image" content="http://example.com/a.png">
+				<meta property="og:image:secure_url" content="../b.png">
+			</head>`,
+			want: Preview{ImageURL: "https://example.com/b.png"},
+		},
+		{
+			name: "non-http images are dropped",
+			html: `<head><meta property="og:image" content="javascript:alert(1)"></head>`,
+			want: Preview{},
+		},
+		{
+			name: "first tag wins",
+			html: `<head><meta property="og:title" content="First"><meta property="og:title" content="Second"></head>`,
+			want: Preview{Title: "First"},
+		},
+		{
+			name: "tags in the body are ignored",
+			html: `<head><title>Head</title></head><body><meta property="og:title" content="Body"></body>`,
+			want: Preview{Title: "Head"},
+		},
+		{
+			name: "long titles are truncated",
+			html: `<head><title>` + strings.Repeat("é", 300) + `</title></head>`,
+			want: Preview{Title: strings.Repeat("é", maxTitleLength - 1) + "…"},
+		},
+		{
+			name: "empty page",
+			html: ``,
+			want: Preview{},
+		},
+	}
+
+	for _, tt := range tests{
+		t.Run(tt.name, func(t *testing.T){
+			got, err := parseMeta(strings.NewReader(tt.html), base)
+			if err != nil{
+				t.Fatalf("parseMeta: %v", err)
+			}
+			if *got != tt.want{
+				t.Errorf("parseMeta =\n%+v\nwant\n%+v", *got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,86 @@
+package unfurl
+
+import (
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// MaxLinksPerPost bounds how many of a post's URLs get previews.
+const MaxLinksPerPost = 3
+
+var urlPattern = regexp.MustCompile(`(?i)\bhttps?://[^\s<>"'\]\[]+`)
+
+// ExtractURLs returns the normalized http(s) URLs in text, in order and
+// without duplicates, up to MaxLinksPerPost.
+func ExtractURLs(text string) []string{
+	urls := []string{}
+	seen := map[string]bool{}
+
+	for _, match := range urlPattern.FindAllString(text, -1){
+		match = strings.TrimRight(match, ".,:;!?*_~")
+		// a closing paren ends a Markdown link unless the URL opened one
+		for strings.HasSuffix(match, ")") && strings.Count(match, "(") < strings.Count(match, ")"){
+			match = strings.TrimRight(match[:len(match)-1], ".,:;!?*_~")
+		}
+
+		normalized, err := NormalizeURL(match)
+		if err != nil || seen[normalized]{
+			continue
+		}
+
+		seen[normalized] = true
+		urls = append(urls, normalized)
+
+		if len(urls) == MaxLinksPerPost{
+			break
+		}
+	}
+
+	return urls
+}
+
+// NormalizeURL maps equivalent URLs to one form so previews are cached once:
+// the scheme and host are lowercased, default ports and fragments dropped,
+// tracking parameters removed and the query sorted.
+func NormalizeURL(raw string) (string, error){
+	u, err := url.Parse(raw)
+	if err != nil{
+		return "", err
+	}
+
+	u.Scheme = strings.ToLower(u.Scheme)
+	if u.Scheme != "http" && u.Scheme != "https" || u.Hostname() == "" || u.User != nil{
+		return "", &url.Error{Op: "normalize", URL: raw, Err: errUnsupportedURL}
+	}
+
+	host := strings.ToLower(strings.TrimSuffix(u.Hostname(), "."))
+	port := u.Port()
+	if port == "" || u.Scheme == "http" && port == "80" || u.Scheme == "https" && port == "443"{
+		u.Host = host
+		if strings.Contains(host, ":"){
+			u.Host = "[" + host + "]"
+		}
+	} else{
+		u.Host = host + ":" + port
+		if strings.Contains(host, ":"){
+			u.Host = "[" + host + "]:" + port
+		}
+	}
+
+	if u.Path == ""{
+		u.Path = "/"
+	}
+	u.Fragment = ""
+	u.RawFragment = ""
+
+	query := u.Query()
+	for key := range query{
+		if strings.HasPrefix(strings.ToLower(key), "utm_") || key == "fbclid" || key == "gclid"{
+			query.Del(key)
+		}
+	}
+	u.RawQuery = query.Encode()
+
+	return u.String(), nil
+}